@@ -0,0 +1,130 @@
+// Package captcha verifies bot-challenge tokens from Cloudflare Turnstile, hCaptcha and
+// Google reCAPTCHA. All three use the same "siteverify" protocol: the token, secret and
+// client IP are POSTed as a form and the provider answers with JSON.
+//
+// A *Verifier satisfies authhttp.ChallengeVerifier.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Provider verification endpoints.
+const (
+	TurnstileURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+	HCaptchaURL  = "https://api.hcaptcha.com/siteverify"
+	ReCAPTCHAURL = "https://www.google.com/recaptcha/api/siteverify"
+)
+
+var (
+	// ErrMissingToken is returned for an empty token.
+	ErrMissingToken = errors.New("captcha: missing token")
+	// ErrFailed is returned when the provider rejects the token. Other errors mean the
+	// provider could not be reached or answered unexpectedly.
+	ErrFailed = errors.New("captcha: challenge failed")
+)
+
+// Config configures a Verifier.
+type Config struct {
+	// Secret is the provider secret key.
+	Secret string
+	// HTTPClient sends verification requests (default: a client with a 10s timeout).
+	HTTPClient *http.Client
+	// Endpoint overrides the provider's verification URL, e.g. for tests or proxies.
+	Endpoint string
+	// Hostnames, when set, restricts the hostname the challenge was solved on.
+	Hostnames []string
+	// SiteKey is sent to hCaptcha to check the token was issued for this site. Optional.
+	SiteKey string
+	// MinScore rejects reCAPTCHA v3 tokens scoring below it (0 accepts any, as for v2).
+	MinScore float64
+	// Action, when set, must match the action reported for Turnstile and reCAPTCHA v3.
+	Action string
+}
+
+// Verifier checks tokens against one provider.
+type Verifier struct {
+	cfg      Config
+	endpoint string
+	client   *http.Client
+}
+
+// NewTurnstile returns a Cloudflare Turnstile verifier.
+func NewTurnstile(cfg Config) *Verifier { return newVerifier(cfg, TurnstileURL) }
+
+// NewHCaptcha returns an hCaptcha verifier.
+func NewHCaptcha(cfg Config) *Verifier { return newVerifier(cfg, HCaptchaURL) }
+
+// NewReCAPTCHA returns a Google reCAPTCHA (v2 or v3) verifier.
+func NewReCAPTCHA(cfg Config) *Verifier { return newVerifier(cfg, ReCAPTCHAURL) }
+
+func newVerifier(cfg Config, endpoint string) *Verifier {
+	if cfg.Endpoint != "" {
+		endpoint = cfg.Endpoint
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Verifier{cfg: cfg, endpoint: endpoint, client: client}
+}
+
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+	Hostname   string   `json:"hostname"`
+	Action     string   `json:"action"`
+	Score      *float64 `json:"score"`
+}
+
+// VerifyChallenge checks token, solved by the client at remoteIP (optional).
+func (v *Verifier) VerifyChallenge(ctx context.Context, token, remoteIP string) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return ErrMissingToken
+	}
+	form := url.Values{"secret": {v.cfg.Secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	if v.cfg.SiteKey != "" {
+		form.Set("sitekey", v.cfg.SiteKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha: siteverify request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha: siteverify status %d", resp.StatusCode)
+	}
+	var out siteverifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&out); err != nil {
+		return fmt.Errorf("captcha: siteverify response: %w", err)
+	}
+	switch {
+	case !out.Success:
+		return fmt.Errorf("%w: %s", ErrFailed, strings.Join(out.ErrorCodes, ","))
+	case len(v.cfg.Hostnames) > 0 && !slices.Contains(v.cfg.Hostnames, out.Hostname):
+		return fmt.Errorf("%w: hostname %q", ErrFailed, out.Hostname)
+	case v.cfg.Action != "" && out.Action != v.cfg.Action:
+		return fmt.Errorf("%w: action %q", ErrFailed, out.Action)
+	case out.Score != nil && *out.Score < v.cfg.MinScore:
+		return fmt.Errorf("%w: score %.2f", ErrFailed, *out.Score)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifier_Siteverify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("secret") != "s3cret" || r.Form.Get("remoteip") != "203.0.113.9" {
+			t.Errorf("unexpected form: %v", r.Form)
+		}
+		switch r.Form.Get("response") {
+		case "good":
+			_, _ = w.Write([]byte(`{"success":true,"hostname":"app.example.com","action":"register","score":0.9}`))
+		case "bot":
+			_, _ = w.Write([]byte(`{"success":true,"hostname":"app.example.com","action":"register","score":0.1}`))
+		default:
+			_, _ = w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+		}
+	}))
+	defer srv.Close()
+
+	v := NewReCAPTCHA(Config{Secret: "s3cret", Endpoint: srv.URL, HTTPClient: srv.Client(), MinScore: 0.5, Action: "register", Hostnames: []string{"app.example.com"}})
+	ctx := context.Background()
+	if err := v.VerifyChallenge(ctx, "good", "203.0.113.9"); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if err := v.VerifyChallenge(ctx, "bot", "203.0.113.9"); !errors.Is(err, ErrFailed) {
+		t.Fatalf("expected low score to fail, got %v", err)
+	}
+	if err := v.VerifyChallenge(ctx, "bad", "203.0.113.9"); !errors.Is(err, ErrFailed) {
+		t.Fatalf("expected rejected token to fail, got %v", err)
+	}
+	if err := v.VerifyChallenge(ctx, " ", ""); !errors.Is(err, ErrMissingToken) {
+		t.Fatalf("expected ErrMissingToken, got %v", err)
+	}
+	if err := NewTurnstile(Config{Endpoint: "http://127.0.0.1:1", HTTPClient: srv.Client()}).VerifyChallenge(ctx, "good", ""); err == nil || errors.Is(err, ErrFailed) {
+		t.Fatalf("expected transport error, got %v", err)
+	}
+}
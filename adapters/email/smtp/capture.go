@@ -0,0 +1,109 @@
+package emailsmtp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"sync"
+)
+
+// Message is a captured email, decoded for assertions.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+	Raw     []byte
+}
+
+// Capture is a Transport that records messages instead of sending them. Use it in tests
+// with Sender.WithTransport to assert on rendered emails:
+//
+//	capture := &emailsmtp.Capture{}
+//	sender, _ := emailsmtp.New(cfg)
+//	svc.WithEmailSender(sender.WithTransport(capture))
+type Capture struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+var _ Transport = (*Capture)(nil)
+
+// Send records msg. It never fails.
+func (c *Capture) Send(_ context.Context, from string, to []string, msg []byte) error {
+	m := Message{From: from, To: append([]string(nil), to...), Raw: append([]byte(nil), msg...)}
+	decodeMessage(&m)
+	c.mu.Lock()
+	c.messages = append(c.messages, m)
+	c.mu.Unlock()
+	return nil
+}
+
+// Messages returns a copy of all captured messages, oldest first.
+func (c *Capture) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.messages...)
+}
+
+// Last returns the most recent message sent to addr (any recipient when addr is empty).
+func (c *Capture) Last(addr string) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		m := c.messages[i]
+		for _, to := range m.To {
+			if addr == "" || strings.EqualFold(to, addr) {
+				return m, true
+			}
+		}
+	}
+	return Message{}, false
+}
+
+// Reset discards captured messages.
+func (c *Capture) Reset() {
+	c.mu.Lock()
+	c.messages = nil
+	c.mu.Unlock()
+}
+
+// decodeMessage fills Subject, Text and HTML from m.Raw on a best-effort basis.
+func decodeMessage(m *Message) {
+	parsed, err := mail.ReadMessage(bytes.NewReader(m.Raw))
+	if err != nil {
+		return
+	}
+	if s, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); err == nil {
+		m.Subject = s
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return
+	}
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			return
+		}
+		var r io.Reader = p
+		if strings.EqualFold(p.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+			r = quotedprintable.NewReader(p)
+		}
+		b, _ := io.ReadAll(r)
+		body := strings.ReplaceAll(string(b), "\r\n", "\n")
+		switch ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type")); ct {
+		case "text/plain":
+			m.Text = body
+		case "text/html":
+			m.HTML = body
+		}
+	}
+}
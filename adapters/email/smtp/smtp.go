@@ -0,0 +1,193 @@
+// Package emailsmtp implements core.EmailSender and its optional link and account-link
+// code extensions over SMTP, rendering each message from text and HTML templates.
+//
+// Default English templates are embedded. Hosts override any of them, or add languages,
+// through Config.Templates: a file "<lang>/<name>.<part>.tmpl" is used when the request
+// language (lang.LanguageFromContext) is <lang>, falling back to "<name>.<part>.tmpl".
+// Parts are "subject", "txt" and "html"; names are the Template* constants.
+package emailsmtp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// Template names, one per sender method.
+const (
+	TemplatePasswordResetCode     = "password_reset_code"
+	TemplatePasswordResetLink     = "password_reset_link"
+	TemplateEmailVerificationCode = "email_verification_code"
+	TemplateLoginCode             = "login_code"
+	TemplateWelcome               = "welcome"
+	TemplateDataExportLink        = "data_export_link"
+	TemplateLinkAccountCode       = "link_account_code"
+)
+
+// TLSMode selects how the SMTP connection is secured.
+type TLSMode int
+
+const (
+	// TLSStartTLS connects in plain text and requires the STARTTLS upgrade before
+	// authenticating or sending (typically port 587). This is the default.
+	TLSStartTLS TLSMode = iota
+	// TLSImplicit connects over TLS from the start (typically port 465).
+	TLSImplicit
+	// TLSNone sends in plain text. Only for local catchers such as Mailpit.
+	TLSNone
+)
+
+// ErrPasswordResetURLNotConfigured is returned by SendPasswordResetLink when
+// Config.PasswordResetURL is empty.
+var ErrPasswordResetURLNotConfigured = errors.New("emailsmtp: PasswordResetURL not configured")
+
+// ErrDataExportURLNotConfigured is returned by SendDataExportLink when
+// Config.DataExportURL is empty.
+var ErrDataExportURLNotConfigured = errors.New("emailsmtp: DataExportURL not configured")
+
+// Config configures an SMTP Sender.
+type Config struct {
+	// Addr is the server "host:port", e.g. "smtp.example.com:587".
+	Addr string
+	// TLS selects STARTTLS (default), implicit TLS or none.
+	TLS TLSMode
+	// TLSConfig is used for STARTTLS and implicit TLS. ServerName defaults to the Addr host.
+	TLSConfig *tls.Config
+	// Username and Password enable SMTP AUTH PLAIN when Username is set.
+	Username string
+	Password string
+	// LocalName is sent in EHLO (default "localhost").
+	LocalName string
+	// Timeout bounds a whole send when ctx has no earlier deadline (default 30s).
+	Timeout time.Duration
+
+	// From is the sender address, e.g. "MyApp <no-reply@example.com>".
+	From string
+	// AppName is available to templates as {{.AppName}}.
+	AppName string
+	// PasswordResetURL is the reset page URL with a "{token}" placeholder, e.g.
+	// "https://app.example.com/reset-password?token={token}". AuthKit does not build
+	// user-facing URLs; the rendered link is available to templates as {{.Link}}.
+	PasswordResetURL string
+	// DataExportURL is the app page that downloads the export with a "{token}"
+	// placeholder, e.g. "https://app.example.com/account/export?token={token}". The page
+	// must call GET /auth/export/{token} with the signed-in user's access token.
+	DataExportURL string
+
+	// Templates overrides or extends the embedded templates (see package doc).
+	Templates fs.FS
+	// DefaultLanguage is tried when the context carries no language, before the
+	// unprefixed templates. Optional.
+	DefaultLanguage string
+}
+
+// Transport delivers a fully rendered RFC 5322 message.
+type Transport interface {
+	Send(ctx context.Context, from string, to []string, msg []byte) error
+}
+
+// Data is passed to every template.
+type Data struct {
+	AppName  string
+	Language string
+	Email    string
+	Username string
+	// Code is set for code messages.
+	Code string
+	// Token and Link are set for password reset and data export links.
+	Token string
+	Link  string
+}
+
+// Sender sends AuthKit emails over SMTP.
+type Sender struct {
+	cfg       Config
+	from      *mail.Address
+	templates *templateSet
+	transport Transport
+}
+
+var (
+	_ core.EmailSender                      = (*Sender)(nil)
+	_ core.EmailSenderWithPasswordResetLink = (*Sender)(nil)
+	_ core.EmailSenderWithDataExportLink    = (*Sender)(nil)
+	_ core.EmailSenderWithLinkAccountCode   = (*Sender)(nil)
+)
+
+// New validates cfg and returns a Sender. Templates are parsed lazily on first use.
+func New(cfg Config) (*Sender, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, errors.New("emailsmtp: invalid From address")
+	}
+	if strings.TrimSpace(cfg.Addr) == "" {
+		return nil, errors.New("emailsmtp: Addr is required")
+	}
+	s := &Sender{cfg: cfg, from: from, templates: newTemplateSet(cfg.Templates)}
+	s.transport = &smtpTransport{cfg: cfg}
+	return s, nil
+}
+
+// WithTransport replaces the SMTP transport, e.g. with a *Capture in tests.
+func (s *Sender) WithTransport(t Transport) *Sender { s.transport = t; return s }
+
+func (s *Sender) SendPasswordResetCode(ctx context.Context, email, username, code string) error {
+	return s.send(ctx, TemplatePasswordResetCode, Data{Email: email, Username: username, Code: code})
+}
+
+func (s *Sender) SendEmailVerificationCode(ctx context.Context, email, username, code string) error {
+	return s.send(ctx, TemplateEmailVerificationCode, Data{Email: email, Username: username, Code: code})
+}
+
+func (s *Sender) SendLoginCode(ctx context.Context, email, username, code string) error {
+	return s.send(ctx, TemplateLoginCode, Data{Email: email, Username: username, Code: code})
+}
+
+func (s *Sender) SendLinkAccountCode(ctx context.Context, email, username, code string) error {
+	return s.send(ctx, TemplateLinkAccountCode, Data{Email: email, Username: username, Code: code})
+}
+
+func (s *Sender) SendWelcome(ctx context.Context, email, username string) error {
+	return s.send(ctx, TemplateWelcome, Data{Email: email, Username: username})
+}
+
+func (s *Sender) SendPasswordResetLink(ctx context.Context, email, username, token string) error {
+	if s.cfg.PasswordResetURL == "" {
+		return ErrPasswordResetURLNotConfigured
+	}
+	link := strings.ReplaceAll(s.cfg.PasswordResetURL, "{token}", url.QueryEscape(token))
+	return s.send(ctx, TemplatePasswordResetLink, Data{Email: email, Username: username, Token: token, Link: link})
+}
+
+func (s *Sender) SendDataExportLink(ctx context.Context, email, username, token string) error {
+	if s.cfg.DataExportURL == "" {
+		return ErrDataExportURLNotConfigured
+	}
+	link := strings.ReplaceAll(s.cfg.DataExportURL, "{token}", url.PathEscape(token))
+	return s.send(ctx, TemplateDataExportLink, Data{Email: email, Username: username, Token: token, Link: link})
+}
+
+func (s *Sender) send(ctx context.Context, name string, d Data) error {
+	to, err := mail.ParseAddress(d.Email)
+	if err != nil {
+		return errors.New("emailsmtp: invalid recipient address")
+	}
+	d.AppName = s.cfg.AppName
+	d.Language = s.language(ctx)
+	subject, text, html, err := s.templates.render(name, d.Language, d)
+	if err != nil {
+		return err
+	}
+	msg, err := buildMessage(s.from, to, subject, text, html, time.Now())
+	if err != nil {
+		return err
+	}
+	return s.transport.Send(ctx, s.from.Address, []string{to.Address}, msg)
+}
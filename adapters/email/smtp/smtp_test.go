@@ -0,0 +1,205 @@
+package emailsmtp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	authlang "github.com/open-rails/authkit/lang"
+)
+
+func newCaptureSender(t *testing.T, cfg Config) (*Sender, *Capture) {
+	t.Helper()
+	if cfg.Addr == "" {
+		cfg.Addr = "smtp.example.com:587"
+	}
+	if cfg.From == "" {
+		cfg.From = "MyApp <no-reply@example.com>"
+	}
+	cfg.AppName = "MyApp"
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Capture{}
+	return s.WithTransport(c), c
+}
+
+func TestSender_DefaultTemplatesMultipart(t *testing.T) {
+	s, capture := newCaptureSender(t, Config{})
+	if err := s.SendLoginCode(context.Background(), "alice@example.com", "<alice>", "ABC123"); err != nil {
+		t.Fatal(err)
+	}
+	m, ok := capture.Last("alice@example.com")
+	if !ok {
+		t.Fatal("no message captured")
+	}
+	if m.From != "no-reply@example.com" || m.Subject != "Your MyApp login code" {
+		t.Fatalf("unexpected envelope: %+v", m)
+	}
+	if !strings.Contains(m.Text, "ABC123") || !strings.Contains(m.Text, "Hi <alice>,") {
+		t.Fatalf("text part: %q", m.Text)
+	}
+	// html/template escapes user-controlled values.
+	if !strings.Contains(m.HTML, "ABC123") || !strings.Contains(m.HTML, "&lt;alice&gt;") {
+		t.Fatalf("html part: %q", m.HTML)
+	}
+	if !strings.Contains(string(m.Raw), "multipart/alternative") {
+		t.Fatal("expected multipart/alternative message")
+	}
+}
+
+func TestSender_LanguageOverride(t *testing.T) {
+	override := fstest.MapFS{
+		"es/login_code.subject.tmpl": {Data: []byte("Tu código de {{.AppName}}")},
+		"es/login_code.txt.tmpl":     {Data: []byte("Código: {{.Code}}")},
+		"welcome.subject.tmpl":       {Data: []byte("Hello from {{.AppName}}")},
+	}
+	s, capture := newCaptureSender(t, Config{Templates: override})
+
+	ctx := authlang.WithLanguage(context.Background(), "es")
+	if err := s.SendLoginCode(ctx, "bob@example.com", "bob", "999111"); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := capture.Last("")
+	if m.Subject != "Tu código de MyApp" || m.Text != "Código: 999111" {
+		t.Fatalf("expected Spanish override: %+v", m)
+	}
+	// No Spanish HTML override: falls back to the embedded default.
+	if !strings.Contains(m.HTML, "999111") {
+		t.Fatalf("html fallback: %q", m.HTML)
+	}
+
+	// Unprefixed overrides apply to every language.
+	if err := s.SendWelcome(ctx, "bob@example.com", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := capture.Last(""); m.Subject != "Hello from MyApp" {
+		t.Fatalf("unexpected subject %q", m.Subject)
+	}
+}
+
+func TestSender_PasswordResetLink(t *testing.T) {
+	s, capture := newCaptureSender(t, Config{PasswordResetURL: "https://app.example.com/reset?token={token}"})
+	if err := s.SendPasswordResetLink(context.Background(), "c@example.com", "", "a b+c"); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := capture.Last("c@example.com")
+	if !strings.Contains(m.Text, "https://app.example.com/reset?token=a+b%2Bc") {
+		t.Fatalf("link missing: %q", m.Text)
+	}
+
+	s, _ = newCaptureSender(t, Config{})
+	if err := s.SendPasswordResetLink(context.Background(), "c@example.com", "", "tok"); err != ErrPasswordResetURLNotConfigured {
+		t.Fatalf("expected ErrPasswordResetURLNotConfigured, got %v", err)
+	}
+}
+
+func TestSender_DataExportLink(t *testing.T) {
+	s, capture := newCaptureSender(t, Config{AppName: "MyApp", DataExportURL: "https://api.example.com/auth/export/{token}"})
+	if err := s.SendDataExportLink(context.Background(), "d@example.com", "dana", "abc_-123"); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := capture.Last("d@example.com")
+	if m.Subject != "Your MyApp data export is ready" || !strings.Contains(m.Text, "https://api.example.com/auth/export/abc_-123") {
+		t.Fatalf("unexpected message: %q %q", m.Subject, m.Text)
+	}
+
+	s, _ = newCaptureSender(t, Config{})
+	if err := s.SendDataExportLink(context.Background(), "d@example.com", "", "tok"); err != ErrDataExportURLNotConfigured {
+		t.Fatalf("expected ErrDataExportURLNotConfigured, got %v", err)
+	}
+}
+
+// fakeSMTP accepts one session and records the commands and DATA it receives.
+func fakeSMTP(t *testing.T, ext []string) (addr string, done <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	ch := make(chan []string, 1)
+	go func() {
+		var got []string
+		defer func() { ch <- got }()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+		reply := func(s string) { _, _ = w.WriteString(s + "\r\n"); _ = w.Flush() }
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			got = append(got, line)
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO":
+				reply("250-fake")
+				for _, e := range ext {
+					reply("250-" + e)
+				}
+				reply("250 8BITMIME")
+			case "AUTH":
+				reply("235 ok")
+			case "DATA":
+				reply("354 go ahead")
+				var body strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					body.WriteString(l)
+				}
+				got = append(got, body.String())
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), ch
+}
+
+func TestSMTPTransport_AuthAndData(t *testing.T) {
+	addr, done := fakeSMTP(t, []string{"AUTH PLAIN"})
+	s, err := New(Config{Addr: addr, TLS: TLSNone, Username: "user", Password: "pass", From: "no-reply@example.com", AppName: "MyApp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SendWelcome(context.Background(), "dana@example.com", "dana"); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(<-done, "\n")
+	auth := base64.StdEncoding.EncodeToString([]byte("\x00user\x00pass"))
+	for _, want := range []string{"EHLO localhost", "AUTH PLAIN " + auth, "MAIL FROM:<no-reply@example.com>", "RCPT TO:<dana@example.com>", "Subject: Welcome to MyApp", "QUIT"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in session:\n%s", want, got)
+		}
+	}
+}
+
+func TestSMTPTransport_RequiresStartTLS(t *testing.T) {
+	addr, _ := fakeSMTP(t, nil)
+	s, err := New(Config{Addr: addr, From: "no-reply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SendWelcome(context.Background(), "dana@example.com", "dana")
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected STARTTLS error, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package emailsmtp
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	authlang "github.com/open-rails/authkit/lang"
+)
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+var defaultTemplates, _ = fs.Sub(embedded, "templates")
+
+// templateSet resolves and caches parsed templates per (language, name, part).
+type templateSet struct {
+	override fs.FS
+	mu       sync.Mutex
+	text     map[string]*texttemplate.Template
+	html     map[string]*htmltemplate.Template
+}
+
+func newTemplateSet(override fs.FS) *templateSet {
+	return &templateSet{
+		override: override,
+		text:     map[string]*texttemplate.Template{},
+		html:     map[string]*htmltemplate.Template{},
+	}
+}
+
+// language returns the request language, else Config.DefaultLanguage.
+func (s *Sender) language(ctx context.Context) string {
+	if l, ok := authlang.LanguageFromContext(ctx); ok {
+		return strings.ToLower(strings.TrimSpace(l))
+	}
+	return strings.ToLower(strings.TrimSpace(s.cfg.DefaultLanguage))
+}
+
+// lookup reads the most specific template file for part: the language directory of the
+// override FS, then of the embedded set, then the unprefixed file in each.
+func (t *templateSet) lookup(lang, name, part string) (string, []byte, error) {
+	file := name + "." + part + ".tmpl"
+	var candidates []string
+	if lang != "" && !strings.ContainsAny(lang, "/.\\") {
+		candidates = append(candidates, path.Join(lang, file))
+	}
+	candidates = append(candidates, file)
+	for _, c := range candidates {
+		for _, fsys := range []fs.FS{t.override, defaultTemplates} {
+			if fsys == nil {
+				continue
+			}
+			b, err := fs.ReadFile(fsys, c)
+			if err == nil {
+				return c, b, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", nil, err
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("emailsmtp: template %s not found", file)
+}
+
+func (t *templateSet) textTemplate(lang, name, part string) (*texttemplate.Template, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := lang + "/" + name + "." + part
+	if tpl, ok := t.text[key]; ok {
+		return tpl, nil
+	}
+	file, src, err := t.lookup(lang, name, part)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := texttemplate.New(file).Option("missingkey=error").Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	t.text[key] = tpl
+	return tpl, nil
+}
+
+func (t *templateSet) htmlTemplate(lang, name string) (*htmltemplate.Template, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := lang + "/" + name
+	if tpl, ok := t.html[key]; ok {
+		return tpl, nil
+	}
+	file, src, err := t.lookup(lang, name, "html")
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := htmltemplate.New(file).Option("missingkey=error").Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	t.html[key] = tpl
+	return tpl, nil
+}
+
+// render executes the subject, text and HTML templates for name.
+func (t *templateSet) render(name, lang string, d Data) (subject, text, html string, err error) {
+	exec := func(tpl interface {
+		Execute(w io.Writer, data any) error
+	}) (string, error) {
+		var buf bytes.Buffer
+		err := tpl.Execute(&buf, d)
+		return buf.String(), err
+	}
+	st, err := t.textTemplate(lang, name, "subject")
+	if err != nil {
+		return "", "", "", err
+	}
+	if subject, err = exec(st); err != nil {
+		return "", "", "", err
+	}
+	tt, err := t.textTemplate(lang, name, "txt")
+	if err != nil {
+		return "", "", "", err
+	}
+	if text, err = exec(tt); err != nil {
+		return "", "", "", err
+	}
+	ht, err := t.htmlTemplate(lang, name)
+	if err != nil {
+		return "", "", "", err
+	}
+	if html, err = exec(ht); err != nil {
+		return "", "", "", err
+	}
+	// Subjects are single-line headers.
+	subject = strings.Join(strings.Fields(subject), " ")
+	return subject, text, html, nil
+}
@@ -0,0 +1,86 @@
+package authhttp
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// registrationInviteResponse includes the invitation code only on create.
+type registrationInviteResponse struct {
+	core.RegistrationInvite
+	Code string `json:"code"`
+}
+
+func (s *Service) handleAdminInvitesGET(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminInvites) {
+		tooMany(w)
+		return
+	}
+	invites, err := s.svc.ListRegistrationInvites(r.Context())
+	if err != nil {
+		serverErr(w, "failed_to_list_invites")
+		return
+	}
+	if invites == nil {
+		invites = []core.RegistrationInvite{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"invites": invites})
+}
+
+func (s *Service) handleAdminInvitesPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminInvites) {
+		tooMany(w)
+		return
+	}
+	var req struct {
+		Note      string     `json:"note"`
+		MaxUses   *int       `json:"max_uses"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		badRequest(w, "invalid_request")
+		return
+	}
+	if req.MaxUses != nil && *req.MaxUses < 1 {
+		badRequest(w, "invalid_max_uses")
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		badRequest(w, "invalid_expires_at")
+		return
+	}
+	opts := core.RegistrationInviteOptions{Note: req.Note, MaxUses: req.MaxUses, ExpiresAt: req.ExpiresAt}
+	if claims, ok := ClaimsFromContext(r.Context()); ok {
+		opts.CreatedBy = strings.TrimSpace(claims.UserID)
+	}
+	code, inv, err := s.svc.CreateRegistrationInvite(r.Context(), opts)
+	if err != nil {
+		serverErr(w, "create_failed")
+		return
+	}
+	writeJSON(w, http.StatusCreated, registrationInviteResponse{RegistrationInvite: *inv, Code: code})
+}
+
+func (s *Service) handleAdminInviteDELETE(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminInvites) {
+		tooMany(w)
+		return
+	}
+	id, ok := uuidPathID(w, r, "invite_id", "invite_not_found")
+	if !ok {
+		return
+	}
+	if err := s.svc.RevokeRegistrationInvite(r.Context(), id); err != nil {
+		if errors.Is(err, core.ErrRegistrationInviteNotFound) {
+			notFound(w, "invite_not_found")
+			return
+		}
+		serverErr(w, "revoke_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
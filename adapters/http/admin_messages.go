@@ -0,0 +1,33 @@
+package authhttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	core "github.com/open-rails/authkit/core"
+)
+
+// handleAdminUserMessagesGET lists a user's outbox email/SMS deliveries, newest first.
+func (s *Service) handleAdminUserMessagesGET(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimSpace(r.PathValue("user_id"))
+	if _, err := uuid.Parse(userID); err != nil {
+		badRequest(w, "invalid_request")
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", core.MessagePending, core.MessageSent, core.MessageDead:
+	default:
+		badRequest(w, "invalid_status")
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	msgs, err := s.svc.ListUserMessages(r.Context(), userID, status, limit)
+	if err != nil {
+		serverErr(w, "failed_to_list_messages")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"messages": msgs})
+}
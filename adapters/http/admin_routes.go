@@ -21,7 +21,7 @@ type adminUsersListResponse struct {
 }
 
 func (s *Service) handleAdminRolesGrantPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLAdminRolesGrant) {
+	if !s.allow(w, r, RLAdminRolesGrant) {
 		tooMany(w)
 		return
 	}
@@ -45,7 +45,7 @@ func (s *Service) handleAdminRolesGrantPOST(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *Service) handleAdminRolesRevokePOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLAdminRolesRevoke) {
+	if !s.allow(w, r, RLAdminRolesRevoke) {
 		tooMany(w)
 		return
 	}
@@ -69,7 +69,7 @@ func (s *Service) handleAdminRolesRevokePOST(w http.ResponseWriter, r *http.Requ
 }
 
 func (s *Service) handleAdminUsersListGET(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLAdminUserSessionsList) {
+	if !s.allow(w, r, RLAdminUserSessionsList) {
 		tooMany(w)
 		return
 	}
@@ -122,7 +122,7 @@ func (s *Service) handleAdminUsersBanPOST(w http.ResponseWriter, r *http.Request
 		badRequest(w, "invalid_request")
 		return
 	}
-	if !s.allow(r, RLAdminUserSessionsRevokeAll) {
+	if !s.allow(w, r, RLAdminUserSessionsRevokeAll) {
 		tooMany(w)
 		return
 	}
@@ -159,7 +159,7 @@ func (s *Service) handleAdminUsersUnbanPOST(w http.ResponseWriter, r *http.Reque
 		badRequest(w, "invalid_request")
 		return
 	}
-	if !s.allow(r, RLAdminUserSessionsRevokeAll) {
+	if !s.allow(w, r, RLAdminUserSessionsRevokeAll) {
 		tooMany(w)
 		return
 	}
@@ -179,7 +179,7 @@ func (s *Service) handleAdminUsersSetEmailPOST(w http.ResponseWriter, r *http.Re
 		badRequest(w, "invalid_request")
 		return
 	}
-	if !s.allow(r, RLAdminRolesGrant) {
+	if !s.allow(w, r, RLAdminRolesGrant) {
 		tooMany(w)
 		return
 	}
@@ -199,7 +199,7 @@ func (s *Service) handleAdminUsersSetUsernamePOST(w http.ResponseWriter, r *http
 		badRequest(w, "invalid_request")
 		return
 	}
-	if !s.allow(r, RLAdminRolesGrant) {
+	if !s.allow(w, r, RLAdminRolesGrant) {
 		tooMany(w)
 		return
 	}
@@ -219,7 +219,7 @@ func (s *Service) handleAdminUsersSetPasswordPOST(w http.ResponseWriter, r *http
 		badRequest(w, "invalid_request")
 		return
 	}
-	if !s.allow(r, RLAdminRolesGrant) {
+	if !s.allow(w, r, RLAdminRolesGrant) {
 		tooMany(w)
 		return
 	}
@@ -270,7 +270,7 @@ func (s *Service) handleAdminUserDeleteDELETE(w http.ResponseWriter, r *http.Req
 		badRequest(w, "invalid_request")
 		return
 	}
-	if !s.allow(r, RLAdminUserSessionsRevokeAll) {
+	if !s.allow(w, r, RLAdminUserSessionsRevokeAll) {
 		tooMany(w)
 		return
 	}
@@ -287,7 +287,7 @@ func (s *Service) handleAdminUserRestorePOST(w http.ResponseWriter, r *http.Requ
 		badRequest(w, "invalid_request")
 		return
 	}
-	if !s.allow(r, RLAdminUserSessionsRevokeAll) {
+	if !s.allow(w, r, RLAdminUserSessionsRevokeAll) {
 		tooMany(w)
 		return
 	}
@@ -0,0 +1,160 @@
+package authhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	core "github.com/open-rails/authkit/core"
+	samlkit "github.com/open-rails/authkit/saml"
+)
+
+var samlSlugRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// samlMetadataMaxBytes bounds IdP metadata fetched from idp_metadata_url.
+const samlMetadataMaxBytes = 1 << 20
+
+type adminSAMLConnection struct {
+	Slug              string                   `json:"slug"`
+	IdPEntityID       string                   `json:"idp_entity_id"`
+	AttributeMapping  samlkit.AttributeMapping `json:"attribute_mapping"`
+	Binding           string                   `json:"binding"`
+	AllowIDPInitiated bool                     `json:"allow_idp_initiated"`
+	TrustEmail        bool                     `json:"trust_email"`
+	CreatedAt         time.Time                `json:"created_at"`
+	UpdatedAt         time.Time                `json:"updated_at"`
+}
+
+func toAdminSAMLConnection(c core.SAMLConnection) adminSAMLConnection {
+	return adminSAMLConnection{
+		Slug:              c.Slug,
+		IdPEntityID:       c.IdPEntityID,
+		AttributeMapping:  c.AttributeMapping,
+		Binding:           c.Binding,
+		AllowIDPInitiated: c.AllowIDPInitiated,
+		TrustEmail:        c.TrustEmail,
+		CreatedAt:         c.CreatedAt,
+		UpdatedAt:         c.UpdatedAt,
+	}
+}
+
+func (s *Service) handleAdminSAMLConnectionsGET(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminSAMLConnections) {
+		tooMany(w)
+		return
+	}
+	conns, err := s.svc.ListSAMLConnections(r.Context())
+	if err != nil {
+		serverErr(w, "failed_to_list_connections")
+		return
+	}
+	out := make([]adminSAMLConnection, 0, len(conns))
+	for _, c := range conns {
+		out = append(out, toAdminSAMLConnection(c))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"connections": out})
+}
+
+// handleAdminSAMLConnectionPUT imports IdP metadata (inline XML or fetched from a URL)
+// and creates or replaces the connection.
+func (s *Service) handleAdminSAMLConnectionPUT(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminSAMLConnections) {
+		tooMany(w)
+		return
+	}
+	slug := r.PathValue("slug")
+	if !samlSlugRe.MatchString(slug) {
+		badRequest(w, "invalid_slug")
+		return
+	}
+	var req struct {
+		IdPMetadataXML    string                   `json:"idp_metadata_xml"`
+		IdPMetadataURL    string                   `json:"idp_metadata_url"`
+		AttributeMapping  samlkit.AttributeMapping `json:"attribute_mapping"`
+		Binding           string                   `json:"binding"`
+		AllowIDPInitiated bool                     `json:"allow_idp_initiated"`
+		TrustEmail        *bool                    `json:"trust_email"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		badRequest(w, "invalid_request")
+		return
+	}
+	switch req.Binding {
+	case "", samlkit.BindingRedirect, samlkit.BindingPost:
+	default:
+		badRequest(w, "invalid_binding")
+		return
+	}
+	metadata := strings.TrimSpace(req.IdPMetadataXML)
+	if metadata == "" && strings.TrimSpace(req.IdPMetadataURL) != "" {
+		b, err := s.fetchSAMLMetadata(r.Context(), strings.TrimSpace(req.IdPMetadataURL))
+		if err != nil {
+			badRequest(w, "metadata_fetch_failed")
+			return
+		}
+		metadata = string(b)
+	}
+	if metadata == "" {
+		badRequest(w, "metadata_required")
+		return
+	}
+	if _, err := samlkit.ParseIdPMetadata([]byte(metadata)); err != nil {
+		badRequest(w, "invalid_metadata")
+		return
+	}
+	conn, err := s.svc.UpsertSAMLConnection(r.Context(), core.SAMLConnection{
+		Slug:              slug,
+		IdPMetadataXML:    metadata,
+		AttributeMapping:  req.AttributeMapping,
+		Binding:           req.Binding,
+		AllowIDPInitiated: req.AllowIDPInitiated,
+		TrustEmail:        req.TrustEmail != nil && *req.TrustEmail,
+	})
+	if err != nil {
+		// idp_entity_id is unique: the IdP is already registered under another slug.
+		sendErr(w, http.StatusConflict, "connection_conflict")
+		return
+	}
+	if conn == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "saml_unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, toAdminSAMLConnection(*conn))
+}
+
+func (s *Service) handleAdminSAMLConnectionDELETE(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminSAMLConnections) {
+		tooMany(w)
+		return
+	}
+	if err := s.svc.DeleteSAMLConnection(r.Context(), r.PathValue("slug")); err != nil {
+		serverErr(w, "delete_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func (s *Service) fetchSAMLMetadata(ctx context.Context, rawURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "https" && !core.IsDevEnvironment() {
+		return nil, fmt.Errorf("metadata url must use https")
+	}
+	resp, err := s.outboundHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata fetch: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, samlMetadataMaxBytes))
+}
@@ -1,7 +1,9 @@
 package authhttp
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	core "github.com/open-rails/authkit/core"
@@ -18,10 +20,33 @@ func (s *Service) handleAdminUserSigninsGET(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	events, err := s.authlogr.ListSessionEvents(r.Context(), userID, core.SessionEventCreated, core.SessionEventFailed)
-	if err != nil {
-		serverErr(w, "failed_to_list_signins")
-		return
+	// Readers with pagination support honor ?limit= and ?cursor=; others return one list.
+	var events []core.AuthSessionEvent
+	var nextCursor string
+	if pr, ok := s.authlogr.(core.AuthEventLogPageReader); ok {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		page, err := pr.ListSessionEventsPage(r.Context(), core.SessionEventQuery{
+			UserID:     userID,
+			EventTypes: []core.SessionEventType{core.SessionEventCreated, core.SessionEventFailed},
+			Limit:      limit,
+			Cursor:     strings.TrimSpace(r.URL.Query().Get("cursor")),
+		})
+		if err != nil {
+			if errors.Is(err, core.ErrInvalidCursor) {
+				badRequest(w, "invalid_cursor")
+				return
+			}
+			serverErr(w, "failed_to_list_signins")
+			return
+		}
+		events, nextCursor = page.Events, page.NextCursor
+	} else {
+		var err error
+		events, err = s.authlogr.ListSessionEvents(r.Context(), userID, core.SessionEventCreated, core.SessionEventFailed)
+		if err != nil {
+			serverErr(w, "failed_to_list_signins")
+			return
+		}
 	}
 
 	resp := make([]map[string]any, 0, len(events))
@@ -39,7 +64,9 @@ func (s *Service) handleAdminUserSigninsGET(w http.ResponseWriter, r *http.Reque
 		})
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"data": resp,
-	})
+	out := map[string]any{"data": resp}
+	if nextCursor != "" {
+		out["next_cursor"] = nextCursor
+	}
+	writeJSON(w, http.StatusOK, out)
 }
@@ -0,0 +1,219 @@
+package authhttp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	core "github.com/open-rails/authkit/core"
+)
+
+// webhookEndpointResponse includes the signing secret only on create and rotate.
+type webhookEndpointResponse struct {
+	core.WebhookEndpoint
+	Secret string `json:"secret,omitempty"`
+}
+
+// uuidPathID returns the named path value if it is a UUID, writing a 404 otherwise.
+func uuidPathID(w http.ResponseWriter, r *http.Request, name, notFoundCode string) (string, bool) {
+	id := strings.TrimSpace(r.PathValue(name))
+	if _, err := uuid.Parse(id); err != nil {
+		notFound(w, notFoundCode)
+		return "", false
+	}
+	return id, true
+}
+
+// writeWebhookErr maps core webhook errors to responses.
+func writeWebhookErr(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, core.ErrWebhookEndpointNotFound):
+		notFound(w, "webhook_not_found")
+	case errors.Is(err, core.ErrWebhookDeliveryNotFound):
+		notFound(w, "delivery_not_found")
+	case errors.Is(err, core.ErrInvalidWebhookURL):
+		badRequest(w, "invalid_url")
+	case errors.Is(err, core.ErrInvalidWebhookEventType):
+		badRequest(w, "invalid_event_type")
+	case errors.Is(err, core.ErrInvalidWebhookFormat):
+		badRequest(w, "invalid_format")
+	default:
+		serverErr(w, fallback)
+	}
+}
+
+func (s *Service) handleAdminWebhooksGET(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminWebhooks) {
+		tooMany(w)
+		return
+	}
+	eps, err := s.svc.ListWebhookEndpoints(r.Context())
+	if err != nil {
+		serverErr(w, "failed_to_list_webhooks")
+		return
+	}
+	if eps == nil {
+		eps = []core.WebhookEndpoint{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"endpoints": eps, "event_types": core.SecurityEventTypes})
+}
+
+func (s *Service) handleAdminWebhooksPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminWebhooks) {
+		tooMany(w)
+		return
+	}
+	var req struct {
+		URL         string   `json:"url"`
+		Description string   `json:"description"`
+		EventTypes  []string `json:"event_types"`
+		Format      string   `json:"format"`
+		Audience    *string  `json:"audience"`
+	}
+	if err := decodeJSON(r, &req); err != nil || strings.TrimSpace(req.URL) == "" {
+		badRequest(w, "invalid_request")
+		return
+	}
+	ep, err := s.svc.CreateWebhookEndpoint(r.Context(), core.WebhookEndpoint{
+		URL:         req.URL,
+		Description: req.Description,
+		EventTypes:  req.EventTypes,
+		Format:      req.Format,
+		Audience:    req.Audience,
+	})
+	if err != nil {
+		writeWebhookErr(w, err, "create_failed")
+		return
+	}
+	writeJSON(w, http.StatusCreated, webhookEndpointResponse{WebhookEndpoint: *ep, Secret: ep.Secret})
+}
+
+func (s *Service) handleAdminWebhookPATCH(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminWebhooks) {
+		tooMany(w)
+		return
+	}
+	id, ok := uuidPathID(w, r, "endpoint_id", "webhook_not_found")
+	if !ok {
+		return
+	}
+	var req struct {
+		URL         *string   `json:"url"`
+		Description *string   `json:"description"`
+		EventTypes  *[]string `json:"event_types"`
+		Enabled     *bool     `json:"enabled"`
+		Format      *string   `json:"format"`
+		Audience    *string   `json:"audience"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		badRequest(w, "invalid_request")
+		return
+	}
+	ep, err := s.svc.UpdateWebhookEndpoint(r.Context(), id, core.WebhookEndpointUpdate{
+		URL:         req.URL,
+		Description: req.Description,
+		EventTypes:  req.EventTypes,
+		Enabled:     req.Enabled,
+		Format:      req.Format,
+		Audience:    req.Audience,
+	})
+	if err != nil {
+		writeWebhookErr(w, err, "update_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, ep)
+}
+
+func (s *Service) handleAdminWebhookDELETE(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminWebhooks) {
+		tooMany(w)
+		return
+	}
+	id, ok := uuidPathID(w, r, "endpoint_id", "webhook_not_found")
+	if !ok {
+		return
+	}
+	if err := s.svc.DeleteWebhookEndpoint(r.Context(), id); err != nil {
+		writeWebhookErr(w, err, "delete_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func (s *Service) handleAdminWebhookRotateSecretPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminWebhooks) {
+		tooMany(w)
+		return
+	}
+	id, ok := uuidPathID(w, r, "endpoint_id", "webhook_not_found")
+	if !ok {
+		return
+	}
+	secret, err := s.svc.RotateWebhookSecret(r.Context(), id)
+	if err != nil {
+		writeWebhookErr(w, err, "rotate_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"secret": secret})
+}
+
+func (s *Service) handleAdminWebhookDeliveriesGET(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminWebhooks) {
+		tooMany(w)
+		return
+	}
+	id, ok := uuidPathID(w, r, "endpoint_id", "webhook_not_found")
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", core.WebhookDeliveryPending, core.WebhookDeliveryDelivered, core.WebhookDeliveryDead:
+	default:
+		badRequest(w, "invalid_status")
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	deliveries, err := s.svc.ListWebhookDeliveries(r.Context(), id, status, limit)
+	if err != nil {
+		serverErr(w, "failed_to_list_deliveries")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"deliveries": deliveries})
+}
+
+// handleAdminWebhookReplayPOST re-enqueues every dead delivery of an endpoint.
+func (s *Service) handleAdminWebhookReplayPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminWebhooks) {
+		tooMany(w)
+		return
+	}
+	id, ok := uuidPathID(w, r, "endpoint_id", "webhook_not_found")
+	if !ok {
+		return
+	}
+	n, err := s.svc.ReplayDeadWebhookDeliveries(r.Context(), id)
+	if err != nil {
+		writeWebhookErr(w, err, "replay_failed")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"replayed": n})
+}
+
+func (s *Service) handleAdminWebhookDeliveryReplayPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminWebhooks) {
+		tooMany(w)
+		return
+	}
+	id, ok := uuidPathID(w, r, "delivery_id", "delivery_not_found")
+	if !ok {
+		return
+	}
+	if err := s.svc.ReplayWebhookDelivery(r.Context(), id); err != nil {
+		writeWebhookErr(w, err, "replay_failed")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
+}
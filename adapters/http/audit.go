@@ -1,12 +1,29 @@
 package authhttp
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+)
 
 func logLoginFailed(s *Service, r *http.Request, userID string, reason string) {
 	if s == nil || s.svc == nil {
 		return
 	}
+	method := "password_login"
+	if strings.HasSuffix(r.URL.Path, "/2fa/verify") {
+		method = "password_login_2fa"
+	}
+	countLoginFailed(s, r, method, reason)
 	ua := r.UserAgent()
 	ip := clientIP(r)
 	s.svc.LogSessionFailed(r.Context(), userID, "", &reason, &ip, &ua)
 }
+
+// countLoginFailed records a failed login in metrics only (browser/wallet flows that
+// fail before a user is known).
+func countLoginFailed(s *Service, r *http.Request, method, reason string) {
+	if s == nil || s.svc == nil {
+		return
+	}
+	s.svc.Telemetry().LoginFailed(r.Context(), method, reason)
+}
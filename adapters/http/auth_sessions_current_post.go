@@ -6,7 +6,7 @@ import (
 )
 
 func (s *Service) handleAuthSessionsCurrentPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLAuthSessionsCurrent) {
+	if !s.allow(w, r, RLAuthSessionsCurrent) {
 		tooMany(w)
 		return
 	}
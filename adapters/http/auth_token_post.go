@@ -10,7 +10,7 @@ import (
 )
 
 func (s *Service) handleAuthTokenPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLAuthToken) {
+	if !s.allow(w, r, RLAuthToken) {
 		tooMany(w)
 		return
 	}
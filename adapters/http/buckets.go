@@ -26,8 +26,13 @@ const (
 	RLEmailVerifyConfirm   = "auth_email_verify_confirm"
 	RLPhoneVerifyRequest   = "auth_phone_verify_request"
 
-	RLOIDCStart    = "auth_oidc_start"
-	RLOIDCCallback = "auth_oidc_callback"
+	RLOIDCStart       = "auth_oidc_start"
+	RLOIDCCallback    = "auth_oidc_callback"
+	RLOIDCLinkCode    = "auth_oidc_link_code"
+	RLOIDCLinkConfirm = "auth_oidc_link_confirm"
+
+	RLSAMLStart    = "auth_saml_start"
+	RLSAMLCallback = "auth_saml_callback"
 
 	RLUserPasswordChange = "auth_user_password_change"
 	RLUserMe             = "auth_user_me"
@@ -44,15 +49,30 @@ const (
 
 	RLUserDelete         = "auth_user_delete"
 	RLUserUnlinkProvider = "auth_user_unlink_provider"
+	RLUserMerge          = "auth_user_merge"
+	RLUserMetadata       = "auth_user_metadata"
+	RLUserExport         = "auth_user_export"
+	RLExportDownload     = "auth_export_download"
 
 	RLAdminRolesGrant            = "auth_admin_roles_grant"
 	RLAdminRolesRevoke           = "auth_admin_roles_revoke"
 	RLAdminUserSessionsList      = "auth_admin_user_sessions_list"
 	RLAdminUserSessionsRevoke    = "auth_admin_user_sessions_revoke"
 	RLAdminUserSessionsRevokeAll = "auth_admin_user_sessions_revoke_all"
+	RLAdminSAMLConnections       = "auth_admin_saml_connections"
+	RLAdminUsersMerge            = "auth_admin_users_merge"
+	RLAdminWebhooks              = "auth_admin_webhooks"
+	RLAdminInvites               = "auth_admin_invites"
+	RLAdminUserMetadata          = "auth_admin_user_metadata"
 
 	// Solana SIWS authentication
 	RLSolanaChallenge = "auth_solana_challenge"
 	RLSolanaLogin     = "auth_solana_login"
 	RLSolanaLink      = "auth_solana_link"
+
+	// SCIM provisioning (directory clients)
+	RLSCIM = "auth_scim"
+
+	// Shared Signals (CAEP/RISC) SET receiver
+	RLSSFEvents = "auth_ssf_events"
 )
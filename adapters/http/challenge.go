@@ -0,0 +1,269 @@
+package authhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-rails/authkit/adapters/captcha"
+	core "github.com/open-rails/authkit/core"
+	memorystore "github.com/open-rails/authkit/storage/memory"
+)
+
+// ChallengeVerifier checks a CAPTCHA or bot-challenge token solved by the client at
+// remoteIP. Any error rejects the request. adapters/captcha provides Turnstile,
+// hCaptcha and reCAPTCHA verifiers.
+type ChallengeVerifier interface {
+	VerifyChallenge(ctx context.Context, token, remoteIP string) error
+}
+
+// ChallengeMode selects when an endpoint requires a challenge token.
+type ChallengeMode int
+
+const (
+	ChallengeNever ChallengeMode = iota
+	ChallengeAlways
+	// ChallengeAdaptive requires a token from a client IP once it has had AfterFailures
+	// failed (4xx) responses, or has used up the endpoint's rate limit down to
+	// RemainingBelow of its quota, within Window.
+	ChallengeAdaptive
+)
+
+// ChallengePolicy configures the challenge for one endpoint.
+type ChallengePolicy struct {
+	Mode ChallengeMode
+	// AfterFailures is the adaptive failure threshold (0 disables it).
+	AfterFailures int
+	// RemainingBelow is the adaptive remaining-quota fraction, e.g. 0.25 (0 disables it).
+	// It needs a limiter that reports quota (DetailedRateLimiter).
+	RemainingBelow float64
+	// Window is how long adaptive state is kept per client IP (default 1 hour).
+	Window time.Duration
+}
+
+// ChallengeConfig enables bot challenges on abuse-prone endpoints.
+type ChallengeConfig struct {
+	Verifier ChallengeVerifier
+	// Header carries the token (default "X-Captcha-Token").
+	Header string
+	// BodyField carries the token in the JSON body when the header is absent (default
+	// "captcha_token"). The field is removed before the handler reads the body.
+	BodyField string
+	// Endpoints maps the endpoint's rate limit bucket (RLAuthRegister,
+	// RLPasswordResetRequest, RLPhoneVerifyRequest, RLSolanaChallenge) to its policy.
+	// Nil requires a challenge on all four; unlisted endpoints never require one.
+	Endpoints map[string]ChallengePolicy
+}
+
+// WithChallenge enables CAPTCHA verification per cfg. Rejected requests get
+// 403 {"error":"challenge_required"} without a token and "challenge_failed" otherwise.
+func (s *Service) WithChallenge(cfg ChallengeConfig) *Service {
+	if cfg.Verifier == nil {
+		s.challenge = nil
+		return s
+	}
+	if cfg.Header == "" {
+		cfg.Header = "X-Captcha-Token"
+	}
+	if cfg.BodyField == "" {
+		cfg.BodyField = "captcha_token"
+	}
+	if cfg.Endpoints == nil {
+		always := ChallengePolicy{Mode: ChallengeAlways}
+		cfg.Endpoints = map[string]ChallengePolicy{
+			RLAuthRegister:         always,
+			RLPasswordResetRequest: always,
+			RLPhoneVerifyRequest:   always,
+			RLSolanaChallenge:      always,
+		}
+	}
+	s.challenge = &cfg
+	return s
+}
+
+const maxChallengeBody = 1 << 20
+
+// quotaObservation records the lowest remaining quota fraction seen by limit() while
+// serving a challenged request.
+type quotaObservation struct {
+	seen      bool
+	remaining float64
+}
+
+type quotaObservationKey struct{}
+
+func observeQuota(ctx context.Context, remaining, limit int) {
+	obs, ok := ctx.Value(quotaObservationKey{}).(*quotaObservation)
+	if !ok || limit <= 0 {
+		return
+	}
+	frac := float64(remaining) / float64(limit)
+	if !obs.seen || frac < obs.remaining {
+		obs.seen, obs.remaining = true, frac
+	}
+}
+
+// bucketAllowedKey carries the bucket whose limits challenged already applied, so the
+// handler's own allow call does not count the request twice.
+type bucketAllowedKey struct{}
+
+// statusRecorder captures the response status for adaptive challenge accounting.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// challenged wraps an endpoint handler with the challenge policy for bucket.
+func (s *Service) challenged(bucket string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.challenge
+		if cfg == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		policy := cfg.Endpoints[bucket]
+		if policy.Mode == ChallengeNever {
+			next.ServeHTTP(w, r)
+			return
+		}
+		obs := &quotaObservation{}
+		r = r.WithContext(context.WithValue(r.Context(), quotaObservationKey{}, obs))
+		// Rate limit before the verifier is called: each verification is a paid,
+		// outbound request to the challenge provider.
+		if !s.allow(w, r, bucket) {
+			tooMany(w)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), bucketAllowedKey{}, bucket))
+		token, err := challengeToken(r, cfg)
+		if err != nil {
+			badRequest(w, "invalid_request")
+			return
+		}
+		ip := s.requestIP(r)
+		stateKey := "auth:challenge:" + bucket + ":" + hashIP(ip)
+		required := policy.Mode == ChallengeAlways
+		if policy.Mode == ChallengeAdaptive && ip != "" {
+			n, _ := s.challengeFailures(r.Context(), stateKey)
+			required = policy.AfterFailures > 0 && n >= policy.AfterFailures
+		}
+		if required {
+			if token == "" {
+				forbidden(w, "challenge_required")
+				return
+			}
+			if err := cfg.Verifier.VerifyChallenge(r.Context(), token, ip); err != nil {
+				if !errors.Is(err, captcha.ErrFailed) && !errors.Is(err, captcha.ErrMissingToken) {
+					s.logIfErr(r.Context(), "authkit: challenge verification error", err, "bucket", bucket)
+				}
+				forbidden(w, "challenge_failed")
+				return
+			}
+		}
+		if policy.Mode != ChallengeAdaptive || ip == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if required {
+			return // solved: keep challenging until the state expires
+		}
+		window := policy.Window
+		if window <= 0 {
+			window = time.Hour
+		}
+		switch {
+		case policy.RemainingBelow > 0 && obs.seen && obs.remaining <= policy.RemainingBelow:
+			s.setChallengeFailures(r.Context(), stateKey, max(policy.AfterFailures, 1), window)
+		case rec.status >= 400 && rec.status < 500:
+			n, _ := s.challengeFailures(r.Context(), stateKey)
+			s.setChallengeFailures(r.Context(), stateKey, n+1, window)
+		}
+	})
+}
+
+// challengeToken returns the token from the configured header, or removes it from the
+// JSON body so strict decoding in the handler still succeeds.
+func challengeToken(r *http.Request, cfg *ChallengeConfig) (string, error) {
+	token := strings.TrimSpace(r.Header.Get(cfg.Header))
+	if r.Body == nil {
+		return token, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxChallengeBody+1))
+	_ = r.Body.Close()
+	if err != nil || len(body) > maxChallengeBody {
+		return "", errors.New("challenge: body too large")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return token, nil
+	}
+	raw, ok := fields[cfg.BodyField]
+	if !ok {
+		return token, nil
+	}
+	delete(fields, cfg.BodyField)
+	stripped, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(stripped))
+	r.ContentLength = int64(len(stripped))
+	if token == "" {
+		_ = json.Unmarshal(raw, &token)
+	}
+	return strings.TrimSpace(token), nil
+}
+
+func (s *Service) requestIP(r *http.Request) string {
+	ipFn := s.clientIP
+	if ipFn == nil {
+		ipFn = DefaultClientIP()
+	}
+	return strings.TrimSpace(ipFn(r))
+}
+
+func hashIP(ip string) string {
+	sum := sha256.Sum256([]byte(ip))
+	return hex.EncodeToString(sum[:16])
+}
+
+// challengeStore holds adaptive challenge counters: the configured ephemeral store, or
+// process memory when none was set. Counters are best-effort.
+func (s *Service) challengeStore() core.EphemeralStore {
+	if s.ephemStore != nil {
+		return s.ephemStore
+	}
+	s.challengeMemOnce.Do(func() { s.challengeMem = memorystore.NewKV() })
+	return s.challengeMem
+}
+
+func (s *Service) challengeFailures(ctx context.Context, key string) (int, error) {
+	b, ok, err := s.challengeStore().Get(ctx, key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return strconv.Atoi(string(b))
+}
+
+func (s *Service) setChallengeFailures(ctx context.Context, key string, n int, ttl time.Duration) {
+	s.logIfErr(ctx, "authkit: challenge state write failed", s.challengeStore().Set(ctx, key, []byte(strconv.Itoa(n)), ttl))
+}
@@ -3,7 +3,10 @@ package authhttp
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"strings"
+
+	core "github.com/open-rails/authkit/core"
 )
 
 // Claims is a typed view of authenticated user information attached by middleware.
@@ -39,6 +42,9 @@ func (c Claims) HasEntitlement(ent string) bool {
 type claimsCtxKey struct{}
 
 func setClaims(ctx context.Context, cl Claims) context.Context {
+	if cl.UserID != "" {
+		ctx = core.ContextWithLogAttrs(ctx, slog.String("user_id", cl.UserID))
+	}
 	return context.WithValue(ctx, claimsCtxKey{}, cl)
 }
 
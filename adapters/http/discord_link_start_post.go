@@ -9,7 +9,7 @@ import (
 )
 
 func (s *Service) handleDiscordLinkStartPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLOIDCStart) {
+	if !s.allow(w, r, RLOIDCStart) {
 		tooMany(w)
 		return
 	}
@@ -16,7 +16,7 @@ import (
 )
 
 func (s *Service) handleDiscordLoginGET(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLOIDCStart) {
+	if !s.allow(w, r, RLOIDCStart) {
 		tooMany(w)
 		return
 	}
@@ -50,7 +50,7 @@ func (s *Service) handleDiscordLoginGET(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	popupNonce := r.URL.Query().Get("popup_nonce")
-	if err := s.oidcCfg().StateCache.Put(r.Context(), st, oidckit.StateData{Provider: provider, RedirectURI: redirectURI, UI: ui, PopupNonce: popupNonce}); err != nil {
+	if err := s.oidcCfg().StateCache.Put(r.Context(), st, oidckit.StateData{Provider: provider, RedirectURI: redirectURI, UI: ui, PopupNonce: popupNonce, InviteCode: strings.TrimSpace(r.URL.Query().Get("invite"))}); err != nil {
 		serverErr(w, "state_store_failed")
 		return
 	}
@@ -92,7 +92,7 @@ type discordUser struct {
 }
 
 func (s *Service) handleDiscordCallbackGET(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLOIDCCallback) {
+	if !s.allow(w, r, RLOIDCCallback) {
 		tooMany(w)
 		return
 	}
@@ -110,8 +110,8 @@ func (s *Service) handleDiscordCallbackGET(w http.ResponseWriter, r *http.Reques
 	}
 
 	cfg := s.oidcCfg()
-	sd, ok, err := cfg.StateCache.Get(r.Context(), state)
-	_ = cfg.StateCache.Del(r.Context(), state)
+	sd, ok, err := oidckit.ConsumeState(r.Context(), cfg.StateCache, state)
+	s.logIfErr(r.Context(), "authkit: state consume failed", err)
 	if err != nil || !ok || sd.Provider != "discord" {
 		badRequest(w, "invalid_state")
 		return
@@ -131,39 +131,45 @@ func (s *Service) handleDiscordCallbackGET(w http.ResponseWriter, r *http.Reques
 	form.Set("redirect_uri", sd.RedirectURI)
 	req, _ := http.NewRequestWithContext(r.Context(), http.MethodPost, "https://discord.com/api/oauth2/token", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.outboundHTTPClient().Do(req)
 	if err != nil {
+		countLoginFailed(s, r, "oauth_login:discord", "exchange_failed")
 		unauthorized(w, "exchange_failed")
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		_, _ = io.ReadAll(resp.Body)
+		countLoginFailed(s, r, "oauth_login:discord", "exchange_failed")
 		unauthorized(w, "exchange_failed")
 		return
 	}
 	body, _ := io.ReadAll(resp.Body)
 	var tok discordTokenResp
 	if json.Unmarshal(body, &tok) != nil || strings.TrimSpace(tok.AccessToken) == "" {
+		countLoginFailed(s, r, "oauth_login:discord", "exchange_failed")
 		unauthorized(w, "exchange_failed")
 		return
 	}
 
 	ureq, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, "https://discord.com/api/users/@me", nil)
 	ureq.Header.Set("Authorization", tok.TokenType+" "+tok.AccessToken)
-	uresp, err := http.DefaultClient.Do(ureq)
+	uresp, err := s.outboundHTTPClient().Do(ureq)
 	if err != nil {
+		countLoginFailed(s, r, "oauth_login:discord", "userinfo_failed")
 		unauthorized(w, "userinfo_failed")
 		return
 	}
 	defer uresp.Body.Close()
 	if uresp.StatusCode != 200 {
+		countLoginFailed(s, r, "oauth_login:discord", "userinfo_failed")
 		unauthorized(w, "userinfo_failed")
 		return
 	}
 	ubody, _ := io.ReadAll(uresp.Body)
 	var du discordUser
 	if json.Unmarshal(ubody, &du) != nil || strings.TrimSpace(du.ID) == "" {
+		countLoginFailed(s, r, "oauth_login:discord", "userinfo_failed")
 		unauthorized(w, "userinfo_failed")
 		return
 	}
@@ -185,32 +191,35 @@ func (s *Service) handleDiscordCallbackGET(w http.ResponseWriter, r *http.Reques
 			return
 		}
 		userID = sd.LinkUserID
-		_ = s.svc.LinkProviderByIssuer(r.Context(), userID, issuer, "discord", du.ID, strptr(email))
+		s.logIfErr(r.Context(), "authkit: link provider failed", s.svc.LinkProviderByIssuer(r.Context(), userID, issuer, "discord", du.ID, strptr(email)), "user_id", userID, "issuer", issuer)
 		if strings.TrimSpace(preferred) != "" {
-			_ = s.svc.SetProviderUsername(r.Context(), userID, issuer, du.ID, preferred)
+			s.logIfErr(r.Context(), "authkit: set provider username failed", s.svc.SetProviderUsername(r.Context(), userID, issuer, du.ID, preferred), "user_id", userID, "issuer", issuer)
 		}
 	} else if uid, _, err := s.svc.GetProviderLinkByIssuer(r.Context(), issuer, du.ID); err == nil && uid != "" {
 		userID = uid
 	} else if email != "" {
 		if u, err := s.svc.GetUserByEmail(r.Context(), email); err == nil && u != nil {
 			userID = u.ID
-			_ = s.svc.LinkProviderByIssuer(r.Context(), u.ID, issuer, "discord", du.ID, strptr(email))
-			_ = s.svc.SetEmailVerified(r.Context(), u.ID, true)
-			_ = s.svc.SetProviderUsername(r.Context(), u.ID, issuer, du.ID, preferred)
+			s.logIfErr(r.Context(), "authkit: link provider failed", s.svc.LinkProviderByIssuer(r.Context(), u.ID, issuer, "discord", du.ID, strptr(email)), "user_id", u.ID, "issuer", issuer)
+			s.logIfErr(r.Context(), "authkit: mark email verified failed", s.svc.SetEmailVerified(r.Context(), u.ID, true), "user_id", u.ID)
+			s.logIfErr(r.Context(), "authkit: set provider username failed", s.svc.SetProviderUsername(r.Context(), u.ID, issuer, du.ID, preferred), "user_id", u.ID, "issuer", issuer)
 		}
 	}
 	if userID == "" {
 		username := s.svc.DeriveUsernameForOAuth(r.Context(), "discord", preferred, email, display)
-		if u, err := s.svc.CreateUser(r.Context(), email, username); err == nil && u != nil {
+		u, err := s.svc.CreateRegisteredUser(r.Context(), core.RegistrationAttempt{Email: email, InviteCode: sd.InviteCode}, username)
+		if err == nil && u != nil {
 			userID = u.ID
-			_ = s.svc.LinkProviderByIssuer(r.Context(), u.ID, issuer, "discord", du.ID, strptr(email))
+			s.logIfErr(r.Context(), "authkit: link provider failed", s.svc.LinkProviderByIssuer(r.Context(), u.ID, issuer, "discord", du.ID, strptr(email)), "user_id", u.ID, "issuer", issuer)
 			if email != "" {
-				_ = s.svc.SetEmailVerified(r.Context(), u.ID, true)
+				s.logIfErr(r.Context(), "authkit: mark email verified failed", s.svc.SetEmailVerified(r.Context(), u.ID, true), "user_id", u.ID)
 			}
-			_ = s.svc.SetProviderUsername(r.Context(), u.ID, issuer, du.ID, preferred)
+			s.logIfErr(r.Context(), "authkit: set provider username failed", s.svc.SetProviderUsername(r.Context(), u.ID, issuer, du.ID, preferred), "user_id", u.ID, "issuer", issuer)
 			created = true
 		} else {
-			serverErr(w, "user_creation_failed")
+			if !registrationDenied(w, err) {
+				serverErr(w, "user_creation_failed")
+			}
 			return
 		}
 	}
@@ -15,7 +15,7 @@ func (s *Service) handleEmailVerifyRequestPOST(w http.ResponseWriter, r *http.Re
 		serverErr(w, "email_verification_unavailable")
 		return
 	}
-	if !s.allow(r, RLEmailVerifyRequest) {
+	if !s.allow(w, r, RLEmailVerifyRequest) {
 		tooMany(w)
 		return
 	}
@@ -26,12 +26,16 @@ func (s *Service) handleEmailVerifyRequestPOST(w http.ResponseWriter, r *http.Re
 		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 		return
 	}
-	_ = s.svc.RequestEmailVerification(r.Context(), req.Email, 0)
+	if !s.allowTarget(w, r, RLEmailVerifyRequest, req.Email) {
+		tooMany(w)
+		return
+	}
+	s.logIfErr(r.Context(), "authkit: send email verification failed", s.svc.RequestEmailVerification(r.Context(), req.Email, 0))
 	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
 }
 
 func (s *Service) handleEmailVerifyConfirmPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLEmailVerifyConfirm) {
+	if !s.allow(w, r, RLEmailVerifyConfirm) {
 		tooMany(w)
 		return
 	}
@@ -58,6 +62,9 @@ func (s *Service) handleEmailVerifyConfirmPOST(w http.ResponseWriter, r *http.Re
 		}
 		return
 	}
+	if registrationDenied(w, err) {
+		return
+	}
 
 	userID, err = s.svc.ConfirmEmailVerification(r.Context(), code)
 	if err != nil {
@@ -6,7 +6,7 @@ import (
 )
 
 func (s *Service) handleEmailVerifyConfirmLinkPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLEmailVerifyConfirm) {
+	if !s.allow(w, r, RLEmailVerifyConfirm) {
 		tooMany(w)
 		return
 	}
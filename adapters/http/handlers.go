@@ -16,8 +16,8 @@ func (s *Service) APIHandler() http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { serverErr(w, "authkit_not_initialized") })
 	}
 	if !core.IsDevEnvironment() {
-		if s.svc.EphemeralMode() != core.EphemeralRedis {
-			panic("authkit: redis-compatible ephemeral store is required in production")
+		if !s.svc.EphemeralMode().Shared() {
+			panic("authkit: redis-compatible or postgres ephemeral store is required in production")
 		}
 	}
 
@@ -29,12 +29,14 @@ func (s *Service) APIHandler() http.Handler {
 
 	// Registration + login
 	mux.Handle("POST /auth/password/login", http.HandlerFunc(s.handlePasswordLoginPOST))
-	mux.Handle("POST /auth/register", http.HandlerFunc(s.handleRegisterUnifiedPOST))
+	mux.Handle("POST /auth/oidc/link/code", http.HandlerFunc(s.handleOIDCLinkCodePOST))
+	mux.Handle("POST /auth/oidc/link/confirm", http.HandlerFunc(s.handleOIDCLinkConfirmPOST))
+	mux.Handle("POST /auth/register", s.challenged(RLAuthRegister, http.HandlerFunc(s.handleRegisterUnifiedPOST)))
 	mux.Handle("POST /auth/register/resend-email", http.HandlerFunc(s.handlePendingRegistrationResendPOST))
 	mux.Handle("POST /auth/register/resend-phone", http.HandlerFunc(s.handlePhoneRegisterResendPOST))
 
 	// Email-based password reset and verification
-	mux.Handle("POST /auth/password/reset/request", http.HandlerFunc(s.handlePasswordResetRequestPOST))
+	mux.Handle("POST /auth/password/reset/request", s.challenged(RLPasswordResetRequest, http.HandlerFunc(s.handlePasswordResetRequestPOST)))
 	mux.Handle("POST /auth/password/reset/confirm", http.HandlerFunc(s.handlePasswordResetConfirmPOST))
 	mux.Handle("POST /auth/password/reset/confirm-link", http.HandlerFunc(s.handlePasswordResetConfirmLinkPOST))
 	mux.Handle("POST /auth/email/verify/request", http.HandlerFunc(s.handleEmailVerifyRequestPOST))
@@ -42,9 +44,9 @@ func (s *Service) APIHandler() http.Handler {
 	mux.Handle("POST /auth/email/verify/confirm-link", http.HandlerFunc(s.handleEmailVerifyConfirmLinkPOST))
 
 	// Phone-based password reset and verification
-	mux.Handle("POST /auth/phone/verify/request", http.HandlerFunc(s.handlePhoneVerifyRequestPOST))
+	mux.Handle("POST /auth/phone/verify/request", s.challenged(RLPhoneVerifyRequest, http.HandlerFunc(s.handlePhoneVerifyRequestPOST)))
 	mux.Handle("POST /auth/phone/verify/confirm", http.HandlerFunc(s.handlePhoneVerifyConfirmPOST))
-	mux.Handle("POST /auth/phone/password/reset/request", http.HandlerFunc(s.handlePhonePasswordResetRequestPOST))
+	mux.Handle("POST /auth/phone/password/reset/request", s.challenged(RLPasswordResetRequest, http.HandlerFunc(s.handlePhonePasswordResetRequestPOST)))
 	mux.Handle("POST /auth/phone/password/reset/confirm", http.HandlerFunc(s.handlePhonePasswordResetConfirmPOST))
 
 	required := Required(s.svc)
@@ -68,8 +70,13 @@ func (s *Service) APIHandler() http.Handler {
 	mux.Handle("POST /auth/user/phone/change/confirm", required(http.HandlerFunc(s.handleUserPhoneChangeConfirmPOST)))
 	mux.Handle("POST /auth/user/phone/change/resend", required(http.HandlerFunc(s.handleUserPhoneChangeResendPOST)))
 	mux.Handle("PATCH /auth/user/biography", required(http.HandlerFunc(s.handleUserBiographyPATCH)))
+	mux.Handle("PATCH /auth/user/metadata", required(http.HandlerFunc(s.handleUserMetadataPATCH)))
+	mux.Handle("POST /auth/user/export", required(http.HandlerFunc(s.handleUserExportPOST)))
+	mux.Handle("GET /auth/export/{token}", required(http.HandlerFunc(s.handleExportDownloadGET)))
 	mux.Handle("DELETE /auth/user", required(http.HandlerFunc(s.handleUserDeleteDELETE)))
 	mux.Handle("DELETE /auth/user/providers/{provider}", required(http.HandlerFunc(s.handleUserUnlinkProviderDELETE)))
+	mux.Handle("POST /auth/user/merge/start", required(http.HandlerFunc(s.handleUserMergeStartPOST)))
+	mux.Handle("POST /auth/user/merge/confirm", required(http.HandlerFunc(s.handleUserMergeConfirmPOST)))
 
 	// Two-Factor Authentication routes
 	mux.Handle("GET /auth/user/2fa", required(http.HandlerFunc(s.handleUser2FAStatusGET)))
@@ -82,10 +89,13 @@ func (s *Service) APIHandler() http.Handler {
 	mux.Handle("POST /auth/2fa/verify", http.HandlerFunc(s.handleUser2FAVerifyPOST))
 
 	// Solana SIWS authentication routes
-	mux.Handle("POST /auth/solana/challenge", http.HandlerFunc(s.handleSolanaChallengePOST))
+	mux.Handle("POST /auth/solana/challenge", s.challenged(RLSolanaChallenge, http.HandlerFunc(s.handleSolanaChallengePOST)))
 	mux.Handle("POST /auth/solana/login", http.HandlerFunc(s.handleSolanaLoginPOST))
 	mux.Handle("POST /auth/solana/link", required(http.HandlerFunc(s.handleSolanaLinkPOST)))
 
+	// Shared Signals receiver (SET push delivery from upstream IdPs)
+	mux.Handle("POST /auth/ssf/events", http.HandlerFunc(s.handleSSFEventsPOST))
+
 	// Admin routes
 	admin := func(h http.Handler) http.Handler { return required(RequireAdmin(s.svc.Postgres())(h)) }
 	mux.Handle("POST /auth/admin/roles/grant", admin(http.HandlerFunc(s.handleAdminRolesGrantPOST)))
@@ -101,9 +111,28 @@ func (s *Service) APIHandler() http.Handler {
 	mux.Handle("DELETE /auth/admin/users/{user_id}", admin(http.HandlerFunc(s.handleAdminUserDeleteDELETE)))
 	mux.Handle("POST /auth/admin/users/{user_id}/restore", admin(http.HandlerFunc(s.handleAdminUserRestorePOST)))
 	mux.Handle("GET /auth/admin/users/deleted", admin(http.HandlerFunc(s.handleAdminDeletedUsersListGET)))
+	mux.Handle("POST /auth/admin/users/merge", admin(http.HandlerFunc(s.handleAdminUsersMergePOST)))
 	mux.Handle("GET /auth/admin/users/{user_id}/signins", admin(http.HandlerFunc(s.handleAdminUserSigninsGET)))
-
-	h := http.Handler(mux)
+	mux.Handle("GET /auth/admin/users/{user_id}/messages", admin(http.HandlerFunc(s.handleAdminUserMessagesGET)))
+	mux.Handle("PATCH /auth/admin/users/{user_id}/metadata", admin(http.HandlerFunc(s.handleAdminUserMetadataPATCH)))
+	mux.Handle("GET /auth/admin/saml/connections", admin(http.HandlerFunc(s.handleAdminSAMLConnectionsGET)))
+	mux.Handle("PUT /auth/admin/saml/connections/{slug}", admin(http.HandlerFunc(s.handleAdminSAMLConnectionPUT)))
+	mux.Handle("DELETE /auth/admin/saml/connections/{slug}", admin(http.HandlerFunc(s.handleAdminSAMLConnectionDELETE)))
+	mux.Handle("GET /auth/admin/webhooks", admin(http.HandlerFunc(s.handleAdminWebhooksGET)))
+	mux.Handle("POST /auth/admin/webhooks", admin(http.HandlerFunc(s.handleAdminWebhooksPOST)))
+	mux.Handle("PATCH /auth/admin/webhooks/{endpoint_id}", admin(http.HandlerFunc(s.handleAdminWebhookPATCH)))
+	mux.Handle("DELETE /auth/admin/webhooks/{endpoint_id}", admin(http.HandlerFunc(s.handleAdminWebhookDELETE)))
+	mux.Handle("POST /auth/admin/webhooks/{endpoint_id}/rotate-secret", admin(http.HandlerFunc(s.handleAdminWebhookRotateSecretPOST)))
+	mux.Handle("GET /auth/admin/webhooks/{endpoint_id}/deliveries", admin(http.HandlerFunc(s.handleAdminWebhookDeliveriesGET)))
+	mux.Handle("POST /auth/admin/webhooks/{endpoint_id}/replay", admin(http.HandlerFunc(s.handleAdminWebhookReplayPOST)))
+	mux.Handle("POST /auth/admin/webhooks/deliveries/{delivery_id}/replay", admin(http.HandlerFunc(s.handleAdminWebhookDeliveryReplayPOST)))
+	mux.Handle("GET /auth/admin/invites", admin(http.HandlerFunc(s.handleAdminInvitesGET)))
+	mux.Handle("POST /auth/admin/invites", admin(http.HandlerFunc(s.handleAdminInvitesPOST)))
+	mux.Handle("DELETE /auth/admin/invites/{invite_id}", admin(http.HandlerFunc(s.handleAdminInviteDELETE)))
+
+	// Telemetry wraps the mux directly so it observes the matched route pattern.
+	h := s.svc.Telemetry().Middleware(mux)
 	h = LanguageMiddleware(s.langCfg)(h)
+	h = requestIDMiddleware(h)
 	return h
 }
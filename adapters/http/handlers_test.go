@@ -10,8 +10,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/open-rails/authkit/adapters/captcha"
 	core "github.com/open-rails/authkit/core"
 	jwtkit "github.com/open-rails/authkit/jwt"
+	memorylimiter "github.com/open-rails/authkit/ratelimit/memory"
+	memorystore "github.com/open-rails/authkit/storage/memory"
 	"github.com/stretchr/testify/require"
 )
 
@@ -55,6 +59,19 @@ func TestAPIHandler_Token_InvalidRequest(t *testing.T) {
 	require.Contains(t, w.Body.String(), `"error":"invalid_request"`)
 }
 
+func TestAPIHandler_ProductionRequiresSharedEphemeralStore(t *testing.T) {
+	t.Setenv("ENV", "production")
+	s := &Service{svc: newTestCoreService(t)}
+	require.Panics(t, func() { s.APIHandler() })
+
+	pool, err := pgxpool.New(context.Background(), "postgres://authkit@127.0.0.1:1/authkit")
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	s.WithPostgresEphemeralStore(pool)
+	require.Equal(t, core.EphemeralPostgres, s.svc.EphemeralMode())
+	require.NotPanics(t, func() { s.APIHandler() })
+}
+
 func TestAPIHandler_Logout_MissingSidClaim(t *testing.T) {
 	s := &Service{svc: newTestCoreService(t)}
 	h := s.APIHandler()
@@ -92,3 +109,119 @@ func TestAPIHandler_SolanaChallenge_InvalidRequest(t *testing.T) {
 	require.Equal(t, http.StatusBadRequest, w.Code)
 	require.Contains(t, w.Body.String(), `"error":"address_required"`)
 }
+
+func TestAPIHandler_OIDCLinkConfirm_UnknownToken(t *testing.T) {
+	s := &Service{svc: newTestCoreService(t)}
+	s.svc.WithEphemeralStore(memorystore.NewKV(), core.EphemeralMemory)
+	h := s.APIHandler()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/auth/oidc/link/confirm", strings.NewReader(`{"link_token":"nope","password":"pw"}`))
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), `"error":"invalid_or_expired_link"`)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/auth/oidc/link/confirm", strings.NewReader(`{"link_token":"nope"}`))
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), `"error":"invalid_request"`)
+}
+
+type stubChallengeVerifier struct{ calls int }
+
+func (v *stubChallengeVerifier) VerifyChallenge(_ context.Context, token, _ string) error {
+	v.calls++
+	if token != "solved" {
+		return captcha.ErrFailed
+	}
+	return nil
+}
+
+func TestChallenge_AlwaysAndAdaptive(t *testing.T) {
+	v := &stubChallengeVerifier{}
+	s := &Service{svc: newTestCoreService(t), clientIP: func(*http.Request) string { return "203.0.113.5" }}
+	s.WithChallenge(ChallengeConfig{Verifier: v, Endpoints: map[string]ChallengePolicy{
+		RLAuthRegister: {Mode: ChallengeAlways},
+	}})
+	h := s.APIHandler()
+	post := func(path, body string, hdr map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		for k, val := range hdr {
+			r.Header.Set(k, val)
+		}
+		h.ServeHTTP(w, r)
+		return w
+	}
+	register := `{"identifier":"nobody","username":"someone","password":"Correct-Horse-9"`
+
+	w := post("/auth/register", register+`}`, nil)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "challenge_required")
+
+	w = post("/auth/register", register+`,"captcha_token":"nope"}`, nil)
+	require.Contains(t, w.Body.String(), "challenge_failed")
+
+	// The body field is stripped, so strict decoding reaches identifier validation.
+	w = post("/auth/register", register+`,"captcha_token":"solved"}`, nil)
+	require.Contains(t, w.Body.String(), "invalid_identifier")
+	w = post("/auth/register", register+`}`, map[string]string{"X-Captcha-Token": "solved"})
+	require.Contains(t, w.Body.String(), "invalid_identifier")
+
+	// Adaptive: two failed requests from the same IP arm the challenge.
+	s.WithChallenge(ChallengeConfig{Verifier: v, Endpoints: map[string]ChallengePolicy{
+		RLAuthRegister: {Mode: ChallengeAdaptive, AfterFailures: 2},
+	}})
+	for i := 0; i < 2; i++ {
+		require.Contains(t, post("/auth/register", register+`}`, nil).Body.String(), "invalid_identifier")
+	}
+	require.Contains(t, post("/auth/register", register+`}`, nil).Body.String(), "challenge_required")
+	require.Contains(t, post("/auth/register", register+`,"captcha_token":"solved"}`, nil).Body.String(), "invalid_identifier")
+}
+
+func TestChallenge_RateLimitedBeforeVerify(t *testing.T) {
+	v := &stubChallengeVerifier{}
+	s := &Service{
+		svc:      newTestCoreService(t),
+		rl:       memorylimiter.NewGCRA(map[string]memorylimiter.Limit{RLAuthRegister: {Limit: 2, Window: time.Minute}}),
+		clientIP: func(*http.Request) string { return "203.0.113.6" },
+	}
+	s.WithChallenge(ChallengeConfig{Verifier: v, Endpoints: map[string]ChallengePolicy{
+		RLAuthRegister: {Mode: ChallengeAlways},
+	}})
+	h := s.APIHandler()
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(`{"identifier":"nobody","username":"someone","password":"Correct-Horse-9","captcha_token":"nope"}`)))
+		return w
+	}
+
+	// Each request is counted once even though the handler applies the bucket too.
+	for i := 0; i < 2; i++ {
+		require.Contains(t, post().Body.String(), "challenge_failed", "request %d", i)
+	}
+	require.Equal(t, http.StatusTooManyRequests, post().Code)
+	require.Equal(t, 2, v.calls)
+}
+
+func TestRegister_RegistrationPolicy(t *testing.T) {
+	svc := newTestCoreService(t).WithRegistrationPolicy(core.RegistrationPolicy{
+		Mode:                 core.RegistrationInviteOnly,
+		BlockDisposableEmail: true,
+	})
+	h := (&Service{svc: svc}).APIHandler()
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"identifier":"someone@yopmail.com","username":"someone","password":"Correct-Horse-9"}`)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "disposable_email_not_allowed")
+
+	w = post(`{"identifier":"someone@example.com","username":"someone","password":"Correct-Horse-9"}`)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "invite_required")
+}
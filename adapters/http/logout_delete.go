@@ -8,7 +8,7 @@ import (
 )
 
 func (s *Service) handleLogoutDELETE(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLAuthLogout) {
+	if !s.allow(w, r, RLAuthLogout) {
 		tooMany(w)
 		return
 	}
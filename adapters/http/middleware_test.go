@@ -12,6 +12,7 @@ import (
 	jwt "github.com/golang-jwt/jwt/v5"
 	core "github.com/open-rails/authkit/core"
 	jwtkit "github.com/open-rails/authkit/jwt"
+	memorylimiter "github.com/open-rails/authkit/ratelimit/memory"
 	"github.com/stretchr/testify/require"
 )
 
@@ -290,3 +291,84 @@ func TestRateLimiting_DefaultsEnabledAndOptOutWorks(t *testing.T) {
 	require.Equal(t, http.StatusTooManyRequests, w.Code)
 	require.JSONEq(t, `{"error":"rate_limited"}`, w.Body.String())
 }
+
+func TestRateLimitHeaders(t *testing.T) {
+	s := &Service{
+		svc:      newTestCoreService(t),
+		rl:       memorylimiter.NewGCRA(map[string]memorylimiter.Limit{RLAuthToken: {Limit: 2, Window: time.Minute}}),
+		clientIP: func(*http.Request) string { return "203.0.113.7" },
+	}
+	h := s.APIHandler()
+	do := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(`{}`)))
+		return w
+	}
+
+	w := do()
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, `"auth_token";q=2;w=60`, w.Header().Get("RateLimit-Policy"))
+	require.Equal(t, `"auth_token";r=1;t=30`, w.Header().Get("RateLimit"))
+	require.Empty(t, w.Header().Get("Retry-After"))
+
+	do()
+	w = do()
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, `"auth_token";r=0;t=60`, w.Header().Get("RateLimit"))
+	require.Equal(t, "30", w.Header().Get("Retry-After"))
+}
+
+func TestRateLimitKeys_TargetAcrossIPs(t *testing.T) {
+	ip := "203.0.113.1"
+	s := &Service{
+		svc: newTestCoreService(t),
+		rl: memorylimiter.NewGCRA(map[string]memorylimiter.Limit{
+			RLPasswordResetRequest:             {Limit: 100, Window: time.Minute},
+			RLPasswordResetRequest + ":target": {Limit: 2, Window: time.Hour},
+		}),
+		clientIP: func(*http.Request) string { return ip },
+	}
+	h := s.APIHandler()
+	reset := func(identifier string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/password/reset/request", strings.NewReader(`{"identifier":"`+identifier+`"}`)))
+		return w
+	}
+
+	for i, addr := range []string{"203.0.113.1", "203.0.113.2"} {
+		ip = addr
+		w := reset("Victim@Example.com")
+		require.NotEqual(t, http.StatusTooManyRequests, w.Code, "request %d", i)
+	}
+	ip = "203.0.113.3"
+	w := reset(" victim@example.com")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Contains(t, w.Header().Values("RateLimit-Policy"), `"auth_pwd_reset_request:target";q=2;w=3600`)
+	require.NotEqual(t, http.StatusTooManyRequests, reset("other@example.com").Code)
+}
+
+func TestRateLimitKeys_LoginPerIPAndTarget(t *testing.T) {
+	ip := "203.0.113.1"
+	s := &Service{
+		svc: newTestCoreService(t),
+		rl: memorylimiter.NewGCRA(map[string]memorylimiter.Limit{
+			RLPasswordLogin:                        {Limit: 100, Window: time.Minute},
+			LimitName(RLPasswordLogin, ByIPTarget): {Limit: 2, Window: time.Hour},
+		}),
+		clientIP: func(*http.Request) string { return ip },
+	}
+	h := s.APIHandler()
+	login := func(identifier string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/password/login", strings.NewReader(`{"login":"`+identifier+`","password":"wrong"}`)))
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		require.NotEqual(t, http.StatusTooManyRequests, login("victim").Code, "request %d", i)
+	}
+	require.Equal(t, http.StatusTooManyRequests, login("Victim").Code)
+	// Failed guesses from one client do not lock the account for everyone else.
+	ip = "203.0.113.2"
+	require.NotEqual(t, http.StatusTooManyRequests, login("victim").Code)
+}
@@ -14,7 +14,7 @@ import (
 )
 
 func (s *Service) handleOIDCLoginGET(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLOIDCStart) {
+	if !s.allow(w, r, RLOIDCStart) {
 		tooMany(w)
 		return
 	}
@@ -70,6 +70,7 @@ func (s *Service) handleOIDCLoginGET(w http.ResponseWriter, r *http.Request) {
 		LinkUserID:  linkUserID,
 		UI:          ui,
 		PopupNonce:  popupNonce,
+		InviteCode:  strings.TrimSpace(r.URL.Query().Get("invite")),
 	}); err != nil {
 		serverErr(w, "state_store_failed")
 		return
@@ -79,7 +80,7 @@ func (s *Service) handleOIDCLoginGET(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) handleOIDCCallbackGET(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLOIDCCallback) {
+	if !s.allow(w, r, RLOIDCCallback) {
 		tooMany(w)
 		return
 	}
@@ -98,8 +99,8 @@ func (s *Service) handleOIDCCallbackGET(w http.ResponseWriter, r *http.Request)
 	}
 
 	cfg := s.oidcCfg()
-	sd, ok, err := cfg.StateCache.Get(r.Context(), state)
-	_ = cfg.StateCache.Del(r.Context(), state)
+	sd, ok, err := oidckit.ConsumeState(r.Context(), cfg.StateCache, state)
+	s.logIfErr(r.Context(), "authkit: state consume failed", err)
 	if err != nil || !ok || sd.Provider != provider {
 		badRequest(w, "invalid_state")
 		return
@@ -119,6 +120,7 @@ func (s *Service) handleOIDCCallbackGET(w http.ResponseWriter, r *http.Request)
 	ex := oidckit.DefaultExchanger
 	claims, err := ex(r.Context(), rpClient, provider, code, sd.Verifier, sd.Nonce)
 	if err != nil {
+		countLoginFailed(s, r, "oidc_login", "oidc_exchange_failed")
 		unauthorized(w, "oidc_exchange_failed")
 		return
 	}
@@ -139,9 +141,9 @@ func (s *Service) handleOIDCCallbackGET(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		userID = sd.LinkUserID
-		_ = s.svc.LinkProviderByIssuer(r.Context(), userID, issuer, provider, claims.Subject, claims.Email)
+		s.logIfErr(r.Context(), "authkit: link provider failed", s.svc.LinkProviderByIssuer(r.Context(), userID, issuer, provider, claims.Subject, claims.Email), "user_id", userID, "issuer", issuer)
 		if strings.TrimSpace(provUsername) != "" {
-			_ = s.svc.SetProviderUsername(r.Context(), userID, issuer, claims.Subject, provUsername)
+			s.logIfErr(r.Context(), "authkit: set provider username failed", s.svc.SetProviderUsername(r.Context(), userID, issuer, claims.Subject, provUsername), "user_id", userID, "issuer", issuer)
 		}
 	} else if uid, provEmail, err := s.svc.GetProviderLink(r.Context(), provider, claims.Subject); err == nil && uid != "" {
 		userID = uid
@@ -149,46 +151,95 @@ func (s *Service) handleOIDCCallbackGET(w http.ResponseWriter, r *http.Request)
 			email = *provEmail
 		}
 		if strings.TrimSpace(provUsername) != "" {
-			_ = s.svc.SetProviderUsername(r.Context(), userID, issuer, claims.Subject, provUsername)
+			s.logIfErr(r.Context(), "authkit: set provider username failed", s.svc.SetProviderUsername(r.Context(), userID, issuer, claims.Subject, provUsername), "user_id", userID, "issuer", issuer)
 		}
 	} else {
-		matched := false
-		if claims.Email != nil && (claims.EmailVerified == nil || (claims.EmailVerified != nil && *claims.EmailVerified)) {
+		var existing *core.User
+		if email != "" {
 			if u, err := s.svc.GetUserByEmail(r.Context(), email); err == nil && u != nil {
-				userID = u.ID
-				matched = true
-				_ = s.svc.LinkProviderByIssuer(r.Context(), u.ID, issuer, provider, claims.Subject, claims.Email)
-				if claims.EmailVerified != nil && *claims.EmailVerified && provider != "discord" {
-					_ = s.svc.SetEmailVerified(r.Context(), u.ID, true)
-				}
-				if strings.TrimSpace(provUsername) != "" {
-					_ = s.svc.SetProviderUsername(r.Context(), userID, issuer, claims.Subject, provUsername)
-				}
+				existing = u
 			}
 		}
-		if !matched {
+		// Discord's verified flag is not trusted for account matching.
+		provVerified := claims.EmailVerified != nil && *claims.EmailVerified && provider != "discord"
+		switch {
+		case existing != nil && s.svc.CanAutoLinkOIDC(existing, provVerified):
+			userID = existing.ID
+			s.logIfErr(r.Context(), "authkit: link provider failed", s.svc.LinkProviderByIssuer(r.Context(), userID, issuer, provider, claims.Subject, claims.Email), "user_id", userID, "issuer", issuer)
+			if strings.TrimSpace(provUsername) != "" {
+				s.logIfErr(r.Context(), "authkit: set provider username failed", s.svc.SetProviderUsername(r.Context(), userID, issuer, claims.Subject, provUsername), "user_id", userID, "issuer", issuer)
+			}
+		case existing != nil && s.svc.OIDCLinkPolicy() == core.OIDCLinkRefuse:
+			sendErr(w, http.StatusConflict, "email_in_use")
+			return
+		case existing != nil:
+			// Prove control of the existing account before linking instead of creating
+			// a duplicate account for the same address.
+			s.beginPendingOIDCLink(w, r, core.PendingOIDCLink{
+				UserID:           existing.ID,
+				Provider:         provider,
+				Issuer:           issuer,
+				Subject:          claims.Subject,
+				Email:            email,
+				EmailVerified:    provVerified,
+				ProviderUsername: provUsername,
+			}, sd, state)
+			return
+		default:
 			displayName := ""
 			if claims.Name != nil {
 				displayName = *claims.Name
 			}
 			username := s.svc.DeriveUsernameForOAuth(r.Context(), provider, provUsername, email, displayName)
-			if u, err := s.svc.CreateUser(r.Context(), email, username); err == nil && u != nil {
-				userID = u.ID
-				if claims.EmailVerified != nil && *claims.EmailVerified && provider != "discord" {
-					_ = s.svc.SetEmailVerified(r.Context(), u.ID, true)
-				}
-				_ = s.svc.LinkProviderByIssuer(r.Context(), u.ID, issuer, provider, claims.Subject, claims.Email)
-				if strings.TrimSpace(provUsername) != "" {
-					_ = s.svc.SetProviderUsername(r.Context(), u.ID, issuer, claims.Subject, provUsername)
+			u, err := s.svc.CreateRegisteredUser(r.Context(), core.RegistrationAttempt{Email: email, InviteCode: sd.InviteCode}, username)
+			if err != nil || u == nil {
+				if !registrationDenied(w, err) {
+					serverErr(w, "user_creation_failed")
 				}
-				created = true
-			} else {
-				serverErr(w, "user_creation_failed")
 				return
 			}
+			userID = u.ID
+			if provVerified {
+				s.logIfErr(r.Context(), "authkit: mark email verified failed", s.svc.SetEmailVerified(r.Context(), u.ID, true), "user_id", u.ID)
+			}
+			s.logIfErr(r.Context(), "authkit: link provider failed", s.svc.LinkProviderByIssuer(r.Context(), u.ID, issuer, provider, claims.Subject, claims.Email), "user_id", u.ID, "issuer", issuer)
+			if strings.TrimSpace(provUsername) != "" {
+				s.logIfErr(r.Context(), "authkit: set provider username failed", s.svc.SetProviderUsername(r.Context(), u.ID, issuer, claims.Subject, provUsername), "user_id", u.ID, "issuer", issuer)
+			}
+			created = true
 		}
 	}
 
+	s.finishBrowserLogin(w, r, browserLogin{
+		UserID:     userID,
+		Email:      email,
+		Provider:   provider,
+		Method:     "oidc_login",
+		Created:    created,
+		UI:         sd.UI,
+		PopupNonce: sd.PopupNonce,
+		State:      state,
+	})
+}
+
+// browserLogin is the resolved outcome of a browser redirect flow (OIDC, SAML).
+type browserLogin struct {
+	UserID     string
+	Email      string
+	Provider   string
+	Method     string // session event method, e.g. "oidc_login"
+	Created    bool
+	UI         string
+	PopupNonce string
+	State      string
+	JSON       bool // always answer with JSON (API endpoints)
+}
+
+// finishBrowserLogin issues a session for a browser redirect flow and hands the tokens
+// back to the app: postMessage for popups, JSON when requested, otherwise a redirect
+// to BaseURL/auth/callback with the tokens in the fragment.
+func (s *Service) finishBrowserLogin(w http.ResponseWriter, r *http.Request, bl browserLogin) {
+	userID, email, provider := bl.UserID, bl.Email, bl.Provider
 	extra := map[string]any{"provider": provider}
 	sid, rt, _, err := s.svc.IssueRefreshSession(r.Context(), userID, r.UserAgent(), nil)
 	if err != nil {
@@ -213,13 +264,13 @@ func (s *Service) handleOIDCCallbackGET(w http.ResponseWriter, r *http.Request)
 	ua := r.UserAgent()
 	ip := clientIP(r)
 	uaPtr, ipPtr := &ua, &ip
-	s.svc.LogSessionCreated(r.Context(), userID, "oidc_login", sid, ipPtr, uaPtr)
+	s.svc.LogSessionCreated(r.Context(), userID, bl.Method, sid, ipPtr, uaPtr)
 
-	if created {
+	if bl.Created {
 		s.svc.SendWelcome(r.Context(), userID)
 	}
 
-	if sd.UI == "popup" {
+	if bl.UI == "popup" {
 		targetOrigin, ok := originFromBaseURL(s.svc.Options().BaseURL)
 		if !ok {
 			serverErr(w, "invalid_base_url")
@@ -231,18 +282,13 @@ func (s *Service) handleOIDCCallbackGET(w http.ResponseWriter, r *http.Request)
 			"refresh_token": rt,
 			"expires_in":    int64(time.Until(exp).Seconds()),
 			"provider":      provider,
-			"nonce":         sd.PopupNonce,
+			"nonce":         bl.PopupNonce,
 		}
-		b, _ := json.Marshal(payload)
-		html := buildPopupHTML(b, targetOrigin)
-		w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; base-uri 'none'; frame-ancestors 'none'")
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write(html)
+		writePopupHTML(w, payload, targetOrigin)
 		return
 	}
 
-	if strings.EqualFold(r.URL.Query().Get("format"), "json") || strings.Contains(r.Header.Get("Accept"), "application/json") {
+	if bl.JSON || wantsJSON(r) {
 		writeJSON(w, http.StatusOK, map[string]any{
 			"access_token":  token,
 			"token_type":    "Bearer",
@@ -257,11 +303,80 @@ func (s *Service) handleOIDCCallbackGET(w http.ResponseWriter, r *http.Request)
 	if base == "" {
 		base = "/"
 	}
-	frag := "#access_token=" + token + "&refresh_token=" + rt + "&expires_in=" + fmt.Sprint(int64(time.Until(exp).Seconds())) + "&provider=" + provider + "&state=" + state
+	frag := "#access_token=" + token + "&refresh_token=" + rt + "&expires_in=" + fmt.Sprint(int64(time.Until(exp).Seconds())) + "&provider=" + provider + "&state=" + bl.State
 	target := strings.TrimRight(base, "/") + "/auth/callback" + frag
 	http.Redirect(w, r, target, http.StatusFound)
 }
 
+// beginPendingOIDCLink stores a pending link and tells the frontend to confirm it via
+// POST /auth/oidc/link/confirm (after POST /auth/oidc/link/code for email_code).
+func (s *Service) beginPendingOIDCLink(w http.ResponseWriter, r *http.Request, link core.PendingOIDCLink, sd oidckit.StateData, state string) {
+	token, err := s.svc.CreatePendingOIDCLink(r.Context(), link)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.ErrUserBanned):
+			unauthorized(w, "user_banned")
+		case errors.Is(err, core.ErrLinkProofUnavailable):
+			sendErr(w, http.StatusConflict, "email_in_use")
+		default:
+			serverErr(w, "link_store_failed")
+		}
+		return
+	}
+	pending, err := s.svc.GetPendingOIDCLink(r.Context(), token)
+	if err != nil {
+		serverErr(w, "link_store_failed")
+		return
+	}
+
+	if sd.UI == "popup" {
+		targetOrigin, ok := originFromBaseURL(s.svc.Options().BaseURL)
+		if !ok {
+			serverErr(w, "invalid_base_url")
+			return
+		}
+		writePopupHTML(w, map[string]any{
+			"type":       "AUTHKIT_OIDC_LINK_REQUIRED",
+			"link_token": token,
+			"methods":    pending.Methods,
+			"provider":   link.Provider,
+			"email":      link.Email,
+			"nonce":      sd.PopupNonce,
+		}, targetOrigin)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error":      "link_confirmation_required",
+			"link_token": token,
+			"methods":    pending.Methods,
+			"provider":   link.Provider,
+			"email":      link.Email,
+		})
+		return
+	}
+
+	base := s.svc.Options().BaseURL
+	if base == "" {
+		base = "/"
+	}
+	frag := "#link_token=" + token + "&methods=" + strings.Join(pending.Methods, ",") + "&provider=" + link.Provider + "&state=" + state
+	http.Redirect(w, r, strings.TrimRight(base, "/")+"/auth/callback"+frag, http.StatusFound)
+}
+
+func wantsJSON(r *http.Request) bool {
+	return strings.EqualFold(r.URL.Query().Get("format"), "json") || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func writePopupHTML(w http.ResponseWriter, payload map[string]any, targetOrigin string) {
+	b, _ := json.Marshal(payload)
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; base-uri 'none'; frame-ancestors 'none'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buildPopupHTML(b, targetOrigin))
+}
+
 func buildPopupHTML(payloadJSON []byte, targetOrigin string) []byte {
 	originJSON, _ := json.Marshal(targetOrigin)
 	html := "<!doctype html><html><body><script>\n" +
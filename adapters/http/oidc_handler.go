@@ -11,6 +11,9 @@ import (
 // - GET /auth/oidc/{provider}/callback
 // - GET /auth/oauth/discord/login (if configured)
 // - GET /auth/oauth/discord/callback (if configured)
+// - GET /auth/saml/{connection}/metadata
+// - GET /auth/saml/{connection}/login
+// - POST /auth/saml/{connection}/callback
 func (s *Service) OIDCHandler() http.Handler {
 	if s == nil || s.svc == nil {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { serverErr(w, "authkit_not_initialized") })
@@ -23,9 +26,14 @@ func (s *Service) OIDCHandler() http.Handler {
 		mux.Handle("GET /auth/oauth/discord/login", http.HandlerFunc(s.handleDiscordLoginGET))
 		mux.Handle("GET /auth/oauth/discord/callback", http.HandlerFunc(s.handleDiscordCallbackGET))
 	}
+	mux.Handle("GET /auth/saml/{connection}/metadata", http.HandlerFunc(s.handleSAMLMetadataGET))
+	mux.Handle("GET /auth/saml/{connection}/login", http.HandlerFunc(s.handleSAMLLoginGET))
+	mux.Handle("POST /auth/saml/{connection}/callback", http.HandlerFunc(s.handleSAMLCallbackPOST))
 
-	h := http.Handler(mux)
+	// Telemetry wraps the mux directly so it observes the matched route pattern.
+	h := s.svc.Telemetry().Middleware(mux)
 	h = LanguageMiddleware(s.langCfg)(h)
+	h = requestIDMiddleware(h)
 	return h
 }
 
@@ -0,0 +1,87 @@
+package authhttp
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// handleOIDCLinkCodePOST emails a one-time code for a pending OIDC account link.
+func (s *Service) handleOIDCLinkCodePOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLOIDCLinkCode) {
+		tooMany(w)
+		return
+	}
+	var req struct {
+		LinkToken string `json:"link_token"`
+	}
+	if err := decodeJSON(r, &req); err != nil || strings.TrimSpace(req.LinkToken) == "" {
+		badRequest(w, "invalid_request")
+		return
+	}
+	if err := s.svc.SendPendingOIDCLinkCode(r.Context(), strings.TrimSpace(req.LinkToken)); err != nil {
+		if errors.Is(err, core.ErrLinkProofUnavailable) {
+			badRequest(w, "method_unavailable")
+			return
+		}
+		badRequest(w, "invalid_or_expired_link")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// handleOIDCLinkConfirmPOST completes a pending OIDC account link once the user proves
+// control of the existing account, then signs them in. Accounts with 2FA get a 2FA
+// challenge instead; the link is made only after POST /auth/2fa/verify succeeds.
+func (s *Service) handleOIDCLinkConfirmPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLOIDCLinkConfirm) {
+		tooMany(w)
+		return
+	}
+	var req struct {
+		LinkToken string `json:"link_token"`
+		Password  string `json:"password"`
+		Code      string `json:"code"`
+	}
+	if err := decodeJSON(r, &req); err != nil || strings.TrimSpace(req.LinkToken) == "" || (req.Password == "" && strings.TrimSpace(req.Code) == "") {
+		badRequest(w, "invalid_request")
+		return
+	}
+	linkToken := strings.TrimSpace(req.LinkToken)
+	link, err := s.svc.ConfirmPendingOIDCLink(r.Context(), linkToken, req.Password, req.Code)
+	if errors.Is(err, core.ErrLinkRequires2FA) {
+		// Nothing is linked yet: POST /auth/2fa/verify with link_token completes it.
+		settings, serr := s.svc.Get2FASettings(r.Context(), link.UserID)
+		if serr != nil {
+			serverErr(w, "2fa_lookup_failed")
+			return
+		}
+		s.begin2FAChallenge(w, r, link.UserID, settings.Method, map[string]any{"link_token": linkToken})
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, core.ErrInvalidCredentials):
+			unauthorized(w, "invalid_credentials")
+		case errors.Is(err, core.ErrLinkProofUnavailable):
+			badRequest(w, "method_unavailable")
+		case errors.Is(err, core.ErrUserBanned):
+			unauthorized(w, "user_banned")
+		case errors.Is(err, core.ErrProviderAlreadyLinked):
+			sendErr(w, http.StatusConflict, "provider_already_linked")
+		default:
+			badRequest(w, "invalid_or_expired_link")
+		}
+		return
+	}
+	email, _ := s.svc.GetEmailByUserID(r.Context(), link.UserID)
+	s.finishBrowserLogin(w, r, browserLogin{
+		UserID:   link.UserID,
+		Email:    email,
+		Provider: link.Provider,
+		Method:   "oidc_login",
+		JSON:     true,
+	})
+}
@@ -2,6 +2,7 @@ package authhttp
 
 import (
 	"net/http"
+	"time"
 
 	oidckit "github.com/open-rails/authkit/oidc"
 )
@@ -11,11 +12,15 @@ func (s *Service) oidcManager() *oidckit.Manager {
 	if providers == nil {
 		providers = map[string]oidckit.RPConfig{}
 	}
-	return oidckit.NewManagerFromMinimal(providers)
+	m := oidckit.NewManagerFromMinimal(providers)
+	if tel := s.svc.Telemetry(); tel != nil {
+		m = m.WithHTTPClient(tel.HTTPClient(&http.Client{Timeout: 30 * time.Second}))
+	}
+	return m
 }
 
 func (s *Service) handleOIDCLinkStartPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLOIDCStart) {
+	if !s.allow(w, r, RLOIDCStart) {
 		tooMany(w)
 		return
 	}
@@ -14,10 +14,8 @@ func randB64(n int) string {
 	return base64.RawURLEncoding.EncodeToString(b)
 }
 
-func buildRedirectURI(r *http.Request, provider string) string {
-	if r == nil {
-		return ""
-	}
+// requestOrigin returns scheme://host for the request, honoring X-Forwarded-Proto/Host.
+func requestOrigin(r *http.Request) string {
 	scheme := r.Header.Get("X-Forwarded-Proto")
 	host := r.Header.Get("X-Forwarded-Host")
 	if scheme == "" {
@@ -30,6 +28,13 @@ func buildRedirectURI(r *http.Request, provider string) string {
 	if host == "" {
 		host = r.Host
 	}
+	return scheme + "://" + host
+}
+
+func buildRedirectURI(r *http.Request, provider string) string {
+	if r == nil {
+		return ""
+	}
 
 	p := r.URL.Path
 	switch {
@@ -45,7 +50,7 @@ func buildRedirectURI(r *http.Request, provider string) string {
 			p = "/auth/oidc/" + provider + "/callback"
 		}
 	}
-	return scheme + "://" + host + p
+	return requestOrigin(r) + p
 }
 
 func originFromBaseURL(baseURL string) (origin string, ok bool) {
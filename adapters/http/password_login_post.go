@@ -11,7 +11,7 @@ import (
 )
 
 func (s *Service) handlePasswordLoginPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLPasswordLogin) {
+	if !s.allow(w, r, RLPasswordLogin) {
 		tooMany(w)
 		return
 	}
@@ -34,6 +34,51 @@ func (s *Service) handlePasswordLoginPOST(w http.ResponseWriter, r *http.Request
 		badRequest(w, "invalid_request")
 		return
 	}
+	if !s.allowTarget(w, r, RLPasswordLogin, identifier) {
+		tooMany(w)
+		return
+	}
+
+	// Directory-backed logins (LDAP/AD) take precedence; logins unknown to the
+	// directory, or not linked to it while it is down, fall through to local passwords.
+	if s.svc.HasExternalPasswordVerifier() && !strings.HasPrefix(identifier, "+") {
+		ext, err := s.svc.ExternalPasswordLogin(r.Context(), identifier, req.Password)
+		switch {
+		case err == nil:
+			if ext.Created {
+				s.svc.SendWelcome(r.Context(), ext.UserID)
+			}
+			s.finishPasswordLogin(w, r, ext.UserID, ext.Email, ext.Provider+"_login")
+			return
+		case errors.Is(err, core.ErrExternalUserNotFound):
+		case errors.Is(err, core.ErrUserBanned):
+			logLoginFailed(s, r, "", "user_banned")
+			unauthorized(w, "user_banned")
+			return
+		case errors.Is(err, core.ErrInvalidCredentials):
+			logLoginFailed(s, r, "", "invalid_credentials")
+			unauthorized(w, "invalid_credentials")
+			return
+		case errors.Is(err, core.ErrExternalEmailInUse):
+			logLoginFailed(s, r, "", "email_in_use")
+			sendErr(w, http.StatusConflict, "email_in_use")
+			return
+		case errors.Is(err, core.ErrRegistrationEmailDomain), errors.Is(err, core.ErrRegistrationDisposableEmail):
+			logLoginFailed(s, r, "", "registration_denied")
+			registrationDenied(w, err)
+			return
+		default:
+			// Only directory-linked accounts depend on the directory; everyone else keeps
+			// signing in with a local password during an outage.
+			if linked, lerr := s.svc.ExternalPasswordLinked(r.Context(), identifier); lerr != nil || linked {
+				s.logIfErr(r.Context(), "authkit: directory link lookup failed", lerr)
+				logLoginFailed(s, r, "", "directory_unavailable")
+				sendErr(w, http.StatusServiceUnavailable, "directory_unavailable")
+				return
+			}
+			s.logIfErr(r.Context(), "authkit: directory unavailable, using local password", err)
+		}
+	}
 
 	type userWithEmail struct {
 		ID            string
@@ -56,7 +101,8 @@ func (s *Service) handlePasswordLoginPOST(w http.ResponseWriter, r *http.Request
 		if e != nil || usr == nil {
 			if pending, perr := s.svc.GetPendingPhoneRegistrationByPhone(r.Context(), identifier); perr == nil && pending != nil {
 				if ok, verr := pwhash.VerifyArgon2id(pending.PasswordHash, req.Password); verr == nil && ok {
-					_, _ = s.svc.CreatePendingPhoneRegistration(r.Context(), identifier, pending.Username, pending.PasswordHash)
+					_, err := s.svc.CreatePendingPhoneRegistration(r.Context(), identifier, pending.Username, pending.PasswordHash)
+					s.logIfErr(r.Context(), "authkit: resend registration code failed", err)
 					unauthorized(w, "phone_not_verified")
 					return
 				}
@@ -101,7 +147,7 @@ func (s *Service) handlePasswordLoginPOST(w http.ResponseWriter, r *http.Request
 	if fetchedUser != nil && !fetchedUser.EmailVerified && fetchedUser.Email != nil && fetchedUser.CreatedAt.After(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
 		if s.svc.HasPassword(r.Context(), userID) {
 			if s.svc.HasEmailSender() {
-				_ = s.svc.RequestEmailVerification(r.Context(), *fetchedUser.Email, 0)
+				s.logIfErr(r.Context(), "authkit: send email verification failed", s.svc.RequestEmailVerification(r.Context(), *fetchedUser.Email, 0))
 				logLoginFailed(s, r, userID, "email_not_verified")
 				unauthorized(w, "email_not_verified")
 				return
@@ -112,7 +158,7 @@ func (s *Service) handlePasswordLoginPOST(w http.ResponseWriter, r *http.Request
 	if fetchedUser != nil && !fetchedUser.PhoneVerified && fetchedUser.PhoneNumber != nil && fetchedUser.CreatedAt.After(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
 		if s.svc.HasPassword(r.Context(), userID) {
 			if s.svc.HasSMSSender() {
-				_ = s.svc.SendPhoneVerificationToUser(r.Context(), *fetchedUser.PhoneNumber, userID, 0)
+				s.logIfErr(r.Context(), "authkit: send phone verification failed", s.svc.SendPhoneVerificationToUser(r.Context(), *fetchedUser.PhoneNumber, userID, 0))
 				logLoginFailed(s, r, userID, "phone_not_verified")
 				unauthorized(w, "phone_not_verified")
 				return
@@ -148,7 +194,8 @@ func (s *Service) handlePasswordLoginPOST(w http.ResponseWriter, r *http.Request
 			pendingUser, pendingErr := s.svc.GetPendingRegistrationByEmail(r.Context(), loginEmail)
 			if pendingErr == nil && pendingUser != nil {
 				if s.svc.VerifyPendingPassword(r.Context(), loginEmail, req.Password) {
-					_, _ = s.svc.CreatePendingRegistration(r.Context(), loginEmail, pendingUser.Username, pendingUser.PasswordHash, 0)
+					_, err := s.svc.CreatePendingRegistration(r.Context(), loginEmail, pendingUser.Username, pendingUser.PasswordHash, 0)
+					s.logIfErr(r.Context(), "authkit: resend registration code failed", err)
 					unauthorized(w, "email_not_verified")
 					return
 				}
@@ -170,47 +217,6 @@ func (s *Service) handlePasswordLoginPOST(w http.ResponseWriter, r *http.Request
 	}
 
 	if finalUserID != "" {
-		twoFASettings, twoFAErr := s.svc.Get2FASettings(r.Context(), finalUserID)
-		if twoFAErr == nil && twoFASettings != nil && twoFASettings.Enabled {
-			verificationID, err := s.svc.Require2FAForLogin(r.Context(), finalUserID)
-			if err != nil {
-				serverErr(w, "2fa_send_failed")
-				return
-			}
-			challenge, err := s.svc.Create2FAChallenge(r.Context(), finalUserID)
-			if err != nil {
-				serverErr(w, "2fa_challenge_failed")
-				return
-			}
-			obfuscatedID := verificationID
-			if len(verificationID) > 5 {
-				obfuscatedID = strings.Repeat("*", len(verificationID)-5) + verificationID[len(verificationID)-5:]
-			}
-			writeJSON(w, http.StatusOK, map[string]any{
-				"requires_2fa":    true,
-				"user_id":         finalUserID,
-				"method":          twoFASettings.Method,
-				"verification_id": obfuscatedID,
-				"challenge":       challenge,
-			})
-			return
-		}
-
-		sid, rt, _, err := s.svc.IssueRefreshSession(r.Context(), finalUserID, r.UserAgent(), nil)
-		if err != nil {
-			if errors.Is(err, core.ErrUserBanned) {
-				logLoginFailed(s, r, finalUserID, "user_banned")
-				unauthorized(w, "user_banned")
-				return
-			}
-			serverErr(w, "session_creation_failed")
-			return
-		}
-		ua := r.UserAgent()
-		ip := clientIP(r)
-		uaPtr, ipPtr := &ua, &ip
-		s.svc.LogSessionCreated(r.Context(), finalUserID, "password_login", sid, ipPtr, uaPtr)
-
 		emailForToken := ""
 		if fetchedUser != nil && fetchedUser.Email != nil {
 			emailForToken = *fetchedUser.Email
@@ -220,23 +226,7 @@ func (s *Service) handlePasswordLoginPOST(w http.ResponseWriter, r *http.Request
 				emailForToken = *usr.Email
 			}
 		}
-		token, exp, err = s.svc.IssueAccessToken(r.Context(), finalUserID, emailForToken, map[string]any{"sid": sid})
-		if err != nil {
-			if errors.Is(err, core.ErrUserBanned) {
-				logLoginFailed(s, r, finalUserID, "user_banned")
-				unauthorized(w, "user_banned")
-				return
-			}
-			serverErr(w, "token_issue_failed")
-			return
-		}
-
-		writeJSON(w, http.StatusOK, map[string]any{
-			"access_token":  token,
-			"token_type":    "Bearer",
-			"expires_in":    int64(time.Until(exp).Seconds()),
-			"refresh_token": rt,
-		})
+		s.finishPasswordLogin(w, r, finalUserID, emailForToken, "password_login")
 		return
 	}
 
@@ -246,3 +236,76 @@ func (s *Service) handlePasswordLoginPOST(w http.ResponseWriter, r *http.Request
 		"expires_in":   int64(time.Until(exp).Seconds()),
 	})
 }
+
+// begin2FAChallenge sends the login 2FA code and answers with the challenge the client
+// completes at POST /auth/2fa/verify. extra fields are added to the response.
+func (s *Service) begin2FAChallenge(w http.ResponseWriter, r *http.Request, userID, method string, extra map[string]any) {
+	verificationID, err := s.svc.Require2FAForLogin(r.Context(), userID)
+	if err != nil {
+		serverErr(w, "2fa_send_failed")
+		return
+	}
+	challenge, err := s.svc.Create2FAChallenge(r.Context(), userID)
+	if err != nil {
+		serverErr(w, "2fa_challenge_failed")
+		return
+	}
+	obfuscatedID := verificationID
+	if len(verificationID) > 5 {
+		obfuscatedID = strings.Repeat("*", len(verificationID)-5) + verificationID[len(verificationID)-5:]
+	}
+	resp := map[string]any{
+		"requires_2fa":    true,
+		"user_id":         userID,
+		"method":          method,
+		"verification_id": obfuscatedID,
+		"challenge":       challenge,
+	}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// finishPasswordLogin starts a 2FA challenge when enabled, otherwise issues a refresh
+// session and access token for a user whose password was verified.
+func (s *Service) finishPasswordLogin(w http.ResponseWriter, r *http.Request, userID, email, method string) {
+	twoFASettings, twoFAErr := s.svc.Get2FASettings(r.Context(), userID)
+	if twoFAErr == nil && twoFASettings != nil && twoFASettings.Enabled {
+		s.begin2FAChallenge(w, r, userID, twoFASettings.Method, nil)
+		return
+	}
+
+	sid, rt, _, err := s.svc.IssueRefreshSession(r.Context(), userID, r.UserAgent(), nil)
+	if err != nil {
+		if errors.Is(err, core.ErrUserBanned) {
+			logLoginFailed(s, r, userID, "user_banned")
+			unauthorized(w, "user_banned")
+			return
+		}
+		serverErr(w, "session_creation_failed")
+		return
+	}
+	ua := r.UserAgent()
+	ip := clientIP(r)
+	uaPtr, ipPtr := &ua, &ip
+	s.svc.LogSessionCreated(r.Context(), userID, method, sid, ipPtr, uaPtr)
+
+	token, exp, err := s.svc.IssueAccessToken(r.Context(), userID, email, map[string]any{"sid": sid})
+	if err != nil {
+		if errors.Is(err, core.ErrUserBanned) {
+			logLoginFailed(s, r, userID, "user_banned")
+			unauthorized(w, "user_banned")
+			return
+		}
+		serverErr(w, "token_issue_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token":  token,
+		"token_type":    "Bearer",
+		"expires_in":    int64(time.Until(exp).Seconds()),
+		"refresh_token": rt,
+	})
+}
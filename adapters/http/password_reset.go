@@ -11,7 +11,7 @@ import (
 var reE164 = regexp.MustCompile(`^\+[1-9]\d{1,14}$`)
 
 func (s *Service) handlePasswordResetRequestPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLPasswordResetRequest) {
+	if !s.allow(w, r, RLPasswordResetRequest) {
 		tooMany(w)
 		return
 	}
@@ -29,6 +29,10 @@ func (s *Service) handlePasswordResetRequestPOST(w http.ResponseWriter, r *http.
 		writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
 		return
 	}
+	if !s.allowTarget(w, r, RLPasswordResetRequest, identifier) {
+		tooMany(w)
+		return
+	}
 
 	isPhone := reE164.MatchString(identifier)
 	if isPhone {
@@ -36,20 +40,20 @@ func (s *Service) handlePasswordResetRequestPOST(w http.ResponseWriter, r *http.
 			serverErr(w, "sms_unavailable")
 			return
 		}
-		_ = s.svc.RequestPhonePasswordReset(r.Context(), identifier, 0)
+		s.logIfErr(r.Context(), "authkit: phone password reset request failed", s.svc.RequestPhonePasswordReset(r.Context(), identifier, 0))
 	} else {
 		if !s.svc.HasEmailSender() {
 			serverErr(w, "email_password_reset_unavailable")
 			return
 		}
-		_ = s.svc.RequestPasswordReset(r.Context(), identifier, 0)
+		s.logIfErr(r.Context(), "authkit: password reset request failed", s.svc.RequestPasswordReset(r.Context(), identifier, 0))
 	}
 
 	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "message": "If this email or phone number is registered, password reset instructions will be sent."})
 }
 
 func (s *Service) handlePasswordResetConfirmPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLPasswordResetConfirm) {
+	if !s.allow(w, r, RLPasswordResetConfirm) {
 		tooMany(w)
 		return
 	}
@@ -82,7 +86,7 @@ func (s *Service) handlePasswordResetConfirmPOST(w http.ResponseWriter, r *http.
 }
 
 func (s *Service) handlePasswordResetConfirmLinkPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLPasswordResetConfirm) {
+	if !s.allow(w, r, RLPasswordResetConfirm) {
 		tooMany(w)
 		return
 	}
@@ -12,7 +12,7 @@ func (s *Service) handlePhonePasswordResetRequestPOST(w http.ResponseWriter, r *
 		serverErr(w, "sms_unavailable")
 		return
 	}
-	if !s.allow(r, RLPasswordResetRequest) {
+	if !s.allow(w, r, RLPasswordResetRequest) {
 		tooMany(w)
 		return
 	}
@@ -29,7 +29,11 @@ func (s *Service) handlePhonePasswordResetRequestPOST(w http.ResponseWriter, r *
 		badRequest(w, "invalid_phone_number")
 		return
 	}
-	_ = s.svc.RequestPhonePasswordReset(r.Context(), phone, 0)
+	if !s.allowTarget(w, r, RLPasswordResetRequest, phone) {
+		tooMany(w)
+		return
+	}
+	s.logIfErr(r.Context(), "authkit: phone password reset request failed", s.svc.RequestPhonePasswordReset(r.Context(), phone, 0))
 	writeJSON(w, http.StatusAccepted, map[string]any{
 		"ok":      true,
 		"message": "If this phone number is registered, password reset instructions will be sent via SMS.",
@@ -37,7 +41,7 @@ func (s *Service) handlePhonePasswordResetRequestPOST(w http.ResponseWriter, r *
 }
 
 func (s *Service) handlePhonePasswordResetConfirmPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLPasswordResetConfirm) {
+	if !s.allow(w, r, RLPasswordResetConfirm) {
 		tooMany(w)
 		return
 	}
@@ -10,7 +10,7 @@ func (s *Service) handlePhoneVerifyRequestPOST(w http.ResponseWriter, r *http.Re
 		serverErr(w, "phone_verification_unavailable")
 		return
 	}
-	if !s.allow(r, RLPhoneVerifyRequest) {
+	if !s.allow(w, r, RLPhoneVerifyRequest) {
 		tooMany(w)
 		return
 	}
@@ -28,13 +28,17 @@ func (s *Service) handlePhoneVerifyRequestPOST(w http.ResponseWriter, r *http.Re
 		writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
 		return
 	}
+	if !s.allowTarget(w, r, RLPhoneVerifyRequest, phone) {
+		tooMany(w)
+		return
+	}
 
-	_ = s.svc.RequestPhoneVerification(r.Context(), phone, 0)
+	s.logIfErr(r.Context(), "authkit: send phone verification failed", s.svc.RequestPhoneVerification(r.Context(), phone, 0))
 	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
 }
 
 func (s *Service) handlePhoneVerifyConfirmPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLEmailVerifyConfirm) {
+	if !s.allow(w, r, RLEmailVerifyConfirm) {
 		tooMany(w)
 		return
 	}
@@ -57,6 +61,9 @@ func (s *Service) handlePhoneVerifyConfirmPOST(w http.ResponseWriter, r *http.Re
 
 	userID, err := s.svc.ConfirmPendingPhoneRegistration(r.Context(), phone, code)
 	if err != nil {
+		if registrationDenied(w, err) {
+			return
+		}
 		badRequest(w, "invalid_or_expired_code")
 		return
 	}
@@ -3,6 +3,10 @@ package authhttp
 import (
 	"net"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/open-rails/authkit/ratelimit"
 )
 
 // RateLimiter is a minimal interface used by adapters.
@@ -10,6 +14,34 @@ type RateLimiter interface {
 	AllowNamed(bucket string, key string) (bool, error)
 }
 
+// DetailedRateLimiter is an optional RateLimiter extension that reports the remaining
+// quota. With it, rate-limited routes send RateLimit-Policy and RateLimit headers, and
+// 429 responses send Retry-After. memorylimiter.NewGCRA and redislimiter.NewGCRA
+// implement it.
+type DetailedRateLimiter interface {
+	RateLimiter
+	AllowNamedDetailed(bucket string, key string) (ratelimit.Result, error)
+}
+
+// setRateLimitHeaders adds the IETF RateLimit header fields for bucket, naming the
+// policy after the bucket. A request checked against several limits lists each of them.
+func setRateLimitHeaders(w http.ResponseWriter, bucket string, res ratelimit.Result) {
+	h := w.Header()
+	h.Add("RateLimit-Policy", strconv.Quote(bucket)+";q="+strconv.Itoa(res.Limit)+";w="+strconv.FormatInt(ceilSeconds(res.Window), 10))
+	h.Add("RateLimit", strconv.Quote(bucket)+";r="+strconv.Itoa(res.Remaining)+";t="+strconv.FormatInt(ceilSeconds(res.Reset), 10))
+	if !res.Allowed {
+		retry := max(ceilSeconds(res.RetryAfter), 1)
+		if prev, err := strconv.ParseInt(h.Get("Retry-After"), 10, 64); err == nil && prev > retry {
+			retry = prev
+		}
+		h.Set("Retry-After", strconv.FormatInt(retry, 10))
+	}
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
 // AllowNamed applies a per-IP limit using the provided bucket name.
 // It fails open on limiter error.
 func AllowNamed(r *http.Request, rl RateLimiter, bucket string) bool {
@@ -15,8 +15,10 @@ type Limit struct {
 
 // DefaultRateLimits returns AuthKit's built-in per-endpoint rate limits.
 //
-// These limits are enforced per client IP (as determined by the Service's ClientIPFunc).
-// Hosts can override by supplying their own limiter via WithRateLimiter(...).
+// Bucket names are enforced per client IP (as determined by the Service's ClientIPFunc).
+// Names of the form "<bucket>:<strategy>" hold the additional per-target or per-user
+// limits from DefaultRateLimitKeys. Hosts can override by supplying their own limiter via
+// WithRateLimiter(...).
 func DefaultRateLimits() map[string]Limit {
 	return map[string]Limit{
 		"default": {Limit: 120, Window: time.Minute},
@@ -58,16 +60,46 @@ func DefaultRateLimits() map[string]Limit {
 		RLUserPhoneChangeResend:  {Limit: 3, Window: 10 * time.Minute},
 		RLUserDelete:             {Limit: 6, Window: time.Hour},
 		RLUserUnlinkProvider:     {Limit: 12, Window: time.Hour},
+		RLUserMerge:              {Limit: 6, Window: time.Hour},
+		RLUserMetadata:           {Limit: 60, Window: time.Hour},
+		RLUserExport:             {Limit: 3, Window: 24 * time.Hour},
+		RLExportDownload:         {Limit: 30, Window: time.Hour},
 
 		// OIDC / OAuth browser flows
-		RLOIDCStart:    {Limit: 30, Window: 10 * time.Minute},
-		RLOIDCCallback: {Limit: 60, Window: 10 * time.Minute},
+		RLOIDCStart:       {Limit: 30, Window: 10 * time.Minute},
+		RLOIDCCallback:    {Limit: 60, Window: 10 * time.Minute},
+		RLOIDCLinkCode:    {Limit: 6, Window: 10 * time.Minute},
+		RLOIDCLinkConfirm: {Limit: 10, Window: 10 * time.Minute},
+
+		// SAML browser flows
+		RLSAMLStart:    {Limit: 30, Window: 10 * time.Minute},
+		RLSAMLCallback: {Limit: 60, Window: 10 * time.Minute},
 
 		// Solana SIWS
 		RLSolanaChallenge: {Limit: 30, Window: 10 * time.Minute},
 		RLSolanaLogin:     {Limit: 20, Window: 10 * time.Minute},
 		RLSolanaLink:      {Limit: 12, Window: time.Hour},
 
+		// SCIM provisioning (directory syncs are bursty)
+		RLSCIM: {Limit: 600, Window: time.Minute},
+
+		// SET push delivery (transmitters batch on incidents)
+		RLSSFEvents: {Limit: 600, Window: time.Minute},
+
+		// Per-target limits (DefaultRateLimitKeys): bound how often one email or phone
+		// is targeted, however many IPs the requests come from. Login guesses are counted
+		// per IP and login, so failed attempts from elsewhere cannot lock the user out.
+		RLPasswordLogin + ":ip+target":        {Limit: 10, Window: 15 * time.Minute},
+		RLPasswordResetRequest + ":target":    {Limit: 5, Window: time.Hour},
+		RLEmailVerifyRequest + ":target":      {Limit: 5, Window: time.Hour},
+		RLPhoneVerifyRequest + ":target":      {Limit: 5, Window: time.Hour},
+		RLAuthRegisterResendEmail + ":target": {Limit: 5, Window: time.Hour},
+		RLAuthRegisterResendPhone + ":target": {Limit: 5, Window: time.Hour},
+		RLUserEmailChangeRequest + ":user":    {Limit: 6, Window: time.Hour},
+		RLUserEmailChangeRequest + ":target":  {Limit: 5, Window: time.Hour},
+		RLUserPhoneChangeRequest + ":user":    {Limit: 3, Window: 10 * time.Minute},
+		RLUserPhoneChangeRequest + ":target":  {Limit: 5, Window: time.Hour},
+
 		// Two-factor setup + verify
 		RL2FAStartPhone:      {Limit: 3, Window: 10 * time.Minute},
 		RL2FAEnable:          {Limit: 6, Window: time.Hour},
@@ -80,6 +112,11 @@ func DefaultRateLimits() map[string]Limit {
 		RLAdminRolesRevoke:           {Limit: 30, Window: time.Hour},
 		RLAdminUserSessionsList:      {Limit: 600, Window: time.Hour},
 		RLAdminUserSessionsRevokeAll: {Limit: 30, Window: time.Hour},
+		RLAdminSAMLConnections:       {Limit: 120, Window: time.Hour},
+		RLAdminUsersMerge:            {Limit: 30, Window: time.Hour},
+		RLAdminWebhooks:              {Limit: 240, Window: time.Hour},
+		RLAdminInvites:               {Limit: 240, Window: time.Hour},
+		RLAdminUserMetadata:          {Limit: 600, Window: time.Hour},
 	}
 }
 
@@ -0,0 +1,174 @@
+package authhttp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// RateKey is one component of a rate limit key.
+type RateKey string
+
+const (
+	// RateKeyIP counts by client IP (see WithClientIPFunc).
+	RateKeyIP RateKey = "ip"
+	// RateKeyUser counts by authenticated user ID; skipped for anonymous requests.
+	RateKeyUser RateKey = "user"
+	// RateKeyTarget counts by the normalized email, phone or login a request acts on,
+	// so rotating IPs cannot hammer one account. Targets are hashed in limiter keys.
+	RateKeyTarget RateKey = "target"
+)
+
+// KeyStrategy lists the components one limit counts requests by. Several components form
+// a composite key: {RateKeyIP, RateKeyTarget} limits each client IP per target.
+type KeyStrategy []RateKey
+
+var (
+	ByIP       = KeyStrategy{RateKeyIP}
+	ByUser     = KeyStrategy{RateKeyUser}
+	ByTarget   = KeyStrategy{RateKeyTarget}
+	ByIPTarget = KeyStrategy{RateKeyIP, RateKeyTarget}
+)
+
+func (k KeyStrategy) String() string {
+	parts := make([]string, len(k))
+	for i, p := range k {
+		parts[i] = string(p)
+	}
+	return strings.Join(parts, "+")
+}
+
+func (k KeyStrategy) hasTarget() bool {
+	for _, p := range k {
+		if p == RateKeyTarget {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitName is the limiter bucket name for one strategy of bucket: the bucket itself for
+// ByIP, otherwise "<bucket>:<strategy>", e.g. "auth_pwd_reset_request:target".
+// Configure its Limit in the map passed to the limiter.
+func LimitName(bucket string, k KeyStrategy) string {
+	if k.String() == string(RateKeyIP) {
+		return bucket
+	}
+	return bucket + ":" + k.String()
+}
+
+// DefaultRateLimitKeys returns the built-in key strategies. Buckets that are not listed
+// are limited per IP only. Every strategy is enforced; a request must pass all of them.
+// Password login is limited per IP and target together rather than per target alone,
+// which would let anyone lock a user out by failing logins against their account.
+func DefaultRateLimitKeys() map[string][]KeyStrategy {
+	ipAndTarget := []KeyStrategy{ByIP, ByTarget}
+	return map[string][]KeyStrategy{
+		RLPasswordLogin:           {ByIP, ByIPTarget},
+		RLPasswordResetRequest:    ipAndTarget,
+		RLEmailVerifyRequest:      ipAndTarget,
+		RLPhoneVerifyRequest:      ipAndTarget,
+		RLAuthRegisterResendEmail: ipAndTarget,
+		RLAuthRegisterResendPhone: ipAndTarget,
+		RLUserEmailChangeRequest:  {ByUser, ByTarget},
+		RLUserPhoneChangeRequest:  {ByUser, ByTarget},
+	}
+}
+
+var defaultRateLimitKeys = DefaultRateLimitKeys()
+
+// WithRateLimitKeys sets the key strategies for the given buckets, replacing the
+// defaults for those buckets only. Give per-target and composite strategies a Limit under
+// LimitName(bucket, strategy); unknown names fall back to the limiter's "default".
+func (s *Service) WithRateLimitKeys(keys map[string][]KeyStrategy) *Service {
+	if s.rlKeys == nil {
+		s.rlKeys = make(map[string][]KeyStrategy, len(keys))
+	}
+	for bucket, ks := range keys {
+		s.rlKeys[bucket] = ks
+	}
+	return s
+}
+
+func (s *Service) keyStrategies(bucket string) []KeyStrategy {
+	if ks, ok := s.rlKeys[bucket]; ok {
+		return ks
+	}
+	if ks, ok := defaultRateLimitKeys[bucket]; ok {
+		return ks
+	}
+	return []KeyStrategy{ByIP}
+}
+
+// allow applies bucket's IP and user limits; target limits are applied by allowTarget
+// once the handler has read the target from the body. It writes RateLimit headers to w
+// when the limiter reports quota.
+func (s *Service) allow(w http.ResponseWriter, r *http.Request, bucket string) bool {
+	if s == nil || s.rl == nil {
+		return true
+	}
+	if b, _ := r.Context().Value(bucketAllowedKey{}).(string); b == bucket {
+		return true
+	}
+	for _, k := range s.keyStrategies(bucket) {
+		if k.hasTarget() {
+			continue
+		}
+		if !s.allowKey(w, r, bucket, k, "") {
+			return false
+		}
+	}
+	return true
+}
+
+// allowTarget applies bucket's limits that include RateKeyTarget for target (an email,
+// phone number or login). An empty target is not limited.
+func (s *Service) allowTarget(w http.ResponseWriter, r *http.Request, bucket, target string) bool {
+	if s == nil || s.rl == nil {
+		return true
+	}
+	target = strings.ToLower(strings.TrimSpace(target))
+	if target == "" {
+		return true
+	}
+	for _, k := range s.keyStrategies(bucket) {
+		if !k.hasTarget() {
+			continue
+		}
+		if !s.allowKey(w, r, bucket, k, target) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowKey builds the limiter key for strategy k and applies it. Strategies whose
+// components are unavailable (no client IP, anonymous user) are skipped.
+func (s *Service) allowKey(w http.ResponseWriter, r *http.Request, bucket string, k KeyStrategy, target string) bool {
+	values := make([]string, 0, len(k))
+	for _, p := range k {
+		var v string
+		switch p {
+		case RateKeyIP:
+			ipFn := s.clientIP
+			if ipFn == nil {
+				ipFn = DefaultClientIP()
+			}
+			v = strings.TrimSpace(ipFn(r))
+		case RateKeyUser:
+			if cl, ok := ClaimsFromContext(r.Context()); ok {
+				v = cl.UserID
+			}
+		case RateKeyTarget:
+			sum := sha256.Sum256([]byte(target))
+			v = hex.EncodeToString(sum[:16])
+		}
+		if v == "" {
+			return true
+		}
+		values = append(values, v)
+	}
+	key := "auth:" + bucket + ":" + k.String() + ":" + strings.Join(values, "|")
+	return s.limit(w, r, LimitName(bucket, k), key)
+}
@@ -1,14 +1,34 @@
 package authhttp
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
+	core "github.com/open-rails/authkit/core"
 	pwhash "github.com/open-rails/authkit/password"
 )
 
+// registrationDenied answers 403 with the policy code when err is a RegistrationPolicy
+// rejection and reports whether it did.
+func registrationDenied(w http.ResponseWriter, err error) bool {
+	for _, denied := range []error{
+		core.ErrRegistrationInviteRequired,
+		core.ErrRegistrationInviteInvalid,
+		core.ErrRegistrationEmailDomain,
+		core.ErrRegistrationDisposableEmail,
+		core.ErrRegistrationPhoneCountry,
+	} {
+		if errors.Is(err, denied) {
+			forbidden(w, denied.Error())
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Service) handleRegisterUnifiedPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLAuthRegister) {
+	if !s.allow(w, r, RLAuthRegister) {
 		tooMany(w)
 		return
 	}
@@ -17,6 +37,7 @@ func (s *Service) handleRegisterUnifiedPOST(w http.ResponseWriter, r *http.Reque
 		Identifier string `json:"identifier"`
 		Username   string `json:"username"`
 		Password   string `json:"password"`
+		InviteCode string `json:"invite_code"`
 	}
 	if err := decodeJSON(r, &req); err != nil {
 		badRequest(w, "invalid_request")
@@ -35,6 +56,12 @@ func (s *Service) handleRegisterUnifiedPOST(w http.ResponseWriter, r *http.Reque
 		badRequest(w, err.Error())
 		return
 	}
+	if err := s.svc.CheckUsername(r.Context(), "", username); err != nil {
+		if !usernameRefused(w, err) {
+			serverErr(w, "database_error")
+		}
+		return
+	}
 
 	isPhone := reE164.MatchString(identifier)
 	isEmail := strings.Contains(identifier, "@")
@@ -47,6 +74,20 @@ func (s *Service) handleRegisterUnifiedPOST(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	attempt := core.RegistrationAttempt{InviteCode: req.InviteCode}
+	if isPhone {
+		attempt.Phone = identifier
+	} else {
+		attempt.Email = identifier
+	}
+	if err := s.svc.CheckRegistration(r.Context(), attempt); err != nil {
+		if !registrationDenied(w, err) {
+			serverErr(w, "registration_failed")
+		}
+		return
+	}
+	ctx := core.WithRegistrationInvite(r.Context(), req.InviteCode)
+
 	phc, err := pwhash.HashArgon2id(pass)
 	if err != nil {
 		serverErr(w, "hash_failed")
@@ -71,7 +112,7 @@ func (s *Service) handleRegisterUnifiedPOST(w http.ResponseWriter, r *http.Reque
 			badRequest(w, "username_in_use")
 			return
 		}
-		_, err = s.svc.CreatePendingPhoneRegistration(r.Context(), identifier, username, phc)
+		_, err = s.svc.CreatePendingPhoneRegistration(ctx, identifier, username, phc)
 		if err != nil {
 			serverErr(w, "registration_failed")
 			return
@@ -101,7 +142,7 @@ func (s *Service) handleRegisterUnifiedPOST(w http.ResponseWriter, r *http.Reque
 		badRequest(w, "username_in_use")
 		return
 	}
-	_, err = s.svc.CreatePendingRegistration(r.Context(), identifier, username, phc, 0)
+	_, err = s.svc.CreatePendingRegistration(ctx, identifier, username, phc, 0)
 	if err != nil {
 		serverErr(w, "registration_failed")
 		return
@@ -118,7 +159,7 @@ func (s *Service) handlePendingRegistrationResendPOST(w http.ResponseWriter, r *
 		serverErr(w, "email_unavailable")
 		return
 	}
-	if !s.allow(r, RLAuthRegisterResendEmail) {
+	if !s.allow(w, r, RLAuthRegisterResendEmail) {
 		tooMany(w)
 		return
 	}
@@ -131,10 +172,15 @@ func (s *Service) handlePendingRegistrationResendPOST(w http.ResponseWriter, r *
 		return
 	}
 	email := strings.TrimSpace(req.Email)
+	if !s.allowTarget(w, r, RLAuthRegisterResendEmail, email) {
+		tooMany(w)
+		return
+	}
 
 	pendingUser, err := s.svc.GetPendingRegistrationByEmail(r.Context(), email)
 	if err == nil && pendingUser != nil {
-		_, _ = s.svc.CreatePendingRegistration(r.Context(), email, pendingUser.Username, pendingUser.PasswordHash, 0)
+		_, err := s.svc.CreatePendingRegistration(r.Context(), email, pendingUser.Username, pendingUser.PasswordHash, 0)
+		s.logIfErr(r.Context(), "authkit: resend registration code failed", err)
 	}
 
 	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "message": "If a pending registration exists, a new code has been sent."})
@@ -145,7 +191,7 @@ func (s *Service) handlePhoneRegisterResendPOST(w http.ResponseWriter, r *http.R
 		serverErr(w, "phone_unavailable")
 		return
 	}
-	if !s.allow(r, RLAuthRegisterResendPhone) {
+	if !s.allow(w, r, RLAuthRegisterResendPhone) {
 		tooMany(w)
 		return
 	}
@@ -162,10 +208,15 @@ func (s *Service) handlePhoneRegisterResendPOST(w http.ResponseWriter, r *http.R
 		writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
 		return
 	}
+	if !s.allowTarget(w, r, RLAuthRegisterResendPhone, phone) {
+		tooMany(w)
+		return
+	}
 
 	pending, err := s.svc.GetPendingPhoneRegistrationByPhone(r.Context(), phone)
 	if err == nil && pending != nil {
-		_, _ = s.svc.CreatePendingPhoneRegistration(r.Context(), phone, pending.Username, pending.PasswordHash)
+		_, err := s.svc.CreatePendingPhoneRegistration(r.Context(), phone, pending.Username, pending.PasswordHash)
+		s.logIfErr(r.Context(), "authkit: resend registration code failed", err)
 	}
 
 	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "message": "If a pending registration exists, a new code has been sent."})
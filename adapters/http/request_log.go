@@ -0,0 +1,34 @@
+package authhttp
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+const maxRequestIDLen = 128
+
+// requestIDMiddleware attaches a request ID (the inbound X-Request-ID, or a generated one)
+// to every log record emitted while serving the request and echoes it in the response.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSpace(r.Header.Get("X-Request-ID"))
+		if id == "" || len(id) > maxRequestIDLen {
+			id = randB64(12)
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := core.ContextWithLogAttrs(r.Context(), slog.String("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// logIfErr logs an error that the handler deliberately does not surface to the client.
+func (s *Service) logIfErr(ctx context.Context, msg string, err error, args ...any) {
+	if err == nil {
+		return
+	}
+	s.svc.Logger().WarnContext(ctx, msg, append(args, slog.Any("error", err))...)
+}
@@ -0,0 +1,321 @@
+package authhttp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/crewjam/saml"
+	jwt "github.com/golang-jwt/jwt/v5"
+	core "github.com/open-rails/authkit/core"
+	oidckit "github.com/open-rails/authkit/oidc"
+	samlkit "github.com/open-rails/authkit/saml"
+)
+
+// samlStateProvider namespaces SAML relay states in the shared OIDC state cache.
+func samlStateProvider(slug string) string { return "saml:" + slug }
+
+// samlCredentials returns the SP signing key and certificate. In development an
+// ephemeral key is generated when none was configured.
+func (s *Service) samlCredentials() (*rsa.PrivateKey, *x509.Certificate, error) {
+	s.samlOnce.Do(func() {
+		if s.samlKey == nil {
+			if !core.IsDevEnvironment() {
+				return
+			}
+			k, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				return
+			}
+			s.samlKey = k
+		}
+		if s.samlCert == nil {
+			if cert, err := samlkit.SelfSignedCertificate(s.samlKey, "authkit-saml-sp", 0); err == nil {
+				s.samlCert = cert
+			}
+		}
+	})
+	if s.samlKey == nil || s.samlCert == nil {
+		return nil, nil, errors.New("saml service provider key not configured")
+	}
+	return s.samlKey, s.samlCert, nil
+}
+
+// samlServiceProvider loads the connection and builds its SP. SP URLs are derived from
+// the request so metadata, login and callback agree behind the same proxy/mount prefix.
+func (s *Service) samlServiceProvider(w http.ResponseWriter, r *http.Request) (*core.SAMLConnection, *saml.ServiceProvider, bool) {
+	slug := r.PathValue("connection")
+	conn, err := s.svc.GetSAMLConnection(r.Context(), slug)
+	if err != nil || conn == nil {
+		notFound(w, "unknown_connection")
+		return nil, nil, false
+	}
+	key, cert, err := s.samlCredentials()
+	if err != nil {
+		serverErr(w, "saml_not_configured")
+		return nil, nil, false
+	}
+	base := requestOrigin(r)
+	if i := strings.Index(r.URL.Path, "/auth/saml/"); i >= 0 {
+		base += r.URL.Path[:i]
+	}
+	base += "/auth/saml/" + conn.Slug
+	sp, err := samlkit.NewServiceProvider(samlkit.SPConfig{
+		MetadataURL:       base + "/metadata",
+		ACSURL:            base + "/callback",
+		Key:               key,
+		Certificate:       cert,
+		IdPMetadata:       []byte(conn.IdPMetadataXML),
+		AllowIDPInitiated: conn.AllowIDPInitiated,
+	})
+	if err != nil {
+		serverErr(w, "saml_connection_invalid")
+		return nil, nil, false
+	}
+	return conn, sp, true
+}
+
+func (s *Service) handleSAMLMetadataGET(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLSAMLStart) {
+		tooMany(w)
+		return
+	}
+	_, sp, ok := s.samlServiceProvider(w, r)
+	if !ok {
+		return
+	}
+	b, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		serverErr(w, "metadata_failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+func (s *Service) handleSAMLLoginGET(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLSAMLStart) {
+		tooMany(w)
+		return
+	}
+	conn, sp, ok := s.samlServiceProvider(w, r)
+	if !ok {
+		return
+	}
+
+	linkUserID := ""
+	if r.URL.Query().Get("link") == "1" || strings.EqualFold(r.URL.Query().Get("link"), "true") {
+		tokenStr := bearerToken(r.Header.Get("Authorization"))
+		if tokenStr == "" {
+			unauthorized(w, "auth_required_for_link")
+			return
+		}
+		claims := jwt.MapClaims{}
+		tok, err := jwt.ParseWithClaims(tokenStr, claims, s.svc.Keyfunc())
+		if err != nil || tok == nil || !tok.Valid {
+			unauthorized(w, "invalid_token")
+			return
+		}
+		sub, _ := claims["sub"].(string)
+		if sub == "" {
+			unauthorized(w, "invalid_token")
+			return
+		}
+		linkUserID = sub
+	}
+
+	ui := r.URL.Query().Get("ui")
+	if ui != "" && ui != "popup" {
+		badRequest(w, "invalid_ui")
+		return
+	}
+
+	binding := samlkit.BindingURN(conn.Binding)
+	if r.URL.Query().Get("binding") != "" {
+		binding = samlkit.BindingURN(r.URL.Query().Get("binding"))
+	}
+	idpURL := sp.GetSSOBindingLocation(binding)
+	if idpURL == "" {
+		// Fall back to whichever binding the IdP does support.
+		if binding == saml.HTTPPostBinding {
+			binding = saml.HTTPRedirectBinding
+		} else {
+			binding = saml.HTTPPostBinding
+		}
+		idpURL = sp.GetSSOBindingLocation(binding)
+	}
+	if idpURL == "" {
+		serverErr(w, "saml_connection_invalid")
+		return
+	}
+	req, err := sp.MakeAuthenticationRequest(idpURL, binding, saml.HTTPPostBinding)
+	if err != nil {
+		serverErr(w, "saml_request_failed")
+		return
+	}
+
+	relayState := randB64(32)
+	if err := s.stateCache().Put(r.Context(), relayState, oidckit.StateData{
+		Provider:    samlStateProvider(conn.Slug),
+		Nonce:       req.ID,
+		RedirectURI: sp.AcsURL.String(),
+		LinkUserID:  linkUserID,
+		UI:          ui,
+		PopupNonce:  r.URL.Query().Get("popup_nonce"),
+	}); err != nil {
+		serverErr(w, "state_store_failed")
+		return
+	}
+
+	if binding == saml.HTTPPostBinding {
+		formAction := "'none'"
+		if u, err := url.Parse(idpURL); err == nil && u.Host != "" {
+			formAction = u.Scheme + "://" + u.Host
+		}
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; form-action "+formAction+"; base-uri 'none'; frame-ancestors 'none'")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(append([]byte("<!doctype html><html><body>"), append(req.Post(relayState), []byte("</body></html>")...)...))
+		return
+	}
+	u, err := req.Redirect(relayState, sp)
+	if err != nil {
+		serverErr(w, "saml_request_failed")
+		return
+	}
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// handleSAMLCallbackPOST is the Assertion Consumer Service (HTTP-POST binding).
+func (s *Service) handleSAMLCallbackPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLSAMLCallback) {
+		tooMany(w)
+		return
+	}
+	conn, sp, ok := s.samlServiceProvider(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("SAMLResponse") == "" {
+		badRequest(w, "invalid_request")
+		return
+	}
+
+	relayState := r.PostForm.Get("RelayState")
+	var sd oidckit.StateData
+	var requestIDs []string
+	if relayState != "" {
+		got, found, err := oidckit.ConsumeState(r.Context(), s.stateCache(), relayState)
+		s.logIfErr(r.Context(), "authkit: state consume failed", err)
+		if err == nil && found && got.Provider == samlStateProvider(conn.Slug) {
+			sd = got
+			requestIDs = []string{got.Nonce}
+		}
+	}
+	// Without a matching SP-initiated request only IdP-initiated logins remain.
+	if requestIDs == nil && !conn.AllowIDPInitiated {
+		badRequest(w, "invalid_state")
+		return
+	}
+
+	// ParseResponse verifies the XML signature against the IdP metadata certificates,
+	// the issuer, audience, destination, validity window and InResponseTo.
+	assertion, err := sp.ParseResponse(r, requestIDs)
+	if err != nil {
+		countLoginFailed(s, r, "saml_login", "saml_response_invalid")
+		unauthorized(w, "saml_response_invalid")
+		return
+	}
+	ident, err := samlkit.ExtractIdentity(assertion, conn.AttributeMapping)
+	if err != nil {
+		countLoginFailed(s, r, "saml_login", "saml_response_invalid")
+		unauthorized(w, "saml_response_invalid")
+		return
+	}
+
+	ctx := r.Context()
+	issuer := conn.IdPEntityID
+	var userID, email string
+	created := false
+	if ident.Email != nil {
+		email = *ident.Email
+	}
+
+	if sd.LinkUserID != "" {
+		if uid0, _, err := s.svc.GetProviderLinkByIssuer(ctx, issuer, ident.Subject); err == nil && uid0 != "" && uid0 != sd.LinkUserID {
+			sendErr(w, http.StatusConflict, "provider_already_linked")
+			return
+		}
+		userID = sd.LinkUserID
+		s.logIfErr(ctx, "authkit: link provider failed", s.svc.LinkProviderByIssuer(ctx, userID, issuer, conn.Slug, ident.Subject, ident.Email), "user_id", userID, "issuer", issuer)
+	} else if uid, provEmail, err := s.svc.GetProviderLinkByIssuer(ctx, issuer, ident.Subject); err == nil && uid != "" {
+		userID = uid
+		if email == "" && provEmail != nil {
+			email = *provEmail
+		}
+	} else {
+		var existing *core.User
+		if email != "" {
+			if u, err := s.svc.GetUserByEmail(ctx, email); err == nil && u != nil {
+				existing = u
+			}
+		}
+		switch {
+		case existing != nil && s.svc.OIDCLinkPolicy() == core.OIDCLinkRefuse:
+			sendErr(w, http.StatusConflict, "email_in_use")
+			return
+		case existing != nil:
+			// An IdP assertion alone never links an existing account: the owner proves
+			// control of it first, exactly as for OIDC logins.
+			s.beginPendingOIDCLink(w, r, core.PendingOIDCLink{
+				UserID:           existing.ID,
+				Provider:         conn.Slug,
+				Issuer:           issuer,
+				Subject:          ident.Subject,
+				Email:            email,
+				EmailVerified:    conn.TrustEmail,
+				ProviderUsername: ident.Username,
+			}, sd, relayState)
+			return
+		default:
+			if err := s.svc.CheckRegistrationIdentity(core.RegistrationAttempt{Email: email}); err != nil {
+				if !registrationDenied(w, err) {
+					serverErr(w, "user_creation_failed")
+				}
+				return
+			}
+			username := s.svc.DeriveUsernameForOAuth(ctx, conn.Slug, ident.Username, email, ident.Name)
+			u, err := s.svc.CreateUser(ctx, email, username)
+			if err != nil || u == nil {
+				serverErr(w, "user_creation_failed")
+				return
+			}
+			userID = u.ID
+			if email != "" && conn.TrustEmail {
+				s.logIfErr(ctx, "authkit: mark email verified failed", s.svc.SetEmailVerified(ctx, userID, true), "user_id", userID)
+			}
+			s.logIfErr(ctx, "authkit: link provider failed", s.svc.LinkProviderByIssuer(ctx, userID, issuer, conn.Slug, ident.Subject, ident.Email), "user_id", userID, "issuer", issuer)
+			created = true
+		}
+	}
+	if strings.TrimSpace(ident.Username) != "" {
+		s.logIfErr(ctx, "authkit: set provider username failed", s.svc.SetProviderUsername(ctx, userID, issuer, ident.Subject, ident.Username), "user_id", userID, "issuer", issuer)
+	}
+
+	s.finishBrowserLogin(w, r, browserLogin{
+		UserID:     userID,
+		Email:      email,
+		Provider:   conn.Slug,
+		Method:     "saml_login",
+		Created:    created,
+		UI:         sd.UI,
+		PopupNonce: sd.PopupNonce,
+		State:      relayState,
+	})
+}
@@ -0,0 +1,335 @@
+package authhttp
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SCIM 2.0 (RFC 7643/7644) provisioning endpoints for enterprise directories
+// (Okta, Entra ID, ...). Users map to profiles.users and Groups map to roles.
+
+const (
+	scimSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSchemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimSchemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	scimContentType  = "application/scim+json"
+	scimMaxResults   = 200
+	scimDefaultCount = 100
+
+	// scimBanReason is stored as the ban reason when a directory deactivates a user.
+	scimBanReason = "scim_deactivated"
+)
+
+// SCIMHandler returns a handler that serves SCIM 2.0 provisioning routes:
+// - GET /scim/v2/ServiceProviderConfig, GET /scim/v2/ResourceTypes
+// - GET|POST /scim/v2/Users, GET|PUT|PATCH|DELETE /scim/v2/Users/{id}
+// - GET|POST /scim/v2/Groups, GET|PUT|PATCH|DELETE /scim/v2/Groups/{id}
+//
+// Every request must carry the bearer token configured via WithSCIMToken.
+// When no token is configured, all requests are rejected.
+func (s *Service) SCIMHandler() http.Handler {
+	if s == nil || s.svc == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { serverErr(w, "authkit_not_initialized") })
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /scim/v2/ServiceProviderConfig", http.HandlerFunc(s.handleSCIMServiceProviderConfigGET))
+	mux.Handle("GET /scim/v2/ResourceTypes", http.HandlerFunc(s.handleSCIMResourceTypesGET))
+
+	mux.Handle("GET /scim/v2/Users", http.HandlerFunc(s.handleSCIMUsersGET))
+	mux.Handle("POST /scim/v2/Users", http.HandlerFunc(s.handleSCIMUsersPOST))
+	mux.Handle("GET /scim/v2/Users/{id}", http.HandlerFunc(s.handleSCIMUserGET))
+	mux.Handle("PUT /scim/v2/Users/{id}", http.HandlerFunc(s.handleSCIMUserPUT))
+	mux.Handle("PATCH /scim/v2/Users/{id}", http.HandlerFunc(s.handleSCIMUserPATCH))
+	mux.Handle("DELETE /scim/v2/Users/{id}", http.HandlerFunc(s.handleSCIMUserDELETE))
+
+	mux.Handle("GET /scim/v2/Groups", http.HandlerFunc(s.handleSCIMGroupsGET))
+	mux.Handle("POST /scim/v2/Groups", http.HandlerFunc(s.handleSCIMGroupsPOST))
+	mux.Handle("GET /scim/v2/Groups/{id}", http.HandlerFunc(s.handleSCIMGroupGET))
+	mux.Handle("PUT /scim/v2/Groups/{id}", http.HandlerFunc(s.handleSCIMGroupPUT))
+	mux.Handle("PATCH /scim/v2/Groups/{id}", http.HandlerFunc(s.handleSCIMGroupPATCH))
+	mux.Handle("DELETE /scim/v2/Groups/{id}", http.HandlerFunc(s.handleSCIMGroupDELETE))
+
+	return s.scimAuth(mux)
+}
+
+// scimAuth enforces the directory client's bearer token and the SCIM rate limit bucket.
+func (s *Service) scimAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tok := bearerToken(r.Header.Get("Authorization"))
+		if s.scimToken == "" || tok == "" || subtle.ConstantTimeCompare([]byte(tok), []byte(s.scimToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			scimError(w, http.StatusUnauthorized, "", "invalid bearer token")
+			return
+		}
+		if !s.allow(w, r, RLSCIM) {
+			scimError(w, http.StatusTooManyRequests, "", "rate limited")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type scimErrorResp struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func scimError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeSCIM(w, status, scimErrorResp{
+		Schemas:  []string{scimSchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+func writeSCIM(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// decodeSCIM decodes a SCIM request body. Unlike decodeJSON it tolerates unknown
+// attributes: directories routinely send attributes AuthKit does not store.
+func decodeSCIM(r *http.Request, dst any) error {
+	if r == nil || r.Body == nil {
+		return errors.New("missing_body")
+	}
+	return json.NewDecoder(r.Body).Decode(dst)
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+type scimMultiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type scimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+func newSCIMList(total, startIndex int, resources []any) scimListResponse {
+	if resources == nil {
+		resources = []any{}
+	}
+	return scimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// scimPaging reads startIndex (1-based) and count from the query string.
+func scimPaging(r *http.Request) (startIndex, count int) {
+	startIndex, _ = strconv.Atoi(r.URL.Query().Get("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count = scimDefaultCount
+	if v := r.URL.Query().Get("count"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			count = n
+		}
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxResults {
+		count = scimMaxResults
+	}
+	return startIndex, count
+}
+
+// scimETag computes a weak entity tag over the resource representation (without meta).
+func scimETag(v any) string {
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// scimPreconditionFailed reports whether If-Match is present and does not match etag.
+func scimPreconditionFailed(r *http.Request, etag string) bool {
+	im := strings.TrimSpace(r.Header.Get("If-Match"))
+	if im == "" || im == "*" {
+		return false
+	}
+	for _, v := range strings.Split(im, ",") {
+		if strings.TrimSpace(v) == etag {
+			return false
+		}
+	}
+	return true
+}
+
+// scimNotModified reports whether If-None-Match matches etag.
+func scimNotModified(r *http.Request, etag string) bool {
+	inm := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if inm == "" {
+		return false
+	}
+	for _, v := range strings.Split(inm, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func scimLocation(r *http.Request, resource, id string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	} else if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		scheme = strings.ToLower(strings.TrimSpace(strings.Split(p, ",")[0]))
+	}
+	return scheme + "://" + r.Host + "/scim/v2/" + resource + "/" + id
+}
+
+func scimTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// scimFilter is a parsed `<attr> eq "<value>"` filter. Attr is lowercased.
+type scimFilter struct {
+	Attr  string
+	Value string
+}
+
+var (
+	scimFilterRe        = regexp.MustCompile(`(?i)^([a-z][a-z0-9._:-]*)\s+eq\s+("(?:[^"\\]|\\.)*")$`)
+	scimFilterBracketRe = regexp.MustCompile(`(?i)^([a-z][a-z0-9_]*)\[\s*([a-z][a-z0-9_]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*\]$`)
+)
+
+var errSCIMInvalidFilter = errors.New("invalid_filter")
+
+// parseSCIMFilter parses the single-comparison filters AuthKit supports:
+// `userName eq "..."`, `emails.value eq "..."` (or `emails[value eq "..."]`)
+// and `displayName eq "..."`. Schema URN prefixes are stripped.
+func parseSCIMFilter(raw string) (scimFilter, error) {
+	raw = strings.TrimSpace(raw)
+	var attr, quoted string
+	if m := scimFilterBracketRe.FindStringSubmatch(raw); m != nil {
+		attr, quoted = m[1]+"."+m[2], m[3]
+	} else if m := scimFilterRe.FindStringSubmatch(raw); m != nil {
+		attr, quoted = m[1], m[2]
+	} else {
+		return scimFilter{}, errSCIMInvalidFilter
+	}
+	var value string
+	if err := json.Unmarshal([]byte(quoted), &value); err != nil {
+		return scimFilter{}, errSCIMInvalidFilter
+	}
+	attr = strings.ToLower(attr)
+	for _, urn := range []string{scimSchemaUser, scimSchemaGroup} {
+		attr = strings.TrimPrefix(attr, strings.ToLower(urn)+":")
+	}
+	switch attr {
+	case "username", "emails.value", "displayname":
+		return scimFilter{Attr: attr, Value: value}, nil
+	}
+	return scimFilter{}, fmt.Errorf("%w: unsupported attribute %q", errSCIMInvalidFilter, attr)
+}
+
+type scimPatchRequest struct {
+	Schemas    []string      `json:"schemas"`
+	Operations []scimPatchOp `json:"Operations"`
+}
+
+type scimPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// scimBool accepts JSON booleans and the "True"/"False" strings some directories send.
+func scimBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(strings.TrimSpace(str))
+}
+
+func (s *Service) handleSCIMServiceProviderConfigGET(w http.ResponseWriter, r *http.Request) {
+	writeSCIM(w, http.StatusOK, map[string]any{
+		"schemas":        []string{scimSchemaSPConfig},
+		"patch":          map[string]any{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": map[string]any{"supported": false},
+		"sort":           map[string]any{"supported": false},
+		"etag":           map[string]any{"supported": true},
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication using a static bearer token issued to the directory client",
+			"primary":     true,
+		}},
+		"meta": map[string]any{"resourceType": "ServiceProviderConfig"},
+	})
+}
+
+func (s *Service) handleSCIMResourceTypesGET(w http.ResponseWriter, r *http.Request) {
+	users := map[string]any{
+		"schemas":  []string{scimSchemaResourceType},
+		"id":       "User",
+		"name":     "User",
+		"endpoint": "/Users",
+		"schema":   scimSchemaUser,
+		"meta":     map[string]any{"resourceType": "ResourceType"},
+	}
+	groups := map[string]any{
+		"schemas":  []string{scimSchemaResourceType},
+		"id":       "Group",
+		"name":     "Group",
+		"endpoint": "/Groups",
+		"schema":   scimSchemaGroup,
+		"meta":     map[string]any{"resourceType": "ResourceType"},
+	}
+	writeSCIM(w, http.StatusOK, newSCIMList(2, 1, []any{users, groups}))
+}
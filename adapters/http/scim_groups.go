@@ -0,0 +1,477 @@
+package authhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+type scimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members,omitempty"`
+	Meta        *scimMeta    `json:"meta,omitempty"`
+}
+
+type scimGroupInput struct {
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members"`
+}
+
+// scimGroupChanges is the normalized membership/name change set from PUT/PATCH.
+type scimGroupChanges struct {
+	DisplayName    *string
+	ReplaceMembers bool
+	Replace        []string
+	RemoveAll      bool
+	Add            []string
+	Remove         []string
+}
+
+var scimMemberFilterPathRe = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+("(?:[^"\\]|\\.)*")\s*\]$`)
+
+// scimRoleSlug maps a SCIM group displayName onto a role slug:
+// lowercase, with runs of characters outside [a-z0-9_] collapsed to "_".
+func scimRoleSlug(displayName string) string {
+	var b strings.Builder
+	pendingSep := false
+	for _, r := range strings.ToLower(strings.TrimSpace(displayName)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			if pendingSep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			pendingSep = false
+			b.WriteRune(r)
+			continue
+		}
+		pendingSep = true
+	}
+	return b.String()
+}
+
+// scimManagedRole reports whether SCIM may expose and change the role (WithSCIMGroupRoles).
+func (s *Service) scimManagedRole(slug string) bool {
+	return s.scimRoles[slug]
+}
+
+func (s *Service) scimGroupFromRole(ctx context.Context, r *http.Request, role *core.Role, withMembers bool) (*scimGroup, error) {
+	members, err := s.svc.ListRoleMembers(ctx, role.Slug)
+	if err != nil {
+		return nil, err
+	}
+	g := &scimGroup{
+		Schemas:     []string{scimSchemaGroup},
+		ID:          role.ID,
+		DisplayName: role.Name,
+	}
+	for _, m := range members {
+		sm := scimMember{Value: m.UserID, Ref: scimLocation(r, "Users", m.UserID)}
+		if m.Username != nil {
+			sm.Display = *m.Username
+		}
+		g.Members = append(g.Members, sm)
+	}
+	// The version covers membership even when members are excluded from the response.
+	etag := scimETag(g)
+	if !withMembers {
+		g.Members = nil
+	}
+	g.Meta = &scimMeta{
+		ResourceType: "Group",
+		Created:      scimTime(role.CreatedAt),
+		LastModified: scimTime(role.UpdatedAt),
+		Location:     scimLocation(r, "Groups", role.ID),
+		Version:      etag,
+	}
+	return g, nil
+}
+
+func scimWantsMembers(r *http.Request) bool {
+	for _, a := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(a), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Service) scimLoadGroup(r *http.Request, id string, withMembers bool) (*core.Role, *scimGroup, bool) {
+	role, err := s.svc.GetRoleByID(r.Context(), id)
+	if err != nil || role == nil || !s.scimManagedRole(role.Slug) {
+		return nil, nil, false
+	}
+	g, err := s.scimGroupFromRole(r.Context(), r, role, withMembers)
+	if err != nil {
+		return nil, nil, false
+	}
+	return role, g, true
+}
+
+// scimFindRole resolves a displayName to a managed role by derived slug first, then by
+// role name (names can diverge from slugs after a rename).
+func (s *Service) scimFindRole(ctx context.Context, displayName string) *core.Role {
+	if slug := scimRoleSlug(displayName); s.scimManagedRole(slug) {
+		if role, err := s.svc.GetRoleBySlug(ctx, slug); err == nil && role != nil {
+			return role
+		}
+	}
+	list, err := s.scimListRoles(ctx)
+	if err != nil {
+		return nil
+	}
+	for i := range list {
+		if strings.EqualFold(list[i].Name, strings.TrimSpace(displayName)) {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// scimListRoles lists the existing managed roles.
+func (s *Service) scimListRoles(ctx context.Context) ([]core.Role, error) {
+	all, err := s.svc.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []core.Role
+	for _, role := range all {
+		if s.scimManagedRole(role.Slug) {
+			out = append(out, role)
+		}
+	}
+	return out, nil
+}
+
+func (s *Service) handleSCIMGroupsGET(w http.ResponseWriter, r *http.Request) {
+	startIndex, count := scimPaging(r)
+	withMembers := scimWantsMembers(r)
+
+	var list []core.Role
+	if raw := strings.TrimSpace(r.URL.Query().Get("filter")); raw != "" {
+		f, err := parseSCIMFilter(raw)
+		if err != nil || f.Attr != "displayname" {
+			scimError(w, http.StatusBadRequest, "invalidFilter", "supported filters: displayName eq")
+			return
+		}
+		if role := s.scimFindRole(r.Context(), f.Value); role != nil {
+			list = append(list, *role)
+		}
+	} else {
+		all, err := s.scimListRoles(r.Context())
+		if err != nil {
+			scimError(w, http.StatusInternalServerError, "", "failed to list groups")
+			return
+		}
+		list = all
+	}
+
+	total := len(list)
+	var resources []any
+	for i := startIndex - 1; i < total && len(resources) < count; i++ {
+		g, err := s.scimGroupFromRole(r.Context(), r, &list[i], withMembers)
+		if err != nil {
+			scimError(w, http.StatusInternalServerError, "", "failed to list group members")
+			return
+		}
+		resources = append(resources, g)
+	}
+	writeSCIM(w, http.StatusOK, newSCIMList(total, startIndex, resources))
+}
+
+func (s *Service) handleSCIMGroupsPOST(w http.ResponseWriter, r *http.Request) {
+	var in scimGroupInput
+	if err := decodeSCIM(r, &in); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	name := strings.TrimSpace(in.DisplayName)
+	slug := scimRoleSlug(name)
+	if slug == "" {
+		scimError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	ctx := r.Context()
+	if s.scimFindRole(ctx, name) != nil {
+		scimError(w, http.StatusConflict, "uniqueness", "group already exists")
+		return
+	}
+	if !s.scimManagedRole(slug) {
+		scimError(w, http.StatusForbidden, "", "group is not managed by SCIM")
+		return
+	}
+	role, err := s.svc.EnsureRole(ctx, slug, name)
+	if err != nil || role == nil {
+		scimError(w, http.StatusInternalServerError, "", "group creation failed")
+		return
+	}
+	ch := scimGroupChanges{Add: scimMemberIDs(in.Members)}
+	if err := s.applySCIMGroupChanges(ctx, role, ch); err != nil {
+		scimGroupChangeError(w, err)
+		return
+	}
+	_, g, ok := s.scimLoadGroup(r, role.ID, true)
+	if !ok {
+		scimError(w, http.StatusInternalServerError, "", "group lookup failed")
+		return
+	}
+	w.Header().Set("Location", g.Meta.Location)
+	w.Header().Set("ETag", g.Meta.Version)
+	writeSCIM(w, http.StatusCreated, g)
+}
+
+func (s *Service) handleSCIMGroupGET(w http.ResponseWriter, r *http.Request) {
+	_, g, ok := s.scimLoadGroup(r, r.PathValue("id"), scimWantsMembers(r))
+	if !ok {
+		scimError(w, http.StatusNotFound, "", "group not found")
+		return
+	}
+	w.Header().Set("ETag", g.Meta.Version)
+	if scimNotModified(r, g.Meta.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeSCIM(w, http.StatusOK, g)
+}
+
+func (s *Service) handleSCIMGroupPUT(w http.ResponseWriter, r *http.Request) {
+	role, g, ok := s.scimLoadGroup(r, r.PathValue("id"), true)
+	if !ok {
+		scimError(w, http.StatusNotFound, "", "group not found")
+		return
+	}
+	if scimPreconditionFailed(r, g.Meta.Version) {
+		scimError(w, http.StatusPreconditionFailed, "", "resource version mismatch")
+		return
+	}
+	var in scimGroupInput
+	if err := decodeSCIM(r, &in); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	ch := scimGroupChanges{ReplaceMembers: true, Replace: scimMemberIDs(in.Members)}
+	if v := strings.TrimSpace(in.DisplayName); v != "" {
+		ch.DisplayName = &v
+	}
+	s.scimRespondGroupChanges(w, r, role, ch)
+}
+
+func (s *Service) handleSCIMGroupPATCH(w http.ResponseWriter, r *http.Request) {
+	role, g, ok := s.scimLoadGroup(r, r.PathValue("id"), true)
+	if !ok {
+		scimError(w, http.StatusNotFound, "", "group not found")
+		return
+	}
+	if scimPreconditionFailed(r, g.Meta.Version) {
+		scimError(w, http.StatusPreconditionFailed, "", "resource version mismatch")
+		return
+	}
+	var req scimPatchRequest
+	if err := decodeSCIM(r, &req); err != nil || len(req.Operations) == 0 {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid patch request")
+		return
+	}
+	ch, err := parseSCIMGroupPatch(req.Operations)
+	if err != nil {
+		scimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	s.scimRespondGroupChanges(w, r, role, ch)
+}
+
+func (s *Service) scimRespondGroupChanges(w http.ResponseWriter, r *http.Request, role *core.Role, ch scimGroupChanges) {
+	if err := s.applySCIMGroupChanges(r.Context(), role, ch); err != nil {
+		scimGroupChangeError(w, err)
+		return
+	}
+	_, g, ok := s.scimLoadGroup(r, role.ID, scimWantsMembers(r))
+	if !ok {
+		scimError(w, http.StatusNotFound, "", "group not found")
+		return
+	}
+	w.Header().Set("ETag", g.Meta.Version)
+	writeSCIM(w, http.StatusOK, g)
+}
+
+func scimGroupChangeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errSCIMInvalidValue) {
+		scimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	scimError(w, http.StatusInternalServerError, "", "group update failed")
+}
+
+func (s *Service) applySCIMGroupChanges(ctx context.Context, role *core.Role, ch scimGroupChanges) error {
+	if ch.DisplayName != nil && *ch.DisplayName != role.Name {
+		// Slugs are immutable identity; only the display name follows the directory.
+		if err := s.svc.RenameRole(ctx, role.Slug, *ch.DisplayName); err != nil {
+			return err
+		}
+	}
+	if ch.ReplaceMembers || ch.RemoveAll {
+		current, err := s.svc.ListRoleMembers(ctx, role.Slug)
+		if err != nil {
+			return err
+		}
+		keep := map[string]bool{}
+		for _, id := range ch.Replace {
+			keep[id] = true
+		}
+		for _, m := range current {
+			if keep[m.UserID] {
+				delete(keep, m.UserID)
+				continue
+			}
+			if err := s.svc.RemoveRoleBySlug(ctx, m.UserID, role.Slug); err != nil {
+				return err
+			}
+		}
+		for id := range keep {
+			ch.Add = append(ch.Add, id)
+		}
+	}
+	for _, id := range ch.Add {
+		if !s.scimUserExists(ctx, id) {
+			return fmt.Errorf("%w: unknown member %q", errSCIMInvalidValue, id)
+		}
+		if err := s.svc.AssignRoleBySlug(ctx, id, role.Slug); err != nil {
+			return err
+		}
+	}
+	for _, id := range ch.Remove {
+		if err := s.svc.RemoveRoleBySlug(ctx, id, role.Slug); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scimUserExists reports whether id names a live (non-deleted) user.
+func (s *Service) scimUserExists(ctx context.Context, id string) bool {
+	u, err := s.svc.AdminGetUser(ctx, id)
+	return err == nil && u != nil && u.DeletedAt == nil
+}
+
+func (s *Service) handleSCIMGroupDELETE(w http.ResponseWriter, r *http.Request) {
+	role, g, ok := s.scimLoadGroup(r, r.PathValue("id"), true)
+	if !ok {
+		scimError(w, http.StatusNotFound, "", "group not found")
+		return
+	}
+	if scimPreconditionFailed(r, g.Meta.Version) {
+		scimError(w, http.StatusPreconditionFailed, "", "resource version mismatch")
+		return
+	}
+	if err := s.svc.DeleteRole(r.Context(), role.Slug); err != nil {
+		scimError(w, http.StatusInternalServerError, "", "group deletion failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func scimMemberIDs(members []scimMember) []string {
+	var out []string
+	for _, m := range members {
+		if v := strings.TrimSpace(m.Value); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func scimDecodeMembers(raw json.RawMessage) ([]string, error) {
+	var list []scimMember
+	if err := json.Unmarshal(raw, &list); err != nil {
+		var one scimMember
+		if err := json.Unmarshal(raw, &one); err != nil {
+			return nil, fmt.Errorf("%w: members", errSCIMInvalidValue)
+		}
+		list = []scimMember{one}
+	}
+	return scimMemberIDs(list), nil
+}
+
+// parseSCIMGroupPatch folds PATCH operations on a group into a change set.
+func parseSCIMGroupPatch(ops []scimPatchOp) (scimGroupChanges, error) {
+	var ch scimGroupChanges
+	apply := func(kind, attr string, raw json.RawMessage) error {
+		switch attr {
+		case "displayname":
+			var v string
+			if err := json.Unmarshal(raw, &v); err != nil || strings.TrimSpace(v) == "" {
+				return fmt.Errorf("%w: displayName", errSCIMInvalidValue)
+			}
+			v = strings.TrimSpace(v)
+			ch.DisplayName = &v
+		case "members":
+			ids, err := scimDecodeMembers(raw)
+			if err != nil {
+				return err
+			}
+			if kind == "replace" {
+				ch.ReplaceMembers = true
+				ch.Replace = ids
+				ch.Add = nil
+			} else {
+				ch.Add = append(ch.Add, ids...)
+			}
+		}
+		return nil
+	}
+
+	for _, op := range ops {
+		kind := strings.ToLower(strings.TrimSpace(op.Op))
+		path := strings.TrimSpace(op.Path)
+		attr := strings.TrimPrefix(strings.ToLower(path), strings.ToLower(scimSchemaGroup)+":")
+		switch kind {
+		case "add", "replace":
+			if path == "" {
+				var attrs map[string]json.RawMessage
+				if err := json.Unmarshal(op.Value, &attrs); err != nil {
+					return ch, fmt.Errorf("%w: value must be an object when path is omitted", errSCIMInvalidValue)
+				}
+				for k, v := range attrs {
+					if err := apply(kind, strings.ToLower(k), v); err != nil {
+						return ch, err
+					}
+				}
+				continue
+			}
+			if err := apply(kind, attr, op.Value); err != nil {
+				return ch, err
+			}
+		case "remove":
+			if m := scimMemberFilterPathRe.FindStringSubmatch(path); m != nil {
+				var id string
+				if err := json.Unmarshal([]byte(m[1]), &id); err != nil {
+					return ch, fmt.Errorf("%w: members", errSCIMInvalidValue)
+				}
+				ch.Remove = append(ch.Remove, id)
+				continue
+			}
+			switch attr {
+			case "members":
+				if len(op.Value) == 0 || string(op.Value) == "null" {
+					ch.RemoveAll = true
+					continue
+				}
+				ids, err := scimDecodeMembers(op.Value)
+				if err != nil {
+					return ch, err
+				}
+				ch.Remove = append(ch.Remove, ids...)
+			case "displayname", "":
+				return ch, fmt.Errorf("%w: %q cannot be removed", errSCIMInvalidValue, path)
+			}
+		default:
+			return ch, fmt.Errorf("%w: unsupported op %q", errSCIMInvalidValue, op.Op)
+		}
+	}
+	return ch, nil
+}
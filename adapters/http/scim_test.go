@@ -0,0 +1,207 @@
+package authhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	core "github.com/open-rails/authkit/core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCIMHandler_RequiresBearerToken(t *testing.T) {
+	s := (&Service{svc: newTestCoreService(t)}).WithSCIMToken("scim-secret")
+	h := s.SCIMHandler()
+
+	for _, auth := range []string{"", "Bearer wrong", "Basic c2NpbS1zZWNyZXQ="} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusUnauthorized, w.Code, auth)
+		require.Equal(t, scimContentType, w.Header().Get("Content-Type"))
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/scim/v2/ServiceProviderConfig", nil)
+	r.Header.Set("Authorization", "Bearer scim-secret")
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, true, body["patch"].(map[string]any)["supported"])
+	require.Equal(t, true, body["etag"].(map[string]any)["supported"])
+}
+
+func TestSCIMHandler_NoTokenConfiguredRejectsAll(t *testing.T) {
+	s := &Service{svc: newTestCoreService(t)}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	s.SCIMHandler().ServeHTTP(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestSCIMHandler_InvalidFilter(t *testing.T) {
+	s := (&Service{svc: newTestCoreService(t)}).WithSCIMToken("scim-secret")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, `/scim/v2/Users?filter=`+strings.ReplaceAll(`title co "x"`, " ", "%20"), nil)
+	r.Header.Set("Authorization", "Bearer scim-secret")
+	s.SCIMHandler().ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), `"scimType":"invalidFilter"`)
+}
+
+func TestParseSCIMFilter(t *testing.T) {
+	cases := []struct {
+		in   string
+		attr string
+		val  string
+		ok   bool
+	}{
+		{`userName eq "alice"`, "username", "alice", true},
+		{`USERNAME EQ "a\"b"`, "username", `a"b`, true},
+		{`emails.value eq "a@example.com"`, "emails.value", "a@example.com", true},
+		{`emails[value eq "a@example.com"]`, "emails.value", "a@example.com", true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "bob"`, "username", "bob", true},
+		{`displayName eq "Engineering"`, "displayname", "Engineering", true},
+		{`userName sw "a"`, "", "", false},
+		{`userName eq "a" and active eq true`, "", "", false},
+		{`title eq "x"`, "", "", false},
+	}
+	for _, c := range cases {
+		f, err := parseSCIMFilter(c.in)
+		if !c.ok {
+			require.Error(t, err, c.in)
+			continue
+		}
+		require.NoError(t, err, c.in)
+		require.Equal(t, c.attr, f.Attr, c.in)
+		require.Equal(t, c.val, f.Value, c.in)
+	}
+}
+
+func TestParseSCIMUserPatch(t *testing.T) {
+	var req scimPatchRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "active", "value": "False"},
+			{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "new@example.com"},
+			{"op": "add", "path": "name.givenName", "value": "Ignored"},
+			{"op": "replace", "value": {"userName": "new_name"}}
+		]
+	}`), &req))
+	ch, err := parseSCIMUserPatch(req.Operations)
+	require.NoError(t, err)
+	require.NotNil(t, ch.Active)
+	require.False(t, *ch.Active)
+	require.Equal(t, "new@example.com", *ch.Email)
+	require.Equal(t, "new_name", *ch.UserName)
+
+	_, err = parseSCIMUserPatch([]scimPatchOp{{Op: "remove", Path: "userName"}})
+	require.Error(t, err)
+}
+
+func TestParseSCIMGroupPatch(t *testing.T) {
+	var req scimPatchRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"Operations": [
+			{"op": "add", "path": "members", "value": [{"value": "u1"}, {"value": "u2"}]},
+			{"op": "remove", "path": "members[value eq \"u3\"]"},
+			{"op": "replace", "value": {"displayName": "Engineering"}}
+		]
+	}`), &req))
+	ch, err := parseSCIMGroupPatch(req.Operations)
+	require.NoError(t, err)
+	require.Equal(t, []string{"u1", "u2"}, ch.Add)
+	require.Equal(t, []string{"u3"}, ch.Remove)
+	require.Equal(t, "Engineering", *ch.DisplayName)
+	require.False(t, ch.ReplaceMembers)
+
+	ch, err = parseSCIMGroupPatch([]scimPatchOp{{Op: "remove", Path: "members"}})
+	require.NoError(t, err)
+	require.True(t, ch.RemoveAll)
+}
+
+func TestSCIMRoleSlug(t *testing.T) {
+	require.Equal(t, "engineering", scimRoleSlug("Engineering"))
+	require.Equal(t, "platform_admins", scimRoleSlug("  Platform -- Admins "))
+	require.Equal(t, "", scimRoleSlug("***"))
+}
+
+func TestParseSCIMGroupPatch_ReplaceMembers(t *testing.T) {
+	ch, err := parseSCIMGroupPatch([]scimPatchOp{
+		{Op: "add", Path: "members", Value: json.RawMessage(`[{"value": "u1"}]`)},
+		{Op: "replace", Value: json.RawMessage(`{"members": [{"value": "u2"}, {"value": "u3"}]}`)},
+	})
+	require.NoError(t, err)
+	require.True(t, ch.ReplaceMembers)
+	require.Equal(t, []string{"u2", "u3"}, ch.Replace)
+	require.Empty(t, ch.Add, "replace supersedes earlier adds")
+
+	_, err = parseSCIMGroupPatch([]scimPatchOp{{Op: "move", Path: "members"}})
+	require.ErrorIs(t, err, errSCIMInvalidValue)
+	_, err = parseSCIMGroupPatch([]scimPatchOp{{Op: "remove", Path: "displayName"}})
+	require.ErrorIs(t, err, errSCIMInvalidValue)
+	_, err = parseSCIMGroupPatch([]scimPatchOp{{Op: "replace", Path: "displayName", Value: json.RawMessage(`"  "`)}})
+	require.ErrorIs(t, err, errSCIMInvalidValue)
+}
+
+func TestSCIMPreconditions(t *testing.T) {
+	etag := scimETag(map[string]string{"id": "1"})
+	require.True(t, strings.HasPrefix(etag, `W/"`))
+	require.Equal(t, etag, scimETag(map[string]string{"id": "1"}))
+	require.NotEqual(t, etag, scimETag(map[string]string{"id": "2"}))
+
+	req := func(header, value string) *http.Request {
+		r := httptest.NewRequest(http.MethodPatch, "/scim/v2/Groups/1", nil)
+		if value != "" {
+			r.Header.Set(header, value)
+		}
+		return r
+	}
+	require.False(t, scimPreconditionFailed(req("If-Match", ""), etag))
+	require.False(t, scimPreconditionFailed(req("If-Match", "*"), etag))
+	require.False(t, scimPreconditionFailed(req("If-Match", `W/"other", `+etag), etag))
+	require.True(t, scimPreconditionFailed(req("If-Match", `W/"other"`), etag))
+
+	require.False(t, scimNotModified(req("If-None-Match", ""), etag))
+	require.True(t, scimNotModified(req("If-None-Match", etag), etag))
+	require.True(t, scimNotModified(req("If-None-Match", "*"), etag))
+	require.False(t, scimNotModified(req("If-None-Match", `W/"other"`), etag))
+}
+
+func TestSCIMUserGroups_OnlyManagedRoles(t *testing.T) {
+	s := (&Service{svc: newTestCoreService(t)}).WithSCIMGroupRoles("engineering")
+	r := httptest.NewRequest(http.MethodGet, "/scim/v2/Users/u1", nil)
+	u := &core.AdminUser{ID: "u1", Roles: []string{"admin", "engineering"}}
+	su := s.scimUserFromAdmin(r, u)
+	require.Len(t, su.Groups, 1)
+	require.Equal(t, "engineering", su.Groups[0].Display)
+}
+
+func TestSCIMGroupsPOST_RejectsUnmanagedRole(t *testing.T) {
+	s := (&Service{svc: newTestCoreService(t)}).WithSCIMToken("scim-secret").WithSCIMGroupRoles("engineering")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/scim/v2/Groups", strings.NewReader(`{"displayName": "Admin"}`))
+	r.Header.Set("Authorization", "Bearer scim-secret")
+	s.SCIMHandler().ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestSCIMUsersGET_EchoesStartIndex(t *testing.T) {
+	s := (&Service{svc: newTestCoreService(t)}).WithSCIMToken("scim-secret")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/scim/v2/Users?startIndex=3&count=2", nil)
+	r.Header.Set("Authorization", "Bearer scim-secret")
+	s.SCIMHandler().ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	var body scimListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, 3, body.StartIndex)
+}
@@ -0,0 +1,476 @@
+package authhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	core "github.com/open-rails/authkit/core"
+	"github.com/open-rails/authkit/roles"
+)
+
+type scimUser struct {
+	Schemas      []string         `json:"schemas"`
+	ID           string           `json:"id"`
+	UserName     string           `json:"userName"`
+	Active       bool             `json:"active"`
+	Emails       []scimMultiValue `json:"emails,omitempty"`
+	PhoneNumbers []scimMultiValue `json:"phoneNumbers,omitempty"`
+	Groups       []scimMember     `json:"groups,omitempty"`
+	Meta         *scimMeta        `json:"meta,omitempty"`
+}
+
+type scimUserInput struct {
+	UserName string           `json:"userName"`
+	Active   *bool            `json:"active"`
+	Emails   []scimMultiValue `json:"emails"`
+}
+
+// scimUserChanges is the normalized set of writable attributes from PUT/PATCH.
+// Attributes AuthKit does not store (name, displayName, externalId, ...) are ignored.
+type scimUserChanges struct {
+	UserName *string
+	Email    *string
+	Active   *bool
+}
+
+var (
+	errSCIMConflict     = errors.New("uniqueness")
+	errSCIMInvalidValue = errors.New("invalid_value")
+)
+
+func (s *Service) scimUserFromAdmin(r *http.Request, u *core.AdminUser) *scimUser {
+	su := &scimUser{
+		Schemas: []string{scimSchemaUser},
+		ID:      u.ID,
+		Active:  u.BannedAt == nil,
+	}
+	if u.Username != nil {
+		su.UserName = *u.Username
+	}
+	if u.Email != nil && *u.Email != "" {
+		su.Emails = []scimMultiValue{{Value: *u.Email, Type: "work", Primary: true}}
+	}
+	if u.PhoneNumber != nil && *u.PhoneNumber != "" {
+		su.PhoneNumbers = []scimMultiValue{{Value: *u.PhoneNumber, Type: "mobile"}}
+	}
+	for _, slug := range u.Roles {
+		if !s.scimManagedRole(slug) {
+			continue
+		}
+		id := roles.IDFromSlug(slug).String()
+		su.Groups = append(su.Groups, scimMember{Value: id, Display: slug, Ref: scimLocation(r, "Groups", id)})
+	}
+	etag := scimETag(su)
+	su.Meta = &scimMeta{
+		ResourceType: "User",
+		Created:      scimTime(u.CreatedAt),
+		LastModified: scimTime(u.UpdatedAt),
+		Location:     scimLocation(r, "Users", u.ID),
+		Version:      etag,
+	}
+	return su
+}
+
+// scimLoadUser returns the user and its SCIM representation. Soft-deleted users are not found.
+func (s *Service) scimLoadUser(r *http.Request, id string) (*core.AdminUser, *scimUser, bool) {
+	u, err := s.svc.AdminGetUser(r.Context(), id)
+	if err != nil || u == nil || u.DeletedAt != nil {
+		return nil, nil, false
+	}
+	return u, s.scimUserFromAdmin(r, u), true
+}
+
+func (s *Service) scimFindUser(ctx context.Context, f scimFilter) *core.AdminUser {
+	var u *core.User
+	switch f.Attr {
+	case "username":
+		u, _ = s.svc.GetUserByUsername(ctx, f.Value)
+		if u == nil && strings.Contains(f.Value, "@") {
+			// Email-shaped userNames are stored as the user's email (see scimResolveUserName).
+			u, _ = s.svc.GetUserByEmail(ctx, f.Value)
+		}
+	case "emails.value":
+		u, _ = s.svc.GetUserByEmail(ctx, f.Value)
+	}
+	if u == nil || u.DeletedAt != nil {
+		return nil
+	}
+	a, err := s.svc.AdminGetUser(ctx, u.ID)
+	if err != nil {
+		return nil
+	}
+	return a
+}
+
+func scimPrimaryEmail(emails []scimMultiValue) string {
+	for _, e := range emails {
+		if e.Primary && strings.TrimSpace(e.Value) != "" {
+			return strings.TrimSpace(e.Value)
+		}
+	}
+	for _, e := range emails {
+		if strings.TrimSpace(e.Value) != "" {
+			return strings.TrimSpace(e.Value)
+		}
+	}
+	return ""
+}
+
+// scimResolveUserName maps a SCIM userName onto an AuthKit username.
+// Directories commonly use the user's email as userName; AuthKit usernames cannot
+// contain "@", so such userNames become the email and a username is derived from it.
+func (s *Service) scimResolveUserName(ctx context.Context, userName, email string) (username, outEmail string, derived bool, err error) {
+	if validateUsername(userName) == nil {
+		return userName, email, false, nil
+	}
+	if strings.Contains(userName, "@") {
+		if email == "" {
+			email = userName
+		}
+		return s.svc.DeriveUsernameForOAuth(ctx, "scim", "", userName, ""), email, true, nil
+	}
+	return "", "", false, fmt.Errorf("%w: userName", errSCIMInvalidValue)
+}
+
+func (s *Service) handleSCIMUsersGET(w http.ResponseWriter, r *http.Request) {
+	startIndex, count := scimPaging(r)
+
+	if raw := strings.TrimSpace(r.URL.Query().Get("filter")); raw != "" {
+		f, err := parseSCIMFilter(raw)
+		if err != nil || f.Attr == "displayname" {
+			scimError(w, http.StatusBadRequest, "invalidFilter", "supported filters: userName eq, emails.value eq")
+			return
+		}
+		var resources []any
+		total := 0
+		if u := s.scimFindUser(r.Context(), f); u != nil {
+			total = 1
+			if startIndex == 1 && count > 0 {
+				resources = append(resources, s.scimUserFromAdmin(r, u))
+			}
+		}
+		writeSCIM(w, http.StatusOK, newSCIMList(total, startIndex, resources))
+		return
+	}
+
+	// startIndex is a 1-based position, not a page: fetch from that exact offset.
+	limit := count
+	if limit == 0 {
+		limit = 1
+	}
+	result, err := s.svc.AdminListUsersFrom(r.Context(), startIndex-1, limit)
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", "failed to list users")
+		return
+	}
+	var resources []any
+	if count > 0 {
+		for i := range result.Users {
+			resources = append(resources, s.scimUserFromAdmin(r, &result.Users[i]))
+		}
+	}
+	writeSCIM(w, http.StatusOK, newSCIMList(int(result.Total), startIndex, resources))
+}
+
+func (s *Service) handleSCIMUsersPOST(w http.ResponseWriter, r *http.Request) {
+	var in scimUserInput
+	if err := decodeSCIM(r, &in); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	userName := strings.TrimSpace(in.UserName)
+	if userName == "" {
+		scimError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	ctx := r.Context()
+	username, email, derived, err := s.scimResolveUserName(ctx, userName, scimPrimaryEmail(in.Emails))
+	if err != nil {
+		scimError(w, http.StatusBadRequest, "invalidValue", "userName is not a valid username or email")
+		return
+	}
+	if !derived {
+		if u, _ := s.svc.GetUserByUsername(ctx, username); u != nil {
+			scimError(w, http.StatusConflict, "uniqueness", "userName already exists")
+			return
+		}
+	}
+	if email != "" {
+		if u, _ := s.svc.GetUserByEmail(ctx, email); u != nil {
+			scimError(w, http.StatusConflict, "uniqueness", "email already exists")
+			return
+		}
+	}
+
+	u, err := s.svc.CreateUser(ctx, email, username)
+	if err != nil || u == nil {
+		scimError(w, http.StatusInternalServerError, "", "user creation failed")
+		return
+	}
+	if email != "" {
+		s.logIfErr(ctx, "authkit: mark email verified failed", s.svc.SetEmailVerified(ctx, u.ID, true), "user_id", u.ID)
+	}
+	if in.Active != nil && !*in.Active {
+		reason := scimBanReason
+		s.logIfErr(ctx, "authkit: ban user failed", s.svc.BanUser(ctx, u.ID, &reason, nil, ""), "user_id", u.ID)
+	}
+
+	_, su, ok := s.scimLoadUser(r, u.ID)
+	if !ok {
+		scimError(w, http.StatusInternalServerError, "", "user lookup failed")
+		return
+	}
+	w.Header().Set("Location", su.Meta.Location)
+	w.Header().Set("ETag", su.Meta.Version)
+	writeSCIM(w, http.StatusCreated, su)
+}
+
+func (s *Service) handleSCIMUserGET(w http.ResponseWriter, r *http.Request) {
+	_, su, ok := s.scimLoadUser(r, r.PathValue("id"))
+	if !ok {
+		scimError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	w.Header().Set("ETag", su.Meta.Version)
+	if scimNotModified(r, su.Meta.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeSCIM(w, http.StatusOK, su)
+}
+
+func (s *Service) handleSCIMUserPUT(w http.ResponseWriter, r *http.Request) {
+	cur, su, ok := s.scimLoadUser(r, r.PathValue("id"))
+	if !ok {
+		scimError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	if scimPreconditionFailed(r, su.Meta.Version) {
+		scimError(w, http.StatusPreconditionFailed, "", "resource version mismatch")
+		return
+	}
+	var in scimUserInput
+	if err := decodeSCIM(r, &in); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	var ch scimUserChanges
+	if v := strings.TrimSpace(in.UserName); v != "" {
+		ch.UserName = &v
+	}
+	if len(in.Emails) > 0 {
+		e := scimPrimaryEmail(in.Emails)
+		ch.Email = &e
+	}
+	ch.Active = in.Active
+	s.scimApplyUserChanges(w, r, cur, ch)
+}
+
+func (s *Service) handleSCIMUserPATCH(w http.ResponseWriter, r *http.Request) {
+	cur, su, ok := s.scimLoadUser(r, r.PathValue("id"))
+	if !ok {
+		scimError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	if scimPreconditionFailed(r, su.Meta.Version) {
+		scimError(w, http.StatusPreconditionFailed, "", "resource version mismatch")
+		return
+	}
+	var req scimPatchRequest
+	if err := decodeSCIM(r, &req); err != nil || len(req.Operations) == 0 {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid patch request")
+		return
+	}
+	ch, err := parseSCIMUserPatch(req.Operations)
+	if err != nil {
+		scimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	s.scimApplyUserChanges(w, r, cur, ch)
+}
+
+func (s *Service) scimApplyUserChanges(w http.ResponseWriter, r *http.Request, cur *core.AdminUser, ch scimUserChanges) {
+	if err := s.applySCIMUserChanges(r.Context(), cur, ch); err != nil {
+		switch {
+		case errors.Is(err, errSCIMConflict):
+			scimError(w, http.StatusConflict, "uniqueness", err.Error())
+		case errors.Is(err, errSCIMInvalidValue):
+			scimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		default:
+			scimError(w, http.StatusInternalServerError, "", "user update failed")
+		}
+		return
+	}
+	_, su, ok := s.scimLoadUser(r, cur.ID)
+	if !ok {
+		scimError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	w.Header().Set("ETag", su.Meta.Version)
+	writeSCIM(w, http.StatusOK, su)
+}
+
+func (s *Service) applySCIMUserChanges(ctx context.Context, cur *core.AdminUser, ch scimUserChanges) error {
+	if ch.UserName != nil {
+		v := strings.TrimSpace(*ch.UserName)
+		switch {
+		case validateUsername(v) == nil:
+			if cur.Username == nil || !strings.EqualFold(*cur.Username, v) {
+				if u, _ := s.svc.GetUserByUsername(ctx, v); u != nil && u.ID != cur.ID {
+					return fmt.Errorf("%w: userName already exists", errSCIMConflict)
+				}
+				if err := s.svc.UpdateUsername(ctx, cur.ID, v); err != nil {
+					return err
+				}
+			}
+		case strings.Contains(v, "@"):
+			// Email-shaped userName: keep the derived username, track the email instead.
+			if ch.Email == nil {
+				ch.Email = &v
+			}
+		default:
+			return fmt.Errorf("%w: userName", errSCIMInvalidValue)
+		}
+	}
+
+	if ch.Email != nil && strings.TrimSpace(*ch.Email) != "" {
+		v := strings.TrimSpace(*ch.Email)
+		if cur.Email == nil || !strings.EqualFold(*cur.Email, v) {
+			if u, _ := s.svc.GetUserByEmail(ctx, v); u != nil && u.ID != cur.ID {
+				return fmt.Errorf("%w: email already exists", errSCIMConflict)
+			}
+			if err := s.svc.UpdateEmail(ctx, cur.ID, v); err != nil {
+				return err
+			}
+			// The directory is authoritative for its users' addresses.
+			if err := s.svc.SetEmailVerified(ctx, cur.ID, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	if ch.Active != nil {
+		switch {
+		case !*ch.Active && cur.BannedAt == nil:
+			reason := scimBanReason
+			if err := s.svc.BanUser(ctx, cur.ID, &reason, nil, ""); err != nil {
+				return err
+			}
+		case *ch.Active && cur.BannedAt != nil:
+			if err := s.svc.UnbanUser(ctx, cur.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Service) handleSCIMUserDELETE(w http.ResponseWriter, r *http.Request) {
+	cur, su, ok := s.scimLoadUser(r, r.PathValue("id"))
+	if !ok {
+		scimError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	if scimPreconditionFailed(r, su.Meta.Version) {
+		scimError(w, http.StatusPreconditionFailed, "", "resource version mismatch")
+		return
+	}
+	if err := s.svc.SoftDeleteUser(r.Context(), cur.ID); err != nil {
+		scimError(w, http.StatusInternalServerError, "", "user deletion failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scimUserAttr normalizes a PATCH path to one of: username, active, emails, emails.value
+// (or the lowercased path for attributes AuthKit ignores).
+func scimUserAttr(path string) string {
+	p := strings.ToLower(strings.TrimSpace(path))
+	p = strings.TrimPrefix(p, strings.ToLower(scimSchemaUser)+":")
+	if strings.HasPrefix(p, "emails[") {
+		if strings.HasSuffix(p, "].value") {
+			return "emails.value"
+		}
+		if strings.HasSuffix(p, "]") {
+			return "emails"
+		}
+	}
+	return p
+}
+
+func (ch *scimUserChanges) set(path string, raw json.RawMessage) error {
+	switch scimUserAttr(path) {
+	case "username":
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil || strings.TrimSpace(v) == "" {
+			return fmt.Errorf("%w: userName", errSCIMInvalidValue)
+		}
+		ch.UserName = &v
+	case "active":
+		v, err := scimBool(raw)
+		if err != nil {
+			return fmt.Errorf("%w: active", errSCIMInvalidValue)
+		}
+		ch.Active = &v
+	case "emails":
+		var list []scimMultiValue
+		if err := json.Unmarshal(raw, &list); err != nil {
+			var one scimMultiValue
+			if err := json.Unmarshal(raw, &one); err != nil {
+				return fmt.Errorf("%w: emails", errSCIMInvalidValue)
+			}
+			list = []scimMultiValue{one}
+		}
+		v := scimPrimaryEmail(list)
+		ch.Email = &v
+	case "emails.value":
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("%w: emails", errSCIMInvalidValue)
+		}
+		ch.Email = &v
+	}
+	return nil
+}
+
+// parseSCIMUserPatch folds PATCH operations into a change set.
+// Path-less add/replace operations carry an attribute map as value (Entra/Okta style).
+func parseSCIMUserPatch(ops []scimPatchOp) (scimUserChanges, error) {
+	var ch scimUserChanges
+	for _, op := range ops {
+		kind := strings.ToLower(strings.TrimSpace(op.Op))
+		switch kind {
+		case "add", "replace":
+		case "remove":
+			switch scimUserAttr(op.Path) {
+			case "":
+				return ch, fmt.Errorf("%w: remove requires a path", errSCIMInvalidValue)
+			case "username", "active", "emails", "emails.value":
+				return ch, fmt.Errorf("%w: %s cannot be removed", errSCIMInvalidValue, op.Path)
+			}
+			continue
+		default:
+			return ch, fmt.Errorf("%w: unsupported op %q", errSCIMInvalidValue, op.Op)
+		}
+		if strings.TrimSpace(op.Path) == "" {
+			var attrs map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &attrs); err != nil {
+				return ch, fmt.Errorf("%w: value must be an object when path is omitted", errSCIMInvalidValue)
+			}
+			for k, v := range attrs {
+				if err := ch.set(k, v); err != nil {
+					return ch, err
+				}
+			}
+			continue
+		}
+		if err := ch.set(op.Path, op.Value); err != nil {
+			return ch, err
+		}
+	}
+	return ch, nil
+}
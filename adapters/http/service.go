@@ -1,16 +1,24 @@
 package authhttp
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	core "github.com/open-rails/authkit/core"
 	oidckit "github.com/open-rails/authkit/oidc"
+	"github.com/open-rails/authkit/ratelimit"
 	memorylimiter "github.com/open-rails/authkit/ratelimit/memory"
+	encryptedstore "github.com/open-rails/authkit/storage/encrypted"
 	memorystore "github.com/open-rails/authkit/storage/memory"
+	postgresstore "github.com/open-rails/authkit/storage/postgres"
 	redisstore "github.com/open-rails/authkit/storage/redis"
+	"github.com/open-rails/authkit/telemetry"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -18,34 +26,58 @@ import (
 type Service struct {
 	svc           *core.Service
 	rd            *redis.Client
+	rlKeys        map[string][]KeyStrategy // WithRateLimitKeys; falls back to DefaultRateLimitKeys
+	pgKV          *postgresstore.KV        // WithPostgresEphemeralStore
+	ephemStore    core.EphemeralStore      // unwrapped store, re-wrapped when encryption changes
+	ephemKeys     *encryptedstore.Keyring  // WithEphemeralEncryption
 	rl            RateLimiter
 	clientIP      ClientIPFunc
 	oidcProviders map[string]oidckit.RPConfig
 	solanaDomain  string // Domain for SIWS messages (optional, derived from request if empty)
 	langCfg       *LanguageConfig
 	authlogr      core.AuthEventLogReader
+	scimToken     string          // Bearer token for SCIM directory clients (SCIMHandler)
+	scimRoles     map[string]bool // role slugs SCIM Groups may manage (WithSCIMGroupRoles)
+	setReceiver   *setReceiver
+
+	samlKey  *rsa.PrivateKey   // SAML SP signing key (WithSAMLServiceProvider)
+	samlCert *x509.Certificate // SAML SP certificate published in SP metadata
+	samlOnce sync.Once
+
+	memStateOnce sync.Once
+	memState     oidckit.StateCache
+
+	challenge        *ChallengeConfig // WithChallenge
+	challengeMemOnce sync.Once
+	challengeMem     core.EphemeralStore
 }
 
-func (s *Service) allow(r *http.Request, bucket string) bool {
-	if s == nil {
-		return true
-	}
-	if s.rl == nil {
-		return true
-	}
-	ipFn := s.clientIP
-	if ipFn == nil {
-		ipFn = DefaultClientIP()
-	}
-	ip := ipFn(r)
-	if strings.TrimSpace(ip) == "" {
-		return true
+// limit applies the named limit to key, writing RateLimit headers to w when the limiter
+// reports quota. Limiter errors fail open.
+func (s *Service) limit(w http.ResponseWriter, r *http.Request, bucket, key string) bool {
+	var ok bool
+	var err error
+	if drl, detailed := s.rl.(DetailedRateLimiter); detailed {
+		var res ratelimit.Result
+		if res, err = drl.AllowNamedDetailed(bucket, key); err == nil {
+			ok = res.Allowed
+			setRateLimitHeaders(w, bucket, res)
+			observeQuota(r.Context(), res.Remaining, res.Limit)
+		}
+	} else {
+		ok, err = s.rl.AllowNamed(bucket, key)
 	}
-	key := "auth:" + bucket + ":ip:" + ip
-	ok, err := s.rl.AllowNamed(bucket, key)
 	if err != nil {
+		// Fail open, but make limiter outages visible.
+		if s.svc != nil {
+			s.svc.Logger().WarnContext(r.Context(), "authkit: rate limiter error; allowing request", "bucket", bucket, "error", err)
+		}
 		return true
 	}
+	if !ok && s.svc != nil {
+		s.svc.Telemetry().RateLimited(r.Context(), bucket)
+		s.svc.Logger().DebugContext(r.Context(), "authkit: rate limited", "bucket", bucket)
+	}
 	return ok
 }
 
@@ -57,13 +89,13 @@ func NewService(cfg core.Config) (*Service, error) {
 		return nil, err
 	}
 	// Default to in-memory ephemeral store for dev/single-instance use.
-	coreSvc = coreSvc.WithEphemeralStore(memorystore.NewKV(), core.EphemeralMemory)
 	s := &Service{
 		svc:           coreSvc,
 		oidcProviders: cfg.Providers,
-		rl:            memorylimiter.New(ToMemoryLimits(DefaultRateLimits())),
+		rl:            memorylimiter.NewGCRA(ToMemoryLimits(DefaultRateLimits())),
 		clientIP:      DefaultClientIP(),
 	}
+	s.setEphemeralStore(memorystore.NewKV(), core.EphemeralMemory)
 	return s, nil
 }
 
@@ -75,10 +107,23 @@ func (s *Service) WithEntitlements(p core.EntitlementsProvider) *Service {
 func (s *Service) WithRedis(rd *redis.Client) *Service {
 	s.rd = rd
 	if rd != nil {
-		s.svc = s.svc.WithEphemeralStore(redisstore.NewKV(rd), core.EphemeralRedis)
+		s.setEphemeralStore(redisstore.NewKV(rd), core.EphemeralRedis)
 	}
 	return s
 }
+
+// WithPostgresEphemeralStore keeps ephemeral auth state, OIDC state and SIWS challenges in
+// the unlogged profiles.ephemeral_kv table, for multi-instance deployments without Redis.
+// Schedule riverjobs.AddSweepEphemeralPeriodicJob to delete expired keys. WithRedis wins
+// when both are configured.
+func (s *Service) WithPostgresEphemeralStore(pool *pgxpool.Pool) *Service {
+	if pool == nil || s.rd != nil {
+		return s
+	}
+	s.pgKV = postgresstore.NewKV(pool)
+	s.setEphemeralStore(s.pgKV, core.EphemeralPostgres)
+	return s
+}
 func (s *Service) WithRateLimiter(rl RateLimiter) *Service { s.rl = rl; return s }
 func (s *Service) DisableRateLimiter() *Service            { s.rl = nil; return s }
 func (s *Service) WithClientIPFunc(fn ClientIPFunc) *Service {
@@ -109,11 +154,116 @@ func (s *Service) WithAuthLogReader(r core.AuthEventLogReader) *Service {
 	s.authlogr = r
 	return s
 }
+func (s *Service) WithExternalPasswordVerifier(v core.ExternalPasswordVerifier) *Service {
+	s.svc = s.svc.WithExternalPasswordVerifier(v)
+	return s
+}
+func (s *Service) WithExternalLinkByEmail(enabled bool) *Service {
+	s.svc = s.svc.WithExternalLinkByEmail(enabled)
+	return s
+}
+func (s *Service) WithOIDCLinkPolicy(p core.OIDCLinkPolicy) *Service {
+	s.svc = s.svc.WithOIDCLinkPolicy(p)
+	return s
+}
+func (s *Service) WithRegistrationPolicy(p core.RegistrationPolicy) *Service {
+	s.svc = s.svc.WithRegistrationPolicy(p)
+	return s
+}
+func (s *Service) WithUsernamePolicy(p core.UsernamePolicy) *Service {
+	s.svc = s.svc.WithUsernamePolicy(p)
+	return s
+}
+func (s *Service) WithMetadata(cfg core.MetadataConfig) (*Service, error) {
+	if _, err := s.svc.WithMetadata(cfg); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// WithDataExport enables POST /auth/user/export. cfg.Events defaults to the reader set by
+// WithAuthLogReader.
+func (s *Service) WithDataExport(e core.DataExportEnqueuer, cfg core.DataExportConfig) *Service {
+	if cfg.Events == nil {
+		cfg.Events = s.authlogr
+	}
+	s.svc = s.svc.WithDataExport(e, cfg)
+	return s
+}
+func (s *Service) WithMergeHook(h core.MergeHook) *Service {
+	s.svc = s.svc.WithMergeHook(h)
+	return s
+}
+func (s *Service) WithSecurityEventPublisher(p core.SecurityEventPublisher) *Service {
+	s.svc = s.svc.WithSecurityEventPublisher(p)
+	return s
+}
+
+// WithWebhookEnqueuer enables outbound security-event webhooks and the
+// /auth/admin/webhooks endpoints' replay actions (see riverjobs.NewWebhookEnqueuer).
+func (s *Service) WithWebhookEnqueuer(e core.WebhookEnqueuer) *Service {
+	s.svc = s.svc.WithWebhookEnqueuer(e)
+	return s
+}
+
+// WithMessageOutbox queues email and SMS in profiles.message_outbox for background
+// delivery with retries (see riverjobs.NewMessageEnqueuer).
+func (s *Service) WithMessageOutbox(e core.MessageEnqueuer) *Service {
+	s.svc = s.svc.WithMessageOutbox(e)
+	return s
+}
+
+// WithLogger sets the structured logger for the HTTP layer and the core service.
+// Records carry request_id, user_id and bucket attributes where known.
+func (s *Service) WithLogger(l *slog.Logger) *Service {
+	s.svc = s.svc.WithLogger(l)
+	return s
+}
+
+// WithTelemetry enables OpenTelemetry spans for every route, core operation, ephemeral
+// store call and outbound OIDC/SAML/Discord request, plus login, token, rate-limit and
+// sender metrics. Telemetry is disabled by default.
+func (s *Service) WithTelemetry(t *telemetry.Telemetry) *Service {
+	s.svc = s.svc.WithTelemetry(t)
+	return s
+}
+
+// outboundHTTPClient returns the client for calls to identity providers.
+func (s *Service) outboundHTTPClient() *http.Client {
+	return s.svc.Telemetry().HTTPClient(nil)
+}
+
 func (s *Service) WithEphemeralStore(store core.EphemeralStore, mode core.EphemeralMode) *Service {
-	s.svc = s.svc.WithEphemeralStore(store, mode)
+	s.setEphemeralStore(store, mode)
 	return s
 }
 
+// WithEphemeralEncryption encrypts ephemeral auth state (pending registrations, codes,
+// OIDC state and PKCE verifiers, SIWS challenges) with AES-256-GCM under keys before it
+// reaches memory, Redis or Postgres. It applies to stores configured before or after it.
+// State written without encryption is unreadable once it is enabled.
+func (s *Service) WithEphemeralEncryption(keys *encryptedstore.Keyring) *Service {
+	s.ephemKeys = keys
+	if s.ephemStore != nil {
+		s.setEphemeralStore(s.ephemStore, s.svc.EphemeralMode())
+	}
+	return s
+}
+
+// setEphemeralStore installs store in the core service, wrapped for encryption when
+// WithEphemeralEncryption is configured.
+func (s *Service) setEphemeralStore(store core.EphemeralStore, mode core.EphemeralMode) {
+	s.ephemStore = store
+	s.svc = s.svc.WithEphemeralStore(s.encryptEphemeral(store), mode)
+}
+
+func (s *Service) encryptEphemeral(store core.EphemeralStore) core.EphemeralStore {
+	if s.ephemKeys == nil || store == nil {
+		return store
+	}
+	return encryptedstore.New(store, s.ephemKeys)
+}
+
 // WithSolanaDomain sets the domain used in SIWS sign-in messages.
 // If not set, the domain is derived from the request Origin or Host header.
 func (s *Service) WithSolanaDomain(domain string) *Service {
@@ -121,11 +271,46 @@ func (s *Service) WithSolanaDomain(domain string) *Service {
 	return s
 }
 
+// WithSCIMToken sets the bearer token that SCIM directory clients (Okta, Entra ID, ...)
+// must present to SCIMHandler. SCIM requests are rejected while no token is set.
+func (s *Service) WithSCIMToken(token string) *Service {
+	s.scimToken = strings.TrimSpace(token)
+	return s
+}
+
+// WithSCIMGroupRoles sets the role slugs that SCIM Groups manage. Groups map only onto
+// these roles: other roles are never listed, changed or deleted through SCIM, and
+// POST /scim/v2/Groups creates roles only from this set. Without it SCIM exposes no groups.
+func (s *Service) WithSCIMGroupRoles(slugs ...string) *Service {
+	s.scimRoles = make(map[string]bool, len(slugs))
+	for _, slug := range slugs {
+		if slug = strings.TrimSpace(slug); slug != "" {
+			s.scimRoles[slug] = true
+		}
+	}
+	return s
+}
+
+// WithSAMLServiceProvider sets the key and certificate used to sign SAML AuthnRequests
+// and published in SP metadata. If cert is nil a self-signed certificate is generated
+// for the key. Without this option SAML login only works in development, where an
+// ephemeral key is generated on first use.
+func (s *Service) WithSAMLServiceProvider(key *rsa.PrivateKey, cert *x509.Certificate) *Service {
+	s.samlKey = key
+	s.samlCert = cert
+	return s
+}
+
 func (s *Service) Core() *core.Service { return s.svc }
 
 func (s *Service) stateCache() oidckit.StateCache {
 	if s.rd != nil {
-		return redisstore.NewStateCache(s.rd, "auth:oidc:state:", 0)
+		return redisstore.NewStateCache(s.rd, "auth:oidc:state:", 0).WithKeyring(s.ephemKeys)
+	}
+	if s.pgKV != nil {
+		return postgresstore.NewStateCache(s.encryptEphemeral(s.pgKV), "auth:oidc:state:", 0)
 	}
-	return memorystore.NewStateCache(15 * time.Minute)
+	// Share one in-memory cache so state written at login is visible at callback.
+	s.memStateOnce.Do(func() { s.memState = memorystore.NewStateCache(15 * time.Minute) })
+	return s.memState
 }
@@ -5,12 +5,16 @@ import (
 
 	"github.com/open-rails/authkit/siws"
 	memorystore "github.com/open-rails/authkit/storage/memory"
+	postgresstore "github.com/open-rails/authkit/storage/postgres"
 	redisstore "github.com/open-rails/authkit/storage/redis"
 )
 
 func (s *Service) siwsCache() siws.ChallengeCache {
 	if s.rd != nil {
-		return redisstore.NewSIWSCache(s.rd, "auth:siws:nonce:", 15*time.Minute)
+		return redisstore.NewSIWSCache(s.rd, "auth:siws:nonce:", 15*time.Minute).WithKeyring(s.ephemKeys)
+	}
+	if s.pgKV != nil {
+		return postgresstore.NewSIWSCache(s.encryptEphemeral(s.pgKV), "auth:siws:nonce:", 15*time.Minute)
 	}
 	return memorystore.NewSIWSCache(15 * time.Minute)
 }
@@ -13,7 +13,7 @@ import (
 )
 
 func (s *Service) handleSolanaChallengePOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLSolanaChallenge) {
+	if !s.allow(w, r, RLSolanaChallenge) {
 		tooMany(w)
 		return
 	}
@@ -73,7 +73,7 @@ func (s *Service) handleSolanaChallengePOST(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *Service) handleSolanaLoginPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLSolanaLogin) {
+	if !s.allow(w, r, RLSolanaLogin) {
 		tooMany(w)
 		return
 	}
@@ -87,6 +87,7 @@ func (s *Service) handleSolanaLoginPOST(w http.ResponseWriter, r *http.Request)
 			Signature     string `json:"signature"`
 			SignedMessage string `json:"signedMessage"`
 		} `json:"output"`
+		InviteCode string `json:"invite_code"`
 	}
 	if err := decodeJSON(r, &req); err != nil {
 		badRequest(w, "invalid_request")
@@ -127,8 +128,13 @@ func (s *Service) handleSolanaLoginPOST(w http.ResponseWriter, r *http.Request)
 		SignedMessage: signedMessage,
 	}
 
-	accessToken, expiresAt, refreshToken, userID, created, err := s.svc.VerifySIWSAndLogin(r.Context(), s.siwsCache(), output, nil)
+	ctx := core.WithRegistrationInvite(r.Context(), req.InviteCode)
+	accessToken, expiresAt, refreshToken, userID, created, err := s.svc.VerifySIWSAndLogin(ctx, s.siwsCache(), output, nil)
 	if err != nil {
+		if registrationDenied(w, err) {
+			return
+		}
+		countLoginFailed(s, r, "solana_login", "siws_verify_failed")
 		if errors.Is(err, core.ErrUserBanned) {
 			unauthorized(w, "user_banned")
 			return
@@ -167,7 +173,7 @@ func (s *Service) handleSolanaLoginPOST(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *Service) handleSolanaLinkPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLSolanaLink) {
+	if !s.allow(w, r, RLSolanaLink) {
 		tooMany(w)
 		return
 	}
@@ -0,0 +1,173 @@
+package authhttp
+
+import (
+	"crypto/subtle"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	core "github.com/open-rails/authkit/core"
+	"github.com/open-rails/authkit/ssf"
+)
+
+// setMaxBytes bounds a pushed SET body.
+const setMaxBytes = 64 << 10
+
+// setJTITTL is how long received SET ids are remembered for deduplication.
+const setJTITTL = 7 * 24 * time.Hour
+
+// SETTransmitter is an upstream Shared Signals transmitter (e.g. Google RISC) whose
+// Security Event Tokens are accepted by the receiver endpoint.
+type SETTransmitter struct {
+	// Issuer is the SET "iss" claim, e.g. "https://accounts.google.com/".
+	Issuer string
+	// JWKSURL serves the transmitter's signing keys
+	// (Google: "https://www.googleapis.com/oauth2/v3/certs").
+	JWKSURL string
+	// Audiences lists accepted "aud" values (Google: your OAuth client IDs). Required.
+	Audiences []string
+	// ProviderIssuer is the profiles.user_providers issuer that subjects are looked up
+	// under. Defaults to the subject's "iss", which must match Issuer.
+	ProviderIssuer string
+}
+
+// SETReceiverConfig configures POST /auth/ssf/events.
+type SETReceiverConfig struct {
+	Transmitters []SETTransmitter
+	// Actions maps event type URIs to actions; nil uses core.DefaultSETActions.
+	Actions map[string]core.SETAction
+	// AuthorizationToken, when set, must be presented as "Authorization: Bearer <token>".
+	AuthorizationToken string
+}
+
+type setReceiver struct {
+	cfg      SETReceiverConfig
+	verifier *Verifier
+	byIssuer map[string]SETTransmitter
+}
+
+// WithSETReceiver enables the Security Event Token receiver at POST /auth/ssf/events.
+// Received CAEP/RISC events revoke sessions of, or ban, the user linked to the event
+// subject in profiles.user_providers.
+func (s *Service) WithSETReceiver(cfg SETReceiverConfig) *Service {
+	accept := core.AcceptConfig{Algorithms: []string{"RS256"}}
+	byIssuer := make(map[string]SETTransmitter, len(cfg.Transmitters))
+	for _, t := range cfg.Transmitters {
+		accept.Issuers = append(accept.Issuers, core.IssuerAccept{Issuer: t.Issuer, JWKSURL: t.JWKSURL, Audiences: t.Audiences})
+		byIssuer[strings.TrimSpace(t.Issuer)] = t
+	}
+	if cfg.Actions == nil {
+		cfg.Actions = core.DefaultSETActions
+	}
+	s.setReceiver = &setReceiver{
+		cfg:      cfg,
+		verifier: NewVerifier(accept).WithHTTPClient(s.outboundHTTPClient()),
+		byIssuer: byIssuer,
+	}
+	return s
+}
+
+// setErr writes an RFC 8935 error response.
+func setErr(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"err": code, "description": description})
+}
+
+// handleSSFEventsPOST implements RFC 8935 push delivery: the body is a single SET.
+// It answers 202 once the SET is verified, including for events that need no action.
+func (s *Service) handleSSFEventsPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLSSFEvents) {
+		tooMany(w)
+		return
+	}
+	rcv := s.setReceiver
+	if rcv == nil {
+		notFound(w, "ssf_receiver_not_configured")
+		return
+	}
+	if want := rcv.cfg.AuthorizationToken; want != "" {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			setErr(w, http.StatusUnauthorized, "authentication_failed", "invalid authorization")
+			return
+		}
+	}
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != ssf.ContentType {
+		setErr(w, http.StatusBadRequest, "invalid_request", "content type must be "+ssf.ContentType)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, setMaxBytes))
+	if err != nil {
+		setErr(w, http.StatusBadRequest, "invalid_request", "unreadable body")
+		return
+	}
+	claims, err := rcv.verifier.Verify(string(body))
+	if err != nil {
+		code := "invalid_request"
+		switch err.Error() {
+		case "bad_issuer":
+			code = "invalid_issuer"
+		case "bad_audience":
+			code = "invalid_audience"
+		case "invalid_token":
+			code = "invalid_key"
+		}
+		setErr(w, http.StatusBadRequest, code, err.Error())
+		return
+	}
+	iss, _ := claims["iss"].(string)
+	jti, _ := claims["jti"].(string)
+	t := rcv.byIssuer[strings.TrimSpace(iss)]
+	// A SET older than the dedup window could be a replay whose jti was already forgotten.
+	if iat, err := jwt.MapClaims(claims).GetIssuedAt(); err != nil || iat == nil || time.Since(iat.Time) > setJTITTL {
+		setErr(w, http.StatusBadRequest, "invalid_request", "stale or missing iat")
+		return
+	}
+	type setAction struct {
+		uri, providerIss, sub string
+		action                core.SETAction
+	}
+	var actions []setAction
+	for uri, event := range ssf.Events(claims) {
+		if ssf.IsVerification(uri) {
+			continue
+		}
+		action := rcv.cfg.Actions[uri]
+		if action == "" || action == core.SETActionNone {
+			continue
+		}
+		subjIss, sub, ok := ssf.IssSubject(jwt.MapClaims(claims), event)
+		if !ok {
+			continue
+		}
+		// A transmitter only speaks for its own subjects; otherwise it could name
+		// another IdP's issuer and act on accounts linked there.
+		if strings.TrimRight(subjIss, "/") != strings.TrimRight(iss, "/") {
+			setErr(w, http.StatusBadRequest, "invalid_request", "subject issuer does not match transmitter")
+			return
+		}
+		providerIss := t.ProviderIssuer
+		if providerIss == "" {
+			providerIss = subjIss
+		}
+		actions = append(actions, setAction{uri: uri, providerIss: providerIss, sub: sub, action: action})
+	}
+
+	// The jti is claimed up front so concurrent redeliveries are processed once, and
+	// released if an action fails so the transmitter's retry is not dropped as a duplicate.
+	if !s.svc.ClaimSecurityEventJTI(r.Context(), iss, jti, setJTITTL) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	for _, a := range actions {
+		if _, err := s.svc.ApplyReceivedSecurityEvent(r.Context(), iss, a.providerIss, a.sub, a.uri, a.action); err != nil {
+			s.svc.Logger().ErrorContext(r.Context(), "authkit: security event action failed", "issuer", iss, "event", a.uri, "error", err)
+			s.svc.ReleaseSecurityEventJTI(r.Context(), iss, jti)
+			serverErr(w, "security_event_failed")
+			return
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,105 @@
+package authhttp
+
+import (
+	"context"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	core "github.com/open-rails/authkit/core"
+	jwtkit "github.com/open-rails/authkit/jwt"
+	"github.com/open-rails/authkit/ssf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSFEvents_VerifiesPushedSET(t *testing.T) {
+	// The transmitter is another AuthKit instance publishing its JWKS.
+	transmitter := newTestCoreService(t)
+	jwks := httptest.NewServer(JWKSHandler(transmitter))
+	t.Cleanup(jwks.Close)
+
+	set, err := transmitter.SecurityEventToken(context.Background(), core.SecurityEvent{
+		ID: "evt-1", Type: core.SecurityEventSessionRevoked, OccurredAt: time.Now(), UserID: "upstream-user",
+	}, "rp-client")
+	require.NoError(t, err)
+
+	s := (&Service{svc: newTestCoreService(t)}).WithSETReceiver(SETReceiverConfig{
+		Transmitters: []SETTransmitter{{Issuer: "https://example.com", JWKSURL: jwks.URL, Audiences: []string{"rp-client"}}},
+	})
+	post := func(body, contentType string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/auth/ssf/events", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		s.APIHandler().ServeHTTP(w, r)
+		return w
+	}
+
+	// No linked user (no Postgres): accepted, nothing to do.
+	require.Equal(t, http.StatusAccepted, post(set, ssf.ContentType).Code)
+
+	w := post(set, "application/json")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), `"err":"invalid_request"`)
+
+	other, err := transmitter.SecurityEventToken(context.Background(), core.SecurityEvent{
+		ID: "evt-2", Type: core.SecurityEventUserBanned, UserID: "upstream-user",
+	}, "someone-else")
+	require.NoError(t, err)
+	w = post(other, ssf.ContentType)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), `"err":"invalid_audience"`)
+
+	forged, err := newTestCoreService(t).SecurityEventToken(context.Background(), core.SecurityEvent{
+		ID: "evt-3", Type: core.SecurityEventUserBanned, UserID: "upstream-user",
+	}, "rp-client")
+	require.NoError(t, err)
+	w = post(forged, ssf.ContentType)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), `"err":"invalid_key"`)
+}
+
+func TestSSFEvents_RejectsSubjectFromAnotherIssuer(t *testing.T) {
+	// Transmitter A is trusted; its SETs name subjects at IdP B.
+	signer, err := jwtkit.NewRSASigner(2048, "a-kid")
+	require.NoError(t, err)
+	transmitter := core.NewService(core.Options{Issuer: "https://a.example"}, core.Keyset{Active: signer, PublicKeys: map[string]*rsa.PublicKey{"a-kid": signer.PublicKey()}})
+	jwks := httptest.NewServer(JWKSHandler(transmitter))
+	t.Cleanup(jwks.Close)
+
+	// Postgres is unreachable, so any attempt to resolve the subject fails with 500.
+	pool, err := pgxpool.New(context.Background(), "postgres://authkit@127.0.0.1:1/authkit")
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	s := (&Service{svc: newTestCoreService(t).WithPostgres(pool)}).WithSETReceiver(SETReceiverConfig{
+		Transmitters: []SETTransmitter{{Issuer: "https://a.example", JWKSURL: jwks.URL, Audiences: []string{"rp-client"}}},
+	})
+	post := func(jti, subjectIss string) *httptest.ResponseRecorder {
+		claims := ssf.NewClaims("https://a.example", "rp-client", jti, time.Now(), ssf.IssSub(subjectIss, "victim"), ssf.RISCAccountDisabled, map[string]any{})
+		set, err := signer.SignTyped(context.Background(), ssf.TokenType, claims)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/auth/ssf/events", strings.NewReader(set))
+		r.Header.Set("Content-Type", ssf.ContentType)
+		s.APIHandler().ServeHTTP(w, r)
+		return w
+	}
+
+	w := post("evt-b", "https://b.example")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "subject issuer does not match transmitter")
+
+	// The transmitter's own subjects (trailing "/" ignored) are looked up.
+	require.Equal(t, http.StatusInternalServerError, post("evt-a", "https://a.example/").Code)
+}
+
+func TestSSFEvents_NotConfigured(t *testing.T) {
+	s := &Service{svc: newTestCoreService(t)}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/auth/ssf/events", strings.NewReader("x"))
+	s.APIHandler().ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
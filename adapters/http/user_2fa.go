@@ -15,7 +15,7 @@ type twoFactorStatusResponse struct {
 }
 
 func (s *Service) handleUser2FAStatusGET(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLUserMe) {
+	if !s.allow(w, r, RLUserMe) {
 		tooMany(w)
 		return
 	}
@@ -39,7 +39,7 @@ func (s *Service) handleUser2FAStatusGET(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *Service) handleUser2FAStartPhonePOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RL2FAStartPhone) {
+	if !s.allow(w, r, RL2FAStartPhone) {
 		tooMany(w)
 		return
 	}
@@ -80,7 +80,7 @@ func (s *Service) handleUser2FAStartPhonePOST(w http.ResponseWriter, r *http.Req
 }
 
 func (s *Service) handleUser2FAEnablePOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RL2FAEnable) {
+	if !s.allow(w, r, RL2FAEnable) {
 		tooMany(w)
 		return
 	}
@@ -138,7 +138,7 @@ func (s *Service) handleUser2FAEnablePOST(w http.ResponseWriter, r *http.Request
 }
 
 func (s *Service) handleUser2FADisablePOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RL2FADisable) {
+	if !s.allow(w, r, RL2FADisable) {
 		tooMany(w)
 		return
 	}
@@ -157,7 +157,7 @@ func (s *Service) handleUser2FADisablePOST(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *Service) handleUser2FARegenerateCodesPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RL2FARegenerateCodes) {
+	if !s.allow(w, r, RL2FARegenerateCodes) {
 		tooMany(w)
 		return
 	}
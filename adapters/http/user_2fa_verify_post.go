@@ -10,7 +10,7 @@ import (
 )
 
 func (s *Service) handleUser2FAVerifyPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RL2FAVerify) {
+	if !s.allow(w, r, RL2FAVerify) {
 		tooMany(w)
 		return
 	}
@@ -20,6 +20,8 @@ func (s *Service) handleUser2FAVerifyPOST(w http.ResponseWriter, r *http.Request
 		Code       string `json:"code"`
 		Challenge  string `json:"challenge"`
 		BackupCode bool   `json:"backup_code"`
+		// LinkToken completes a pending OIDC link whose proof required 2FA.
+		LinkToken string `json:"link_token"`
 	}
 	if err := decodeJSON(r, &req); err != nil {
 		badRequest(w, "invalid_request")
@@ -56,7 +58,25 @@ func (s *Service) handleUser2FAVerifyPOST(w http.ResponseWriter, r *http.Request
 		unauthorized(w, "invalid_code")
 		return
 	}
-	_ = s.svc.Clear2FAChallenge(r.Context(), userID)
+	s.logIfErr(r.Context(), "authkit: clear 2FA challenge failed", s.svc.Clear2FAChallenge(r.Context(), userID), "user_id", userID)
+
+	if linkToken := strings.TrimSpace(req.LinkToken); linkToken != "" {
+		link, err := s.svc.CompletePendingOIDCLink(r.Context(), linkToken, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, core.ErrUserBanned):
+				unauthorized(w, "user_banned")
+			case errors.Is(err, core.ErrProviderAlreadyLinked):
+				sendErr(w, http.StatusConflict, "provider_already_linked")
+			default:
+				badRequest(w, "invalid_or_expired_link")
+			}
+			return
+		}
+		email, _ := s.svc.GetEmailByUserID(r.Context(), userID)
+		s.finishBrowserLogin(w, r, browserLogin{UserID: userID, Email: email, Provider: link.Provider, Method: "oidc_login_2fa", JSON: true})
+		return
+	}
 
 	sid, rt, _, err := s.svc.IssueRefreshSession(r.Context(), userID, r.UserAgent(), nil)
 	if err != nil {
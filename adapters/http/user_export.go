@@ -0,0 +1,64 @@
+package authhttp
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// handleUserExportPOST queues an export of the caller's data; the link arrives by email.
+func (s *Service) handleUserExportPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLUserExport) {
+		tooMany(w)
+		return
+	}
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok || claims.UserID == "" {
+		unauthorized(w, "unauthorized")
+		return
+	}
+	if err := s.svc.RequestDataExport(r.Context(), claims.UserID); err != nil {
+		switch {
+		case errors.Is(err, core.ErrDataExportUnavailable):
+			sendErr(w, http.StatusServiceUnavailable, err.Error())
+		case errors.Is(err, core.ErrDataExportEmailRequired):
+			badRequest(w, err.Error())
+		case errors.Is(err, core.ErrUserNotFound):
+			notFound(w, "user_not_found")
+		default:
+			serverErr(w, "failed_to_request_export")
+		}
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
+}
+
+// handleExportDownloadGET serves a finished export to its signed-in owner; the emailed
+// token alone is not enough.
+func (s *Service) handleExportDownloadGET(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLExportDownload) {
+		tooMany(w)
+		return
+	}
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok || claims.UserID == "" {
+		unauthorized(w, "unauthorized")
+		return
+	}
+	archive, err := s.svc.DataExportArchive(r.Context(), strings.TrimSpace(r.PathValue("token")), claims.UserID)
+	if err != nil {
+		if errors.Is(err, core.ErrDataExportNotFound) {
+			notFound(w, err.Error())
+			return
+		}
+		serverErr(w, "failed_to_load_export")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="data-export.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(archive)
+}
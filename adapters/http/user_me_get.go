@@ -7,22 +7,24 @@ import (
 )
 
 type userMeResponse struct {
-	ID              string   `json:"id"`
-	Email           *string  `json:"email"`
-	PhoneNumber     *string  `json:"phone_number"`
-	Username        string   `json:"username"`
-	DiscordUsername *string  `json:"discord_username,omitempty"`
-	EmailVerified   bool     `json:"email_verified"`
-	PhoneVerified   bool     `json:"phone_verified"`
-	HasPassword     bool     `json:"has_password"`
-	Roles           []string `json:"roles"`
-	Entitlements    []string `json:"entitlements"`
-	Biography       *string  `json:"biography,omitempty"`
-	CreatedAt       *string  `json:"created_at,omitempty"`
+	ID              string         `json:"id"`
+	Email           *string        `json:"email"`
+	PhoneNumber     *string        `json:"phone_number"`
+	Username        string         `json:"username"`
+	DiscordUsername *string        `json:"discord_username,omitempty"`
+	EmailVerified   bool           `json:"email_verified"`
+	PhoneVerified   bool           `json:"phone_verified"`
+	HasPassword     bool           `json:"has_password"`
+	Roles           []string       `json:"roles"`
+	Entitlements    []string       `json:"entitlements"`
+	Biography       *string        `json:"biography,omitempty"`
+	CreatedAt       *string        `json:"created_at,omitempty"`
+	UserMetadata    map[string]any `json:"user_metadata"`
+	AppMetadata     map[string]any `json:"app_metadata"`
 }
 
 func (s *Service) handleUserMeGET(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLUserMe) {
+	if !s.allow(w, r, RLUserMe) {
 		tooMany(w)
 		return
 	}
@@ -71,6 +73,14 @@ func (s *Service) handleUserMeGET(w http.ResponseWriter, r *http.Request) {
 		Entitlements:    adminUser.Entitlements,
 		Biography:       adminUser.Biography,
 		CreatedAt:       createdAt,
+		UserMetadata:    adminUser.UserMetadata,
+		AppMetadata:     adminUser.AppMetadata,
+	}
+	if resp.UserMetadata == nil {
+		resp.UserMetadata = map[string]any{}
+	}
+	if resp.AppMetadata == nil {
+		resp.AppMetadata = map[string]any{}
 	}
 	writeJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,115 @@
+package authhttp
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// handleUserMergeStartPOST is called while signed in to the account that will be merged
+// away; the returned token proves control of it to the surviving account.
+func (s *Service) handleUserMergeStartPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLUserMerge) {
+		tooMany(w)
+		return
+	}
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok || claims.UserID == "" {
+		unauthorized(w, "unauthorized")
+		return
+	}
+	token, ttl, err := s.svc.CreateMergeToken(r.Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, core.ErrUserBanned) {
+			unauthorized(w, "user_banned")
+			return
+		}
+		serverErr(w, "merge_start_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"merge_token": token, "expires_in": int64(ttl.Seconds())})
+}
+
+// handleUserMergeConfirmPOST merges the account that issued merge_token into the caller.
+func (s *Service) handleUserMergeConfirmPOST(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLUserMerge) {
+		tooMany(w)
+		return
+	}
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok || claims.UserID == "" {
+		unauthorized(w, "unauthorized")
+		return
+	}
+	var req struct {
+		MergeToken string `json:"merge_token"`
+	}
+	if err := decodeJSON(r, &req); err != nil || strings.TrimSpace(req.MergeToken) == "" {
+		badRequest(w, "invalid_request")
+		return
+	}
+	sourceID, err := s.svc.ConsumeMergeToken(r.Context(), strings.TrimSpace(req.MergeToken))
+	if err != nil {
+		badRequest(w, "invalid_or_expired_token")
+		return
+	}
+	err = s.svc.MergeUsers(r.Context(), core.AccountMerge{
+		SourceUserID: sourceID,
+		TargetUserID: claims.UserID,
+		InitiatedBy:  core.MergeInitiatedByUser,
+		ActorUserID:  claims.UserID,
+	})
+	if err != nil {
+		writeMergeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "merged_user_id": sourceID})
+}
+
+func (s *Service) handleAdminUsersMergePOST(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SourceUserID string `json:"source_user_id"`
+		TargetUserID string `json:"target_user_id"`
+	}
+	if err := decodeJSON(r, &req); err != nil || strings.TrimSpace(req.SourceUserID) == "" || strings.TrimSpace(req.TargetUserID) == "" {
+		badRequest(w, "invalid_request")
+		return
+	}
+	if !s.allow(w, r, RLAdminUsersMerge) {
+		tooMany(w)
+		return
+	}
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok || strings.TrimSpace(claims.UserID) == "" {
+		unauthorized(w, "unauthorized")
+		return
+	}
+	err := s.svc.MergeUsers(r.Context(), core.AccountMerge{
+		SourceUserID: req.SourceUserID,
+		TargetUserID: req.TargetUserID,
+		InitiatedBy:  core.MergeInitiatedByAdmin,
+		ActorUserID:  claims.UserID,
+	})
+	if err != nil {
+		writeMergeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func writeMergeErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, core.ErrMergeSameUser):
+		badRequest(w, "merge_same_user")
+	case errors.Is(err, core.ErrMergeProviderConflict):
+		sendErr(w, http.StatusConflict, "merge_provider_conflict")
+	case errors.Is(err, core.ErrUserNotFound):
+		notFound(w, "user_not_found")
+	case errors.Is(err, core.ErrUserBanned):
+		unauthorized(w, "user_banned")
+	default:
+		serverErr(w, "merge_failed")
+	}
+}
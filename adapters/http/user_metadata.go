@@ -0,0 +1,87 @@
+package authhttp
+
+import (
+	"errors"
+	"net/http"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// writeMetadataErr maps core metadata errors to responses.
+func writeMetadataErr(w http.ResponseWriter, err error) {
+	var merr *core.MetadataError
+	switch {
+	case errors.As(err, &merr):
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":   core.ErrInvalidMetadata.Error(),
+			"field":   string(merr.Kind),
+			"message": merr.Detail,
+		})
+	case errors.Is(err, core.ErrUserNotFound):
+		notFound(w, "user_not_found")
+	default:
+		serverErr(w, "failed_to_update_metadata")
+	}
+}
+
+// handleUserMetadataPATCH applies a JSON merge patch to the caller's user_metadata.
+func (s *Service) handleUserMetadataPATCH(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLUserMetadata) {
+		tooMany(w)
+		return
+	}
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok || claims.UserID == "" {
+		unauthorized(w, "unauthorized")
+		return
+	}
+	var patch map[string]any
+	if err := decodeJSON(r, &patch); err != nil || patch == nil {
+		badRequest(w, "invalid_request")
+		return
+	}
+	updated, err := s.svc.UpdateUserMetadata(r.Context(), claims.UserID, core.MetadataUser, patch)
+	if err != nil {
+		writeMetadataErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"user_metadata": updated})
+}
+
+// handleAdminUserMetadataPATCH applies merge patches to a user's user_metadata and/or app_metadata.
+func (s *Service) handleAdminUserMetadataPATCH(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, RLAdminUserMetadata) {
+		tooMany(w)
+		return
+	}
+	userID, ok := uuidPathID(w, r, "user_id", "user_not_found")
+	if !ok {
+		return
+	}
+	var req struct {
+		UserMetadata map[string]any `json:"user_metadata"`
+		AppMetadata  map[string]any `json:"app_metadata"`
+	}
+	if err := decodeJSON(r, &req); err != nil || (req.UserMetadata == nil && req.AppMetadata == nil) {
+		badRequest(w, "invalid_request")
+		return
+	}
+	if req.UserMetadata != nil {
+		if _, err := s.svc.UpdateUserMetadata(r.Context(), userID, core.MetadataUser, req.UserMetadata); err != nil {
+			writeMetadataErr(w, err)
+			return
+		}
+	}
+	if req.AppMetadata != nil {
+		if _, err := s.svc.UpdateUserMetadata(r.Context(), userID, core.MetadataApp, req.AppMetadata); err != nil {
+			writeMetadataErr(w, err)
+			return
+		}
+	}
+	user, app, err := s.svc.GetUserMetadata(r.Context(), userID)
+	if err != nil {
+		writeMetadataErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"user_metadata": user, "app_metadata": app})
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func (s *Service) handleUserPasswordPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLUserPasswordChange) {
+	if !s.allow(w, r, RLUserPasswordChange) {
 		tooMany(w)
 		return
 	}
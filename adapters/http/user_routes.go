@@ -6,7 +6,7 @@ import (
 )
 
 func (s *Service) handleUserUsernamePATCH(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLUserUpdateUsername) {
+	if !s.allow(w, r, RLUserUpdateUsername) {
 		tooMany(w)
 		return
 	}
@@ -28,8 +28,10 @@ func (s *Service) handleUserUsernamePATCH(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := s.svc.UpdateUsername(r.Context(), claims.UserID, body.Username); err != nil {
-		badRequest(w, "failed_to_update_username")
+	if err := s.svc.ChangeUsername(r.Context(), claims.UserID, body.Username); err != nil {
+		if !usernameRefused(w, err) {
+			badRequest(w, "failed_to_update_username")
+		}
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
@@ -40,7 +42,7 @@ func (s *Service) handleUserEmailChangeRequestPOST(w http.ResponseWriter, r *htt
 		serverErr(w, "email_verification_unavailable")
 		return
 	}
-	if !s.allow(r, RLUserEmailChangeRequest) {
+	if !s.allow(w, r, RLUserEmailChangeRequest) {
 		tooMany(w)
 		return
 	}
@@ -59,6 +61,10 @@ func (s *Service) handleUserEmailChangeRequestPOST(w http.ResponseWriter, r *htt
 		badRequest(w, "invalid_request")
 		return
 	}
+	if !s.allowTarget(w, r, RLUserEmailChangeRequest, body.NewEmail) {
+		tooMany(w)
+		return
+	}
 
 	_, _, err := s.svc.PasswordLoginByUserID(r.Context(), claims.UserID, body.Password, nil)
 	if err != nil {
@@ -86,7 +92,7 @@ func (s *Service) handleUserEmailChangeRequestPOST(w http.ResponseWriter, r *htt
 }
 
 func (s *Service) handleUserEmailChangeConfirmPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLUserEmailChangeConfirm) {
+	if !s.allow(w, r, RLUserEmailChangeConfirm) {
 		tooMany(w)
 		return
 	}
@@ -122,7 +128,7 @@ func (s *Service) handleUserEmailChangeResendPOST(w http.ResponseWriter, r *http
 		serverErr(w, "email_verification_unavailable")
 		return
 	}
-	if !s.allow(r, RLUserEmailChangeResend) {
+	if !s.allow(w, r, RLUserEmailChangeResend) {
 		tooMany(w)
 		return
 	}
@@ -145,7 +151,7 @@ func (s *Service) handleUserEmailChangeResendPOST(w http.ResponseWriter, r *http
 }
 
 func (s *Service) handleUserPhoneChangeRequestPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLUserPhoneChangeRequest) {
+	if !s.allow(w, r, RLUserPhoneChangeRequest) {
 		tooMany(w)
 		return
 	}
@@ -164,6 +170,10 @@ func (s *Service) handleUserPhoneChangeRequestPOST(w http.ResponseWriter, r *htt
 		badRequest(w, "invalid_request")
 		return
 	}
+	if !s.allowTarget(w, r, RLUserPhoneChangeRequest, body.NewPhone) {
+		tooMany(w)
+		return
+	}
 
 	_, _, err := s.svc.PasswordLoginByUserID(r.Context(), claims.UserID, body.Password, nil)
 	if err != nil {
@@ -191,7 +201,7 @@ func (s *Service) handleUserPhoneChangeRequestPOST(w http.ResponseWriter, r *htt
 }
 
 func (s *Service) handleUserPhoneChangeConfirmPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLUserPhoneChangeConfirm) {
+	if !s.allow(w, r, RLUserPhoneChangeConfirm) {
 		tooMany(w)
 		return
 	}
@@ -225,7 +235,7 @@ func (s *Service) handleUserPhoneChangeConfirmPOST(w http.ResponseWriter, r *htt
 }
 
 func (s *Service) handleUserPhoneChangeResendPOST(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLUserPhoneChangeResend) {
+	if !s.allow(w, r, RLUserPhoneChangeResend) {
 		tooMany(w)
 		return
 	}
@@ -285,7 +295,7 @@ func (s *Service) handleUserBiographyPATCH(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *Service) handleUserDeleteDELETE(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLUserDelete) {
+	if !s.allow(w, r, RLUserDelete) {
 		tooMany(w)
 		return
 	}
@@ -294,12 +304,12 @@ func (s *Service) handleUserDeleteDELETE(w http.ResponseWriter, r *http.Request)
 		unauthorized(w, "unauthorized")
 		return
 	}
-	_ = s.svc.SoftDeleteUser(r.Context(), claims.UserID)
+	s.logIfErr(r.Context(), "authkit: soft delete failed", s.svc.SoftDeleteUser(r.Context(), claims.UserID), "user_id", claims.UserID)
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
 func (s *Service) handleUserUnlinkProviderDELETE(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLUserUnlinkProvider) {
+	if !s.allow(w, r, RLUserUnlinkProvider) {
 		tooMany(w)
 		return
 	}
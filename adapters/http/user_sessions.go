@@ -8,7 +8,7 @@ import (
 )
 
 func (s *Service) handleUserSessionsGET(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLAuthSessionsList) {
+	if !s.allow(w, r, RLAuthSessionsList) {
 		tooMany(w)
 		return
 	}
@@ -38,7 +38,7 @@ func (s *Service) handleUserSessionsGET(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *Service) handleUserSessionDELETE(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLAuthSessionsRevoke) {
+	if !s.allow(w, r, RLAuthSessionsRevoke) {
 		tooMany(w)
 		return
 	}
@@ -61,7 +61,7 @@ func (s *Service) handleUserSessionDELETE(w http.ResponseWriter, r *http.Request
 }
 
 func (s *Service) handleUserSessionsDELETE(w http.ResponseWriter, r *http.Request) {
-	if !s.allow(r, RLAuthSessionsRevokeAll) {
+	if !s.allow(w, r, RLAuthSessionsRevokeAll) {
 		tooMany(w)
 		return
 	}
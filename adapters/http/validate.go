@@ -1,9 +1,13 @@
 package authhttp
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"regexp"
 	"strings"
+
+	core "github.com/open-rails/authkit/core"
 )
 
 func validateUsername(username string) error {
@@ -36,10 +40,26 @@ func validateUsername(username string) error {
 		return fmt.Errorf("username_invalid_characters")
 	}
 
-	lowerUsername := strings.ToLower(username)
-	if lowerUsername == "admin" || lowerUsername == "moderator" {
-		return fmt.Errorf("username_reserved")
-	}
-
 	return nil
 }
+
+// usernameRefused answers a core username policy rejection and reports whether err was one.
+func usernameRefused(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, core.ErrUsernameChangeCooldown) {
+		sendErr(w, http.StatusTooManyRequests, err.Error())
+		return true
+	}
+	for _, refused := range []error{
+		core.ErrUsernameTaken,
+		core.ErrUsernameReserved,
+		core.ErrUsernameNotAllowed,
+		core.ErrUsernameConfusable,
+		core.ErrUsernameHeld,
+	} {
+		if errors.Is(err, refused) {
+			badRequest(w, refused.Error())
+			return true
+		}
+	}
+	return false
+}
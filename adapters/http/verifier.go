@@ -18,6 +18,7 @@ import (
 	jwt "github.com/golang-jwt/jwt/v5"
 	core "github.com/open-rails/authkit/core"
 	jwtkit "github.com/open-rails/authkit/jwt"
+	"github.com/open-rails/authkit/telemetry"
 )
 
 // Verifier validates JWTs from one or more issuers using remote JWKS (verify-only mode).
@@ -65,6 +66,12 @@ func (v *Verifier) WithHTTPClient(c *http.Client) *Verifier {
 	return v
 }
 
+// WithTelemetry traces JWKS fetches made by the verifier.
+func (v *Verifier) WithTelemetry(t *telemetry.Telemetry) *Verifier {
+	v.httpClient = t.HTTPClient(v.httpClient)
+	return v
+}
+
 func (v *Verifier) JWKS() jwtkit.JWKS { return jwtkit.JWKS{} }
 
 func (v *Verifier) Options() core.Options { return core.Options{} }
@@ -0,0 +1,314 @@
+package ldapauth
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+	core "github.com/open-rails/authkit/core"
+)
+
+// Config configures search-then-bind authentication against LDAP or Active Directory.
+type Config struct {
+	// URL of the directory: ldap://host:389 or ldaps://host:636.
+	URL string
+	// StartTLS upgrades ldap:// connections before any credentials are sent.
+	StartTLS bool
+	// AllowInsecure permits plain ldap:// without StartTLS, sending bind passwords in
+	// cleartext. For local development directories only.
+	AllowInsecure bool
+	// TLSConfig is used for ldaps:// and StartTLS. ServerName defaults to the URL host.
+	TLSConfig *tls.Config
+
+	// BindDN/BindPassword is the service account used to search for users.
+	// Leave empty for an anonymous search bind.
+	BindDN       string
+	BindPassword string
+
+	// BaseDN is the user search base.
+	BaseDN string
+	// UserFilter locates the user; {login} is replaced with the escaped login.
+	// Default: (|(uid={login})(mail={login})).
+	// Active Directory: (&(objectClass=user)(|(sAMAccountName={login})(userPrincipalName={login})))
+	UserFilter string
+
+	// IDAttribute holds the stable user ID (e.g. objectGUID, entryUUID). Default: the entry DN.
+	IDAttribute string
+	// UsernameAttribute defaults to uid (sAMAccountName on AD).
+	UsernameAttribute string
+	// EmailAttribute defaults to mail.
+	EmailAttribute string
+	// NameAttribute defaults to displayName.
+	NameAttribute string
+
+	// GroupBaseDN enables a group search with GroupFilter. When empty, groups are
+	// read from the user's memberOf attribute.
+	GroupBaseDN string
+	// GroupFilter finds the user's groups; {dn} is replaced with the escaped user DN.
+	// Default: (member={dn}).
+	GroupFilter string
+	// GroupRoles maps a group DN or CN (case-insensitive) to an AuthKit role slug.
+	// Roles listed here are managed by the directory: they are granted and revoked on login.
+	GroupRoles map[string]string
+
+	// Provider is the provider slug stored on user links. Default: "ldap".
+	Provider string
+	// Issuer identifies the directory in profiles.user_providers. Default: URL.
+	Issuer string
+	// Timeout bounds dialing and each LDAP operation. Default: 10s.
+	Timeout time.Duration
+}
+
+// Verifier implements core.ExternalPasswordVerifier.
+type Verifier struct {
+	cfg Config
+}
+
+var (
+	_ core.ExternalPasswordVerifier = (*Verifier)(nil)
+	_ core.ExternalDirectoryIssuer  = (*Verifier)(nil)
+)
+
+// New validates cfg, applies defaults and returns a Verifier.
+func New(cfg Config) (*Verifier, error) {
+	u, err := url.Parse(strings.TrimSpace(cfg.URL))
+	if err != nil || u.Host == "" || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+		return nil, fmt.Errorf("ldap: invalid url %q", cfg.URL)
+	}
+	if u.Scheme == "ldaps" && cfg.StartTLS {
+		return nil, errors.New("ldap: StartTLS is not used with ldaps://")
+	}
+	if u.Scheme == "ldap" && !cfg.StartTLS && !cfg.AllowInsecure {
+		return nil, errors.New("ldap: ldap:// requires StartTLS (or AllowInsecure)")
+	}
+	if strings.TrimSpace(cfg.BaseDN) == "" {
+		return nil, errors.New("ldap: BaseDN required")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(|(uid={login})(mail={login}))"
+	}
+	if !strings.Contains(cfg.UserFilter, "{login}") {
+		return nil, errors.New("ldap: UserFilter must contain {login}")
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.NameAttribute == "" {
+		cfg.NameAttribute = "displayName"
+	}
+	if cfg.GroupFilter == "" {
+		cfg.GroupFilter = "(member={dn})"
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = "ldap"
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = u.Scheme + "://" + u.Host
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSConfig != nil {
+		tlsCfg = cfg.TLSConfig.Clone()
+	}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName = u.Hostname()
+	}
+	cfg.TLSConfig = tlsCfg
+	return &Verifier{cfg: cfg}, nil
+}
+
+// Issuer returns the issuer stored on user links.
+func (v *Verifier) Issuer() string { return v.cfg.Issuer }
+
+// VerifyPassword searches for the login with the service account, then binds as the
+// found entry with the supplied password.
+func (v *Verifier) VerifyPassword(ctx context.Context, login, password string) (*core.ExternalIdentity, error) {
+	login = strings.TrimSpace(login)
+	// An empty password would be an unauthenticated bind, which many servers accept.
+	if login == "" || password == "" {
+		return nil, core.ErrInvalidCredentials
+	}
+	conn, err := v.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if v.cfg.BindDN != "" {
+		err = conn.Bind(v.cfg.BindDN, v.cfg.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap: service bind: %w", err)
+	}
+
+	attrs := []string{v.cfg.UsernameAttribute, v.cfg.EmailAttribute, v.cfg.NameAttribute, "memberOf"}
+	if v.cfg.IDAttribute != "" {
+		attrs = append(attrs, v.cfg.IDAttribute)
+	}
+	res, err := conn.Search(ldap.NewSearchRequest(
+		v.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(v.cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(v.cfg.UserFilter, "{login}", ldap.EscapeFilter(login)),
+		attrs, nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, core.ErrExternalUserNotFound
+		}
+		return nil, fmt.Errorf("ldap: user search: %w", err)
+	}
+	switch len(res.Entries) {
+	case 0:
+		return nil, core.ErrExternalUserNotFound
+	case 1:
+	default:
+		return nil, fmt.Errorf("ldap: login %q matches multiple entries", login)
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, core.ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap: user bind: %w", err)
+	}
+
+	groups := entry.GetAttributeValues("memberOf")
+	if v.cfg.GroupBaseDN != "" {
+		// Group membership may not be readable by the user; search as the service account.
+		if v.cfg.BindDN != "" {
+			if err := conn.Bind(v.cfg.BindDN, v.cfg.BindPassword); err != nil {
+				return nil, fmt.Errorf("ldap: service bind: %w", err)
+			}
+		}
+		gres, err := conn.Search(ldap.NewSearchRequest(
+			v.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(v.cfg.Timeout.Seconds()), false,
+			strings.ReplaceAll(v.cfg.GroupFilter, "{dn}", ldap.EscapeFilter(entry.DN)),
+			[]string{"cn"}, nil,
+		))
+		if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, fmt.Errorf("ldap: group search: %w", err)
+		}
+		if gres != nil {
+			for _, g := range gres.Entries {
+				groups = append(groups, g.DN)
+			}
+		}
+	}
+
+	subject := entry.DN
+	if v.cfg.IDAttribute != "" {
+		raw := entry.GetRawAttributeValue(v.cfg.IDAttribute)
+		if len(raw) == 0 {
+			return nil, fmt.Errorf("ldap: entry has no %s", v.cfg.IDAttribute)
+		}
+		subject = stableID(raw)
+	}
+	username := entry.GetAttributeValue(v.cfg.UsernameAttribute)
+	if username == "" {
+		username = login
+	}
+	return &core.ExternalIdentity{
+		Provider:     v.cfg.Provider,
+		Issuer:       v.cfg.Issuer,
+		Subject:      subject,
+		Username:     username,
+		Email:        entry.GetAttributeValue(v.cfg.EmailAttribute),
+		Name:         entry.GetAttributeValue(v.cfg.NameAttribute),
+		Roles:        v.rolesForGroups(groups),
+		ManagedRoles: v.managedRoles(),
+	}, nil
+}
+
+func (v *Verifier) dial(ctx context.Context) (*ldap.Conn, error) {
+	d := &net.Dialer{Timeout: v.cfg.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		d.Deadline = deadline
+	}
+	conn, err := ldap.DialURL(v.cfg.URL, ldap.DialWithDialer(d), ldap.DialWithTLSConfig(v.cfg.TLSConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: dial: %w", err)
+	}
+	conn.SetTimeout(v.cfg.Timeout)
+	if v.cfg.StartTLS {
+		if err := conn.StartTLS(v.cfg.TLSConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// rolesForGroups maps group DNs to role slugs, matching GroupRoles keys by DN or CN.
+func (v *Verifier) rolesForGroups(groups []string) []string {
+	if len(v.cfg.GroupRoles) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, g := range groups {
+		keys := []string{g}
+		if dn, err := ldap.ParseDN(g); err == nil && len(dn.RDNs) > 0 {
+			for _, a := range dn.RDNs[0].Attributes {
+				if strings.EqualFold(a.Type, "cn") {
+					keys = append(keys, a.Value)
+				}
+			}
+		}
+		for k, role := range v.cfg.GroupRoles {
+			for _, key := range keys {
+				if strings.EqualFold(k, key) && !seen[role] {
+					seen[role] = true
+					out = append(out, role)
+				}
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (v *Verifier) managedRoles() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, role := range v.cfg.GroupRoles {
+		if !seen[role] {
+			seen[role] = true
+			out = append(out, role)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// stableID renders an ID attribute as text; binary values (AD objectGUID) are hex-encoded.
+func stableID(raw []byte) string {
+	if utf8.Valid(raw) {
+		printable := true
+		for _, r := range string(raw) {
+			if r < 0x20 || r == 0x7f {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return string(raw)
+		}
+	}
+	return hex.EncodeToString(raw)
+}
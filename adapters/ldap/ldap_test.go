@@ -0,0 +1,120 @@
+package ldapauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"testing"
+
+	"github.com/jimlambrt/gldap"
+	"github.com/jimlambrt/gldap/testdirectory"
+	core "github.com/open-rails/authkit/core"
+	"github.com/stretchr/testify/require"
+)
+
+// startDirectory runs an in-process LDAP server (plain listener with StartTLS support).
+func startDirectory(t *testing.T) (*testdirectory.Directory, *tls.Config) {
+	t.Helper()
+	users := testdirectory.NewUsers(t, []string{"alice"}, testdirectory.WithMembersOf(t, "admins"))
+	users = append(users, testdirectory.NewUsers(t, []string{"bob"})...)
+	users = append(users, gldap.NewEntry("cn=svc,ou=people,dc=example,dc=org", map[string][]string{"password": {"svc-secret"}}))
+	d := testdirectory.Start(t,
+		testdirectory.WithNoTLS(t),
+		testdirectory.WithDefaults(t, &testdirectory.Defaults{
+			Users:  users,
+			Groups: []*gldap.Entry{testdirectory.NewGroup(t, "engineering", []string{"alice"})},
+		}),
+	)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM([]byte(d.Cert())))
+	return d, &tls.Config{RootCAs: roots, ServerName: d.Host()}
+}
+
+func newTestVerifier(t *testing.T, d *testdirectory.Directory, tlsCfg *tls.Config, mutate func(*Config)) *Verifier {
+	t.Helper()
+	cfg := Config{
+		URL:            fmt.Sprintf("ldap://%s:%d", d.Host(), d.Port()),
+		StartTLS:       true,
+		TLSConfig:      tlsCfg,
+		BindDN:         "cn=svc,ou=people,dc=example,dc=org",
+		BindPassword:   "svc-secret",
+		BaseDN:         testdirectory.DefaultUserDN,
+		UserFilter:     "(cn={login})",
+		EmailAttribute: "email",
+		NameAttribute:  "name",
+		GroupRoles: map[string]string{
+			"admins": "admin",
+			"cn=engineering,ou=groups,dc=example,dc=org": "engineer",
+			"ops": "ops",
+		},
+	}
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	v, err := New(cfg)
+	require.NoError(t, err)
+	return v
+}
+
+func TestVerifier_SearchThenBindOverStartTLS(t *testing.T) {
+	d, tlsCfg := startDirectory(t)
+	v := newTestVerifier(t, d, tlsCfg, nil)
+
+	id, err := v.VerifyPassword(context.Background(), "alice", "password")
+	require.NoError(t, err)
+	require.Equal(t, "ldap", id.Provider)
+	require.Equal(t, fmt.Sprintf("ldap://%s:%d", d.Host(), d.Port()), id.Issuer)
+	require.Equal(t, "cn=alice,ou=people,dc=example,dc=org", id.Subject)
+	require.Equal(t, "alice", id.Username)
+	require.Equal(t, "alice@example.com", id.Email)
+	require.Equal(t, []string{"admin"}, id.Roles) // from memberOf
+	require.Equal(t, []string{"admin", "engineer", "ops"}, id.ManagedRoles)
+
+	_, err = v.VerifyPassword(context.Background(), "alice", "wrong")
+	require.ErrorIs(t, err, core.ErrInvalidCredentials)
+
+	_, err = v.VerifyPassword(context.Background(), "alice", "")
+	require.ErrorIs(t, err, core.ErrInvalidCredentials)
+
+	_, err = v.VerifyPassword(context.Background(), "mallory", "password")
+	require.ErrorIs(t, err, core.ErrExternalUserNotFound)
+}
+
+func TestVerifier_GroupSearch(t *testing.T) {
+	d, tlsCfg := startDirectory(t)
+	v := newTestVerifier(t, d, tlsCfg, func(c *Config) { c.GroupBaseDN = testdirectory.DefaultGroupDN })
+
+	id, err := v.VerifyPassword(context.Background(), "alice", "password")
+	require.NoError(t, err)
+	require.Equal(t, []string{"admin", "engineer"}, id.Roles)
+
+	id, err = v.VerifyPassword(context.Background(), "bob", "password")
+	require.NoError(t, err)
+	require.Empty(t, id.Roles)
+}
+
+func TestVerifier_ServiceBindFailureIsNotInvalidCredentials(t *testing.T) {
+	d, tlsCfg := startDirectory(t)
+	v := newTestVerifier(t, d, tlsCfg, func(c *Config) { c.BindPassword = "nope" })
+
+	_, err := v.VerifyPassword(context.Background(), "alice", "password")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, core.ErrInvalidCredentials)
+	require.NotErrorIs(t, err, core.ErrExternalUserNotFound)
+}
+
+func TestNew_Validation(t *testing.T) {
+	_, err := New(Config{URL: "http://example.com", BaseDN: "dc=example"})
+	require.Error(t, err)
+	_, err = New(Config{URL: "ldaps://example.com", StartTLS: true, BaseDN: "dc=example"})
+	require.Error(t, err)
+	_, err = New(Config{URL: "ldap://example.com"})
+	require.Error(t, err)
+	_, err = New(Config{URL: "ldap://example.com", StartTLS: true, BaseDN: "dc=example", UserFilter: "(uid=x)"})
+	require.Error(t, err)
+	_, err = New(Config{URL: "ldap://example.com", BaseDN: "dc=example"})
+	require.Error(t, err)
+	_, err = New(Config{URL: "ldap://example.com", AllowInsecure: true, BaseDN: "dc=example"})
+	require.NoError(t, err)
+}
@@ -0,0 +1,111 @@
+package smsgateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSender_Templates(t *testing.T) {
+	var gotQuery, gotAuth string
+	var gotBody map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery, gotAuth = r.URL.RawQuery, r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &gotBody)
+		if gotBody["to"] == "+19999999999" {
+			http.Error(w, "rejected", http.StatusUnprocessableEntity)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := NewHTTPSender(HTTPConfig{
+		URL:       srv.URL + "/send?dest={{query .To}}",
+		Header:    http.Header{"Authorization": {"Bearer k"}},
+		From:      "+15550001111",
+		SenderIDs: SenderIDs{"+49": "MyApp"},
+		Texts:     Texts{AppName: "My \"App\""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SendVerificationCode(context.Background(), "+4915112345678", "654321"); err != nil {
+		t.Fatal(err)
+	}
+	if gotQuery != "dest=%2B4915112345678" || gotAuth != "Bearer k" {
+		t.Fatalf("unexpected request: query=%q auth=%q", gotQuery, gotAuth)
+	}
+	if gotBody["from"] != "MyApp" || gotBody["text"] != `Your My "App" verification code is 654321` {
+		t.Fatalf("unexpected body: %v", gotBody)
+	}
+	if err := s.SendLoginCode(context.Background(), "+19999999999", "1"); err == nil {
+		t.Fatal("expected error for non-2xx response")
+	}
+	if err := s.SendPasswordResetLink(context.Background(), "+15551234567", "t"); !errors.Is(err, ErrPasswordResetURLNotConfigured) {
+		t.Fatalf("expected ErrPasswordResetURLNotConfigured, got %v", err)
+	}
+}
+
+type fakeSMS struct {
+	name string
+	fail bool
+	sent *[]string
+}
+
+func (f fakeSMS) SendVerificationCode(_ context.Context, phone, _ string) error {
+	return f.record(phone)
+}
+func (f fakeSMS) SendLoginCode(_ context.Context, phone, _ string) error { return f.record(phone) }
+func (f fakeSMS) record(phone string) error {
+	*f.sent = append(*f.sent, f.name+":"+phone)
+	if f.fail {
+		return errors.New(f.name + " down")
+	}
+	return nil
+}
+
+type fakeLinkSMS struct{ fakeSMS }
+
+func (f fakeLinkSMS) SendPasswordResetLink(_ context.Context, phone, _ string) error {
+	return f.record(phone)
+}
+
+func TestRouter_FailoverAndRoutes(t *testing.T) {
+	var sent []string
+	primary := fakeSMS{name: "primary", fail: true, sent: &sent}
+	backup := fakeLinkSMS{fakeSMS{name: "backup", sent: &sent}}
+	local := fakeSMS{name: "local", sent: &sent}
+	r := NewRouter(primary, backup).Route("+49", local, backup)
+	ctx := context.Background()
+
+	if err := r.SendLoginCode(ctx, "+15551234567", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SendLoginCode(ctx, "+4915112345678", "1"); err != nil {
+		t.Fatal(err)
+	}
+	// Only backup implements password reset links.
+	if err := r.SendPasswordResetLink(ctx, "+15551234567", "t"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"primary:+15551234567", "backup:+15551234567", "local:+4915112345678", "backup:+15551234567"}
+	if len(sent) != len(want) {
+		t.Fatalf("sent %v, want %v", sent, want)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Fatalf("sent %v, want %v", sent, want)
+		}
+	}
+
+	if err := NewRouter(primary).SendPasswordResetLink(ctx, "+1555", "t"); !errors.Is(err, ErrNoSender) {
+		t.Fatalf("expected ErrNoSender, got %v", err)
+	}
+	if err := NewRouter(primary).SendVerificationCode(ctx, "+1555", "1"); err == nil {
+		t.Fatal("expected error when every provider fails")
+	}
+}
@@ -0,0 +1,149 @@
+package smsgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// DefaultHTTPBody is the request body used when HTTPConfig.Body is empty.
+const DefaultHTTPBody = `{"to":{{json .To}},"from":{{json .From}},"text":{{json .Text}}}`
+
+// HTTPConfig configures an HTTPSender for a vendor SMS API.
+type HTTPConfig struct {
+	// URL receives the request. It is a text/template with the same fields as Body,
+	// so vendors that take parameters in the query string can use {{query .To}}.
+	URL string
+	// Method defaults to POST.
+	Method string
+	// Header is added to every request (e.g. Authorization).
+	Header http.Header
+	// ContentType defaults to "application/json".
+	ContentType string
+	// Body is a text/template rendering the request body from .To, .From and .Text.
+	// Functions: json (JSON string literal), query (URL query escape). Default: DefaultHTTPBody.
+	Body string
+	// From is the default sender ID; SenderIDs overrides it per country.
+	From      string
+	SenderIDs SenderIDs
+	Texts     Texts
+	Client    *http.Client
+}
+
+// HTTPMessage is the data passed to the URL and Body templates.
+type HTTPMessage struct {
+	To   string
+	From string
+	Text string
+}
+
+// HTTPSender implements core.SMSSender and core.SMSSenderWithPasswordResetLink on top of
+// any HTTP SMS API described by request templates. Any 2xx response is a success.
+type HTTPSender struct {
+	cfg  HTTPConfig
+	url  *template.Template
+	body *template.Template
+}
+
+var (
+	_ core.SMSSender                      = (*HTTPSender)(nil)
+	_ core.SMSSenderWithPasswordResetLink = (*HTTPSender)(nil)
+)
+
+var templateFuncs = template.FuncMap{
+	"json": func(s string) (string, error) {
+		b, err := json.Marshal(s)
+		return string(b), err
+	},
+	"query": url.QueryEscape,
+}
+
+// NewHTTPSender parses cfg's templates.
+func NewHTTPSender(cfg HTTPConfig) (*HTTPSender, error) {
+	if strings.TrimSpace(cfg.URL) == "" {
+		return nil, errors.New("smsgateway: URL is required")
+	}
+	if cfg.Body == "" {
+		cfg.Body = DefaultHTTPBody
+	}
+	u, err := template.New("url").Funcs(templateFuncs).Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("smsgateway: URL template: %w", err)
+	}
+	b, err := template.New("body").Funcs(templateFuncs).Parse(cfg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("smsgateway: Body template: %w", err)
+	}
+	return &HTTPSender{cfg: cfg, url: u, body: b}, nil
+}
+
+func (s *HTTPSender) SendVerificationCode(ctx context.Context, phone, code string) error {
+	return s.Send(ctx, phone, s.cfg.Texts.VerificationCodeText(code))
+}
+
+func (s *HTTPSender) SendLoginCode(ctx context.Context, phone, code string) error {
+	return s.Send(ctx, phone, s.cfg.Texts.LoginCodeText(code))
+}
+
+func (s *HTTPSender) SendPasswordResetLink(ctx context.Context, phone, token string) error {
+	text, err := s.cfg.Texts.PasswordResetLinkText(token)
+	if err != nil {
+		return err
+	}
+	return s.Send(ctx, phone, text)
+}
+
+// Send delivers an arbitrary text to phone.
+func (s *HTTPSender) Send(ctx context.Context, phone, text string) error {
+	msg := HTTPMessage{To: phone, From: s.cfg.SenderIDs.For(phone, s.cfg.From), Text: text}
+	var u, body bytes.Buffer
+	if err := s.url.Execute(&u, msg); err != nil {
+		return err
+	}
+	if err := s.body.Execute(&body, msg); err != nil {
+		return err
+	}
+	method := s.cfg.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), &body)
+	if err != nil {
+		return err
+	}
+	for k, vs := range s.cfg.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	contentType := s.cfg.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	client := s.cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	return fmt.Errorf("smsgateway: status %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+}
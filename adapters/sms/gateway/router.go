@@ -0,0 +1,100 @@
+package smsgateway
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// ErrNoSender is returned when no provider can handle a message, e.g. a password reset
+// link when no provider in the chain implements core.SMSSenderWithPasswordResetLink.
+var ErrNoSender = errors.New("smsgateway: no sender available")
+
+type route struct {
+	prefix  string
+	senders []core.SMSSender
+}
+
+// Router picks a provider chain by destination and fails over within it: each provider
+// is tried in order until one succeeds. It implements core.SMSSender and
+// core.SMSSenderWithPasswordResetLink.
+type Router struct {
+	routes   []route
+	fallback []core.SMSSender
+}
+
+var (
+	_ core.SMSSender                      = (*Router)(nil)
+	_ core.SMSSenderWithPasswordResetLink = (*Router)(nil)
+)
+
+// NewRouter returns a Router whose default chain is senders, in order of preference.
+func NewRouter(senders ...core.SMSSender) *Router {
+	return &Router{fallback: senders}
+}
+
+// Route sends numbers starting with prefix (e.g. "+1", "+4477") through senders instead
+// of the default chain. The longest matching prefix wins.
+func (r *Router) Route(prefix string, senders ...core.SMSSender) *Router {
+	r.routes = append(r.routes, route{prefix: prefix, senders: senders})
+	return r
+}
+
+func (r *Router) chain(phone string) []core.SMSSender {
+	best := -1
+	out := r.fallback
+	for _, rt := range r.routes {
+		if strings.HasPrefix(phone, rt.prefix) && len(rt.prefix) > best {
+			best, out = len(rt.prefix), rt.senders
+		}
+	}
+	return out
+}
+
+func (r *Router) SendVerificationCode(ctx context.Context, phone, code string) error {
+	return r.try(ctx, phone, func(s core.SMSSender) (bool, error) {
+		return true, s.SendVerificationCode(ctx, phone, code)
+	})
+}
+
+func (r *Router) SendLoginCode(ctx context.Context, phone, code string) error {
+	return r.try(ctx, phone, func(s core.SMSSender) (bool, error) {
+		return true, s.SendLoginCode(ctx, phone, code)
+	})
+}
+
+func (r *Router) SendPasswordResetLink(ctx context.Context, phone, token string) error {
+	return r.try(ctx, phone, func(s core.SMSSender) (bool, error) {
+		ls, ok := s.(core.SMSSenderWithPasswordResetLink)
+		if !ok {
+			return false, nil
+		}
+		return true, ls.SendPasswordResetLink(ctx, phone, token)
+	})
+}
+
+// try calls send on each provider until one succeeds. send reports false for providers
+// that cannot handle the message. All provider errors are returned joined; a canceled
+// context stops the failover.
+func (r *Router) try(ctx context.Context, phone string, send func(core.SMSSender) (bool, error)) error {
+	var errs []error
+	for _, s := range r.chain(phone) {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		ok, err := send(s)
+		if !ok {
+			continue
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return ErrNoSender
+	}
+	return errors.Join(errs...)
+}
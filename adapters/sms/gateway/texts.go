@@ -0,0 +1,76 @@
+// Package smsgateway holds provider-agnostic SMS building blocks: message texts shared by
+// sender implementations, a sender for arbitrary HTTP SMS APIs, and a Router that fails
+// over between providers.
+package smsgateway
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrPasswordResetURLNotConfigured is returned for password reset links when
+// Texts.PasswordResetURL is empty.
+var ErrPasswordResetURLNotConfigured = errors.New("smsgateway: PasswordResetURL not configured")
+
+// Texts renders SMS bodies. Templates may use {app}, {code} and {link}; empty templates
+// use the defaults.
+type Texts struct {
+	// AppName replaces {app}.
+	AppName string
+	// VerificationCode defaults to "Your {app} verification code is {code}".
+	VerificationCode string
+	// LoginCode defaults to "Your {app} login code is {code}".
+	LoginCode string
+	// PasswordResetLink defaults to "Reset your {app} password: {link}".
+	PasswordResetLink string
+	// PasswordResetURL is the reset page URL with a "{token}" placeholder. AuthKit does not
+	// build user-facing URLs.
+	PasswordResetURL string
+}
+
+// VerificationCodeText returns the phone verification message for code.
+func (t Texts) VerificationCodeText(code string) string {
+	return t.render(t.VerificationCode, "Your {app} verification code is {code}", code, "")
+}
+
+// LoginCodeText returns the 2FA login message for code.
+func (t Texts) LoginCodeText(code string) string {
+	return t.render(t.LoginCode, "Your {app} login code is {code}", code, "")
+}
+
+// PasswordResetLinkText returns the password reset message carrying token.
+func (t Texts) PasswordResetLinkText(token string) (string, error) {
+	if t.PasswordResetURL == "" {
+		return "", ErrPasswordResetURLNotConfigured
+	}
+	link := strings.ReplaceAll(t.PasswordResetURL, "{token}", url.QueryEscape(token))
+	return t.render(t.PasswordResetLink, "Reset your {app} password: {link}", "", link), nil
+}
+
+func (t Texts) render(tpl, def, code, link string) string {
+	if tpl == "" {
+		tpl = def
+		if t.AppName == "" {
+			// "Your {app} login code" reads "Your login code" without an app name.
+			tpl = strings.ReplaceAll(tpl, "{app} ", "")
+		}
+	}
+	return strings.NewReplacer("{app}", t.AppName, "{code}", code, "{link}", link).Replace(tpl)
+}
+
+// SenderIDs maps E.164 country calling code prefixes ("+44", "+1") to sender IDs: a
+// phone number or an alphanumeric sender name where the country allows it.
+type SenderIDs map[string]string
+
+// For returns the sender ID for the longest prefix of phone, or def.
+func (m SenderIDs) For(phone, def string) string {
+	best := -1
+	out := def
+	for prefix, id := range m {
+		if strings.HasPrefix(phone, prefix) && len(prefix) > best {
+			best, out = len(prefix), id
+		}
+	}
+	return out
+}
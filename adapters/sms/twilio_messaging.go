@@ -0,0 +1,212 @@
+package smstwilio
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	smsgateway "github.com/open-rails/authkit/adapters/sms/gateway"
+	core "github.com/open-rails/authkit/core"
+)
+
+// MessagingConfig configures a MessagingSender.
+type MessagingConfig struct {
+	AccountSID string
+	AuthToken  string
+	// MessagingServiceSID sends through a Messaging Service (sender pool). When empty,
+	// From (or a SenderIDs match) is used as the sender.
+	MessagingServiceSID string
+	// From is the default sender: an E.164 number or an alphanumeric sender ID.
+	From string
+	// SenderIDs overrides the sender per country calling code, e.g. {"+44": "MyApp"}.
+	// A match takes precedence over MessagingServiceSID.
+	SenderIDs smsgateway.SenderIDs
+	// StatusCallbackURL, when set, is passed to Twilio for delivery status updates.
+	// Serve StatusCallbackHandler at this exact URL.
+	StatusCallbackURL string
+	// Texts renders message bodies.
+	Texts smsgateway.Texts
+	// BaseURL defaults to https://api.twilio.com (override in tests).
+	BaseURL string
+	Client  *http.Client
+}
+
+// MessagingSender sends SMS through Twilio's Programmable Messaging API. Unlike Sender
+// (Verify API) it can send arbitrary text, so it also implements password reset links.
+type MessagingSender struct {
+	cfg MessagingConfig
+}
+
+var (
+	_ core.SMSSender                      = (*MessagingSender)(nil)
+	_ core.SMSSenderWithPasswordResetLink = (*MessagingSender)(nil)
+)
+
+// NewMessaging validates cfg and returns a MessagingSender.
+func NewMessaging(cfg MessagingConfig) (*MessagingSender, error) {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" {
+		return nil, errors.New("smstwilio: AccountSID and AuthToken are required")
+	}
+	if cfg.MessagingServiceSID == "" && cfg.From == "" && len(cfg.SenderIDs) == 0 {
+		return nil, errors.New("smstwilio: MessagingServiceSID or From is required")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "https://api.twilio.com"
+	}
+	return &MessagingSender{cfg: cfg}, nil
+}
+
+func (s *MessagingSender) httpClient() *http.Client {
+	if s.cfg.Client != nil {
+		return s.cfg.Client
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+func (s *MessagingSender) SendVerificationCode(ctx context.Context, phone, code string) error {
+	_, err := s.Send(ctx, phone, s.cfg.Texts.VerificationCodeText(code))
+	return err
+}
+
+func (s *MessagingSender) SendLoginCode(ctx context.Context, phone, code string) error {
+	_, err := s.Send(ctx, phone, s.cfg.Texts.LoginCodeText(code))
+	return err
+}
+
+func (s *MessagingSender) SendPasswordResetLink(ctx context.Context, phone, token string) error {
+	text, err := s.cfg.Texts.PasswordResetLinkText(token)
+	if err != nil {
+		return err
+	}
+	_, err = s.Send(ctx, phone, text)
+	return err
+}
+
+// Send creates a Message resource and returns its SID.
+// See: https://www.twilio.com/docs/messaging/api/message-resource#create-a-message-resource
+func (s *MessagingSender) Send(ctx context.Context, phone, text string) (string, error) {
+	form := url.Values{}
+	form.Set("To", phone)
+	form.Set("Body", text)
+	if from := s.cfg.SenderIDs.For(phone, ""); from != "" {
+		form.Set("From", from)
+	} else if s.cfg.MessagingServiceSID != "" {
+		form.Set("MessagingServiceSid", s.cfg.MessagingServiceSID)
+	} else {
+		form.Set("From", s.cfg.From)
+	}
+	if s.cfg.StatusCallbackURL != "" {
+		form.Set("StatusCallback", s.cfg.StatusCallbackURL)
+	}
+
+	apiURL := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", strings.TrimRight(s.cfg.BaseURL, "/"), url.PathEscape(s.cfg.AccountSID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(s.cfg.AccountSID, s.cfg.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		SID     string `json:"sid"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&out)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return out.SID, nil
+	}
+	if decodeErr == nil && out.Message != "" {
+		return "", fmt.Errorf("twilio messaging error %d: %s", out.Code, out.Message)
+	}
+	return "", fmt.Errorf("twilio messaging error: status %d", resp.StatusCode)
+}
+
+// MessageStatus is a delivery status update posted by Twilio to StatusCallbackURL.
+type MessageStatus struct {
+	MessageSID string
+	// Status is queued, sending, sent, delivered, undelivered or failed.
+	Status string
+	To     string
+	From   string
+	// ErrorCode is set for undelivered and failed messages.
+	ErrorCode string
+}
+
+// StatusCallbackHandler returns a handler for Twilio status callbacks. Requests must carry
+// a valid X-Twilio-Signature for Config.StatusCallbackURL; fn is called for each update.
+func (s *MessagingSender) StatusCallbackHandler(fn func(context.Context, MessageStatus)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !ValidSignature(s.cfg.AuthToken, s.cfg.StatusCallbackURL, r.PostForm, r.Header.Get("X-Twilio-Signature")) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fn(r.Context(), MessageStatus{
+			MessageSID: r.PostForm.Get("MessageSid"),
+			Status:     r.PostForm.Get("MessageStatus"),
+			To:         r.PostForm.Get("To"),
+			From:       r.PostForm.Get("From"),
+			ErrorCode:  r.PostForm.Get("ErrorCode"),
+		})
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ValidSignature checks a Twilio request signature: base64(HMAC-SHA1(authToken, url +
+// each POST parameter name and value, sorted by name)).
+// See: https://www.twilio.com/docs/usage/security#validating-requests
+func ValidSignature(authToken, fullURL string, params url.Values, signature string) bool {
+	if authToken == "" || signature == "" {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(signatureFor(authToken, fullURL, params), want)
+}
+
+func signatureFor(authToken, fullURL string, params url.Values) []byte {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(fullURL)
+	for _, k := range keys {
+		vs := append([]string(nil), params[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			b.WriteString(k)
+			b.WriteString(v)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,100 @@
+package smstwilio
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	smsgateway "github.com/open-rails/authkit/adapters/sms/gateway"
+)
+
+func TestMessagingSender_Send(t *testing.T) {
+	var got []url.Values
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if u, p, _ := r.BasicAuth(); u != "AC123" || p != "secret" {
+			t.Errorf("unexpected basic auth %q/%q", u, p)
+		}
+		_ = r.ParseForm()
+		got = append(got, r.PostForm)
+		if r.PostForm.Get("To") == "+15550000000" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":21211,"message":"Invalid 'To' Phone Number"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"sid":"SM1"}`))
+	}))
+	defer api.Close()
+
+	s, err := NewMessaging(MessagingConfig{
+		AccountSID:          "AC123",
+		AuthToken:           "secret",
+		MessagingServiceSID: "MG1",
+		SenderIDs:           smsgateway.SenderIDs{"+44": "MyApp"},
+		StatusCallbackURL:   "https://app.example.com/twilio/status",
+		Texts:               smsgateway.Texts{AppName: "MyApp", PasswordResetURL: "https://app.example.com/r?t={token}"},
+		BaseURL:             api.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := s.SendLoginCode(ctx, "+15551234567", "123456"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SendPasswordResetLink(ctx, "+447700900123", "tok"); err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Get("MessagingServiceSid") != "MG1" || got[0].Get("From") != "" || got[0].Get("Body") != "Your MyApp login code is 123456" {
+		t.Fatalf("unexpected US request: %v", got[0])
+	}
+	if got[0].Get("StatusCallback") != "https://app.example.com/twilio/status" {
+		t.Fatalf("missing status callback: %v", got[0])
+	}
+	if got[1].Get("From") != "MyApp" || got[1].Get("Body") != "Reset your MyApp password: https://app.example.com/r?t=tok" {
+		t.Fatalf("unexpected UK request: %v", got[1])
+	}
+
+	err = s.SendVerificationCode(ctx, "+15550000000", "1")
+	if err == nil || !strings.Contains(err.Error(), "21211") {
+		t.Fatalf("expected Twilio error, got %v", err)
+	}
+}
+
+func TestMessagingSender_StatusCallback(t *testing.T) {
+	const callbackURL = "https://app.example.com/twilio/status"
+	s, err := NewMessaging(MessagingConfig{AccountSID: "AC123", AuthToken: "secret", From: "+15550001111", StatusCallbackURL: callbackURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updates []MessageStatus
+	h := s.StatusCallbackHandler(func(_ context.Context, st MessageStatus) { updates = append(updates, st) })
+
+	form := url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30003"}, "To": {"+15551234567"}}
+	post := func(sig string) int {
+		r := httptest.NewRequest(http.MethodPost, "/twilio/status", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Twilio-Signature", sig)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := post(base64.StdEncoding.EncodeToString([]byte("forged"))); code != http.StatusForbidden {
+		t.Fatalf("forged signature: got %d", code)
+	}
+	sig := base64.StdEncoding.EncodeToString(signatureFor("secret", callbackURL, form))
+	if code := post(sig); code != http.StatusNoContent {
+		t.Fatalf("valid signature: got %d", code)
+	}
+	if len(updates) != 1 || updates[0].Status != "undelivered" || updates[0].ErrorCode != "30003" {
+		t.Fatalf("unexpected updates: %+v", updates)
+	}
+}
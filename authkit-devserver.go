@@ -19,6 +19,7 @@ import (
 	"github.com/open-rails/authkit/core"
 	jwtkit "github.com/open-rails/authkit/jwt"
 	pgmigrations "github.com/open-rails/authkit/migrations/postgres"
+	authkittesting "github.com/open-rails/authkit/testing"
 )
 
 type config struct {
@@ -27,6 +28,8 @@ type config struct {
 	DBURL          string
 	DevMode        bool
 	DevMintSecret  string
+	DevInbox       bool
+	DevResetURL    string
 	MigrateOnStart bool
 }
 
@@ -62,6 +65,7 @@ func loadConfig() (*config, error) {
 		DBURL:          firstEnv("DB_URL", "DATABASE_URL"),
 		DevMode:        envBool("AUTHKIT_DEV_MODE", false),
 		DevMintSecret:  strings.TrimSpace(os.Getenv("AUTHKIT_DEV_MINT_SECRET")),
+		DevResetURL:    strings.TrimSpace(os.Getenv("AUTHKIT_DEV_RESET_URL")),
 		MigrateOnStart: envBool("AUTHKIT_MIGRATE_ON_START", true),
 	}
 	if c.Issuer == "" {
@@ -73,6 +77,10 @@ func loadConfig() (*config, error) {
 	if c.DevMode && c.DevMintSecret == "" {
 		return nil, fmt.Errorf("AUTHKIT_DEV_MINT_SECRET is required when AUTHKIT_DEV_MODE=true")
 	}
+	c.DevInbox = envBool("AUTHKIT_DEV_INBOX", c.DevMode)
+	if c.DevInbox && !core.IsDevEnvironment() {
+		return nil, fmt.Errorf("AUTHKIT_DEV_INBOX exposes verification codes and requires a dev ENV")
+	}
 	return c, nil
 }
 
@@ -110,6 +118,14 @@ func runServe(cfg *config) error {
 	}
 	svc.WithPostgres(pg)
 
+	// Dev inbox: capture emails and SMS instead of sending them.
+	var inbox *authkittesting.Inbox
+	if cfg.DevInbox {
+		inbox = authkittesting.NewInbox()
+		inbox.ResetURL = cfg.DevResetURL
+		svc.WithEmailSender(inbox.EmailSender()).WithSMSSender(inbox.SMSSender())
+	}
+
 	apiH := svc.APIHandler()
 	oidcH := svc.OIDCHandler()
 	jwksH := svc.JWKSHandler()
@@ -118,6 +134,9 @@ func runServe(cfg *config) error {
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
 	})
+	if inbox != nil {
+		mux.Handle("/dev/inbox/", http.StripPrefix("/dev/inbox", inbox.Handler()))
+	}
 	// Public: consumers (e.g., billing) fetch keys here.
 	mux.Handle("/.well-known/jwks.json", jwksH)
 	// Auth routes: dispatch browser flows vs JSON API.
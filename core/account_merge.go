@@ -0,0 +1,260 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/open-rails/authkit/telemetry"
+)
+
+// Merge initiators recorded on AccountMerge and in audit events.
+const (
+	MergeInitiatedByAdmin = "admin"
+	MergeInitiatedByUser  = "user"
+)
+
+const mergeTokenTTL = 10 * time.Minute
+
+var (
+	// ErrMergeSameUser indicates the source and target of a merge are the same account.
+	ErrMergeSameUser = errors.New("merge_same_user")
+	// ErrMergeProviderConflict indicates both accounts are linked to the same issuer
+	// (e.g. two different Google accounts); one link must be removed before merging.
+	ErrMergeProviderConflict = errors.New("merge_provider_conflict")
+)
+
+// AccountMerge describes a merge of SourceUserID into TargetUserID (the survivor).
+type AccountMerge struct {
+	SourceUserID string
+	TargetUserID string
+	InitiatedBy  string // MergeInitiatedByAdmin or MergeInitiatedByUser
+	ActorUserID  string // admin or user performing the merge
+}
+
+// MergeHook lets the host re-parent its own rows from the source to the target user.
+// It runs inside the merge transaction; returning an error aborts the merge.
+type MergeHook func(ctx context.Context, tx pgx.Tx, m AccountMerge) error
+
+type mergeTokenData struct {
+	SourceUserID string `json:"source_user_id"`
+}
+
+// WithMergeHook registers a hook called by MergeUsers.
+func (s *Service) WithMergeHook(h MergeHook) *Service {
+	s.mergeHook = h
+	return s
+}
+
+// CreateMergeToken issues a short-lived, single-use token proving control of
+// sourceUserID. The token is redeemed by the surviving account via ConsumeMergeToken.
+func (s *Service) CreateMergeToken(ctx context.Context, sourceUserID string) (string, time.Duration, error) {
+	if err := s.ensureUserAccessByID(ctx, sourceUserID); err != nil {
+		return "", 0, err
+	}
+	token := randB64(32)
+	if err := s.ephemSetJSON(ctx, keyMergeToken+sha256Hex(token), mergeTokenData{SourceUserID: sourceUserID}, mergeTokenTTL); err != nil {
+		return "", 0, err
+	}
+	return token, mergeTokenTTL, nil
+}
+
+// ConsumeMergeToken redeems a merge token and returns the source user ID.
+func (s *Service) ConsumeMergeToken(ctx context.Context, token string) (string, error) {
+	key := keyMergeToken + sha256Hex(token)
+	var data mergeTokenData
+	ok, err := s.ephemGetDelJSON(ctx, key, &data)
+	if err != nil || !ok || data.SourceUserID == "" {
+		return "", jwt.ErrTokenUnverifiable
+	}
+	return data.SourceUserID, nil
+}
+
+// MergeUsers moves provider links (including wallets), roles, active sessions,
+// 2FA settings and, where the target has none, the password, email and phone of the
+// source user onto the target, runs the host MergeHook and soft-deletes the source.
+// Everything happens in one transaction. User-initiated merges require both accounts
+// to be in good standing.
+func (s *Service) MergeUsers(ctx context.Context, m AccountMerge) (err error) {
+	ctx, span := s.startSpan(ctx, "MergeUsers")
+	defer func() { telemetry.End(span, err) }()
+	if s.pg == nil {
+		return fmt.Errorf("postgres not configured")
+	}
+	m.SourceUserID = strings.TrimSpace(m.SourceUserID)
+	m.TargetUserID = strings.TrimSpace(m.TargetUserID)
+	if m.SourceUserID == "" || m.TargetUserID == "" {
+		return ErrUserNotFound
+	}
+	if m.SourceUserID == m.TargetUserID {
+		return ErrMergeSameUser
+	}
+	if m.InitiatedBy == MergeInitiatedByUser {
+		if err := s.ensureUserAccessByID(ctx, m.SourceUserID); err != nil {
+			return err
+		}
+		if err := s.ensureUserAccessByID(ctx, m.TargetUserID); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.pg.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Lock both rows so concurrent merges/deletes cannot interleave.
+	type mergeUser struct {
+		email         *string
+		emailVerified bool
+		phone         *string
+		phoneVerified bool
+	}
+	users := map[string]*mergeUser{}
+	rows, err := tx.Query(ctx, `
+		SELECT id::text, email::text, email_verified, phone_number, COALESCE(phone_verified,false)
+		FROM profiles.users
+		WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+		FOR UPDATE`, []string{m.SourceUserID, m.TargetUserID})
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id string
+		u := &mergeUser{}
+		if err := rows.Scan(&id, &u.email, &u.emailVerified, &u.phone, &u.phoneVerified); err != nil {
+			rows.Close()
+			return err
+		}
+		users[id] = u
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	src, tgt := users[m.SourceUserID], users[m.TargetUserID]
+	if src == nil || tgt == nil {
+		return ErrUserNotFound
+	}
+
+	var conflicts int
+	if err := tx.QueryRow(ctx, `
+		SELECT count(*) FROM profiles.user_providers a
+		JOIN profiles.user_providers b ON b.issuer = a.issuer AND b.user_id = $2
+		WHERE a.user_id = $1`, m.SourceUserID, m.TargetUserID).Scan(&conflicts); err != nil {
+		return err
+	}
+	if conflicts > 0 {
+		return ErrMergeProviderConflict
+	}
+
+	both := []any{m.SourceUserID, m.TargetUserID}
+	srcOnly := []any{m.SourceUserID}
+	stmts := []struct {
+		q    string
+		args []any
+	}{
+		// Provider links (OIDC, SAML, LDAP, Solana wallets).
+		{`UPDATE profiles.user_providers SET user_id = $2 WHERE user_id = $1`, both},
+		// Roles: union, then drop the source's grants.
+		{`INSERT INTO profiles.user_roles (user_id, role_id)
+		 SELECT $2, role_id FROM profiles.user_roles WHERE user_id = $1
+		 ON CONFLICT (user_id, role_id) DO NOTHING`, both},
+		{`DELETE FROM profiles.user_roles WHERE user_id = $1`, srcOnly},
+		// Active sessions keep working and now belong to the survivor.
+		{`UPDATE profiles.refresh_sessions SET user_id = $2 WHERE user_id = $1 AND revoked_at IS NULL`, both},
+		// 2FA: never downgrade; an enabled source setting replaces a disabled target one.
+		{`INSERT INTO profiles.two_factor_settings (user_id, enabled, method, phone_number, backup_codes, created_at, updated_at)
+		 SELECT $2, enabled, method, phone_number, backup_codes, created_at, now()
+		 FROM profiles.two_factor_settings WHERE user_id = $1
+		 ON CONFLICT (user_id) DO UPDATE
+		 SET enabled = EXCLUDED.enabled, method = EXCLUDED.method, phone_number = EXCLUDED.phone_number,
+		     backup_codes = EXCLUDED.backup_codes, updated_at = now()
+		 WHERE NOT profiles.two_factor_settings.enabled AND EXCLUDED.enabled`, both},
+		{`DELETE FROM profiles.two_factor_settings WHERE user_id = $1`, srcOnly},
+		// Password: only when the survivor has none.
+		{`INSERT INTO profiles.user_passwords (user_id, password_hash, hash_algo, hash_params, password_updated_at)
+		 SELECT $2, password_hash, hash_algo, hash_params, password_updated_at
+		 FROM profiles.user_passwords WHERE user_id = $1
+		 ON CONFLICT (user_id) DO NOTHING`, both},
+		{`DELETE FROM profiles.user_passwords WHERE user_id = $1`, srcOnly},
+	}
+	for _, st := range stmts {
+		if _, err := tx.Exec(ctx, st.q, st.args...); err != nil {
+			return err
+		}
+	}
+
+	// Email/phone are unique: release them on the source before handing them over.
+	moveEmail := tgt.email == nil && src.email != nil
+	movePhone := tgt.phone == nil && src.phone != nil
+	if _, err := tx.Exec(ctx, `
+		UPDATE profiles.users
+		SET email = CASE WHEN $2 THEN NULL ELSE email END,
+		    phone_number = CASE WHEN $3 THEN NULL ELSE phone_number END,
+		    deleted_at = now(), updated_at = now()
+		WHERE id = $1`, m.SourceUserID, moveEmail, movePhone); err != nil {
+		return err
+	}
+	if moveEmail || movePhone {
+		if _, err := tx.Exec(ctx, `
+			UPDATE profiles.users
+			SET email = CASE WHEN $2 THEN $3 ELSE email END,
+			    email_verified = CASE WHEN $2 THEN $4 ELSE email_verified END,
+			    phone_number = CASE WHEN $5 THEN $6 ELSE phone_number END,
+			    phone_verified = CASE WHEN $5 THEN $7 ELSE phone_verified END,
+			    updated_at = now()
+			WHERE id = $1`, m.TargetUserID, moveEmail, src.email, src.emailVerified, movePhone, src.phone, src.phoneVerified); err != nil {
+			return err
+		}
+	}
+
+	if s.mergeHook != nil {
+		if err := s.mergeHook(ctx, tx, m); err != nil {
+			return fmt.Errorf("merge hook: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	s.logAccountMerged(ctx, m)
+	// The source account is gone for relying parties just as after a soft delete.
+	s.publishSecurityEvent(ctx, SecurityEventUserDeleted, m.SourceUserID, "", map[string]any{"soft": true, "merged_into": m.TargetUserID})
+	return nil
+}
+
+// logAccountMerged records the merge on both users' event streams.
+func (s *Service) logAccountMerged(ctx context.Context, m AccountMerge) {
+	if s.authlog == nil {
+		return
+	}
+	method := m.InitiatedBy
+	var actor *string
+	if a := strings.TrimSpace(m.ActorUserID); a != "" {
+		actor = &a
+	}
+	now := time.Now().UTC()
+	for _, e := range []struct{ user, related, reason string }{
+		{m.SourceUserID, m.TargetUserID, "merged_into"},
+		{m.TargetUserID, m.SourceUserID, "merged_from"},
+	} {
+		reason, related := e.reason, e.related
+		err := s.authlog.LogSessionEvent(ctx, AuthSessionEvent{
+			OccurredAt:    now,
+			Issuer:        s.opts.Issuer,
+			UserID:        e.user,
+			Event:         SessionEventAccountMerged,
+			Method:        &method,
+			Reason:        &reason,
+			RelatedUserID: &related,
+			ActorUserID:   actor,
+		})
+		s.logIfErr(ctx, "authkit: auth event log failed", err, "user_id", e.user)
+	}
+}
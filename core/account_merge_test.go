@@ -0,0 +1,28 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	memorystore "github.com/open-rails/authkit/storage/memory"
+)
+
+func TestMergeToken_SingleUse(t *testing.T) {
+	svc := NewService(Options{}, Keyset{})
+	svc.WithEphemeralStore(memorystore.NewKV(), EphemeralMemory)
+	ctx := context.Background()
+
+	token := "merge-token"
+	if err := svc.ephemSetJSON(ctx, keyMergeToken+sha256Hex(token), mergeTokenData{SourceUserID: "src"}, mergeTokenTTL); err != nil {
+		t.Fatalf("seed merge token: %v", err)
+	}
+	got, err := svc.ConsumeMergeToken(ctx, token)
+	if err != nil || got != "src" {
+		t.Fatalf("expected source user src, got %q (%v)", got, err)
+	}
+	if _, err := svc.ConsumeMergeToken(ctx, token); !errors.Is(err, jwt.ErrTokenUnverifiable) {
+		t.Fatalf("expected merge token to be single-use, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -14,6 +15,7 @@ const (
 	SessionEventPasswordChange   SessionEventType = "password_changed"
 	SessionEventPasswordRecovery SessionEventType = "password_recovery"
 	SessionEventFailed           SessionEventType = "session_failed"
+	SessionEventAccountMerged    SessionEventType = "account_merged"
 )
 
 // SessionRevokeReason identifies why a session (or set of sessions) was revoked.
@@ -33,6 +35,7 @@ const (
 	SessionRevokeReasonSoftDeleted          SessionRevokeReason = "soft_deleted"
 	SessionRevokeReasonEvicted              SessionRevokeReason = "evicted"
 	SessionRevokeReasonRefreshReuseDetected SessionRevokeReason = "refresh_reuse_detected"
+	SessionRevokeReasonSecurityEvent        SessionRevokeReason = "security_event"
 )
 
 // AuthSessionEvent is a best-effort, append-only session lifecycle record intended for external sinks.
@@ -51,6 +54,11 @@ type AuthSessionEvent struct {
 	Reason     *string
 	IPAddr     *string
 	UserAgent  *string
+	// RelatedUserID is the other account involved, e.g. the counterpart of an account merge.
+	RelatedUserID *string
+	// ActorUserID is the account that performed the action when it is not UserID, e.g. the
+	// admin who merged two accounts.
+	ActorUserID *string
 }
 
 // AuthEventLogger records authentication session lifecycle events to an external sink (e.g., ClickHouse).
@@ -66,3 +74,34 @@ type AuthEventLogReader interface {
 	// If userID is empty, returns events for all users.
 	ListSessionEvents(ctx context.Context, userID string, eventTypes ...SessionEventType) ([]AuthSessionEvent, error)
 }
+
+// ErrInvalidCursor is returned by AuthEventLogPageReader implementations for malformed cursors.
+var ErrInvalidCursor = errors.New("invalid_cursor")
+
+// SessionEventQuery filters and paginates session events. Results are ordered newest first.
+type SessionEventQuery struct {
+	// UserID restricts results to one user; empty means all users.
+	UserID string
+	// EventTypes restricts results to any of the given types; empty means all types.
+	EventTypes []SessionEventType
+	// Since and Until bound OccurredAt (inclusive, exclusive); zero values are unbounded.
+	Since time.Time
+	Until time.Time
+	// Limit caps the page size; implementations apply a default when <= 0.
+	Limit int
+	// Cursor is the NextCursor from a previous page; empty starts from the newest event.
+	Cursor string
+}
+
+// SessionEventPage is one page of session events.
+type SessionEventPage struct {
+	Events []AuthSessionEvent
+	// NextCursor is empty when there are no more events.
+	NextCursor string
+}
+
+// AuthEventLogPageReader is an optional extension of AuthEventLogReader with filtering and
+// cursor pagination.
+type AuthEventLogPageReader interface {
+	ListSessionEventsPage(ctx context.Context, q SessionEventQuery) (SessionEventPage, error)
+}
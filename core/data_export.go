@@ -0,0 +1,367 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	entpg "github.com/open-rails/authkit/entitlements"
+	"github.com/open-rails/authkit/telemetry"
+)
+
+var (
+	// ErrDataExportUnavailable indicates exports are not configured: no enqueuer, no
+	// ephemeral store, or an EmailSender without EmailSenderWithDataExportLink.
+	ErrDataExportUnavailable = errors.New("data_export_unavailable")
+	// ErrDataExportEmailRequired indicates the user has no email to receive the link.
+	ErrDataExportEmailRequired = errors.New("email_required")
+	// ErrDataExportNotFound indicates the download token is unknown or expired.
+	ErrDataExportNotFound = errors.New("export_not_found")
+)
+
+// defaultDataExportLinkTTL is how long a finished export can be downloaded.
+const defaultDataExportLinkTTL = 48 * time.Hour
+
+// dataExportEventPages bounds how many event pages an export reads from a paginating reader.
+const dataExportEventPages = 100
+
+// DataExportEnqueuer schedules building a user's data export.
+// riverjobs.NewDataExportEnqueuer provides the River-backed implementation.
+type DataExportEnqueuer interface {
+	EnqueueDataExport(ctx context.Context, userID string) error
+}
+
+// DataExportContributor returns host application data for a user's export. The value
+// must be JSON-encodable.
+type DataExportContributor func(ctx context.Context, userID string) (any, error)
+
+// DataExportConfig configures user data exports.
+type DataExportConfig struct {
+	// LinkTTL is how long the emailed download link stays valid (default 48h).
+	LinkTTL time.Duration
+	// Events reads the user's session events. Defaults to the AuthEventLogger when it
+	// also implements AuthEventLogReader; without one the export has no events.
+	Events AuthEventLogReader
+	// Contributors add host application data under "app.<name>". A contributor error
+	// fails the export so the job retries; a partial export is never sent.
+	Contributors map[string]DataExportContributor
+}
+
+// WithDataExport enables self-service data exports. Exports are built in the background
+// by the enqueuer's worker, stored in the ephemeral store and announced by email.
+func (s *Service) WithDataExport(e DataExportEnqueuer, cfg DataExportConfig) *Service {
+	s.exportEnqueuer = e
+	s.exportCfg = cfg
+	return s
+}
+
+func (s *Service) dataExportLinkTTL() time.Duration {
+	if s.exportCfg.LinkTTL > 0 {
+		return s.exportCfg.LinkTTL
+	}
+	return defaultDataExportLinkTTL
+}
+
+func (s *Service) dataExportEvents() AuthEventLogReader {
+	if s.exportCfg.Events != nil {
+		return s.exportCfg.Events
+	}
+	r, _ := s.authlog.(AuthEventLogReader)
+	return r
+}
+
+// DataExport is the machine-readable archive of a user's data. Secrets (password and
+// token hashes, 2FA backup codes) are never included.
+type DataExport struct {
+	GeneratedAt  time.Time            `json:"generated_at"`
+	Issuer       string               `json:"issuer"`
+	Profile      *AdminUser           `json:"profile"`
+	Providers    []DataExportProvider `json:"providers"`
+	Sessions     []DataExportSession  `json:"sessions"`
+	TwoFactor    DataExportTwoFactor  `json:"two_factor"`
+	Roles        []string             `json:"roles"`
+	Entitlements []entpg.Entitlement  `json:"entitlements"`
+	Events       []DataExportEvent    `json:"events"`
+	App          map[string]any       `json:"app,omitempty"`
+}
+
+// DataExportProvider is a linked external identity.
+type DataExportProvider struct {
+	Provider        *string         `json:"provider"`
+	Issuer          string          `json:"issuer"`
+	Subject         string          `json:"subject"`
+	EmailAtProvider *string         `json:"email_at_provider,omitempty"`
+	Profile         json.RawMessage `json:"profile,omitempty"`
+	LinkedAt        time.Time       `json:"linked_at"`
+}
+
+// DataExportSession is a refresh session, including revoked ones.
+type DataExportSession struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	UserAgent  *string    `json:"user_agent,omitempty"`
+	IPAddr     *string    `json:"ip_addr,omitempty"`
+}
+
+// DataExportTwoFactor is the user's 2FA status without backup codes.
+type DataExportTwoFactor struct {
+	Enabled              bool       `json:"enabled"`
+	Method               string     `json:"method,omitempty"`
+	PhoneNumber          *string    `json:"phone_number,omitempty"`
+	BackupCodesRemaining int        `json:"backup_codes_remaining"`
+	UpdatedAt            *time.Time `json:"updated_at,omitempty"`
+}
+
+// DataExportEvent is a session lifecycle event from the auth event log.
+type DataExportEvent struct {
+	OccurredAt time.Time        `json:"occurred_at"`
+	SessionID  string           `json:"session_id"`
+	Event      SessionEventType `json:"event"`
+	Method     *string          `json:"method,omitempty"`
+	Reason     *string          `json:"reason,omitempty"`
+	IPAddr     *string          `json:"ip_addr,omitempty"`
+	UserAgent  *string          `json:"user_agent,omitempty"`
+}
+
+// dataExportRecord is the ephemeral value behind a download token.
+type dataExportRecord struct {
+	UserID  string          `json:"user_id"`
+	Archive json.RawMessage `json:"archive"`
+}
+
+func dataExportKey(token string) string { return "data_export:" + sha256Hex(token) }
+
+// RequestDataExport queues an export of the user's data. The user is emailed a download
+// link once it is ready.
+func (s *Service) RequestDataExport(ctx context.Context, userID string) (err error) {
+	ctx, span := s.startSpan(ctx, "RequestDataExport")
+	defer func() { telemetry.End(span, err) }()
+	if s.exportEnqueuer == nil || !s.useEphemeralStore() {
+		return ErrDataExportUnavailable
+	}
+	if _, ok := s.email.(EmailSenderWithDataExportLink); !ok {
+		return ErrDataExportUnavailable
+	}
+	u, err := s.AdminGetUser(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && u == nil) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if u.Email == nil || *u.Email == "" {
+		return ErrDataExportEmailRequired
+	}
+	return s.exportEnqueuer.EnqueueDataExport(ctx, userID)
+}
+
+// DeliverDataExport builds the user's export, stores it for the configured link TTL and
+// emails the download token. Deleted users and users without an email are skipped.
+func (s *Service) DeliverDataExport(ctx context.Context, userID string) (err error) {
+	ctx, span := s.startSpan(ctx, "DeliverDataExport")
+	defer func() { telemetry.End(span, err) }()
+	export, err := s.BuildDataExport(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	u := export.Profile
+	if u.DeletedAt != nil || u.Email == nil || *u.Email == "" {
+		return nil
+	}
+	archive, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+	token := randB64(32)
+	if err := s.ephemSetJSON(ctx, dataExportKey(token), dataExportRecord{UserID: userID, Archive: archive}, s.dataExportLinkTTL()); err != nil {
+		return err
+	}
+	username := ""
+	if u.Username != nil {
+		username = *u.Username
+	}
+	return s.sendMessage(ctx, outboundMessage{UserID: userID, Channel: MessageChannelEmail, Template: MessageTemplateDataExportLink, To: *u.Email, Username: username, Secret: token})
+}
+
+// DataExportArchive returns the JSON archive for a download token to the user it was
+// built for; any other caller gets ErrDataExportNotFound, so a leaked link alone is not
+// enough. Tokens stay valid until they expire, but the archive is no longer served once
+// the user is deleted.
+func (s *Service) DataExportArchive(ctx context.Context, token, userID string) ([]byte, error) {
+	if token == "" || userID == "" || !s.useEphemeralStore() {
+		return nil, ErrDataExportNotFound
+	}
+	var rec dataExportRecord
+	ok, err := s.ephemGetJSON(ctx, dataExportKey(token), &rec)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || rec.UserID != userID {
+		return nil, ErrDataExportNotFound
+	}
+	if s.pg != nil {
+		var active bool
+		err := s.pg.QueryRow(ctx, `SELECT deleted_at IS NULL FROM profiles.users WHERE id=$1`, rec.UserID).Scan(&active)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		if !active {
+			s.logIfErr(ctx, "authkit: data export delete failed", s.ephemDel(ctx, dataExportKey(token)))
+			return nil, ErrDataExportNotFound
+		}
+	}
+	return rec.Archive, nil
+}
+
+// BuildDataExport assembles the user's data export.
+func (s *Service) BuildDataExport(ctx context.Context, userID string) (*DataExport, error) {
+	if s.pg == nil {
+		return nil, fmt.Errorf("postgres not configured")
+	}
+	u, err := s.AdminGetUser(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && u == nil) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := &DataExport{
+		GeneratedAt:  time.Now().UTC(),
+		Issuer:       s.opts.Issuer,
+		Profile:      u,
+		Roles:        u.Roles,
+		Entitlements: s.ListEntitlementsDetailed(ctx, userID),
+	}
+	if out.Providers, err = s.exportProviders(ctx, userID); err != nil {
+		return nil, err
+	}
+	if out.Sessions, err = s.exportSessions(ctx, userID); err != nil {
+		return nil, err
+	}
+	if out.TwoFactor, err = s.exportTwoFactor(ctx, userID); err != nil {
+		return nil, err
+	}
+	if out.Events, err = s.exportEvents(ctx, userID); err != nil {
+		return nil, err
+	}
+	if len(s.exportCfg.Contributors) > 0 {
+		out.App = make(map[string]any, len(s.exportCfg.Contributors))
+		for name, contribute := range s.exportCfg.Contributors {
+			v, err := contribute(ctx, userID)
+			if err != nil {
+				return nil, fmt.Errorf("data export contributor %q: %w", name, err)
+			}
+			out.App[name] = v
+		}
+	}
+	return out, nil
+}
+
+func (s *Service) exportProviders(ctx context.Context, userID string) ([]DataExportProvider, error) {
+	rows, err := s.pg.Query(ctx, `
+		SELECT provider_slug, issuer, subject, email_at_provider, profile, created_at
+		FROM profiles.user_providers WHERE user_id=$1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []DataExportProvider{}
+	for rows.Next() {
+		var p DataExportProvider
+		var profile []byte
+		if err := rows.Scan(&p.Provider, &p.Issuer, &p.Subject, &p.EmailAtProvider, &profile, &p.LinkedAt); err != nil {
+			return nil, err
+		}
+		if len(profile) > 0 {
+			p.Profile = profile
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *Service) exportSessions(ctx context.Context, userID string) ([]DataExportSession, error) {
+	rows, err := s.pg.Query(ctx, `
+		SELECT id::text, created_at, last_used_at, expires_at, revoked_at,
+		       user_agent, COALESCE(NULLIF(host(ip_addr)::text,''), NULL)
+		FROM profiles.refresh_sessions WHERE user_id=$1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []DataExportSession{}
+	for rows.Next() {
+		var ses DataExportSession
+		if err := rows.Scan(&ses.ID, &ses.CreatedAt, &ses.LastUsedAt, &ses.ExpiresAt, &ses.RevokedAt, &ses.UserAgent, &ses.IPAddr); err != nil {
+			return nil, err
+		}
+		out = append(out, ses)
+	}
+	return out, rows.Err()
+}
+
+func (s *Service) exportTwoFactor(ctx context.Context, userID string) (DataExportTwoFactor, error) {
+	settings, err := s.Get2FASettings(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DataExportTwoFactor{}, nil
+	}
+	if err != nil {
+		return DataExportTwoFactor{}, err
+	}
+	return DataExportTwoFactor{
+		Enabled:              settings.Enabled,
+		Method:               settings.Method,
+		PhoneNumber:          settings.PhoneNumber,
+		BackupCodesRemaining: len(settings.BackupCodes),
+		UpdatedAt:            &settings.UpdatedAt,
+	}, nil
+}
+
+func (s *Service) exportEvents(ctx context.Context, userID string) ([]DataExportEvent, error) {
+	out := []DataExportEvent{}
+	reader := s.dataExportEvents()
+	if reader == nil {
+		return out, nil
+	}
+	var events []AuthSessionEvent
+	if pr, ok := reader.(AuthEventLogPageReader); ok {
+		q := SessionEventQuery{UserID: userID, Limit: 1000}
+		for range dataExportEventPages {
+			page, err := pr.ListSessionEventsPage(ctx, q)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, page.Events...)
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+	} else {
+		var err error
+		if events, err = reader.ListSessionEvents(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range events {
+		out = append(out, DataExportEvent{
+			OccurredAt: e.OccurredAt,
+			SessionID:  e.SessionID,
+			Event:      e.Event,
+			Method:     e.Method,
+			Reason:     e.Reason,
+			IPAddr:     e.IPAddr,
+			UserAgent:  e.UserAgent,
+		})
+	}
+	return out, nil
+}
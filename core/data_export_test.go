@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	memorystore "github.com/open-rails/authkit/storage/memory"
+)
+
+type recordingExportEnqueuer struct{ users []string }
+
+func (e *recordingExportEnqueuer) EnqueueDataExport(_ context.Context, userID string) error {
+	e.users = append(e.users, userID)
+	return nil
+}
+
+type exportEmail struct{ recordingEmail }
+
+func (e *exportEmail) SendDataExportLink(_ context.Context, email, _, token string) error {
+	e.calls = append(e.calls, "export:"+email+":"+token)
+	return nil
+}
+
+func TestRequestDataExport_RequiresConfiguration(t *testing.T) {
+	ctx := context.Background()
+	enq := &recordingExportEnqueuer{}
+
+	svc := NewService(Options{}, Keyset{}).WithEmailSender(&exportEmail{})
+	if err := svc.RequestDataExport(ctx, "u1"); !errors.Is(err, ErrDataExportUnavailable) {
+		t.Fatalf("expected ErrDataExportUnavailable without enqueuer, got %v", err)
+	}
+	// recordingEmail cannot send the download link.
+	svc = NewService(Options{}, Keyset{}).WithEmailSender(&recordingEmail{}).WithDataExport(enq, DataExportConfig{})
+	svc.WithEphemeralStore(memorystore.NewKV(), EphemeralMemory)
+	if err := svc.RequestDataExport(ctx, "u1"); !errors.Is(err, ErrDataExportUnavailable) {
+		t.Fatalf("expected ErrDataExportUnavailable without link sender, got %v", err)
+	}
+	if len(enq.users) != 0 {
+		t.Fatalf("nothing should be enqueued: %v", enq.users)
+	}
+}
+
+func TestDataExportArchive_Token(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(Options{}, Keyset{})
+	svc.WithEphemeralStore(memorystore.NewKV(), EphemeralMemory)
+
+	archive := []byte(`{"profile":{"id":"u1"}}`)
+	if err := svc.ephemSetJSON(ctx, dataExportKey("tok"), dataExportRecord{UserID: "u1", Archive: archive}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	got, err := svc.DataExportArchive(ctx, "tok", "u1")
+	if err != nil || string(got) != string(archive) {
+		t.Fatalf("archive = %s, %v", got, err)
+	}
+	for _, tok := range []string{"", "other"} {
+		if _, err := svc.DataExportArchive(ctx, tok, "u1"); !errors.Is(err, ErrDataExportNotFound) {
+			t.Fatalf("token %q: expected ErrDataExportNotFound, got %v", tok, err)
+		}
+	}
+	for _, uid := range []string{"", "u2"} {
+		if _, err := svc.DataExportArchive(ctx, "tok", uid); !errors.Is(err, ErrDataExportNotFound) {
+			t.Fatalf("user %q: expected ErrDataExportNotFound, got %v", uid, err)
+		}
+	}
+}
+
+func TestDeliverMessage_DataExportLink(t *testing.T) {
+	email := &exportEmail{}
+	svc := NewService(Options{}, Keyset{}).WithEmailSender(email)
+	err := svc.sendMessage(context.Background(), outboundMessage{Channel: MessageChannelEmail, Template: MessageTemplateDataExportLink, To: "a@example.com", Secret: "tok"})
+	if err != nil || len(email.calls) != 1 || email.calls[0] != "export:a@example.com:tok" {
+		t.Fatalf("unexpected delivery: %v %v", email.calls, err)
+	}
+}
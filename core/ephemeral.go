@@ -11,10 +11,17 @@ import (
 type EphemeralMode string
 
 const (
-	EphemeralMemory EphemeralMode = "memory"
-	EphemeralRedis  EphemeralMode = "redis"
+	EphemeralMemory   EphemeralMode = "memory"
+	EphemeralRedis    EphemeralMode = "redis"
+	EphemeralPostgres EphemeralMode = "postgres"
 )
 
+// Shared reports whether state in this mode is visible to every instance, as production
+// multi-instance deployments require.
+func (m EphemeralMode) Shared() bool {
+	return m == EphemeralRedis || m == EphemeralPostgres
+}
+
 // EphemeralStore is a minimal key-value interface used for short-lived auth state.
 // Implementations should honor TTL on Set and treat missing keys as (found=false, err=nil).
 type EphemeralStore interface {
@@ -23,6 +30,21 @@ type EphemeralStore interface {
 	Del(ctx context.Context, key string) error
 }
 
+// AtomicEphemeralStore is an optional extension of EphemeralStore with atomic primitives
+// for single-use state (reset tokens, codes, replay markers). Stores that do not implement
+// it fall back to Get followed by Del/Set, which lets two concurrent requests redeem the
+// same value. The bundled memory and Redis stores implement it.
+type AtomicEphemeralStore interface {
+	EphemeralStore
+	// GetDel returns the value and deletes the key in one step.
+	GetDel(ctx context.Context, key string) ([]byte, bool, error)
+	// CompareAndDelete deletes the key only if its value equals expected and reports
+	// whether it did.
+	CompareAndDelete(ctx context.Context, key string, expected []byte) (bool, error)
+	// SetNX sets the key only if it does not exist and reports whether it did.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+}
+
 func (s *Service) WithEphemeralStore(store EphemeralStore, mode EphemeralMode) *Service {
 	if mode == "" {
 		mode = EphemeralMemory
@@ -63,14 +85,14 @@ func (s *Service) ephemSetJSON(ctx context.Context, key string, value any, ttl t
 	if err != nil {
 		return err
 	}
-	return s.ephemeralStore.Set(ctx, key, b, ttl)
+	return s.storeSet(ctx, key, b, ttl)
 }
 
 func (s *Service) ephemGetJSON(ctx context.Context, key string, out any) (bool, error) {
 	if !s.useEphemeralStore() {
 		return false, fmt.Errorf("ephemeral store unavailable")
 	}
-	b, ok, err := s.ephemeralStore.Get(ctx, key)
+	b, ok, err := s.storeGet(ctx, key)
 	if err != nil || !ok {
 		return false, err
 	}
@@ -81,14 +103,14 @@ func (s *Service) ephemSetString(ctx context.Context, key, value string, ttl tim
 	if !s.useEphemeralStore() {
 		return fmt.Errorf("ephemeral store unavailable")
 	}
-	return s.ephemeralStore.Set(ctx, key, []byte(value), ttl)
+	return s.storeSet(ctx, key, []byte(value), ttl)
 }
 
 func (s *Service) ephemGetString(ctx context.Context, key string) (string, bool, error) {
 	if !s.useEphemeralStore() {
 		return "", false, fmt.Errorf("ephemeral store unavailable")
 	}
-	b, ok, err := s.ephemeralStore.Get(ctx, key)
+	b, ok, err := s.storeGet(ctx, key)
 	if err != nil || !ok {
 		return "", ok, err
 	}
@@ -99,7 +121,56 @@ func (s *Service) ephemDel(ctx context.Context, key string) error {
 	if !s.useEphemeralStore() {
 		return fmt.Errorf("ephemeral store unavailable")
 	}
-	return s.ephemeralStore.Del(ctx, key)
+	return s.storeDel(ctx, key)
+}
+
+// ephemGetDelJSON reads key into out and deletes it. Only one caller observes the value.
+func (s *Service) ephemGetDelJSON(ctx context.Context, key string, out any) (bool, error) {
+	if !s.useEphemeralStore() {
+		return false, fmt.Errorf("ephemeral store unavailable")
+	}
+	b, ok, err := s.storeGetDel(ctx, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, unmarshalJSON(b, out)
+}
+
+// ephemConsumeJSON reads key into out and, if accept approves the value, deletes it only
+// if it is unchanged. It reports true when this caller consumed the value; a concurrent
+// consumer or overwrite makes it report false.
+func (s *Service) ephemConsumeJSON(ctx context.Context, key string, out any, accept func() bool) (bool, error) {
+	if !s.useEphemeralStore() {
+		return false, fmt.Errorf("ephemeral store unavailable")
+	}
+	b, ok, err := s.storeGet(ctx, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := unmarshalJSON(b, out); err != nil {
+		return false, err
+	}
+	if !accept() {
+		return false, nil
+	}
+	return s.storeCompareAndDelete(ctx, key, b)
+}
+
+// ephemDelIfString deletes key only if it still holds value.
+func (s *Service) ephemDelIfString(ctx context.Context, key, value string) error {
+	if !s.useEphemeralStore() {
+		return fmt.Errorf("ephemeral store unavailable")
+	}
+	_, err := s.storeCompareAndDelete(ctx, key, []byte(value))
+	return err
+}
+
+// ephemSetStringNX sets key only if it does not exist and reports whether it did.
+func (s *Service) ephemSetStringNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	if !s.useEphemeralStore() {
+		return false, fmt.Errorf("ephemeral store unavailable")
+	}
+	return s.storeSetNX(ctx, key, []byte(value), ttl)
 }
 
 func marshalJSON(v any) ([]byte, error) {
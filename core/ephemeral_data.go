@@ -22,12 +22,16 @@ const (
 	keyPasswordReset      = "auth:password_reset:token:"
 	keyTwoFactor          = "auth:2fa:code:"
 	keyTwoFactorChallenge = "auth:2fa:challenge:"
+	keyPendingOIDCLink    = "auth:oidc_link:"
+	keyMergeToken         = "auth:merge:token:"
 )
 
 type pendingRegistrationData struct {
 	Email        string `json:"email"`
 	Username     string `json:"username"`
 	PasswordHash string `json:"password_hash"`
+	// InviteHash is the invitation redeemed when the registration is confirmed.
+	InviteHash string `json:"invite_hash,omitempty"`
 }
 
 type phoneVerificationData struct {
@@ -51,25 +55,30 @@ type twoFactorData struct {
 	Destination string `json:"destination"`
 }
 
-func (s *Service) storePendingRegistration(ctx context.Context, email, username, passwordHash, tokenHash string, ttl time.Duration) error {
+// storePendingRegistration replaces any pending registration for the same email or
+// username. A resend without an invitation keeps the one of the registration it replaces.
+func (s *Service) storePendingRegistration(ctx context.Context, email, username, passwordHash, inviteHash, tokenHash string, ttl time.Duration) error {
 	email = normalizeEmail(email)
 	userKey := keyPendingRegUser + username
 	emailKey := keyPendingRegEmail + email
 	tokenKey := keyPendingRegToken + tokenHash
 
 	if old, ok, _ := s.ephemGetString(ctx, emailKey); ok && old != "" && old != tokenHash {
-		_ = s.ephemDel(ctx, keyPendingRegToken+old)
+		if prev, ok, _ := s.loadPendingRegistration(ctx, old); ok && inviteHash == "" {
+			inviteHash = prev.InviteHash
+		}
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDel(ctx, keyPendingRegToken+old))
 	}
 	if old, ok, _ := s.ephemGetString(ctx, userKey); ok && old != "" && old != tokenHash {
-		_ = s.ephemDel(ctx, keyPendingRegToken+old)
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDel(ctx, keyPendingRegToken+old))
 	}
 
-	data := pendingRegistrationData{Email: email, Username: username, PasswordHash: passwordHash}
+	data := pendingRegistrationData{Email: email, Username: username, PasswordHash: passwordHash, InviteHash: inviteHash}
 	if err := s.ephemSetJSON(ctx, tokenKey, data, ttl); err != nil {
 		return err
 	}
-	_ = s.ephemSetString(ctx, emailKey, tokenHash, ttl)
-	_ = s.ephemSetString(ctx, userKey, tokenHash, ttl)
+	s.logIfErr(ctx, "authkit: ephemeral write failed", s.ephemSetString(ctx, emailKey, tokenHash, ttl))
+	s.logIfErr(ctx, "authkit: ephemeral write failed", s.ephemSetString(ctx, userKey, tokenHash, ttl))
 	return nil
 }
 
@@ -79,34 +88,47 @@ func (s *Service) loadPendingRegistration(ctx context.Context, tokenHash string)
 	return data, ok, err
 }
 
+// consumePendingRegistration removes and returns the pending registration for tokenHash,
+// so concurrent confirmations of the same token cannot both proceed.
+func (s *Service) consumePendingRegistration(ctx context.Context, tokenHash string) (pendingRegistrationData, bool, error) {
+	var data pendingRegistrationData
+	ok, err := s.ephemGetDelJSON(ctx, keyPendingRegToken+tokenHash, &data)
+	return data, ok, err
+}
+
+// deletePendingRegistration removes the token and the email/username indexes that still
+// point at it; a newer registration for the same email or username keeps its indexes.
 func (s *Service) deletePendingRegistration(ctx context.Context, tokenHash string, data pendingRegistrationData) {
-	_ = s.ephemDel(ctx, keyPendingRegToken+tokenHash)
+	s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDel(ctx, keyPendingRegToken+tokenHash))
 	if data.Email != "" {
-		_ = s.ephemDel(ctx, keyPendingRegEmail+normalizeEmail(data.Email))
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDelIfString(ctx, keyPendingRegEmail+normalizeEmail(data.Email), tokenHash))
 	}
 	if data.Username != "" {
-		_ = s.ephemDel(ctx, keyPendingRegUser+data.Username)
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDelIfString(ctx, keyPendingRegUser+data.Username, tokenHash))
 	}
 }
 
-func (s *Service) storePendingPhoneRegistration(ctx context.Context, phone, username, passwordHash, tokenHash string, ttl time.Duration) error {
+func (s *Service) storePendingPhoneRegistration(ctx context.Context, phone, username, passwordHash, inviteHash, tokenHash string, ttl time.Duration) error {
 	phoneKey := keyPendingPhonePhone + phone
 	userKey := keyPendingPhoneUser + username
 	tokenKey := keyPendingPhoneToken + tokenHash
 
 	if old, ok, _ := s.ephemGetString(ctx, phoneKey); ok && old != "" && old != tokenHash {
-		_ = s.ephemDel(ctx, keyPendingPhoneToken+old)
+		if prev, ok, _ := s.loadPendingPhoneRegistration(ctx, old); ok && inviteHash == "" {
+			inviteHash = prev.InviteHash
+		}
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDel(ctx, keyPendingPhoneToken+old))
 	}
 	if old, ok, _ := s.ephemGetString(ctx, userKey); ok && old != "" && old != tokenHash {
-		_ = s.ephemDel(ctx, keyPendingPhoneToken+old)
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDel(ctx, keyPendingPhoneToken+old))
 	}
 
-	data := pendingRegistrationData{Email: phone, Username: username, PasswordHash: passwordHash}
+	data := pendingRegistrationData{Email: phone, Username: username, PasswordHash: passwordHash, InviteHash: inviteHash}
 	if err := s.ephemSetJSON(ctx, tokenKey, data, ttl); err != nil {
 		return err
 	}
-	_ = s.ephemSetString(ctx, phoneKey, tokenHash, ttl)
-	_ = s.ephemSetString(ctx, userKey, tokenHash, ttl)
+	s.logIfErr(ctx, "authkit: ephemeral write failed", s.ephemSetString(ctx, phoneKey, tokenHash, ttl))
+	s.logIfErr(ctx, "authkit: ephemeral write failed", s.ephemSetString(ctx, userKey, tokenHash, ttl))
 	return nil
 }
 
@@ -116,13 +138,19 @@ func (s *Service) loadPendingPhoneRegistration(ctx context.Context, tokenHash st
 	return data, ok, err
 }
 
+func (s *Service) consumePendingPhoneRegistration(ctx context.Context, tokenHash string) (pendingRegistrationData, bool, error) {
+	var data pendingRegistrationData
+	ok, err := s.ephemGetDelJSON(ctx, keyPendingPhoneToken+tokenHash, &data)
+	return data, ok, err
+}
+
 func (s *Service) deletePendingPhoneRegistration(ctx context.Context, tokenHash string, data pendingRegistrationData) {
-	_ = s.ephemDel(ctx, keyPendingPhoneToken+tokenHash)
+	s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDel(ctx, keyPendingPhoneToken+tokenHash))
 	if data.Email != "" {
-		_ = s.ephemDel(ctx, keyPendingPhonePhone+data.Email)
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDelIfString(ctx, keyPendingPhonePhone+data.Email, tokenHash))
 	}
 	if data.Username != "" {
-		_ = s.ephemDel(ctx, keyPendingPhoneUser+data.Username)
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDelIfString(ctx, keyPendingPhoneUser+data.Username, tokenHash))
 	}
 }
 
@@ -141,42 +169,34 @@ func (s *Service) storePhoneVerification(ctx context.Context, purpose, phone, us
 
 func (s *Service) consumePhoneVerification(ctx context.Context, purpose, phone, codeHash string) (string, error) {
 	var data phoneVerificationData
-	ok, err := s.ephemGetJSON(ctx, s.phoneVerificationKey(purpose, phone), &data)
+	ok, err := s.ephemConsumeJSON(ctx, s.phoneVerificationKey(purpose, phone), &data, func() bool { return data.CodeHash == codeHash })
 	if err != nil || !ok {
 		return "", jwt.ErrTokenUnverifiable
 	}
-	if data.CodeHash != codeHash {
-		return "", jwt.ErrTokenUnverifiable
-	}
-	_ = s.ephemDel(ctx, s.phoneVerificationKey(purpose, phone))
 	return data.UserID, nil
 }
 
 func (s *Service) storeEmailVerification(ctx context.Context, userID, tokenHash string, email *string, ttl time.Duration) error {
 	userKey := keyEmailVerifyUser + userID
 	if old, ok, _ := s.ephemGetString(ctx, userKey); ok && old != "" && old != tokenHash {
-		_ = s.ephemDel(ctx, keyEmailVerifyToken+old)
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDel(ctx, keyEmailVerifyToken+old))
 	}
 	data := emailVerifyData{UserID: userID, Email: email}
 	if err := s.ephemSetJSON(ctx, keyEmailVerifyToken+tokenHash, data, ttl); err != nil {
 		return err
 	}
-	_ = s.ephemSetString(ctx, userKey, tokenHash, ttl)
+	s.logIfErr(ctx, "authkit: ephemeral write failed", s.ephemSetString(ctx, userKey, tokenHash, ttl))
 	return nil
 }
 
 func (s *Service) consumeEmailVerification(ctx context.Context, tokenHash string) (*emailVerifyToken, error) {
 	var data emailVerifyData
-	ok, err := s.ephemGetJSON(ctx, keyEmailVerifyToken+tokenHash, &data)
+	ok, err := s.ephemGetDelJSON(ctx, keyEmailVerifyToken+tokenHash, &data)
 	if err != nil || !ok {
 		return nil, jwt.ErrTokenUnverifiable
 	}
-	_ = s.ephemDel(ctx, keyEmailVerifyToken+tokenHash)
 	if data.UserID != "" {
-		userKey := keyEmailVerifyUser + data.UserID
-		if v, ok, _ := s.ephemGetString(ctx, userKey); ok && v == tokenHash {
-			_ = s.ephemDel(ctx, userKey)
-		}
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDelIfString(ctx, keyEmailVerifyUser+data.UserID, tokenHash))
 	}
 	return &emailVerifyToken{UserID: data.UserID, Email: data.Email}, nil
 }
@@ -202,11 +222,10 @@ func (s *Service) storePasswordReset(ctx context.Context, tokenHash, userID stri
 
 func (s *Service) consumePasswordReset(ctx context.Context, tokenHash string) (string, error) {
 	var data passwordResetData
-	ok, err := s.ephemGetJSON(ctx, keyPasswordReset+tokenHash, &data)
+	ok, err := s.ephemGetDelJSON(ctx, keyPasswordReset+tokenHash, &data)
 	if err != nil || !ok {
 		return "", jwt.ErrTokenUnverifiable
 	}
-	_ = s.ephemDel(ctx, keyPasswordReset+tokenHash)
 	return data.UserID, nil
 }
 
@@ -216,15 +235,12 @@ func (s *Service) storeTwoFactorCode(ctx context.Context, userID, codeHash, meth
 }
 
 func (s *Service) consumeTwoFactorCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	// A wrong code leaves the stored code in place; a matching one is consumed once.
 	var data twoFactorData
-	ok, err := s.ephemGetJSON(ctx, keyTwoFactor+userID, &data)
+	ok, err := s.ephemConsumeJSON(ctx, keyTwoFactor+userID, &data, func() bool { return data.CodeHash == codeHash })
 	if err != nil || !ok {
 		return false, nil
 	}
-	if data.CodeHash != codeHash {
-		return false, nil
-	}
-	_ = s.ephemDel(ctx, keyTwoFactor+userID)
 	return true, nil
 }
 
@@ -2,7 +2,10 @@ package core
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	memorystore "github.com/open-rails/authkit/storage/memory"
 )
@@ -33,3 +36,76 @@ func TestPendingRegistrationMemoryStore(t *testing.T) {
 		t.Fatalf("expected password hash to match")
 	}
 }
+
+var _ AtomicEphemeralStore = (*memorystore.KV)(nil)
+
+// plainStore hides the atomic extension to exercise the non-atomic fallback.
+type plainStore struct{ EphemeralStore }
+
+func TestPasswordReset_ConcurrentConsumeOnce(t *testing.T) {
+	svc := NewService(Options{}, Keyset{})
+	svc.WithEphemeralStore(memorystore.NewKV(), EphemeralMemory)
+	ctx := context.Background()
+
+	if err := svc.storePasswordReset(ctx, "hash", "u1", time.Minute); err != nil {
+		t.Fatalf("storePasswordReset: %v", err)
+	}
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if uid, err := svc.consumePasswordReset(ctx, "hash"); err == nil && uid == "u1" {
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins.Load() != 1 {
+		t.Fatalf("expected exactly one consumer, got %d", wins.Load())
+	}
+}
+
+func TestTwoFactorCode_WrongCodeKeepsCode(t *testing.T) {
+	for name, store := range map[string]EphemeralStore{
+		"atomic":   memorystore.NewKV(),
+		"fallback": plainStore{memorystore.NewKV()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			svc := NewService(Options{}, Keyset{})
+			svc.WithEphemeralStore(store, EphemeralMemory)
+			ctx := context.Background()
+
+			if err := svc.storeTwoFactorCode(ctx, "u1", "good", "email", "a@example.com", time.Minute); err != nil {
+				t.Fatalf("storeTwoFactorCode: %v", err)
+			}
+			if ok, _ := svc.consumeTwoFactorCode(ctx, "u1", "bad"); ok {
+				t.Fatalf("wrong code accepted")
+			}
+			if ok, _ := svc.consumeTwoFactorCode(ctx, "u1", "good"); !ok {
+				t.Fatalf("expected code to survive a wrong attempt")
+			}
+			if ok, _ := svc.consumeTwoFactorCode(ctx, "u1", "good"); ok {
+				t.Fatalf("expected code to be single-use")
+			}
+		})
+	}
+}
+
+func TestClaimSecurityEventJTI_Once(t *testing.T) {
+	svc := NewService(Options{}, Keyset{})
+	svc.WithEphemeralStore(memorystore.NewKV(), EphemeralMemory)
+	ctx := context.Background()
+
+	if !svc.ClaimSecurityEventJTI(ctx, "https://idp.example.com", "jti-1", time.Minute) {
+		t.Fatalf("expected first claim to succeed")
+	}
+	if svc.ClaimSecurityEventJTI(ctx, "https://idp.example.com", "jti-1", time.Minute) {
+		t.Fatalf("expected replayed jti to be rejected")
+	}
+	svc.ReleaseSecurityEventJTI(ctx, "https://idp.example.com", "jti-1")
+	if !svc.ClaimSecurityEventJTI(ctx, "https://idp.example.com", "jti-1", time.Minute) {
+		t.Fatalf("expected released jti to be claimable again")
+	}
+}
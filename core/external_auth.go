@@ -0,0 +1,217 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/open-rails/authkit/telemetry"
+)
+
+var (
+	// ErrExternalUserNotFound is returned by an ExternalPasswordVerifier when the login is
+	// unknown to the directory; password login then falls back to local passwords.
+	ErrExternalUserNotFound = errors.New("external_user_not_found")
+	// ErrInvalidCredentials is returned by an ExternalPasswordVerifier when the directory
+	// rejects the password.
+	ErrInvalidCredentials = errors.New("invalid_credentials")
+	// ErrExternalEmailInUse is returned by ExternalPasswordLogin when an unlinked directory
+	// user's email belongs to an existing account and linking by email is not enabled.
+	ErrExternalEmailInUse = errors.New("email_in_use")
+)
+
+// ExternalIdentity is a user authenticated by an ExternalPasswordVerifier.
+type ExternalIdentity struct {
+	Provider string // provider slug stored on the link (e.g. "ldap")
+	Issuer   string // stable directory identifier, stored as user_providers.issuer
+	Subject  string // stable per-user identifier within the directory
+	Username string
+	Email    string
+	Name     string
+	// Roles are the role slugs granted by directory group membership.
+	Roles []string
+	// ManagedRoles are all role slugs the directory controls; managed roles not in
+	// Roles are revoked on login. Roles outside this set are never touched.
+	ManagedRoles []string
+}
+
+// ExternalPasswordVerifier checks a login and password against an external
+// directory (LDAP, Active Directory, ...). Implementations return
+// ErrExternalUserNotFound for unknown logins and ErrInvalidCredentials for
+// rejected passwords; any other error is treated as the directory being unavailable.
+type ExternalPasswordVerifier interface {
+	VerifyPassword(ctx context.Context, login, password string) (*ExternalIdentity, error)
+}
+
+// ExternalDirectoryIssuer is optionally implemented by an ExternalPasswordVerifier to
+// report the issuer it stores on user links. While the directory is unavailable, accounts
+// not linked to that issuer can still sign in with local passwords.
+type ExternalDirectoryIssuer interface {
+	Issuer() string
+}
+
+// ExternalLogin is the local outcome of a successful external password login.
+type ExternalLogin struct {
+	UserID   string
+	Email    string
+	Provider string
+	Created  bool
+}
+
+// WithExternalPasswordVerifier enables password login against an external directory.
+// The verifier is consulted before local passwords.
+func (s *Service) WithExternalPasswordVerifier(v ExternalPasswordVerifier) *Service {
+	s.extPasswords = v
+	return s
+}
+
+// WithExternalLinkByEmail lets directory logins link an existing account with the same
+// email. Off by default: the directory would otherwise take over any local account
+// whose address it asserts, so such logins fail with ErrExternalEmailInUse until an
+// admin merges the accounts.
+func (s *Service) WithExternalLinkByEmail(enabled bool) *Service {
+	s.extLinkByEmail = enabled
+	return s
+}
+
+// HasExternalPasswordVerifier reports whether an external password verifier is configured.
+func (s *Service) HasExternalPasswordVerifier() bool { return s != nil && s.extPasswords != nil }
+
+// ExternalPasswordLogin verifies login/password with the external verifier and resolves
+// the local user: an existing provider link, then an account with the same email
+// (linked only with WithExternalLinkByEmail), otherwise a new user is provisioned if the
+// registration policy's identity rules allow its email. Directory group roles are
+// synced on every login. The caller issues the session and tokens.
+func (s *Service) ExternalPasswordLogin(ctx context.Context, login, password string) (_ *ExternalLogin, err error) {
+	ctx, span := s.startSpan(ctx, "ExternalPasswordLogin")
+	defer func() { telemetry.End(span, err) }()
+	if s.extPasswords == nil {
+		return nil, ErrExternalUserNotFound
+	}
+	if s.pg == nil {
+		return nil, errors.New("postgres not configured")
+	}
+	if strings.TrimSpace(login) == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	ident, err := s.extPasswords.VerifyPassword(ctx, login, password)
+	if err != nil {
+		return nil, err
+	}
+	if ident == nil || strings.TrimSpace(ident.Issuer) == "" || strings.TrimSpace(ident.Subject) == "" {
+		return nil, errors.New("external identity missing issuer or subject")
+	}
+	provider := ident.Provider
+	if provider == "" {
+		provider = "external"
+	}
+	var emailPtr *string
+	if e := strings.TrimSpace(ident.Email); e != "" {
+		emailPtr = &e
+	}
+
+	out := &ExternalLogin{Provider: provider}
+	var byEmail *User
+	uid, _, err := s.getProviderLink(ctx, ident.Issuer, ident.Subject)
+	if (err != nil || uid == "") && emailPtr != nil {
+		byEmail, _ = s.getUserByEmail(ctx, *emailPtr)
+	}
+	switch {
+	case err == nil && uid != "":
+		out.UserID = uid
+	case byEmail != nil && !s.extLinkByEmail:
+		return nil, ErrExternalEmailInUse
+	case byEmail != nil:
+		// The operator opted in: the directory is authoritative for its users' addresses.
+		out.UserID = byEmail.ID
+		if err := s.LinkProviderByIssuer(ctx, byEmail.ID, ident.Issuer, provider, ident.Subject, emailPtr); err != nil {
+			return nil, err
+		}
+		s.logIfErr(ctx, "authkit: mark email verified failed", s.setEmailVerified(ctx, byEmail.ID, true), "user_id", byEmail.ID)
+	default:
+		// Like SAML, the directory admits its users without an invitation, but the
+		// registration policy's identity rules still apply.
+		if err := s.CheckRegistrationIdentity(RegistrationAttempt{Email: ident.Email}); err != nil {
+			return nil, err
+		}
+		username := s.DeriveUsernameForOAuth(ctx, provider, ident.Username, ident.Email, ident.Name)
+		u, err := s.createUser(ctx, ident.Email, username)
+		if err != nil {
+			return nil, err
+		}
+		out.UserID = u.ID
+		out.Created = true
+		if emailPtr != nil {
+			s.logIfErr(ctx, "authkit: mark email verified failed", s.setEmailVerified(ctx, u.ID, true), "user_id", u.ID)
+		}
+		if err := s.LinkProviderByIssuer(ctx, u.ID, ident.Issuer, provider, ident.Subject, emailPtr); err != nil {
+			return nil, err
+		}
+	}
+
+	u, err := s.getUserByID(ctx, out.UserID)
+	if err != nil || u == nil {
+		return nil, errOrUnauthorized(err)
+	}
+	if err := s.ensureUserAccess(ctx, u); err != nil {
+		return nil, err
+	}
+	if u.Email != nil {
+		out.Email = *u.Email
+	}
+	if strings.TrimSpace(ident.Username) != "" {
+		s.logIfErr(ctx, "authkit: set provider username failed", s.setProviderUsername(ctx, u.ID, ident.Issuer, ident.Subject, ident.Username), "user_id", u.ID)
+	}
+	s.syncExternalRoles(ctx, u.ID, ident.Roles, ident.ManagedRoles)
+	s.logIfErr(ctx, "authkit: update last login failed", s.setLastLogin(ctx, u.ID, time.Now()), "user_id", u.ID)
+	return out, nil
+}
+
+// ExternalPasswordLinked reports whether the local account for login (an email or
+// username) is linked to the external directory. Unknown logins are not linked; with a
+// verifier that does not implement ExternalDirectoryIssuer every account is assumed to be.
+func (s *Service) ExternalPasswordLinked(ctx context.Context, login string) (bool, error) {
+	if s.extPasswords == nil {
+		return false, nil
+	}
+	dir, ok := s.extPasswords.(ExternalDirectoryIssuer)
+	if !ok {
+		return true, nil
+	}
+	if s.pg == nil {
+		return false, errors.New("postgres not configured")
+	}
+	var u *User
+	var err error
+	if strings.Contains(login, "@") {
+		u, err = s.getUserByEmail(ctx, login)
+	} else {
+		u, err = s.getUserByUsername(ctx, login)
+	}
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && u == nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var linked bool
+	err = s.pg.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM profiles.user_providers WHERE user_id=$1 AND issuer=$2)`, u.ID, dir.Issuer()).Scan(&linked)
+	return linked, err
+}
+
+// syncExternalRoles grants directory roles and revokes managed roles the user no longer holds.
+// Roles must already exist; unknown slugs are skipped.
+func (s *Service) syncExternalRoles(ctx context.Context, userID string, granted, managed []string) {
+	want := make(map[string]bool, len(granted))
+	for _, r := range granted {
+		want[r] = true
+		s.logIfErr(ctx, "authkit: directory role grant failed", s.assignRoleBySlug(ctx, userID, r), "user_id", userID, "role", r)
+	}
+	for _, r := range managed {
+		if !want[r] {
+			s.logIfErr(ctx, "authkit: directory role revoke failed", s.removeRoleBySlug(ctx, userID, r), "user_id", userID, "role", r)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type stubDirectory struct{ ident ExternalIdentity }
+
+func (d stubDirectory) VerifyPassword(context.Context, string, string) (*ExternalIdentity, error) {
+	id := d.ident
+	return &id, nil
+}
+
+func TestExternalPasswordLogin_RegistrationIdentityRules(t *testing.T) {
+	ctx := context.Background()
+	// Nothing listens here: the link and email lookups fail, so the login reaches
+	// provisioning, which must reject the email before inserting anything.
+	pool, err := pgxpool.New(ctx, "postgres://authkit@127.0.0.1:1/authkit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	svc := NewService(Options{}, Keyset{}).WithPostgres(pool).
+		WithRegistrationPolicy(RegistrationPolicy{
+			Mode:                 RegistrationInviteOnly,
+			DeniedEmailDomains:   []string{"contractors.example.com"},
+			BlockDisposableEmail: true,
+		})
+
+	cases := map[string]error{
+		"a@contractors.example.com": ErrRegistrationEmailDomain,
+		"a@mailinator.com":          ErrRegistrationDisposableEmail,
+	}
+	for email, want := range cases {
+		svc.WithExternalPasswordVerifier(stubDirectory{ExternalIdentity{
+			Provider: "ldap", Issuer: "ldap://dc.example.com", Subject: email, Email: email,
+		}})
+		if _, err := svc.ExternalPasswordLogin(ctx, email, "pw"); !errors.Is(err, want) {
+			t.Fatalf("%s: expected %v, got %v", email, want, err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// WithLogger sets the structured logger used for dev-mode code delivery, security notices
+// and best-effort operations whose errors do not fail the request. Defaults to slog.Default().
+//
+// Attributes added with ContextWithLogAttrs (request ID, user ID, rate-limit bucket, ...)
+// are attached to every record, and secret-bearing attributes are redacted outside dev.
+func (s *Service) WithLogger(l *slog.Logger) *Service {
+	s.logger = l
+	return s
+}
+
+// Logger returns the service logger wrapped with context attributes and redaction.
+func (s *Service) Logger() *slog.Logger {
+	var h slog.Handler
+	if s != nil && s.logger != nil {
+		h = s.logger.Handler()
+	} else {
+		h = slog.Default().Handler()
+	}
+	return slog.New(&contextHandler{next: h})
+}
+
+// logIfErr logs a swallowed error from a best-effort operation.
+func (s *Service) logIfErr(ctx context.Context, msg string, err error, args ...any) {
+	if err == nil {
+		return
+	}
+	s.Logger().WarnContext(ctx, msg, append(args, slog.Any("error", err))...)
+}
+
+type logAttrsKey struct{}
+
+// ContextWithLogAttrs returns a context whose log records carry attrs in addition to any
+// attributes already attached to ctx. Later attributes with the same key win.
+func ContextWithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev := LogAttrsFromContext(ctx)
+	merged := make([]slog.Attr, 0, len(prev)+len(attrs))
+	for _, a := range prev {
+		shadowed := false
+		for _, b := range attrs {
+			if a.Key == b.Key {
+				shadowed = true
+				break
+			}
+		}
+		if !shadowed {
+			merged = append(merged, a)
+		}
+	}
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, logAttrsKey{}, merged)
+}
+
+// LogAttrsFromContext returns the attributes attached with ContextWithLogAttrs.
+func LogAttrsFromContext(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// sensitiveLogKeys are attribute keys whose values are replaced outside dev environments.
+var sensitiveLogKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"code":          true,
+	"secret":        true,
+	"refresh_token": true,
+	"access_token":  true,
+	"client_secret": true,
+	"backup_code":   true,
+}
+
+const redactedValue = "[REDACTED]"
+
+// RedactLogAttr replaces the value of secret-bearing attributes (password, token, code, ...).
+func RedactLogAttr(a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		group := a.Value.Group()
+		out := make([]slog.Attr, len(group))
+		for i, g := range group {
+			out[i] = RedactLogAttr(g)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(out...)}
+	}
+	if sensitiveLogKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redactedValue)
+	}
+	return a
+}
+
+// contextHandler adds context attributes and redacts secrets before delegating.
+type contextHandler struct {
+	next slog.Handler
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	redact := !isDevEnvironment(getEnvironment())
+	out := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	for _, a := range LogAttrsFromContext(ctx) {
+		out.AddAttrs(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if redact {
+			a = RedactLogAttr(a)
+		}
+		out.AddAttrs(a)
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if !isDevEnvironment(getEnvironment()) {
+		red := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			red[i] = RedactLogAttr(a)
+		}
+		attrs = red
+	}
+	return &contextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger_RedactsSecretsAndAddsContextAttrs(t *testing.T) {
+	t.Setenv("ENV", "production")
+	var buf bytes.Buffer
+	svc := NewService(Options{}, Keyset{}).WithLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	ctx := ContextWithLogAttrs(context.Background(), slog.String("request_id", "req-1"))
+	ctx = ContextWithLogAttrs(ctx, slog.String("user_id", "u1"))
+	svc.Logger().InfoContext(ctx, "dev code", "to", "a@example.com", "code", "123456")
+	svc.logIfErr(ctx, "best effort", errors.New("boom"), "bucket", "auth_password_login")
+
+	out := buf.String()
+	for _, want := range []string{"request_id=req-1", "user_id=u1", "code=[REDACTED]", "bucket=auth_password_login", "error=boom"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in log output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "123456") {
+		t.Fatalf("secret leaked into log output:\n%s", out)
+	}
+}
+
+func TestLogger_DevKeepsCodes(t *testing.T) {
+	t.Setenv("ENV", "development")
+	var buf bytes.Buffer
+	svc := NewService(Options{}, Keyset{}).WithLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	svc.Logger().Info("dev code", "code", "123456")
+	if !strings.Contains(buf.String(), "code=123456") {
+		t.Fatalf("expected dev code in output: %s", buf.String())
+	}
+}
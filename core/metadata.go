@@ -0,0 +1,313 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/open-rails/authkit/telemetry"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// MetadataKind selects one of the JSONB metadata columns on profiles.users.
+type MetadataKind string
+
+const (
+	// MetadataUser is user_metadata: profile attributes the user may edit.
+	MetadataUser MetadataKind = "user_metadata"
+	// MetadataApp is app_metadata: attributes only admins and the host application may write.
+	MetadataApp MetadataKind = "app_metadata"
+)
+
+// defaultMetadataMaxBytes bounds each encoded metadata object.
+const defaultMetadataMaxBytes = 16 << 10
+
+var (
+	// ErrInvalidMetadata matches every *MetadataError.
+	ErrInvalidMetadata = errors.New("invalid_metadata")
+	// ErrReservedMetadataClaim is returned by WithMetadata when a MetadataClaim is unnamed
+	// or names a registered JWT/OIDC claim or a claim AuthKit sets itself.
+	ErrReservedMetadataClaim = errors.New("reserved_metadata_claim")
+)
+
+// reservedMetadataClaims are the claim names metadata can never write: registered JWT
+// and OIDC claims, and the claims AuthKit and its handlers put into access tokens.
+var reservedMetadataClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"sid": true, "amr": true, "acr": true, "azp": true, "auth_time": true, "nonce": true,
+	"at_hash": true, "c_hash": true, "scope": true, "scp": true, "client_id": true,
+	"cnf": true, "act": true, "may_act": true, "typ": true,
+	"email": true, "email_verified": true, "phone_number": true, "phone_number_verified": true,
+	"username": true, "discord_username": true, "roles": true, "entitlements": true, "provider": true,
+}
+
+// MetadataError is returned when a metadata update is rejected by the schema or size limit.
+type MetadataError struct {
+	Kind   MetadataKind
+	Detail string
+}
+
+func (e *MetadataError) Error() string { return fmt.Sprintf("invalid %s: %s", e.Kind, e.Detail) }
+func (e *MetadataError) Unwrap() error { return ErrInvalidMetadata }
+
+// MetadataSchema is a compiled JSON Schema for a metadata object.
+type MetadataSchema struct {
+	schema *jsonschema.Schema
+}
+
+// CompileMetadataSchema compiles a JSON Schema (draft 2020-12 unless $schema says
+// otherwise). Remote $refs are not resolved.
+func CompileMetadataSchema(schemaJSON []byte) (*MetadataSchema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaJSON))
+	if err != nil {
+		return nil, err
+	}
+	c := jsonschema.NewCompiler()
+	c.DefaultDraft(jsonschema.Draft2020)
+	const url = "authkit:metadata.json"
+	if err := c.AddResource(url, doc); err != nil {
+		return nil, err
+	}
+	sch, err := c.Compile(url)
+	if err != nil {
+		return nil, err
+	}
+	return &MetadataSchema{schema: sch}, nil
+}
+
+// MetadataClaim projects a metadata field into access tokens.
+type MetadataClaim struct {
+	Claim  string       // access-token claim name
+	Source MetadataKind // MetadataUser or MetadataApp
+	Path   string       // dot-separated field path, e.g. "locale" or "billing.plan"
+}
+
+// MetadataConfig configures user and app metadata.
+type MetadataConfig struct {
+	// UserSchema and AppSchema validate the whole object after each update (nil = any object).
+	UserSchema *MetadataSchema
+	AppSchema  *MetadataSchema
+	// Claims are added to access tokens when the field is present. They never replace
+	// the standard claims (sub, roles, email, ...) or claims passed by the caller.
+	Claims []MetadataClaim
+	// MaxBytes caps each encoded object (default 16 KiB).
+	MaxBytes int
+}
+
+// WithMetadata configures metadata validation and token projection. Metadata can be
+// read and written without it (any object up to 16 KiB). It fails with
+// ErrReservedMetadataClaim, leaving the service unchanged, when a claim is unnamed or
+// reserved, so metadata can never write claims such as nbf, sid or scope.
+func (s *Service) WithMetadata(cfg MetadataConfig) (*Service, error) {
+	for _, c := range cfg.Claims {
+		if name := strings.TrimSpace(c.Claim); name == "" || reservedMetadataClaims[name] {
+			return s, fmt.Errorf("%w: %q", ErrReservedMetadataClaim, c.Claim)
+		}
+	}
+	s.metadata = cfg
+	return s, nil
+}
+
+func (s *Service) metadataSchema(kind MetadataKind) *MetadataSchema {
+	if kind == MetadataApp {
+		return s.metadata.AppSchema
+	}
+	return s.metadata.UserSchema
+}
+
+func (s *Service) metadataMaxBytes() int {
+	if s.metadata.MaxBytes > 0 {
+		return s.metadata.MaxBytes
+	}
+	return defaultMetadataMaxBytes
+}
+
+// GetUserMetadata returns the user's user_metadata and app_metadata.
+func (s *Service) GetUserMetadata(ctx context.Context, userID string) (user, app map[string]any, err error) {
+	if s.pg == nil {
+		return nil, nil, fmt.Errorf("postgres not configured")
+	}
+	var userRaw, appRaw []byte
+	err = s.pg.QueryRow(ctx, `SELECT user_metadata, app_metadata FROM profiles.users WHERE id = $1`, userID).Scan(&userRaw, &appRaw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if user, err = decodeMetadata(userRaw); err != nil {
+		return nil, nil, err
+	}
+	if app, err = decodeMetadata(appRaw); err != nil {
+		return nil, nil, err
+	}
+	return user, app, nil
+}
+
+func decodeMetadata(raw []byte) (map[string]any, error) {
+	out := map[string]any{}
+	if len(raw) == 0 {
+		return out, nil
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = map[string]any{}
+	}
+	return out, nil
+}
+
+// UpdateUserMetadata applies patch to the user's metadata of the given kind as a JSON
+// merge patch (RFC 7396: null removes a key, objects merge recursively), validates the
+// result and stores it. Returns the updated object.
+func (s *Service) UpdateUserMetadata(ctx context.Context, userID string, kind MetadataKind, patch map[string]any) (_ map[string]any, err error) {
+	ctx, span := s.startSpan(ctx, "UpdateUserMetadata")
+	defer func() { telemetry.End(span, err) }()
+	if kind != MetadataUser && kind != MetadataApp {
+		return nil, fmt.Errorf("unknown metadata kind %q", kind)
+	}
+	if s.pg == nil {
+		return nil, fmt.Errorf("postgres not configured")
+	}
+	col := string(kind)
+
+	tx, err := s.pg.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var raw []byte
+	err = tx.QueryRow(ctx, `SELECT `+col+` FROM profiles.users WHERE id = $1 FOR UPDATE`, userID).Scan(&raw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	current, err := decodeMetadata(raw)
+	if err != nil {
+		return nil, err
+	}
+	merged := mergeMetadataPatch(current, patch)
+	encoded, err := s.validateMetadata(kind, merged)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE profiles.users SET `+col+` = $2, updated_at = now() WHERE id = $1`, userID, encoded); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// validateMetadata checks size and schema and returns the encoded object.
+func (s *Service) validateMetadata(kind MetadataKind, v map[string]any) ([]byte, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if max := s.metadataMaxBytes(); len(encoded) > max {
+		return nil, &MetadataError{Kind: kind, Detail: fmt.Sprintf("exceeds %d bytes", max)}
+	}
+	if sch := s.metadataSchema(kind); sch != nil {
+		inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(encoded))
+		if err != nil {
+			return nil, err
+		}
+		if err := sch.schema.Validate(inst); err != nil {
+			var verr *jsonschema.ValidationError
+			if errors.As(err, &verr) {
+				return nil, &MetadataError{Kind: kind, Detail: metadataValidationDetail(verr)}
+			}
+			return nil, err
+		}
+	}
+	return encoded, nil
+}
+
+var metadataPrinter = message.NewPrinter(language.English)
+
+// metadataValidationDetail flattens a validation error into "location: message" lines.
+func metadataValidationDetail(verr *jsonschema.ValidationError) string {
+	var lines []string
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			loc := "/" + strings.Join(e.InstanceLocation, "/")
+			lines = append(lines, loc+": "+e.ErrorKind.LocalizedString(metadataPrinter))
+			return
+		}
+		for _, c := range e.Causes {
+			walk(c)
+		}
+	}
+	walk(verr)
+	return strings.Join(lines, "; ")
+}
+
+// mergeMetadataPatch applies an RFC 7396 merge patch to target and returns the result.
+func mergeMetadataPatch(target, patch map[string]any) map[string]any {
+	out := make(map[string]any, len(target)+len(patch))
+	for k, v := range target {
+		out[k] = v
+	}
+	for k, v := range patch {
+		switch pv := v.(type) {
+		case nil:
+			delete(out, k)
+		case map[string]any:
+			cur, _ := out[k].(map[string]any)
+			out[k] = mergeMetadataPatch(cur, pv)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// metadataClaims resolves the configured MetadataClaims for userID.
+func (s *Service) metadataClaims(ctx context.Context, userID string) map[string]any {
+	if len(s.metadata.Claims) == 0 || s.pg == nil {
+		return nil
+	}
+	user, app, err := s.GetUserMetadata(ctx, userID)
+	if err != nil {
+		s.logIfErr(ctx, "authkit: metadata claims lookup failed", err, "user_id", userID)
+		return nil
+	}
+	out := map[string]any{}
+	for _, c := range s.metadata.Claims {
+		src := user
+		if c.Source == MetadataApp {
+			src = app
+		}
+		if v, ok := metadataPath(src, c.Path); ok && c.Claim != "" {
+			out[c.Claim] = v
+		}
+	}
+	return out
+}
+
+func metadataPath(m map[string]any, path string) (any, bool) {
+	var cur any = m
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
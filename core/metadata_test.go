@@ -0,0 +1,103 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeMetadataPatch(t *testing.T) {
+	target := map[string]any{
+		"locale": "en",
+		"prefs":  map[string]any{"theme": "dark", "beta": true},
+		"tags":   []any{"a"},
+	}
+	patch := map[string]any{
+		"locale": nil,
+		"prefs":  map[string]any{"beta": nil, "density": "compact"},
+		"tags":   []any{"b"},
+		"bio":    "hi",
+	}
+	got := mergeMetadataPatch(target, patch)
+	want := map[string]any{
+		"prefs": map[string]any{"theme": "dark", "density": "compact"},
+		"tags":  []any{"b"},
+		"bio":   "hi",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merge = %#v, want %#v", got, want)
+	}
+	if _, ok := target["bio"]; ok {
+		t.Fatalf("merge must not modify target")
+	}
+}
+
+func TestValidateMetadata(t *testing.T) {
+	sch, err := CompileMetadataSchema([]byte(`{
+		"type": "object",
+		"properties": {"locale": {"type": "string", "maxLength": 5}},
+		"additionalProperties": false
+	}`))
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	s, err := (&Service{}).WithMetadata(MetadataConfig{UserSchema: sch, MaxBytes: 64})
+	if err != nil {
+		t.Fatalf("with metadata: %v", err)
+	}
+
+	if _, err := s.validateMetadata(MetadataUser, map[string]any{"locale": "en"}); err != nil {
+		t.Fatalf("valid metadata rejected: %v", err)
+	}
+	_, err = s.validateMetadata(MetadataUser, map[string]any{"locale": "english"})
+	var merr *MetadataError
+	if !errors.As(err, &merr) || !errors.Is(err, ErrInvalidMetadata) || !strings.HasPrefix(merr.Detail, "/locale: ") {
+		t.Fatalf("expected schema violation at /locale, got %v", err)
+	}
+	if _, err := s.validateMetadata(MetadataUser, map[string]any{"nickname": "x"}); !errors.Is(err, ErrInvalidMetadata) {
+		t.Fatalf("expected additionalProperties violation, got %v", err)
+	}
+	// app_metadata has no schema, only the size limit.
+	if _, err := s.validateMetadata(MetadataApp, map[string]any{"plan": "pro"}); err != nil {
+		t.Fatalf("app metadata rejected: %v", err)
+	}
+	if _, err := s.validateMetadata(MetadataApp, map[string]any{"plan": strings.Repeat("x", 64)}); !errors.Is(err, ErrInvalidMetadata) {
+		t.Fatalf("expected size violation, got %v", err)
+	}
+
+	if _, err := CompileMetadataSchema([]byte(`{"type": 5}`)); err == nil {
+		t.Fatalf("expected invalid schema to fail compilation")
+	}
+}
+
+func TestWithMetadata_ReservedClaims(t *testing.T) {
+	for _, name := range []string{"", "sub", "nbf", "jti", "sid", "amr", "acr", "azp", "scope", "auth_time", "roles", "email"} {
+		s := &Service{}
+		_, err := s.WithMetadata(MetadataConfig{Claims: []MetadataClaim{{Claim: name, Source: MetadataApp, Path: "x"}}})
+		if !errors.Is(err, ErrReservedMetadataClaim) {
+			t.Fatalf("claim %q: expected ErrReservedMetadataClaim, got %v", name, err)
+		}
+		if len(s.metadata.Claims) != 0 {
+			t.Fatalf("claim %q: rejected config must not be applied", name)
+		}
+	}
+	if _, err := (&Service{}).WithMetadata(MetadataConfig{Claims: []MetadataClaim{{Claim: "plan", Source: MetadataApp, Path: "billing.plan"}}}); err != nil {
+		t.Fatalf("custom claim rejected: %v", err)
+	}
+}
+
+func TestMetadataPath(t *testing.T) {
+	m := map[string]any{"locale": "en", "billing": map[string]any{"plan": "pro"}}
+	if v, ok := metadataPath(m, "billing.plan"); !ok || v != "pro" {
+		t.Fatalf("billing.plan = %v, %v", v, ok)
+	}
+	if v, ok := metadataPath(m, "locale"); !ok || v != "en" {
+		t.Fatalf("locale = %v, %v", v, ok)
+	}
+	for _, p := range []string{"missing", "locale.x", "billing.tier"} {
+		if _, ok := metadataPath(m, p); ok {
+			t.Fatalf("%s should not resolve", p)
+		}
+	}
+}
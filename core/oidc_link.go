@@ -0,0 +1,321 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/open-rails/authkit/telemetry"
+)
+
+// OIDCLinkPolicy controls what happens when an OIDC login's email matches an
+// existing account that is not yet linked to the provider identity.
+type OIDCLinkPolicy string
+
+const (
+	// OIDCLinkVerified links automatically only when the provider asserts the email
+	// as verified and the existing account has verified it too; any other match
+	// requires confirmation. This is the default.
+	OIDCLinkVerified OIDCLinkPolicy = "verified"
+	// OIDCLinkConfirm always requires the user to prove control of the existing
+	// account (password or emailed code) before linking.
+	OIDCLinkConfirm OIDCLinkPolicy = "confirm"
+	// OIDCLinkRefuse never links by email; the login fails with email_in_use and the
+	// user must sign in and link the provider explicitly.
+	OIDCLinkRefuse OIDCLinkPolicy = "refuse"
+)
+
+// Proof methods accepted by ConfirmPendingOIDCLink.
+const (
+	LinkProofPassword  = "password"
+	LinkProofEmailCode = "email_code"
+)
+
+const (
+	pendingOIDCLinkTTL         = 15 * time.Minute
+	pendingOIDCLinkMaxAttempts = 5
+)
+
+var (
+	// ErrLinkProofUnavailable indicates the existing account has no way to prove ownership
+	// (no password and no email), or the requested proof method is not offered.
+	ErrLinkProofUnavailable = errors.New("link_proof_unavailable")
+	// ErrProviderAlreadyLinked indicates the provider identity belongs to another user.
+	ErrProviderAlreadyLinked = errors.New("provider_already_linked")
+	// ErrLinkRequires2FA indicates the proof was accepted but the account has 2FA enabled:
+	// the link completes only through CompletePendingOIDCLink after the 2FA code is verified.
+	ErrLinkRequires2FA = errors.New("2fa_required")
+)
+
+// PendingOIDCLink is a provider identity waiting for the owner of the matching
+// account to confirm the link.
+type PendingOIDCLink struct {
+	UserID           string   `json:"user_id"`
+	Provider         string   `json:"provider"`
+	Issuer           string   `json:"issuer"`
+	Subject          string   `json:"subject"`
+	Email            string   `json:"email"`
+	EmailVerified    bool     `json:"email_verified"` // asserted (and trusted) by the provider
+	ProviderUsername string   `json:"provider_username,omitempty"`
+	Methods          []string `json:"methods"`
+	CodeHash         string   `json:"code_hash,omitempty"`
+	// Proof is the accepted proof method while the link waits for the 2FA step.
+	Proof     string    `json:"proof,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WithOIDCLinkPolicy sets the account-linking policy for OIDC logins whose email
+// matches an existing account. Defaults to OIDCLinkVerified.
+func (s *Service) WithOIDCLinkPolicy(p OIDCLinkPolicy) *Service {
+	s.oidcLink = p
+	return s
+}
+
+// OIDCLinkPolicy returns the configured linking policy.
+func (s *Service) OIDCLinkPolicy() OIDCLinkPolicy {
+	switch s.oidcLink {
+	case OIDCLinkConfirm, OIDCLinkRefuse:
+		return s.oidcLink
+	default:
+		return OIDCLinkVerified
+	}
+}
+
+// CanAutoLinkOIDC reports whether the policy allows linking u to a provider identity
+// without confirmation.
+func (s *Service) CanAutoLinkOIDC(u *User, providerEmailVerified bool) bool {
+	return s.OIDCLinkPolicy() == OIDCLinkVerified && providerEmailVerified && u != nil && u.EmailVerified
+}
+
+// CreatePendingOIDCLink stores a pending link for the existing account and returns the
+// opaque token the frontend uses to confirm it.
+func (s *Service) CreatePendingOIDCLink(ctx context.Context, link PendingOIDCLink) (string, error) {
+	u, err := s.getUserByID(ctx, link.UserID)
+	if err != nil || u == nil {
+		return "", errOrUnauthorized(err)
+	}
+	if err := s.ensureUserAccess(ctx, u); err != nil {
+		return "", err
+	}
+	link.Methods = nil
+	if s.hasPassword(ctx, u.ID) {
+		link.Methods = append(link.Methods, LinkProofPassword)
+	}
+	if u.Email != nil && *u.Email != "" && s.canSendLinkAccountCode() {
+		link.Methods = append(link.Methods, LinkProofEmailCode)
+	}
+	if len(link.Methods) == 0 {
+		return "", ErrLinkProofUnavailable
+	}
+	link.CodeHash = ""
+	link.Proof = ""
+	link.ExpiresAt = time.Now().Add(pendingOIDCLinkTTL)
+	token := randB64(32)
+	if err := s.ephemSetJSON(ctx, keyPendingOIDCLink+sha256Hex(token), link, pendingOIDCLinkTTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetPendingOIDCLink returns the pending link for token, or jwt.ErrTokenUnverifiable
+// when it is unknown or expired.
+func (s *Service) GetPendingOIDCLink(ctx context.Context, token string) (*PendingOIDCLink, error) {
+	var link PendingOIDCLink
+	ok, err := s.ephemGetJSON(ctx, keyPendingOIDCLink+sha256Hex(token), &link)
+	if err != nil || !ok || time.Now().After(link.ExpiresAt) {
+		return nil, jwt.ErrTokenUnverifiable
+	}
+	return &link, nil
+}
+
+// SendPendingOIDCLinkCode emails a one-time code to the existing account's address.
+// A new code replaces any previous one.
+func (s *Service) SendPendingOIDCLinkCode(ctx context.Context, token string) error {
+	link, err := s.GetPendingOIDCLink(ctx, token)
+	if err != nil {
+		return err
+	}
+	if !containsString(link.Methods, LinkProofEmailCode) {
+		return ErrLinkProofUnavailable
+	}
+	u, err := s.getUserByID(ctx, link.UserID)
+	if err != nil || u == nil || u.Email == nil {
+		return errOrUnauthorized(err)
+	}
+	code := randAlphanumeric(6)
+	link.CodeHash = sha256Hex(code)
+	if err := s.savePendingOIDCLink(ctx, token, link); err != nil {
+		return err
+	}
+	username := ""
+	if u.Username != nil {
+		username = *u.Username
+	}
+	if _, ok := s.email.(EmailSenderWithLinkAccountCode); ok {
+		return s.sendMessage(ctx, outboundMessage{UserID: u.ID, Channel: MessageChannelEmail, Template: MessageTemplateLinkAccountCode, To: *u.Email, Username: username, Secret: code})
+	}
+	s.Logger().InfoContext(ctx, "authkit dev email: account link code", "to", *u.Email, "username", username, "code", code)
+	return nil
+}
+
+// ConfirmPendingOIDCLink verifies proof of ownership of the existing account (its
+// password or the emailed code) and links the provider identity to it. The pending
+// link is single-use and is discarded after pendingOIDCLinkMaxAttempts guesses.
+//
+// When the account has 2FA enabled, the accepted proof is recorded on the pending link
+// and ErrLinkRequires2FA is returned together with the link; nothing is linked until
+// CompletePendingOIDCLink runs after the 2FA code is verified.
+func (s *Service) ConfirmPendingOIDCLink(ctx context.Context, token, pass, code string) (_ *PendingOIDCLink, err error) {
+	ctx, span := s.startSpan(ctx, "ConfirmPendingOIDCLink")
+	defer func() { telemetry.End(span, err) }()
+	link, err := s.GetPendingOIDCLink(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	key := keyPendingOIDCLink + sha256Hex(token)
+
+	proof := ""
+	switch {
+	case pass != "" && containsString(link.Methods, LinkProofPassword):
+		proof = LinkProofPassword
+	case strings.TrimSpace(code) != "" && containsString(link.Methods, LinkProofEmailCode):
+		proof = LinkProofEmailCode
+	default:
+		return nil, ErrLinkProofUnavailable
+	}
+	// Reserve a guess before checking it, so parallel requests cannot exceed the limit.
+	ok, err := s.claimPendingOIDCLinkAttempt(ctx, key, time.Until(link.ExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		s.logIfErr(ctx, "authkit: ephemeral delete failed", s.ephemDel(ctx, key))
+		return nil, ErrInvalidCredentials
+	}
+	var proofErr error
+	if proof == LinkProofPassword {
+		proofErr = s.verifyPassword(ctx, link.UserID, pass)
+	} else if link.CodeHash == "" || link.CodeHash != sha256Hex(strings.TrimSpace(code)) {
+		proofErr = ErrInvalidCredentials
+	}
+	if proofErr != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	twoFA, err := s.twoFactorEnabled(ctx, link.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFA {
+		link.Proof = proof
+		if err := s.savePendingOIDCLink(ctx, token, link); err != nil {
+			return nil, err
+		}
+		return link, ErrLinkRequires2FA
+	}
+	// Redeem the link once: a concurrent confirmation that already consumed it wins.
+	var consumed PendingOIDCLink
+	if ok, err := s.ephemGetDelJSON(ctx, key, &consumed); err != nil || !ok {
+		return nil, jwt.ErrTokenUnverifiable
+	}
+	return link, s.linkPendingOIDC(ctx, link, proof)
+}
+
+// CompletePendingOIDCLink links a pending OIDC identity whose proof was accepted by
+// ConfirmPendingOIDCLink, once the caller has verified userID's 2FA code.
+func (s *Service) CompletePendingOIDCLink(ctx context.Context, token, userID string) (_ *PendingOIDCLink, err error) {
+	ctx, span := s.startSpan(ctx, "CompletePendingOIDCLink")
+	defer func() { telemetry.End(span, err) }()
+	var link PendingOIDCLink
+	ok, err := s.ephemConsumeJSON(ctx, keyPendingOIDCLink+sha256Hex(token), &link, func() bool {
+		return link.Proof != "" && link.UserID == userID && time.Now().Before(link.ExpiresAt)
+	})
+	if err != nil || !ok {
+		return nil, jwt.ErrTokenUnverifiable
+	}
+	return &link, s.linkPendingOIDC(ctx, &link, link.Proof)
+}
+
+// linkPendingOIDC links a redeemed pending identity to its account.
+func (s *Service) linkPendingOIDC(ctx context.Context, link *PendingOIDCLink, proof string) error {
+	if err := s.ensureUserAccessByID(ctx, link.UserID); err != nil {
+		return err
+	}
+	if uid, _, err := s.getProviderLink(ctx, link.Issuer, link.Subject); err == nil && uid != "" && uid != link.UserID {
+		return ErrProviderAlreadyLinked
+	}
+	var email *string
+	if link.Email != "" {
+		email = &link.Email
+	}
+	if err := s.LinkProviderByIssuer(ctx, link.UserID, link.Issuer, link.Provider, link.Subject, email); err != nil {
+		return err
+	}
+	if strings.TrimSpace(link.ProviderUsername) != "" {
+		s.logIfErr(ctx, "authkit: set provider username failed", s.setProviderUsername(ctx, link.UserID, link.Issuer, link.Subject, link.ProviderUsername), "user_id", link.UserID)
+	}
+	// Either the provider vouches for the address or the user just received a code at it.
+	if link.EmailVerified || proof == LinkProofEmailCode {
+		s.logIfErr(ctx, "authkit: mark email verified failed", s.setEmailVerified(ctx, link.UserID, true), "user_id", link.UserID)
+	}
+	return nil
+}
+
+// claimPendingOIDCLinkAttempt reserves one of the pendingOIDCLinkMaxAttempts guesses for
+// the pending link at key. Each guess takes its own slot with SetNX, so the count holds
+// under concurrency. It reports false once every slot is taken.
+func (s *Service) claimPendingOIDCLinkAttempt(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, jwt.ErrTokenUnverifiable
+	}
+	for i := 1; i <= pendingOIDCLinkMaxAttempts; i++ {
+		ok, err := s.ephemSetStringNX(ctx, fmt.Sprintf("%s:attempt:%d", key, i), "1", ttl)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// twoFactorEnabled reports whether userID has 2FA enabled. Lookup failures are returned
+// rather than treated as disabled.
+func (s *Service) twoFactorEnabled(ctx context.Context, userID string) (bool, error) {
+	settings, err := s.Get2FASettings(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return settings.Enabled, nil
+}
+
+// canSendLinkAccountCode reports whether account-link codes can be delivered (or logged in dev).
+func (s *Service) canSendLinkAccountCode() bool {
+	if _, ok := s.email.(EmailSenderWithLinkAccountCode); ok {
+		return true
+	}
+	return s.email == nil && isDevEnvironment(getEnvironment())
+}
+
+// savePendingOIDCLink rewrites the pending link, keeping its original expiry.
+func (s *Service) savePendingOIDCLink(ctx context.Context, token string, link *PendingOIDCLink) error {
+	ttl := time.Until(link.ExpiresAt)
+	if ttl <= 0 {
+		return jwt.ErrTokenUnverifiable
+	}
+	return s.ephemSetJSON(ctx, keyPendingOIDCLink+sha256Hex(token), link, ttl)
+}
+
+func containsString(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
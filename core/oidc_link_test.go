@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	memorystore "github.com/open-rails/authkit/storage/memory"
+)
+
+func TestOIDCLinkPolicy_AutoLinkRequiresBothSidesVerified(t *testing.T) {
+	svc := NewService(Options{}, Keyset{})
+	verified := &User{ID: "u1", EmailVerified: true}
+	unverified := &User{ID: "u2"}
+
+	if svc.OIDCLinkPolicy() != OIDCLinkVerified {
+		t.Fatalf("expected default policy %q, got %q", OIDCLinkVerified, svc.OIDCLinkPolicy())
+	}
+	if !svc.CanAutoLinkOIDC(verified, true) {
+		t.Fatalf("expected auto-link when both sides are verified")
+	}
+	if svc.CanAutoLinkOIDC(verified, false) || svc.CanAutoLinkOIDC(unverified, true) {
+		t.Fatalf("expected confirmation when either side is unverified")
+	}
+	for _, p := range []OIDCLinkPolicy{OIDCLinkConfirm, OIDCLinkRefuse} {
+		svc.WithOIDCLinkPolicy(p)
+		if svc.CanAutoLinkOIDC(verified, true) {
+			t.Fatalf("policy %q must never auto-link", p)
+		}
+	}
+}
+
+func TestPendingOIDCLink_UnknownToken(t *testing.T) {
+	svc := NewService(Options{}, Keyset{})
+	svc.WithEphemeralStore(memorystore.NewKV(), EphemeralMemory)
+
+	if _, err := svc.ConfirmPendingOIDCLink(context.Background(), "missing", "pw", ""); !errors.Is(err, jwt.ErrTokenUnverifiable) {
+		t.Fatalf("expected ErrTokenUnverifiable, got %v", err)
+	}
+	if err := svc.SendPendingOIDCLinkCode(context.Background(), "missing"); !errors.Is(err, jwt.ErrTokenUnverifiable) {
+		t.Fatalf("expected ErrTokenUnverifiable, got %v", err)
+	}
+}
+
+func TestPendingOIDCLink_AttemptSlots(t *testing.T) {
+	svc := NewService(Options{}, Keyset{})
+	svc.WithEphemeralStore(memorystore.NewKV(), EphemeralMemory)
+	ctx := context.Background()
+
+	for i := 0; i < pendingOIDCLinkMaxAttempts; i++ {
+		if ok, err := svc.claimPendingOIDCLinkAttempt(ctx, "k", time.Minute); err != nil || !ok {
+			t.Fatalf("attempt %d should be allowed: %v %v", i+1, ok, err)
+		}
+	}
+	if ok, _ := svc.claimPendingOIDCLinkAttempt(ctx, "k", time.Minute); ok {
+		t.Fatalf("attempt beyond the limit must be refused")
+	}
+	if ok, _ := svc.claimPendingOIDCLinkAttempt(ctx, "other", time.Minute); !ok {
+		t.Fatalf("limits are per pending link")
+	}
+}
+
+func TestCompletePendingOIDCLink_RequiresProof(t *testing.T) {
+	svc := NewService(Options{}, Keyset{})
+	svc.WithEphemeralStore(memorystore.NewKV(), EphemeralMemory)
+	ctx := context.Background()
+
+	link := PendingOIDCLink{UserID: "u1", Issuer: "https://idp", Subject: "s", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := svc.ephemSetJSON(ctx, keyPendingOIDCLink+sha256Hex("tok"), link, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// Without an accepted proof, or for another user, the link cannot be completed.
+	if _, err := svc.CompletePendingOIDCLink(ctx, "tok", "u1"); !errors.Is(err, jwt.ErrTokenUnverifiable) {
+		t.Fatalf("expected ErrTokenUnverifiable without proof, got %v", err)
+	}
+	link.Proof = LinkProofPassword
+	if err := svc.ephemSetJSON(ctx, keyPendingOIDCLink+sha256Hex("tok"), link, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CompletePendingOIDCLink(ctx, "tok", "u2"); !errors.Is(err, jwt.ErrTokenUnverifiable) {
+		t.Fatalf("expected ErrTokenUnverifiable for another user, got %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	authlang "github.com/open-rails/authkit/lang"
+	"github.com/open-rails/authkit/telemetry"
+)
+
+var (
+	// ErrMessageSenderUnavailable indicates no configured sender can deliver the message
+	// (sender missing, or it lacks the password reset link extension).
+	ErrMessageSenderUnavailable = errors.New("message_sender_unavailable")
+)
+
+// Message channels.
+const (
+	MessageChannelEmail = "email"
+	MessageChannelSMS   = "sms"
+)
+
+// Message templates. They name the sender method a message is delivered through.
+const (
+	MessageTemplateVerificationCode      = "verification_code" // SMS
+	MessageTemplateEmailVerificationCode = "email_verification_code"
+	MessageTemplateLoginCode             = "login_code"
+	MessageTemplatePasswordResetLink     = "password_reset_link"
+	MessageTemplateWelcome               = "welcome"
+	MessageTemplateDataExportLink        = "data_export_link"
+	MessageTemplateLinkAccountCode       = "link_account_code"
+)
+
+// Outbox message states.
+const (
+	MessagePending = "pending"
+	MessageSent    = "sent"
+	MessageDead    = "dead"
+)
+
+// messageMaxAge is how long a queued code or link message stays worth delivering. Codes
+// expire within minutes, so a message stuck behind a provider outage is dropped rather
+// than delivered stale. Welcome and data export messages have no age limit.
+const messageMaxAge = 30 * time.Minute
+
+// MessageEnqueuer schedules delivery attempts for an outbox message.
+// riverjobs.NewMessageEnqueuer provides the River-backed implementation.
+type MessageEnqueuer interface {
+	EnqueueMessageDelivery(ctx context.Context, messageID string) error
+}
+
+// WithMessageOutbox routes email and SMS through profiles.message_outbox: each message is
+// persisted and delivered by a background worker with retries, instead of being sent
+// inline. Requires Postgres; without it messages are sent inline as before.
+func (s *Service) WithMessageOutbox(e MessageEnqueuer) *Service { s.messageEnqueuer = e; return s }
+
+// outboundMessage is one email or SMS handed to sendMessage.
+type outboundMessage struct {
+	UserID   string // optional; links the message to a user for status queries
+	Channel  string
+	Template string
+	To       string
+	Username string
+	Secret   string // code or reset token
+}
+
+// idempotencyKey identifies a message by content, so a retried request that resends the
+// same code does not queue a second copy.
+func (m outboundMessage) idempotencyKey() string {
+	return sha256Hex(strings.Join([]string{m.Channel, m.Template, m.To, m.Secret}, "\x00"))
+}
+
+// OutboxMessage is a row from profiles.message_outbox. Codes and tokens are never exposed.
+type OutboxMessage struct {
+	ID          string     `json:"id"`
+	UserID      *string    `json:"user_id,omitempty"`
+	Channel     string     `json:"channel"`
+	Template    string     `json:"template"`
+	Destination string     `json:"destination"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   *string    `json:"last_error,omitempty"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// outboxSecretKey is the ephemeral key holding a queued message's code or token. Secrets
+// never reach profiles.message_outbox; they live in the (optionally encrypted) ephemeral
+// store, keyed by the message's idempotency key.
+func outboxSecretKey(idempotencyKey string) string { return "outbox_secret:" + idempotencyKey }
+
+// outboxSecretTTL is how long a queued message's secret is kept: as long as the message
+// may still be delivered.
+func (s *Service) outboxSecretTTL(template string) time.Duration {
+	if template == MessageTemplateDataExportLink {
+		return s.dataExportLinkTTL()
+	}
+	return messageMaxAge
+}
+
+// sendMessage delivers m through the outbox when configured, otherwise inline.
+// Messages carrying a secret are queued only with an ephemeral store to hold it.
+// Inline failures are logged and returned; queued messages return enqueue errors only.
+func (s *Service) sendMessage(ctx context.Context, m outboundMessage) error {
+	if s.messageEnqueuer != nil && s.pg != nil && (m.Secret == "" || s.useEphemeralStore()) {
+		if err := s.enqueueMessage(ctx, m); err != nil {
+			s.Logger().ErrorContext(ctx, "authkit: message enqueue failed", "channel", m.Channel, "template", m.Template, "error", err)
+			return err
+		}
+		return nil
+	}
+	return s.observeSend(ctx, m.Channel, m.Template, s.deliverMessage(ctx, m))
+}
+
+func (s *Service) enqueueMessage(ctx context.Context, m outboundMessage) error {
+	var userID *string
+	if m.UserID != "" {
+		userID = &m.UserID
+	}
+	key := m.idempotencyKey()
+	if m.Secret != "" {
+		if err := s.ephemSetString(ctx, outboxSecretKey(key), m.Secret, s.outboxSecretTTL(m.Template)); err != nil {
+			return err
+		}
+	}
+	// The worker has no request context; keep the language so senders can localize.
+	language, _ := authlang.LanguageFromContext(ctx)
+	var id string
+	err := s.pg.QueryRow(ctx, `
+		INSERT INTO profiles.message_outbox (user_id, channel, template, destination, username, idempotency_key, language)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (idempotency_key) DO NOTHING
+		RETURNING id::text`, userID, m.Channel, m.Template, m.To, m.Username, key, language).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // already queued
+	}
+	if err != nil {
+		return err
+	}
+	return s.messageEnqueuer.EnqueueMessageDelivery(ctx, id)
+}
+
+// deliverMessage calls the configured sender for m.
+func (s *Service) deliverMessage(ctx context.Context, m outboundMessage) error {
+	switch m.Channel {
+	case MessageChannelEmail:
+		if s.email == nil {
+			return ErrMessageSenderUnavailable
+		}
+		switch m.Template {
+		case MessageTemplateEmailVerificationCode:
+			return s.email.SendEmailVerificationCode(ctx, m.To, m.Username, m.Secret)
+		case MessageTemplateLoginCode:
+			return s.email.SendLoginCode(ctx, m.To, m.Username, m.Secret)
+		case MessageTemplateWelcome:
+			return s.email.SendWelcome(ctx, m.To, m.Username)
+		case MessageTemplatePasswordResetLink:
+			if ls, ok := s.email.(EmailSenderWithPasswordResetLink); ok {
+				return ls.SendPasswordResetLink(ctx, m.To, m.Username, m.Secret)
+			}
+			return ErrMessageSenderUnavailable
+		case MessageTemplateLinkAccountCode:
+			if ls, ok := s.email.(EmailSenderWithLinkAccountCode); ok {
+				return ls.SendLinkAccountCode(ctx, m.To, m.Username, m.Secret)
+			}
+			return ErrMessageSenderUnavailable
+		case MessageTemplateDataExportLink:
+			if ls, ok := s.email.(EmailSenderWithDataExportLink); ok {
+				return ls.SendDataExportLink(ctx, m.To, m.Username, m.Secret)
+			}
+			return ErrMessageSenderUnavailable
+		}
+	case MessageChannelSMS:
+		if s.sms == nil {
+			return ErrMessageSenderUnavailable
+		}
+		switch m.Template {
+		case MessageTemplateVerificationCode:
+			return s.sms.SendVerificationCode(ctx, m.To, m.Secret)
+		case MessageTemplateLoginCode:
+			return s.sms.SendLoginCode(ctx, m.To, m.Secret)
+		case MessageTemplatePasswordResetLink:
+			if ls, ok := s.sms.(SMSSenderWithPasswordResetLink); ok {
+				return ls.SendPasswordResetLink(ctx, m.To, m.Secret)
+			}
+			return ErrMessageSenderUnavailable
+		}
+	}
+	return fmt.Errorf("unknown message %s/%s", m.Channel, m.Template)
+}
+
+// DeliverMessage performs one delivery attempt for an outbox message. final marks the
+// last attempt: a failure then moves the message to the dead state. Sent and dead
+// messages are skipped, so duplicate job executions never send twice; the stored code
+// or token is cleared once the message leaves the pending state.
+func (s *Service) DeliverMessage(ctx context.Context, messageID string, final bool) (err error) {
+	ctx, span := s.startSpan(ctx, "DeliverMessage")
+	defer func() { telemetry.End(span, err) }()
+	if s.pg == nil {
+		return fmt.Errorf("postgres not configured")
+	}
+	var (
+		m         outboundMessage
+		userID    *string
+		key       string
+		status    string
+		language  string
+		createdAt time.Time
+	)
+	// secret is only set on rows queued before secrets moved to the ephemeral store.
+	err = s.pg.QueryRow(ctx, `
+		SELECT user_id::text, channel, template, destination, username, COALESCE(secret, ''), idempotency_key, status, language, created_at
+		FROM profiles.message_outbox WHERE id=$1`, messageID).
+		Scan(&userID, &m.Channel, &m.Template, &m.To, &m.Username, &m.Secret, &key, &status, &language, &createdAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if status != MessagePending {
+		return nil
+	}
+	if userID != nil {
+		m.UserID = *userID
+	}
+	if language != "" {
+		ctx = authlang.WithLanguage(ctx, language)
+	}
+	if m.Template != MessageTemplateWelcome && m.Template != MessageTemplateDataExportLink && time.Since(createdAt) > messageMaxAge {
+		return s.finishMessage(ctx, messageID, key, MessageDead, "expired")
+	}
+	if m.Secret == "" && m.Template != MessageTemplateWelcome {
+		if !s.useEphemeralStore() {
+			return s.finishMessage(ctx, messageID, key, MessageDead, "secret_unavailable")
+		}
+		secret, ok, err := s.ephemGetString(ctx, outboxSecretKey(key))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return s.finishMessage(ctx, messageID, key, MessageDead, "expired")
+		}
+		m.Secret = secret
+	}
+
+	sendErr := s.observeSend(ctx, m.Channel, m.Template, s.deliverMessage(ctx, m))
+	if sendErr == nil {
+		return s.finishMessage(ctx, messageID, key, MessageSent, "")
+	}
+	if final || errors.Is(sendErr, ErrMessageSenderUnavailable) {
+		s.Logger().WarnContext(ctx, "authkit: message delivery dead", "message_id", messageID, "channel", m.Channel, "template", m.Template, "error", sendErr)
+		return s.finishMessage(ctx, messageID, key, MessageDead, sendErr.Error())
+	}
+	if err := s.recordMessageAttempt(ctx, messageID, MessagePending, sendErr.Error()); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// finishMessage records a final (sent or dead) attempt and drops the message's secret.
+func (s *Service) finishMessage(ctx context.Context, messageID, key, status, lastErr string) error {
+	if err := s.recordMessageAttempt(ctx, messageID, status, lastErr); err != nil {
+		return err
+	}
+	if s.useEphemeralStore() {
+		s.logIfErr(ctx, "authkit: outbox secret delete failed", s.ephemDel(ctx, outboxSecretKey(key)), "message_id", messageID)
+	}
+	return nil
+}
+
+func (s *Service) recordMessageAttempt(ctx context.Context, messageID, status, lastErr string) error {
+	var errPtr *string
+	if lastErr != "" {
+		errPtr = &lastErr
+	}
+	_, err := s.pg.Exec(ctx, `
+		UPDATE profiles.message_outbox SET
+			status=$2,
+			attempts=attempts+1,
+			last_error=$3,
+			secret=CASE WHEN $2='pending' THEN secret ELSE NULL END,
+			sent_at=CASE WHEN $2='sent' THEN now() ELSE sent_at END,
+			updated_at=now()
+		WHERE id=$1`, messageID, status, errPtr)
+	return err
+}
+
+// ListUserMessages returns the most recent outbox messages for a user, newest first.
+// status filters by state when non-empty; limit defaults to 50 (max 500).
+func (s *Service) ListUserMessages(ctx context.Context, userID, status string, limit int) ([]OutboxMessage, error) {
+	if s.pg == nil {
+		return []OutboxMessage{}, nil
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	rows, err := s.pg.Query(ctx, `
+		SELECT id::text, user_id::text, channel, template, destination, status, attempts, last_error, sent_at, created_at, updated_at
+		FROM profiles.message_outbox
+		WHERE user_id=$1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3`, userID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []OutboxMessage{}
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.UserID, &m.Channel, &m.Template, &m.Destination, &m.Status, &m.Attempts, &m.LastError, &m.SentAt, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
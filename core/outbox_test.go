@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type recordingEmail struct{ calls []string }
+
+func (r *recordingEmail) SendPasswordResetCode(_ context.Context, email, _, code string) error {
+	r.calls = append(r.calls, "reset_code:"+email+":"+code)
+	return nil
+}
+func (r *recordingEmail) SendEmailVerificationCode(_ context.Context, email, _, code string) error {
+	r.calls = append(r.calls, "verify:"+email+":"+code)
+	return nil
+}
+func (r *recordingEmail) SendLoginCode(_ context.Context, email, _, code string) error {
+	r.calls = append(r.calls, "login:"+email+":"+code)
+	return nil
+}
+func (r *recordingEmail) SendWelcome(_ context.Context, email, username string) error {
+	r.calls = append(r.calls, "welcome:"+email+":"+username)
+	return nil
+}
+
+func TestSendMessage_InlineWithoutOutbox(t *testing.T) {
+	email := &recordingEmail{}
+	// An enqueuer without Postgres falls back to inline delivery.
+	svc := NewService(Options{}, Keyset{}).WithEmailSender(email).WithMessageOutbox(nil)
+
+	ctx := context.Background()
+	if err := svc.sendMessage(ctx, outboundMessage{Channel: MessageChannelEmail, Template: MessageTemplateLoginCode, To: "a@example.com", Secret: "ABC123"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.sendMessage(ctx, outboundMessage{Channel: MessageChannelEmail, Template: MessageTemplateWelcome, To: "a@example.com", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(email.calls) != 2 || email.calls[0] != "login:a@example.com:ABC123" || email.calls[1] != "welcome:a@example.com:alice" {
+		t.Fatalf("unexpected sender calls: %v", email.calls)
+	}
+
+	// recordingEmail has no SendPasswordResetLink; SMS has no sender at all.
+	err := svc.sendMessage(ctx, outboundMessage{Channel: MessageChannelEmail, Template: MessageTemplatePasswordResetLink, To: "a@example.com", Secret: "tok"})
+	if !errors.Is(err, ErrMessageSenderUnavailable) {
+		t.Fatalf("expected ErrMessageSenderUnavailable, got %v", err)
+	}
+	err = svc.sendMessage(ctx, outboundMessage{Channel: MessageChannelSMS, Template: MessageTemplateLoginCode, To: "+15550100", Secret: "1"})
+	if !errors.Is(err, ErrMessageSenderUnavailable) {
+		t.Fatalf("expected ErrMessageSenderUnavailable, got %v", err)
+	}
+}
+
+func TestOutboundMessage_IdempotencyKey(t *testing.T) {
+	a := outboundMessage{UserID: "u1", Channel: MessageChannelSMS, Template: MessageTemplateLoginCode, To: "+15550100", Secret: "123456"}
+	b := a
+	b.UserID = ""
+	if a.idempotencyKey() != b.idempotencyKey() {
+		t.Fatal("key must depend on message content only")
+	}
+	b.Secret = "654321"
+	if a.idempotencyKey() == b.idempotencyKey() {
+		t.Fatal("a new code must produce a new key")
+	}
+}
@@ -0,0 +1,469 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/open-rails/authkit/telemetry"
+)
+
+// RegistrationMode controls who may create an account.
+type RegistrationMode string
+
+const (
+	// RegistrationOpen lets anyone sign up. This is the default.
+	RegistrationOpen RegistrationMode = "open"
+	// RegistrationInviteOnly requires a valid invitation code for every new account.
+	RegistrationInviteOnly RegistrationMode = "invite_only"
+)
+
+var (
+	// ErrRegistrationInviteRequired indicates invite-only registration and no code was presented.
+	ErrRegistrationInviteRequired = errors.New("invite_required")
+	// ErrRegistrationInviteInvalid indicates an unknown, revoked, expired or used-up invitation code.
+	ErrRegistrationInviteInvalid = errors.New("invalid_invite")
+	// ErrRegistrationEmailDomain indicates the email domain is denied or not on the allowlist.
+	ErrRegistrationEmailDomain = errors.New("email_domain_not_allowed")
+	// ErrRegistrationDisposableEmail indicates a disposable (throwaway) email domain.
+	ErrRegistrationDisposableEmail = errors.New("disposable_email_not_allowed")
+	// ErrRegistrationPhoneCountry indicates the phone number's country code is not allowed.
+	ErrRegistrationPhoneCountry = errors.New("phone_country_not_allowed")
+	// ErrRegistrationInviteNotFound indicates the invitation does not exist.
+	ErrRegistrationInviteNotFound = errors.New("registration_invite_not_found")
+)
+
+// RegistrationPolicy restricts account creation. It applies to password sign-ups
+// (email and phone) and to accounts created just-in-time by OIDC, Discord and SIWS
+// logins. Accounts created just-in-time by SAML and external directory (LDAP) logins are
+// held to the identity rules but need no invitation; admin and SCIM provisioning are not
+// affected.
+type RegistrationPolicy struct {
+	Mode RegistrationMode
+	// AllowedEmailDomains, when set, is the only set of email domains that may sign up
+	// (subdomains included). Sign-ups without an email (phone, wallet) are rejected.
+	AllowedEmailDomains []string
+	// DeniedEmailDomains rejects these email domains (subdomains included).
+	DeniedEmailDomains []string
+	// BlockDisposableEmail rejects domains on the disposable-email list: the embedded
+	// list unless replaced with SetDisposableEmailDomains.
+	BlockDisposableEmail bool
+	// AllowedPhoneCountryCodes, when set, restricts phone sign-ups to these E.164
+	// calling codes (e.g. "1", "+44").
+	AllowedPhoneCountryCodes []string
+	// DeniedPhoneCountryCodes rejects phone sign-ups with these calling codes.
+	DeniedPhoneCountryCodes []string
+}
+
+// RegistrationAttempt describes an account about to be created.
+type RegistrationAttempt struct {
+	Email      string
+	Phone      string // E.164
+	InviteCode string
+}
+
+//go:embed disposable_email_domains.txt
+var embeddedDisposableDomains string
+
+var defaultDisposableDomains = sync.OnceValue(func() map[string]struct{} {
+	set, _ := parseDomainList(strings.NewReader(embeddedDisposableDomains))
+	return set
+})
+
+// parseDomainList reads one domain per line; blank lines and "#" comments are skipped.
+func parseDomainList(r io.Reader) (map[string]struct{}, error) {
+	set := map[string]struct{}{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line != "" {
+			set[strings.ToLower(strings.TrimPrefix(line, "."))] = struct{}{}
+		}
+	}
+	return set, sc.Err()
+}
+
+// WithRegistrationPolicy sets the registration policy. The zero value is open registration.
+func (s *Service) WithRegistrationPolicy(p RegistrationPolicy) *Service {
+	s.regPolicy = p
+	return s
+}
+
+// RegistrationPolicy returns the configured registration policy.
+func (s *Service) RegistrationPolicy() RegistrationPolicy { return s.regPolicy }
+
+// SetDisposableEmailDomains replaces the disposable-email list used by
+// RegistrationPolicy.BlockDisposableEmail. Safe to call while serving, e.g. from a
+// periodic refresh of an upstream list.
+func (s *Service) SetDisposableEmailDomains(domains []string) {
+	set := make(map[string]struct{}, len(domains))
+	for _, d := range domains {
+		if d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), ".")); d != "" {
+			set[d] = struct{}{}
+		}
+	}
+	s.disposableMu.Lock()
+	s.disposable = set
+	s.disposableMu.Unlock()
+}
+
+// LoadDisposableEmailDomains replaces the disposable-email list with the domains read
+// from r, one per line ("#" starts a comment).
+func (s *Service) LoadDisposableEmailDomains(r io.Reader) error {
+	set, err := parseDomainList(r)
+	if err != nil {
+		return err
+	}
+	s.disposableMu.Lock()
+	s.disposable = set
+	s.disposableMu.Unlock()
+	return nil
+}
+
+// IsDisposableEmail reports whether email's domain (or a parent domain) is on the
+// disposable-email list.
+func (s *Service) IsDisposableEmail(email string) bool {
+	s.disposableMu.RLock()
+	set := s.disposable
+	s.disposableMu.RUnlock()
+	if set == nil {
+		set = defaultDisposableDomains()
+	}
+	for d := emailDomain(email); d != ""; d = parentDomain(d) {
+		if _, ok := set[d]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func emailDomain(email string) string {
+	i := strings.LastIndexByte(email, '@')
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(email[i+1:])), ".")
+}
+
+func parentDomain(d string) string {
+	if i := strings.IndexByte(d, '.'); i >= 0 {
+		return d[i+1:]
+	}
+	return ""
+}
+
+// domainMatches reports whether domain equals one of list or is a subdomain of it.
+func domainMatches(domain string, list []string) bool {
+	for _, l := range list {
+		l = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(l), "."))
+		if l != "" && (domain == l || strings.HasSuffix(domain, "."+l)) {
+			return true
+		}
+	}
+	return false
+}
+
+// phoneCountryMatches reports whether the E.164 phone starts with one of the calling codes.
+func phoneCountryMatches(phone string, codes []string) bool {
+	phone = strings.TrimPrefix(strings.TrimSpace(phone), "+")
+	for _, c := range codes {
+		c = strings.TrimPrefix(strings.TrimSpace(c), "+")
+		if c != "" && strings.HasPrefix(phone, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRegistration applies the registration policy to a. The invitation code is
+// validated but not consumed; use AdmitRegistration when the account is created.
+func (s *Service) CheckRegistration(ctx context.Context, a RegistrationAttempt) error {
+	if err := s.CheckRegistrationIdentity(a); err != nil {
+		return err
+	}
+	if s.regPolicy.Mode != RegistrationInviteOnly {
+		return nil
+	}
+	code := strings.TrimSpace(a.InviteCode)
+	if code == "" {
+		return ErrRegistrationInviteRequired
+	}
+	if s.pg == nil {
+		return fmt.Errorf("postgres not configured")
+	}
+	var ok bool
+	err := s.pg.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM profiles.registration_invites
+			WHERE code_hash = $1`+inviteUsableSQL+`
+		)
+	`, sha256Hex(code)).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRegistrationInviteInvalid
+	}
+	return nil
+}
+
+// AdmitRegistration applies the registration policy to a and, for invite-only
+// registration, consumes one use of the invitation code. Call it right before the
+// account is created; CreateRegisteredUser does both in one transaction.
+func (s *Service) AdmitRegistration(ctx context.Context, a RegistrationAttempt) (err error) {
+	ctx, span := s.startSpan(ctx, "AdmitRegistration")
+	defer func() { telemetry.End(span, err) }()
+	if err := s.CheckRegistrationIdentity(a); err != nil {
+		return err
+	}
+	if s.regPolicy.Mode != RegistrationInviteOnly {
+		return nil
+	}
+	code := strings.TrimSpace(a.InviteCode)
+	if code == "" {
+		return ErrRegistrationInviteRequired
+	}
+	if s.pg == nil {
+		return fmt.Errorf("postgres not configured")
+	}
+	return redeemRegistrationInvite(ctx, s.pg, sha256Hex(code))
+}
+
+// CreateRegisteredUser applies the registration policy to a and creates a user with
+// a.Email and username. The invitation use is consumed in the same transaction as the
+// insert, so a failed insert does not burn it. Used by just-in-time sign-ups (OIDC,
+// Discord, SIWS).
+func (s *Service) CreateRegisteredUser(ctx context.Context, a RegistrationAttempt, username string) (u *User, err error) {
+	ctx, span := s.startSpan(ctx, "CreateRegisteredUser")
+	defer func() { telemetry.End(span, err) }()
+	if err := s.CheckRegistrationIdentity(a); err != nil {
+		return nil, err
+	}
+	inviteHash := ""
+	if s.regPolicy.Mode == RegistrationInviteOnly {
+		code := strings.TrimSpace(a.InviteCode)
+		if code == "" {
+			return nil, ErrRegistrationInviteRequired
+		}
+		inviteHash = sha256Hex(code)
+	}
+	if s.pg == nil {
+		return nil, fmt.Errorf("postgres not configured")
+	}
+	tx, err := s.pg.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if inviteHash != "" {
+		if err := redeemRegistrationInvite(ctx, tx, inviteHash); err != nil {
+			return nil, err
+		}
+	}
+	if u, err = insertUser(ctx, tx, a.Email, username); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// redeemRegistrationInvite consumes one use of the invitation with codeHash.
+func redeemRegistrationInvite(ctx context.Context, q rowQuerier, codeHash string) error {
+	var id string
+	err := q.QueryRow(ctx, `
+		UPDATE profiles.registration_invites
+		SET uses = uses + 1
+		WHERE code_hash = $1`+inviteUsableSQL+`
+		RETURNING id::text
+	`, codeHash).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRegistrationInviteInvalid
+	}
+	return err
+}
+
+// CheckRegistrationIdentity applies the email-domain, disposable-email and phone-country
+// rules to a without requiring an invitation. SAML connections provision accounts this
+// way, as do external directory logins: the connection or directory admits the user,
+// but the deployment's identity rules still hold.
+func (s *Service) CheckRegistrationIdentity(a RegistrationAttempt) error {
+	p := s.regPolicy
+	if email := strings.TrimSpace(a.Email); email != "" {
+		domain := emailDomain(email)
+		if len(p.AllowedEmailDomains) > 0 && !domainMatches(domain, p.AllowedEmailDomains) {
+			return ErrRegistrationEmailDomain
+		}
+		if domainMatches(domain, p.DeniedEmailDomains) {
+			return ErrRegistrationEmailDomain
+		}
+		if p.BlockDisposableEmail && s.IsDisposableEmail(email) {
+			return ErrRegistrationDisposableEmail
+		}
+	} else if len(p.AllowedEmailDomains) > 0 {
+		return ErrRegistrationEmailDomain
+	}
+	if phone := strings.TrimSpace(a.Phone); phone != "" {
+		if len(p.AllowedPhoneCountryCodes) > 0 && !phoneCountryMatches(phone, p.AllowedPhoneCountryCodes) {
+			return ErrRegistrationPhoneCountry
+		}
+		if phoneCountryMatches(phone, p.DeniedPhoneCountryCodes) {
+			return ErrRegistrationPhoneCountry
+		}
+	}
+	return nil
+}
+
+// --- Invitations ---
+
+const inviteUsableSQL = `
+			  AND revoked_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > now())
+			  AND (max_uses IS NULL OR uses < max_uses)`
+
+// RegistrationInvite is a row from profiles.registration_invites. The code itself is
+// only returned by CreateRegistrationInvite.
+type RegistrationInvite struct {
+	ID        string     `json:"id"`
+	Note      string     `json:"note"`
+	MaxUses   *int       `json:"max_uses,omitempty"` // nil = unlimited
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy *string    `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RegistrationInviteOptions configures a new invitation.
+type RegistrationInviteOptions struct {
+	Note      string
+	MaxUses   *int // nil = unlimited
+	ExpiresAt *time.Time
+	CreatedBy string // admin user ID, optional
+}
+
+const registrationInviteColumns = `id::text, note, max_uses, uses, expires_at, revoked_at, created_by::text, created_at`
+
+func scanRegistrationInvite(row interface{ Scan(...any) error }) (*RegistrationInvite, error) {
+	var inv RegistrationInvite
+	if err := row.Scan(&inv.ID, &inv.Note, &inv.MaxUses, &inv.Uses, &inv.ExpiresAt, &inv.RevokedAt, &inv.CreatedBy, &inv.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRegistrationInviteNotFound
+		}
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// CreateRegistrationInvite creates an invitation and returns its code. Only a hash of
+// the code is stored, so it cannot be shown again.
+func (s *Service) CreateRegistrationInvite(ctx context.Context, opts RegistrationInviteOptions) (string, *RegistrationInvite, error) {
+	if s.pg == nil {
+		return "", nil, fmt.Errorf("postgres not configured")
+	}
+	if opts.MaxUses != nil && *opts.MaxUses < 1 {
+		return "", nil, fmt.Errorf("max_uses must be positive")
+	}
+	var createdBy *string
+	if v := strings.TrimSpace(opts.CreatedBy); v != "" {
+		createdBy = &v
+	}
+	code := randB64(18)
+	inv, err := scanRegistrationInvite(s.pg.QueryRow(ctx, `
+		INSERT INTO profiles.registration_invites (code_hash, note, max_uses, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5::uuid)
+		RETURNING `+registrationInviteColumns,
+		sha256Hex(code), strings.TrimSpace(opts.Note), opts.MaxUses, opts.ExpiresAt, createdBy))
+	if err != nil {
+		return "", nil, err
+	}
+	return code, inv, nil
+}
+
+// ListRegistrationInvites returns all invitations, newest first.
+func (s *Service) ListRegistrationInvites(ctx context.Context) ([]RegistrationInvite, error) {
+	if s.pg == nil {
+		return nil, fmt.Errorf("postgres not configured")
+	}
+	rows, err := s.pg.Query(ctx, `SELECT `+registrationInviteColumns+` FROM profiles.registration_invites ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []RegistrationInvite
+	for rows.Next() {
+		inv, err := scanRegistrationInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *inv)
+	}
+	return out, rows.Err()
+}
+
+// RevokeRegistrationInvite stops an invitation from being used. Accounts already
+// created with it are not affected.
+func (s *Service) RevokeRegistrationInvite(ctx context.Context, id string) error {
+	if s.pg == nil {
+		return fmt.Errorf("postgres not configured")
+	}
+	tag, err := s.pg.Exec(ctx, `
+		UPDATE profiles.registration_invites SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1::uuid
+	`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRegistrationInviteNotFound
+	}
+	return nil
+}
+
+const authCtxKeyRegistrationInvite authCtxKey = "authkit.registration_invite"
+
+// WithRegistrationInvite annotates ctx with the invitation code presented with a
+// sign-up, for flows whose signatures do not carry it (pending registrations, SIWS).
+func WithRegistrationInvite(ctx context.Context, code string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, authCtxKeyRegistrationInvite, strings.TrimSpace(code))
+}
+
+func registrationInviteFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	v, _ := ctx.Value(authCtxKeyRegistrationInvite).(string)
+	return v
+}
+
+func inviteHashFromContext(ctx context.Context) string {
+	if code := registrationInviteFromContext(ctx); code != "" {
+		return sha256Hex(code)
+	}
+	return ""
+}
+
+// admitPendingRegistration redeems the invitation stored with a pending registration
+// when registration is invite-only. tx is the transaction that creates the user.
+func (s *Service) admitPendingRegistration(ctx context.Context, tx pgx.Tx, inviteHash string) error {
+	if s.regPolicy.Mode != RegistrationInviteOnly {
+		return nil
+	}
+	if inviteHash == "" {
+		return ErrRegistrationInviteRequired
+	}
+	return redeemRegistrationInvite(ctx, tx, inviteHash)
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistrationPolicy_IdentityRules(t *testing.T) {
+	svc := NewService(Options{}, Keyset{})
+	ctx := context.Background()
+
+	if err := svc.CheckRegistration(ctx, RegistrationAttempt{Email: "a@mailinator.com"}); err != nil {
+		t.Fatalf("open policy must admit anyone, got %v", err)
+	}
+
+	svc.WithRegistrationPolicy(RegistrationPolicy{
+		AllowedEmailDomains:      []string{"example.com"},
+		DeniedEmailDomains:       []string{"contractors.example.com"},
+		BlockDisposableEmail:     true,
+		AllowedPhoneCountryCodes: []string{"+1", "44"},
+	})
+	cases := []struct {
+		attempt RegistrationAttempt
+		want    error
+	}{
+		{RegistrationAttempt{Email: "a@example.com"}, nil},
+		{RegistrationAttempt{Email: "a@EU.Example.com"}, nil},
+		{RegistrationAttempt{Email: "a@contractors.example.com"}, ErrRegistrationEmailDomain},
+		{RegistrationAttempt{Email: "a@example.org"}, ErrRegistrationEmailDomain},
+		{RegistrationAttempt{Phone: "+15551234567"}, ErrRegistrationEmailDomain},
+	}
+	for _, c := range cases {
+		if err := svc.CheckRegistration(ctx, c.attempt); !errors.Is(err, c.want) {
+			t.Fatalf("%+v: expected %v, got %v", c.attempt, c.want, err)
+		}
+	}
+
+	svc.WithRegistrationPolicy(RegistrationPolicy{BlockDisposableEmail: true, AllowedPhoneCountryCodes: []string{"+1", "44"}})
+	cases = []struct {
+		attempt RegistrationAttempt
+		want    error
+	}{
+		{RegistrationAttempt{Email: "a@sub.mailinator.com"}, ErrRegistrationDisposableEmail},
+		{RegistrationAttempt{Phone: "+15551234567"}, nil},
+		{RegistrationAttempt{Phone: "+447700900123"}, nil},
+		{RegistrationAttempt{Phone: "+33612345678"}, ErrRegistrationPhoneCountry},
+	}
+	for _, c := range cases {
+		if err := svc.CheckRegistration(ctx, c.attempt); !errors.Is(err, c.want) {
+			t.Fatalf("%+v: expected %v, got %v", c.attempt, c.want, err)
+		}
+	}
+
+	if err := svc.LoadDisposableEmailDomains(strings.NewReader("# custom\nthrowaway.test\n")); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !svc.IsDisposableEmail("x@throwaway.test") || svc.IsDisposableEmail("x@mailinator.com") {
+		t.Fatalf("expected the loaded list to replace the embedded one")
+	}
+}
+
+func TestRegistrationPolicy_IdentityCheckSkipsInvite(t *testing.T) {
+	svc := NewService(Options{}, Keyset{}).WithRegistrationPolicy(RegistrationPolicy{
+		Mode:                 RegistrationInviteOnly,
+		DeniedEmailDomains:   []string{"example.org"},
+		BlockDisposableEmail: true,
+	})
+
+	if err := svc.CheckRegistrationIdentity(RegistrationAttempt{Email: "a@example.com"}); err != nil {
+		t.Fatalf("identity check must not require an invite, got %v", err)
+	}
+	if err := svc.CheckRegistrationIdentity(RegistrationAttempt{Email: "a@example.org"}); !errors.Is(err, ErrRegistrationEmailDomain) {
+		t.Fatalf("expected ErrRegistrationEmailDomain, got %v", err)
+	}
+	if err := svc.CheckRegistrationIdentity(RegistrationAttempt{Email: "a@mailinator.com"}); !errors.Is(err, ErrRegistrationDisposableEmail) {
+		t.Fatalf("expected ErrRegistrationDisposableEmail, got %v", err)
+	}
+}
+
+func TestRegistrationPolicy_InviteOnlyRequiresCode(t *testing.T) {
+	svc := NewService(Options{}, Keyset{}).WithRegistrationPolicy(RegistrationPolicy{Mode: RegistrationInviteOnly})
+	ctx := context.Background()
+
+	if err := svc.CheckRegistration(ctx, RegistrationAttempt{Email: "a@example.com"}); !errors.Is(err, ErrRegistrationInviteRequired) {
+		t.Fatalf("expected ErrRegistrationInviteRequired, got %v", err)
+	}
+	if err := svc.AdmitRegistration(ctx, RegistrationAttempt{}); !errors.Is(err, ErrRegistrationInviteRequired) {
+		t.Fatalf("expected ErrRegistrationInviteRequired, got %v", err)
+	}
+	if _, err := svc.CreateRegisteredUser(ctx, RegistrationAttempt{}, "wallet"); !errors.Is(err, ErrRegistrationInviteRequired) {
+		t.Fatalf("expected ErrRegistrationInviteRequired, got %v", err)
+	}
+	if got := registrationInviteFromContext(WithRegistrationInvite(ctx, " code ")); got != "code" {
+		t.Fatalf("expected trimmed invite from context, got %q", got)
+	}
+}
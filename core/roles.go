@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Role is a row from profiles.roles.
+type Role struct {
+	ID          string
+	Slug        string
+	Name        string
+	Description *string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// RoleMember is a user holding a role.
+type RoleMember struct {
+	UserID   string
+	Username *string
+}
+
+// ListRoles returns all non-deleted roles ordered by slug.
+func (s *Service) ListRoles(ctx context.Context) ([]Role, error) {
+	if s.pg == nil {
+		return nil, nil
+	}
+	rows, err := s.pg.Query(ctx, `SELECT id::text, slug, name, description, created_at, updated_at FROM profiles.roles WHERE deleted_at IS NULL ORDER BY slug`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Role
+	for rows.Next() {
+		var r Role
+		if err := rows.Scan(&r.ID, &r.Slug, &r.Name, &r.Description, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// GetRoleByID returns a non-deleted role by ID.
+func (s *Service) GetRoleByID(ctx context.Context, id string) (*Role, error) {
+	if s.pg == nil {
+		return nil, nil
+	}
+	var r Role
+	err := s.pg.QueryRow(ctx, `SELECT id::text, slug, name, description, created_at, updated_at FROM profiles.roles WHERE id::text=$1 AND deleted_at IS NULL`, id).
+		Scan(&r.ID, &r.Slug, &r.Name, &r.Description, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetRoleBySlug returns a non-deleted role by slug.
+func (s *Service) GetRoleBySlug(ctx context.Context, slug string) (*Role, error) {
+	if s.pg == nil {
+		return nil, nil
+	}
+	var r Role
+	err := s.pg.QueryRow(ctx, `SELECT id::text, slug, name, description, created_at, updated_at FROM profiles.roles WHERE slug=$1 AND deleted_at IS NULL`, slug).
+		Scan(&r.ID, &r.Slug, &r.Name, &r.Description, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// EnsureRole creates the role if missing (or restores a soft-deleted one) and returns it.
+// The role ID is derived from the slug (see roles.IDFromSlug).
+func (s *Service) EnsureRole(ctx context.Context, slug, name string) (*Role, error) {
+	if s.pg == nil {
+		return nil, nil
+	}
+	slug = strings.TrimSpace(slug)
+	if slug == "" {
+		return nil, fmt.Errorf("role slug required")
+	}
+	if strings.TrimSpace(name) == "" {
+		name = slug
+	}
+	var r Role
+	err := s.pg.QueryRow(ctx, `
+		INSERT INTO profiles.roles (name, slug) VALUES ($1, $2)
+		ON CONFLICT (slug) DO UPDATE SET deleted_at=NULL, updated_at=now()
+		RETURNING id::text, slug, name, description, created_at, updated_at
+	`, name, slug).Scan(&r.ID, &r.Slug, &r.Name, &r.Description, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// RenameRole updates the display name of a role. Slugs are immutable.
+func (s *Service) RenameRole(ctx context.Context, slug, name string) error {
+	if s.pg == nil {
+		return nil
+	}
+	_, err := s.pg.Exec(ctx, `UPDATE profiles.roles SET name=$2, updated_at=now() WHERE slug=$1 AND deleted_at IS NULL`, slug, name)
+	return err
+}
+
+// DeleteRole removes all memberships and soft-deletes the role.
+func (s *Service) DeleteRole(ctx context.Context, slug string) error {
+	if s.pg == nil {
+		return nil
+	}
+	if _, err := s.pg.Exec(ctx, `DELETE FROM profiles.user_roles ur USING profiles.roles r WHERE ur.role_id=r.id AND r.slug=$1`, slug); err != nil {
+		return err
+	}
+	_, err := s.pg.Exec(ctx, `UPDATE profiles.roles SET deleted_at=now(), updated_at=now() WHERE slug=$1`, slug)
+	return err
+}
+
+// ListRoleMembers returns the non-deleted users holding the role.
+func (s *Service) ListRoleMembers(ctx context.Context, slug string) ([]RoleMember, error) {
+	if s.pg == nil {
+		return nil, nil
+	}
+	rows, err := s.pg.Query(ctx, `
+		SELECT u.id::text, u.username
+		FROM profiles.user_roles ur
+		JOIN profiles.roles r ON ur.role_id=r.id AND r.deleted_at IS NULL
+		JOIN profiles.users u ON ur.user_id=u.id AND u.deleted_at IS NULL
+		WHERE r.slug=$1
+		ORDER BY ur.created_at
+	`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []RoleMember
+	for rows.Next() {
+		var m RoleMember
+		if err := rows.Scan(&m.UserID, &m.Username); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	samlkit "github.com/open-rails/authkit/saml"
+)
+
+// SAMLConnection is a row from profiles.saml_connections.
+type SAMLConnection struct {
+	ID                string                   `json:"id"`
+	Slug              string                   `json:"slug"`
+	IdPEntityID       string                   `json:"idp_entity_id"`
+	IdPMetadataXML    string                   `json:"idp_metadata_xml"`
+	AttributeMapping  samlkit.AttributeMapping `json:"attribute_mapping"`
+	Binding           string                   `json:"binding"`
+	AllowIDPInitiated bool                     `json:"allow_idp_initiated"`
+	TrustEmail        bool                     `json:"trust_email"`
+	CreatedAt         time.Time                `json:"created_at"`
+	UpdatedAt         time.Time                `json:"updated_at"`
+}
+
+const samlConnectionColumns = `id::text, slug, idp_entity_id, idp_metadata_xml, attribute_mapping, binding, allow_idp_initiated, trust_email, created_at, updated_at`
+
+func scanSAMLConnection(row interface{ Scan(...any) error }) (*SAMLConnection, error) {
+	var c SAMLConnection
+	if err := row.Scan(&c.ID, &c.Slug, &c.IdPEntityID, &c.IdPMetadataXML, &c.AttributeMapping, &c.Binding, &c.AllowIDPInitiated, &c.TrustEmail, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UpsertSAMLConnection creates or replaces the connection identified by c.Slug.
+// The IdP metadata is validated and the IdP entityID is taken from it.
+func (s *Service) UpsertSAMLConnection(ctx context.Context, c SAMLConnection) (*SAMLConnection, error) {
+	if s.pg == nil {
+		return nil, nil
+	}
+	c.Slug = strings.TrimSpace(c.Slug)
+	if c.Slug == "" {
+		return nil, fmt.Errorf("saml connection slug required")
+	}
+	ed, err := samlkit.ParseIdPMetadata([]byte(c.IdPMetadataXML))
+	if err != nil {
+		return nil, err
+	}
+	c.IdPEntityID = ed.EntityID
+	if c.Binding != samlkit.BindingPost {
+		c.Binding = samlkit.BindingRedirect
+	}
+	row := s.pg.QueryRow(ctx, `
+		INSERT INTO profiles.saml_connections (slug, idp_entity_id, idp_metadata_xml, attribute_mapping, binding, allow_idp_initiated, trust_email)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		ON CONFLICT (slug) DO UPDATE SET
+			idp_entity_id=EXCLUDED.idp_entity_id,
+			idp_metadata_xml=EXCLUDED.idp_metadata_xml,
+			attribute_mapping=EXCLUDED.attribute_mapping,
+			binding=EXCLUDED.binding,
+			allow_idp_initiated=EXCLUDED.allow_idp_initiated,
+			trust_email=EXCLUDED.trust_email,
+			updated_at=now()
+		RETURNING `+samlConnectionColumns,
+		c.Slug, c.IdPEntityID, c.IdPMetadataXML, c.AttributeMapping, c.Binding, c.AllowIDPInitiated, c.TrustEmail)
+	return scanSAMLConnection(row)
+}
+
+// GetSAMLConnection returns the connection with the given slug.
+func (s *Service) GetSAMLConnection(ctx context.Context, slug string) (*SAMLConnection, error) {
+	if s.pg == nil {
+		return nil, nil
+	}
+	return scanSAMLConnection(s.pg.QueryRow(ctx, `SELECT `+samlConnectionColumns+` FROM profiles.saml_connections WHERE slug=$1`, slug))
+}
+
+// ListSAMLConnections returns all connections ordered by slug.
+func (s *Service) ListSAMLConnections(ctx context.Context) ([]SAMLConnection, error) {
+	if s.pg == nil {
+		return nil, nil
+	}
+	rows, err := s.pg.Query(ctx, `SELECT `+samlConnectionColumns+` FROM profiles.saml_connections ORDER BY slug`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SAMLConnection
+	for rows.Next() {
+		c, err := scanSAMLConnection(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *c)
+	}
+	return out, rows.Err()
+}
+
+// DeleteSAMLConnection removes a connection. Existing provider links are kept so
+// that re-adding the same IdP restores access for linked users.
+func (s *Service) DeleteSAMLConnection(ctx context.Context, slug string) error {
+	if s.pg == nil {
+		return nil
+	}
+	_, err := s.pg.Exec(ctx, `DELETE FROM profiles.saml_connections WHERE slug=$1`, slug)
+	return err
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	jwtkit "github.com/open-rails/authkit/jwt"
+	"github.com/open-rails/authkit/ssf"
+)
+
+// ErrNoSETMapping indicates a security event has no CAEP/RISC equivalent.
+var ErrNoSETMapping = errors.New("no_set_mapping")
+
+// setEventFor maps a security event to a CAEP/RISC event type and payload.
+func setEventFor(e SecurityEvent) (string, map[string]any, bool) {
+	ts := e.OccurredAt.Unix()
+	switch e.Type {
+	case SecurityEventSessionRevoked:
+		ev := map[string]any{"event_timestamp": ts}
+		if r := eventDataString(e.Data, "reason"); r != "" {
+			ev["reason_admin"] = map[string]string{"en": r}
+		}
+		return ssf.CAEPSessionRevoked, ev, true
+	case SecurityEventPasswordChanged:
+		return ssf.CAEPCredentialChange, map[string]any{"event_timestamp": ts, "credential_type": "password", "change_type": "update"}, true
+	case SecurityEventTwoFactorEnabled:
+		credType := "email-otp"
+		if eventDataString(e.Data, "method") == "sms" {
+			credType = "phone-sms"
+		}
+		return ssf.CAEPCredentialChange, map[string]any{"event_timestamp": ts, "credential_type": credType, "change_type": "create"}, true
+	case SecurityEventUserBanned:
+		return ssf.RISCAccountDisabled, map[string]any{}, true
+	case SecurityEventUserDeleted:
+		if soft, _ := e.Data["soft"].(bool); soft {
+			return ssf.RISCAccountDisabled, map[string]any{}, true
+		}
+		return ssf.RISCAccountPurged, map[string]any{}, true
+	case SecurityEventUserUnbanned, SecurityEventUserRestored:
+		return ssf.RISCAccountEnabled, map[string]any{}, true
+	case SecurityEventEmailChanged:
+		ev := map[string]any{}
+		if email := eventDataString(e.Data, "email"); email != "" {
+			ev["new-value"] = email
+		}
+		return ssf.RISCIdentifierChanged, ev, true
+	}
+	return "", nil, false
+}
+
+// eventDataString reads a string detail whether Data was built in-process (string or
+// *string) or decoded from a stored JSON payload.
+func eventDataString(data map[string]any, key string) string {
+	switch v := data[key].(type) {
+	case string:
+		return v
+	case *string:
+		if v != nil {
+			return *v
+		}
+	}
+	return ""
+}
+
+// SecurityEventToken returns e as a Security Event Token (RFC 8417) for audience,
+// signed with the service's active jwtkit.Signer. The subject is identified as
+// iss_sub (this issuer, AuthKit user ID) and jti is the event ID.
+func (s *Service) SecurityEventToken(ctx context.Context, e SecurityEvent, audience string) (string, error) {
+	uri, event, ok := setEventFor(e)
+	if !ok {
+		return "", ErrNoSETMapping
+	}
+	if s.keys.Active == nil {
+		return "", fmt.Errorf("no signing key configured")
+	}
+	iat := e.OccurredAt
+	if iat.IsZero() {
+		iat = time.Now()
+	}
+	issuer := e.Issuer
+	if issuer == "" {
+		issuer = s.opts.Issuer
+	}
+	claims := ssf.NewClaims(issuer, audience, e.ID, iat, ssf.IssSub(issuer, e.UserID), uri, event)
+	if ts, ok := s.keys.Active.(jwtkit.TypedSigner); ok {
+		return ts.SignTyped(ctx, ssf.TokenType, claims)
+	}
+	return s.keys.Active.Sign(ctx, claims)
+}
+
+// SETAction is what a received security event does to the linked local account.
+type SETAction string
+
+const (
+	SETActionNone           SETAction = "none"
+	SETActionRevokeSessions SETAction = "revoke_sessions"
+	SETActionBan            SETAction = "ban"
+)
+
+// DefaultSETActions maps received CAEP/RISC event types to actions. Event types not
+// listed are accepted and ignored.
+var DefaultSETActions = map[string]SETAction{
+	ssf.CAEPSessionRevoked:                  SETActionRevokeSessions,
+	ssf.CAEPCredentialChange:                SETActionRevokeSessions,
+	ssf.RISCSessionsRevoked:                 SETActionRevokeSessions,
+	ssf.OAuthTokensRevoked:                  SETActionRevokeSessions,
+	ssf.RISCCredentialCompromise:            SETActionRevokeSessions,
+	ssf.RISCAccountCredentialChangeRequired: SETActionRevokeSessions,
+	ssf.RISCAccountPurged:                   SETActionRevokeSessions,
+	ssf.RISCAccountDisabled:                 SETActionBan,
+}
+
+// ApplyReceivedSecurityEvent applies action to the user linked to (providerIssuer, subject)
+// in profiles.user_providers. A trailing "/" on providerIssuer is ignored when matching,
+// since transmitters such as Google use "https://accounts.google.com/" while OIDC links
+// store "https://accounts.google.com". It returns the affected user ID, or "" when no
+// user is linked. Bans are recorded with bannedBy set to the transmitter issuer.
+func (s *Service) ApplyReceivedSecurityEvent(ctx context.Context, transmitter, providerIssuer, subject, eventURI string, action SETAction) (string, error) {
+	if action == "" || action == SETActionNone {
+		return "", nil
+	}
+	userID, err := s.userIDForProviderSubject(ctx, providerIssuer, subject)
+	if err != nil || userID == "" {
+		return "", err
+	}
+	s.Logger().InfoContext(ctx, "authkit: security event received", "issuer", transmitter, "event", eventURI, "action", string(action), "user_id", userID)
+	switch action {
+	case SETActionRevokeSessions:
+		return userID, s.RevokeAllSessions(WithSessionRevokeReason(ctx, SessionRevokeReasonSecurityEvent), userID, nil)
+	case SETActionBan:
+		reason := "security_event: " + eventURI
+		return userID, s.BanUser(ctx, userID, &reason, nil, transmitter)
+	}
+	return userID, fmt.Errorf("unknown SET action %q", action)
+}
+
+func (s *Service) userIDForProviderSubject(ctx context.Context, issuer, subject string) (string, error) {
+	if s.pg == nil {
+		return "", nil
+	}
+	trimmed := strings.TrimRight(issuer, "/")
+	var userID string
+	err := s.pg.QueryRow(ctx, `
+		SELECT user_id::text FROM profiles.user_providers
+		WHERE issuer = ANY($1) AND subject = $2
+		LIMIT 1`, []string{trimmed, trimmed + "/"}, subject).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return userID, err
+}
+
+// ClaimSecurityEventJTI records a received SET's (issuer, jti) for ttl and reports whether
+// it was new. Without an ephemeral store every SET is treated as new; the actions are
+// idempotent, so this only suppresses redundant work and audit noise.
+func (s *Service) ClaimSecurityEventJTI(ctx context.Context, issuer, jti string, ttl time.Duration) bool {
+	if !s.useEphemeralStore() || jti == "" {
+		return true
+	}
+	claimed, err := s.ephemSetStringNX(ctx, securityEventJTIKey(issuer, jti), "1", ttl)
+	if err != nil {
+		s.logIfErr(ctx, "authkit: record SET jti failed", err)
+		return true
+	}
+	return claimed
+}
+
+// ReleaseSecurityEventJTI forgets a claimed (issuer, jti) so a redelivery of a SET whose
+// actions failed is processed again.
+func (s *Service) ReleaseSecurityEventJTI(ctx context.Context, issuer, jti string) {
+	if !s.useEphemeralStore() || jti == "" {
+		return
+	}
+	s.logIfErr(ctx, "authkit: release SET jti failed", s.ephemDel(ctx, securityEventJTIKey(issuer, jti)))
+}
+
+func securityEventJTIKey(issuer, jti string) string {
+	return "ssf:jti:" + sha256Hex(issuer+"|"+jti)
+}
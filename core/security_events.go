@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SecurityEventType names an account-security change that downstream services may react to.
+type SecurityEventType string
+
+const (
+	SecurityEventUserBanned       SecurityEventType = "user.banned"
+	SecurityEventUserUnbanned     SecurityEventType = "user.unbanned"
+	SecurityEventUserDeleted      SecurityEventType = "user.deleted"
+	SecurityEventUserRestored     SecurityEventType = "user.restored"
+	SecurityEventEmailChanged     SecurityEventType = "user.email_changed"
+	SecurityEventPasswordChanged  SecurityEventType = "user.password_changed"
+	SecurityEventTwoFactorEnabled SecurityEventType = "user.2fa_enabled"
+	SecurityEventSessionRevoked   SecurityEventType = "session.revoked"
+)
+
+// SecurityEventTypes lists every event type AuthKit emits.
+var SecurityEventTypes = []SecurityEventType{
+	SecurityEventUserBanned,
+	SecurityEventUserUnbanned,
+	SecurityEventUserDeleted,
+	SecurityEventUserRestored,
+	SecurityEventEmailChanged,
+	SecurityEventPasswordChanged,
+	SecurityEventTwoFactorEnabled,
+	SecurityEventSessionRevoked,
+}
+
+// IsSecurityEventType reports whether t is an event type AuthKit emits.
+func IsSecurityEventType(t string) bool {
+	for _, et := range SecurityEventTypes {
+		if string(et) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// SecurityEvent is published after the change it describes has been committed.
+type SecurityEvent struct {
+	ID         string            `json:"id"`
+	Type       SecurityEventType `json:"type"`
+	OccurredAt time.Time         `json:"timestamp"`
+	Issuer     string            `json:"issuer"`
+	UserID     string            `json:"user_id"`
+	SessionID  string            `json:"session_id,omitempty"`
+	// Data carries type-specific details (e.g. ban reason, revoke reason, 2FA method).
+	Data map[string]any `json:"data,omitempty"`
+}
+
+// SecurityEventPublisher receives security events in-process. Publishing is best-effort:
+// errors are logged and never fail the originating operation.
+type SecurityEventPublisher interface {
+	PublishSecurityEvent(ctx context.Context, e SecurityEvent) error
+}
+
+// WithSecurityEventPublisher adds a publisher. It may be called more than once; every
+// publisher receives every event. Webhook delivery (WithWebhookEnqueuer) is independent.
+func (s *Service) WithSecurityEventPublisher(p SecurityEventPublisher) *Service {
+	if p != nil {
+		s.secPublishers = append(s.secPublishers, p)
+	}
+	return s
+}
+
+// publishSecurityEvent fills ID, time and issuer, then fans e out to publishers and
+// webhook subscriptions.
+func (s *Service) publishSecurityEvent(ctx context.Context, typ SecurityEventType, userID, sessionID string, data map[string]any) {
+	if len(s.secPublishers) == 0 && s.webhookEnqueuer == nil {
+		return
+	}
+	e := SecurityEvent{
+		ID:         uuid.NewString(),
+		Type:       typ,
+		OccurredAt: time.Now().UTC(),
+		Issuer:     s.opts.Issuer,
+		UserID:     userID,
+		SessionID:  sessionID,
+		Data:       data,
+	}
+	for _, p := range s.secPublishers {
+		s.logIfErr(ctx, "authkit: security event publish failed", p.PublishSecurityEvent(ctx, e), "event", string(typ), "user_id", userID)
+	}
+	s.logIfErr(ctx, "authkit: webhook enqueue failed", s.enqueueWebhookDeliveries(ctx, e), "event", string(typ), "user_id", userID)
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type recordingPublisher struct{ events []SecurityEvent }
+
+func (p *recordingPublisher) PublishSecurityEvent(_ context.Context, e SecurityEvent) error {
+	p.events = append(p.events, e)
+	return errors.New("ignored")
+}
+
+func TestPublishSecurityEvent_FansOutBestEffort(t *testing.T) {
+	svc := NewService(Options{Issuer: "https://auth.example.com"}, Keyset{})
+	a, b := &recordingPublisher{}, &recordingPublisher{}
+	svc.WithSecurityEventPublisher(a).WithSecurityEventPublisher(b)
+
+	svc.logSessionRevoked(context.Background(), "u1", "s1", nil)
+
+	for _, p := range []*recordingPublisher{a, b} {
+		if len(p.events) != 1 {
+			t.Fatalf("every publisher should receive the event despite errors, got %d", len(p.events))
+		}
+		e := p.events[0]
+		if e.Type != SecurityEventSessionRevoked || e.UserID != "u1" || e.SessionID != "s1" || e.ID == "" || e.OccurredAt.IsZero() || e.Issuer != "https://auth.example.com" {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	}
+	if a.events[0].ID != b.events[0].ID {
+		t.Fatalf("publishers must see the same event id")
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	t.Setenv("ENV", "production")
+	if err := validateWebhookURL("http://hooks.example.com/x"); !errors.Is(err, ErrInvalidWebhookURL) {
+		t.Fatalf("http must be rejected outside dev, got %v", err)
+	}
+	if err := validateWebhookURL("https://hooks.example.com/x"); err != nil {
+		t.Fatal(err)
+	}
+	types, err := normalizeWebhookEventTypes([]string{" user.banned", "user.banned", "session.revoked"})
+	if err != nil || len(types) != 2 {
+		t.Fatalf("unexpected types %v: %v", types, err)
+	}
+	if _, err := normalizeWebhookEventTypes([]string{"user.exploded"}); !errors.Is(err, ErrInvalidWebhookEventType) {
+		t.Fatalf("expected ErrInvalidWebhookEventType, got %v", err)
+	}
+}
@@ -9,17 +9,22 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	stdlog "log"
+	"log/slog"
+	"net/http"
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	entpg "github.com/open-rails/authkit/entitlements"
 	jwtkit "github.com/open-rails/authkit/jwt"
 	"github.com/open-rails/authkit/password"
+	"github.com/open-rails/authkit/telemetry"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // strPtr returns a pointer to the given string.
@@ -75,6 +80,24 @@ type Service struct {
 	authlog        AuthEventLogger
 	ephemeralStore EphemeralStore
 	ephemeralMode  EphemeralMode
+	extPasswords   ExternalPasswordVerifier
+	extLinkByEmail bool
+	oidcLink       OIDCLinkPolicy
+	regPolicy      RegistrationPolicy
+	usernamePolicy *UsernamePolicy
+	metadata       MetadataConfig
+	disposableMu   sync.RWMutex
+	disposable     map[string]struct{}
+	mergeHook      MergeHook
+	tel            *telemetry.Telemetry
+	logger         *slog.Logger
+
+	secPublishers   []SecurityEventPublisher
+	webhookEnqueuer WebhookEnqueuer
+	webhookClient   *http.Client
+	messageEnqueuer MessageEnqueuer
+	exportEnqueuer  DataExportEnqueuer
+	exportCfg       DataExportConfig
 }
 
 func NewService(opts Options, keys Keyset) *Service {
@@ -176,6 +199,7 @@ func (s *Service) AdminSetPassword(ctx context.Context, userID, new string) erro
 	if err := s.RevokeAllSessions(ctx, userID, nil); err != nil {
 		return err
 	}
+	s.publishSecurityEvent(ctx, SecurityEventPasswordChanged, userID, "", map[string]any{"source": "admin"})
 	return nil
 }
 
@@ -188,8 +212,11 @@ func (s *Service) EntitlementsProvider() EntitlementsProvider {
 // - roles (snapshot)
 // - entitlements (snapshot)
 // - email, username, discord_username (if available)
+// - metadata fields configured in MetadataConfig.Claims
 // Extra claims in `extra` are merged into the token body (e.g., sid).
 func (s *Service) IssueAccessToken(ctx context.Context, userID, email string, extra map[string]any) (token string, expiresAt time.Time, err error) {
+	ctx, span := s.startSpan(ctx, "IssueAccessToken")
+	defer func() { telemetry.End(span, err) }()
 	base := jwtkit.BaseRegisteredClaims(userID, s.opts.IssuedAudiences, s.opts.AccessTokenDuration)
 	expiresAt = base.ExpiresAt.Time
 	var roles []string
@@ -244,10 +271,18 @@ func (s *Service) IssueAccessToken(ctx context.Context, userID, email string, ex
 		"roles":            roles,
 		"entitlements":     ents,
 	}
+	for k, v := range s.metadataClaims(ctx, userID) {
+		if _, reserved := claims[k]; !reserved {
+			claims[k] = v
+		}
+	}
 	for k, v := range extra {
 		claims[k] = v
 	}
 	tok, err := s.keys.Active.Sign(ctx, claims)
+	if err == nil {
+		s.tel.TokenIssued(ctx, "access")
+	}
 	return tok, expiresAt, err
 }
 
@@ -342,9 +377,9 @@ func (s *Service) RequestPhoneChange(ctx context.Context, userID, newPhone strin
 
 	// Send verification code to new phone
 	if s.sms != nil {
-		_ = s.sms.SendVerificationCode(ctx, trimmed, code)
+		_ = s.sendMessage(ctx, outboundMessage{UserID: userID, Channel: MessageChannelSMS, Template: MessageTemplateVerificationCode, To: trimmed, Secret: code})
 	} else {
-		stdlog.Printf("[authkit/dev-sms] phone change verify to=%s username=%s code=%s", trimmed, username, code)
+		s.Logger().InfoContext(ctx, "authkit dev sms: phone change verification", "to", trimmed, "username", username, "code", code)
 	}
 
 	// Optionally: notify old phone (not implemented)
@@ -433,9 +468,9 @@ func (s *Service) ResendPhoneChangeCode(ctx context.Context, userID, phone strin
 
 	// Send new code
 	if s.sms != nil {
-		_ = s.sms.SendVerificationCode(ctx, phone, code)
+		_ = s.sendMessage(ctx, outboundMessage{UserID: userID, Channel: MessageChannelSMS, Template: MessageTemplateVerificationCode, To: phone, Secret: code})
 	} else {
-		stdlog.Printf("[authkit/dev-sms] phone change resend to=%s username=%s code=%s", phone, username, code)
+		s.Logger().InfoContext(ctx, "authkit dev sms: phone change resend", "to", phone, "username", username, "code", code)
 	}
 
 	return nil
@@ -476,14 +511,14 @@ func (s *Service) SendPhone2FASetupCode(ctx context.Context, userID, phone, code
 	}
 
 	if s.sms != nil {
-		return s.sms.SendVerificationCode(ctx, phone, code)
+		return s.sendMessage(ctx, outboundMessage{UserID: userID, Channel: MessageChannelSMS, Template: MessageTemplateVerificationCode, To: phone, Secret: code})
 	}
 	// In production, require SMS to be configured
 	if !isDevEnvironment(getEnvironment()) {
 		return fmt.Errorf("SMS sender not configured")
 	}
-	// Dev mode: log code to stdout
-	stdlog.Printf("[authkit/dev-sms] 2FA setup phone=%s code= %s", phone, code)
+	// Dev mode: log the code
+	s.Logger().InfoContext(ctx, "authkit dev sms: 2FA setup", "to", phone, "code", code)
 	return nil
 }
 
@@ -504,7 +539,9 @@ func (s *Service) VerifyPhone2FASetupCode(ctx context.Context, userID, phone, co
 }
 
 // PasswordLogin verifies credentials and issues an ID token.
-func (s *Service) PasswordLogin(ctx context.Context, email, pass string, extra map[string]any) (string, time.Time, error) {
+func (s *Service) PasswordLogin(ctx context.Context, email, pass string, extra map[string]any) (_ string, _ time.Time, err error) {
+	ctx, span := s.startSpan(ctx, "PasswordLogin")
+	defer func() { telemetry.End(span, err) }()
 	if s.pg == nil {
 		return "", time.Time{}, jwt.ErrTokenUnverifiable
 	}
@@ -515,35 +552,10 @@ func (s *Service) PasswordLogin(ctx context.Context, email, pass string, extra m
 	if err := s.ensureUserAccess(ctx, u); err != nil {
 		return "", time.Time{}, err
 	}
-	hash, algo, _, err := s.getPasswordHash(ctx, u.ID)
-	if err != nil {
-		return "", time.Time{}, errOrUnauthorized(err)
-	}
-	// Support legacy bcrypt with lazy rehash to Argon2id on successful login.
-	switch algo {
-	case "argon2id":
-		ok, err := password.VerifyArgon2id(hash, pass)
-		if err != nil || !ok {
-			return "", time.Time{}, errOrUnauthorized(err)
-		}
-	case "bcrypt", "":
-		// Some legacy rows may have empty algo but bcrypt formatted hash ($2b$...) — accept those too.
-		if !password.IsBcryptHash(hash) && algo == "" {
-			return "", time.Time{}, errOrUnauthorized(nil)
-		}
-		ok, err := password.VerifyBcrypt(hash, pass)
-		if err != nil || !ok {
-			return "", time.Time{}, errOrUnauthorized(err)
-		}
-		// Rehash to Argon2id and upsert
-		phc, err := password.HashArgon2id(pass)
-		if err == nil {
-			_ = s.upsertPasswordHash(ctx, u.ID, phc, "argon2id", nil)
-		}
-	default:
-		return "", time.Time{}, errOrUnauthorized(nil)
+	if err := s.verifyPassword(ctx, u.ID, pass); err != nil {
+		return "", time.Time{}, err
 	}
-	_ = s.setLastLogin(ctx, u.ID, time.Now())
+	s.logIfErr(ctx, "authkit: update last login failed", s.setLastLogin(ctx, u.ID, time.Now()), "user_id", u.ID)
 	emailStr := ""
 	if u.Email != nil {
 		emailStr = *u.Email
@@ -553,7 +565,9 @@ func (s *Service) PasswordLogin(ctx context.Context, email, pass string, extra m
 
 // PasswordLoginByUserID verifies credentials for a specific user ID and issues an ID token.
 // This supports login flows where the identifier is a phone number or username and email may be NULL.
-func (s *Service) PasswordLoginByUserID(ctx context.Context, userID, pass string, extra map[string]any) (string, time.Time, error) {
+func (s *Service) PasswordLoginByUserID(ctx context.Context, userID, pass string, extra map[string]any) (_ string, _ time.Time, err error) {
+	ctx, span := s.startSpan(ctx, "PasswordLoginByUserID")
+	defer func() { telemetry.End(span, err) }()
 	if s.pg == nil {
 		return "", time.Time{}, jwt.ErrTokenUnverifiable
 	}
@@ -567,38 +581,52 @@ func (s *Service) PasswordLoginByUserID(ctx context.Context, userID, pass string
 	if err := s.ensureUserAccess(ctx, u); err != nil {
 		return "", time.Time{}, err
 	}
-	hash, algo, _, err := s.getPasswordHash(ctx, u.ID)
+	if err := s.verifyPassword(ctx, u.ID, pass); err != nil {
+		return "", time.Time{}, err
+	}
+	s.logIfErr(ctx, "authkit: update last login failed", s.setLastLogin(ctx, u.ID, time.Now()), "user_id", u.ID)
+	emailStr := ""
+	if u.Email != nil {
+		emailStr = *u.Email
+	}
+	return s.IssueAccessToken(ctx, u.ID, emailStr, extra)
+}
+
+// verifyPassword checks pass against the user's stored hash.
+// Legacy bcrypt hashes are lazily rehashed to Argon2id on success.
+func (s *Service) verifyPassword(ctx context.Context, userID, pass string) (err error) {
+	ctx, span := s.startSpan(ctx, "password.verify")
+	defer func() { telemetry.End(span, err) }()
+	hash, algo, _, err := s.getPasswordHash(ctx, userID)
 	if err != nil {
-		return "", time.Time{}, errOrUnauthorized(err)
+		return errOrUnauthorized(err)
 	}
+	// Hash verification dominates login latency; expose the algorithm so Argon2 cost is visible.
+	span.SetAttributes(attribute.String("authkit.password.algo", algo))
 	switch algo {
 	case "argon2id":
 		ok, err := password.VerifyArgon2id(hash, pass)
 		if err != nil || !ok {
-			return "", time.Time{}, errOrUnauthorized(err)
+			return errOrUnauthorized(err)
 		}
 	case "bcrypt", "":
+		// Some legacy rows may have empty algo but bcrypt formatted hash ($2b$...) — accept those too.
 		if !password.IsBcryptHash(hash) && algo == "" {
-			return "", time.Time{}, errOrUnauthorized(nil)
+			return errOrUnauthorized(nil)
 		}
 		ok, err := password.VerifyBcrypt(hash, pass)
 		if err != nil || !ok {
-			return "", time.Time{}, errOrUnauthorized(err)
+			return errOrUnauthorized(err)
 		}
 		// Rehash to Argon2id and upsert
 		phc, err := password.HashArgon2id(pass)
 		if err == nil {
-			_ = s.upsertPasswordHash(ctx, u.ID, phc, "argon2id", nil)
+			s.logIfErr(ctx, "authkit: password rehash failed", s.upsertPasswordHash(ctx, userID, phc, "argon2id", nil), "user_id", userID)
 		}
 	default:
-		return "", time.Time{}, errOrUnauthorized(nil)
-	}
-	_ = s.setLastLogin(ctx, u.ID, time.Now())
-	emailStr := ""
-	if u.Email != nil {
-		emailStr = *u.Email
+		return errOrUnauthorized(nil)
 	}
-	return s.IssueAccessToken(ctx, u.ID, emailStr, extra)
+	return nil
 }
 
 func errOrUnauthorized(err error) error {
@@ -667,6 +695,7 @@ func (s *Service) ChangePassword(ctx context.Context, userID, current, new strin
 		sessionID = *keepSessionID
 	}
 	s.LogPasswordChanged(ctx, userID, sessionID, nil, nil)
+	s.publishSecurityEvent(ctx, SecurityEventPasswordChanged, userID, sessionID, map[string]any{"source": "user"})
 	return nil
 }
 
@@ -697,6 +726,19 @@ type EmailSenderWithPasswordResetLink interface {
 	SendPasswordResetLink(ctx context.Context, email, username, token string) error
 }
 
+// EmailSenderWithLinkAccountCode is an optional extension interface for the code that confirms
+// linking a provider identity to an existing account. Without it the email_code proof is not
+// offered for pending OIDC links.
+type EmailSenderWithLinkAccountCode interface {
+	SendLinkAccountCode(ctx context.Context, email, username, code string) error
+}
+
+// EmailSenderWithDataExportLink is an optional extension interface required for data exports.
+// The host builds the download URL from token; GET /auth/export/{token} serves the archive.
+type EmailSenderWithDataExportLink interface {
+	SendDataExportLink(ctx context.Context, email, username, token string) error
+}
+
 // SMSSender sends verification and 2FA codes via SMS.
 type SMSSender interface {
 	SendVerificationCode(ctx context.Context, phone, code string) error
@@ -725,7 +767,9 @@ func (s *Service) HasSMSSender() bool { return s.sms != nil }
 
 // RequestPasswordReset creates a password reset token and dispatches a reset link via email.
 // Returns nil for unknown emails to prevent user enumeration (202-like behavior).
-func (s *Service) RequestPasswordReset(ctx context.Context, email string, ttl time.Duration) error {
+func (s *Service) RequestPasswordReset(ctx context.Context, email string, ttl time.Duration) (err error) {
+	ctx, span := s.startSpan(ctx, "RequestPasswordReset")
+	defer func() { telemetry.End(span, err) }()
 	if s.pg == nil {
 		return nil
 	}
@@ -756,15 +800,14 @@ func (s *Service) RequestPasswordReset(ctx context.Context, email string, ttl ti
 		if !isDevEnvironment(getEnvironment()) {
 			return fmt.Errorf("email password reset unavailable: email sender not configured")
 		}
-		stdlog.Printf("[authkit/dev-email] password reset email=%s username=%s token=%s", *u.Email, username, token)
+		s.Logger().InfoContext(ctx, "authkit dev email: password reset", "to", *u.Email, "username", username, "token", token)
 		return nil
 	}
 
-	linkSender, ok := s.email.(EmailSenderWithPasswordResetLink)
-	if !ok {
+	if _, ok := s.email.(EmailSenderWithPasswordResetLink); !ok {
 		return fmt.Errorf("email password reset unavailable: email sender does not implement password reset links")
 	}
-	if err := linkSender.SendPasswordResetLink(ctx, *u.Email, username, token); err != nil {
+	if err := s.sendMessage(ctx, outboundMessage{UserID: u.ID, Channel: MessageChannelEmail, Template: MessageTemplatePasswordResetLink, To: *u.Email, Username: username, Secret: token}); err != nil {
 		return err
 	}
 
@@ -774,7 +817,9 @@ func (s *Service) RequestPasswordReset(ctx context.Context, email string, ttl ti
 }
 
 // ConfirmPasswordReset verifies token and sets a new password.
-func (s *Service) ConfirmPasswordReset(ctx context.Context, token, newPassword string) (string, error) {
+func (s *Service) ConfirmPasswordReset(ctx context.Context, token, newPassword string) (_ string, err error) {
+	ctx, span := s.startSpan(ctx, "ConfirmPasswordReset")
+	defer func() { telemetry.End(span, err) }()
 	if s.pg == nil {
 		return "", jwt.ErrTokenUnverifiable
 	}
@@ -790,8 +835,9 @@ func (s *Service) ConfirmPasswordReset(ctx context.Context, token, newPassword s
 		return "", err
 	}
 	// Revoke all sessions to invalidate any potentially compromised refresh tokens.
-	_ = s.RevokeAllSessions(ctx, rt.UserID, nil)
+	s.logIfErr(ctx, "authkit: revoke sessions failed", s.RevokeAllSessions(ctx, rt.UserID, nil), "user_id", rt.UserID)
 	s.LogPasswordChanged(ctx, rt.UserID, "", nil, nil)
+	s.publishSecurityEvent(ctx, SecurityEventPasswordChanged, rt.UserID, "", map[string]any{"source": "reset"})
 
 	return rt.UserID, nil
 }
@@ -825,9 +871,9 @@ func (s *Service) RequestEmailVerification(ctx context.Context, email string, tt
 		username = *u.Username
 	}
 	if s.email != nil {
-		_ = s.email.SendEmailVerificationCode(ctx, *u.Email, username, code)
+		_ = s.sendMessage(ctx, outboundMessage{UserID: u.ID, Channel: MessageChannelEmail, Template: MessageTemplateEmailVerificationCode, To: *u.Email, Username: username, Secret: code})
 	} else {
-		stdlog.Printf("[authkit/dev-email] email verify to=%s username=%s code=%s", *u.Email, username, code)
+		s.Logger().InfoContext(ctx, "authkit dev email: email verification", "to", *u.Email, "username", username, "code", code)
 	}
 	return nil
 }
@@ -863,6 +909,7 @@ func (s *Service) ConfirmEmailVerification(ctx context.Context, token string) (u
 
 // CreatePendingRegistration creates a pending registration and sends verification email.
 // Returns token for verification. Allows duplicate pending registrations (last one wins).
+// An invitation code attached with WithRegistrationInvite is redeemed on confirmation.
 func (s *Service) CreatePendingRegistration(ctx context.Context, email, username, passwordHash string, ttl time.Duration) (string, error) {
 	if ttl <= 0 {
 		ttl = 24 * time.Hour
@@ -873,7 +920,7 @@ func (s *Service) CreatePendingRegistration(ctx context.Context, email, username
 	hash := sha256Hex(code)
 
 	if s.useEphemeralStore() {
-		if err := s.storePendingRegistration(ctx, email, username, passwordHash, hash, ttl); err != nil {
+		if err := s.storePendingRegistration(ctx, email, username, passwordHash, inviteHashFromContext(ctx), hash, ttl); err != nil {
 			return "", err
 		}
 	} else {
@@ -882,9 +929,9 @@ func (s *Service) CreatePendingRegistration(ctx context.Context, email, username
 
 	// Send verification email with code
 	if s.email != nil {
-		_ = s.email.SendEmailVerificationCode(ctx, email, username, code)
+		_ = s.sendMessage(ctx, outboundMessage{Channel: MessageChannelEmail, Template: MessageTemplateEmailVerificationCode, To: email, Username: username, Secret: code})
 	} else {
-		stdlog.Printf("[authkit/dev-email] verify pending registration to=%s username=%s code=%s", email, username, code)
+		s.Logger().InfoContext(ctx, "authkit dev email: pending registration", "to", email, "username", username, "code", code)
 	}
 
 	return code, nil
@@ -895,13 +942,13 @@ func (s *Service) CreatePendingRegistration(ctx context.Context, email, username
 func (s *Service) ConfirmPendingRegistration(ctx context.Context, token string) (userID string, err error) {
 	hash := sha256Hex(token)
 
-	var email, username, passwordHash string
+	var email, username, passwordHash, inviteHash string
 	if s.useEphemeralStore() {
-		data, ok, err := s.loadPendingRegistration(ctx, hash)
+		data, ok, err := s.consumePendingRegistration(ctx, hash)
 		if err != nil || !ok {
 			return "", jwt.ErrTokenUnverifiable
 		}
-		email, username, passwordHash = data.Email, data.Username, data.PasswordHash
+		email, username, passwordHash, inviteHash = data.Email, data.Username, data.PasswordHash, data.InviteHash
 	} else {
 		return "", jwt.ErrTokenUnverifiable
 	}
@@ -926,10 +973,20 @@ func (s *Service) ConfirmPendingRegistration(ctx context.Context, token string)
 		}
 		return "", fmt.Errorf("email or username already taken")
 	}
+	// The invitation is redeemed in the same transaction that creates the user.
+	tx, err := s.pg.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if err := s.admitPendingRegistration(ctx, tx, inviteHash); err != nil {
+		s.deletePendingRegistration(ctx, hash, pendingRegistrationData{Email: email, Username: username})
+		return "", err
+	}
 
 	// Create the actual user (email_verified = true from the start)
 	var uid string
-	err = s.pg.QueryRow(ctx, `
+	err = tx.QueryRow(ctx, `
 		INSERT INTO profiles.users (email, username, email_verified)
 		VALUES (lower($1), $2, true)
 		RETURNING id::text
@@ -940,7 +997,7 @@ func (s *Service) ConfirmPendingRegistration(ctx context.Context, token string)
 	}
 
 	// Set password
-	_, err = s.pg.Exec(ctx, `
+	_, err = tx.Exec(ctx, `
 		INSERT INTO profiles.user_passwords (user_id, password_hash, hash_algo)
 		VALUES ($1, $2, 'argon2id')
 	`, uid, passwordHash)
@@ -948,6 +1005,9 @@ func (s *Service) ConfirmPendingRegistration(ctx context.Context, token string)
 	if err != nil {
 		return "", err
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
 
 	// Delete pending registration (success)
 	if s.useEphemeralStore() {
@@ -997,7 +1057,7 @@ func (s *Service) CreatePendingPhoneRegistration(ctx context.Context, phone, use
 	code := randAlphanumeric(6)
 	hash := sha256Hex(code)
 	if s.useEphemeralStore() {
-		if err := s.storePendingPhoneRegistration(ctx, phone, username, passwordHash, hash, 15*time.Minute); err != nil {
+		if err := s.storePendingPhoneRegistration(ctx, phone, username, passwordHash, inviteHashFromContext(ctx), hash, 15*time.Minute); err != nil {
 			return "", err
 		}
 	} else {
@@ -1006,14 +1066,14 @@ func (s *Service) CreatePendingPhoneRegistration(ctx context.Context, phone, use
 
 	// Send SMS
 	if s.sms != nil {
-		_ = s.sms.SendVerificationCode(ctx, phone, code)
+		_ = s.sendMessage(ctx, outboundMessage{Channel: MessageChannelSMS, Template: MessageTemplateVerificationCode, To: phone, Secret: code})
 	} else {
 		// In production, require SMS to be configured
 		if !isDevEnvironment(getEnvironment()) {
 			return "", fmt.Errorf("SMS verification unavailable: Twilio not configured (phone registration requires SMS in production)")
 		}
-		// Dev mode: log code to stdout
-		stdlog.Printf("[authkit/dev-sms] verify pending phone registration phone=%s code=%s", phone, code)
+		// Dev mode: log the code
+		s.Logger().InfoContext(ctx, "authkit dev sms: pending phone registration", "to", phone, "code", code)
 	}
 
 	return code, nil
@@ -1024,17 +1084,17 @@ func (s *Service) CreatePendingPhoneRegistration(ctx context.Context, phone, use
 func (s *Service) ConfirmPendingPhoneRegistration(ctx context.Context, phone, code string) (userID string, err error) {
 	hash := sha256Hex(code)
 
-	var username, passwordHash string
+	var username, passwordHash, inviteHash string
 	if s.useEphemeralStore() {
 		tokenHash, ok, err := s.ephemGetString(ctx, keyPendingPhonePhone+phone)
 		if err != nil || !ok || tokenHash == "" || tokenHash != hash {
 			return "", jwt.ErrTokenUnverifiable
 		}
-		data, ok, err := s.loadPendingPhoneRegistration(ctx, tokenHash)
+		data, ok, err := s.consumePendingPhoneRegistration(ctx, tokenHash)
 		if err != nil || !ok {
 			return "", jwt.ErrTokenUnverifiable
 		}
-		username, passwordHash = data.Username, data.PasswordHash
+		username, passwordHash, inviteHash = data.Username, data.PasswordHash, data.InviteHash
 	} else {
 		return "", jwt.ErrTokenUnverifiable
 	}
@@ -1059,10 +1119,20 @@ func (s *Service) ConfirmPendingPhoneRegistration(ctx context.Context, phone, co
 		}
 		return "", fmt.Errorf("phone or username already taken")
 	}
+	// The invitation is redeemed in the same transaction that creates the user.
+	tx, err := s.pg.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if err := s.admitPendingRegistration(ctx, tx, inviteHash); err != nil {
+		s.deletePendingPhoneRegistration(ctx, hash, pendingRegistrationData{Email: phone, Username: username})
+		return "", err
+	}
 
 	// Create the actual user (phone_verified = true from the start, email = NULL)
 	var uid string
-	err = s.pg.QueryRow(ctx, `
+	err = tx.QueryRow(ctx, `
 		INSERT INTO profiles.users (phone_number, username, phone_verified, email_verified)
 		VALUES ($1, $2, true, false)
 		RETURNING id::text
@@ -1073,7 +1143,7 @@ func (s *Service) ConfirmPendingPhoneRegistration(ctx context.Context, phone, co
 	}
 
 	// Set password
-	_, err = s.pg.Exec(ctx, `
+	_, err = tx.Exec(ctx, `
 		INSERT INTO profiles.user_passwords (user_id, password_hash, hash_algo)
 		VALUES ($1, $2, 'argon2id')
 	`, uid, passwordHash)
@@ -1081,6 +1151,9 @@ func (s *Service) ConfirmPendingPhoneRegistration(ctx context.Context, phone, co
 	if err != nil {
 		return "", err
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
 
 	// Delete pending registration
 	if s.useEphemeralStore() {
@@ -1181,14 +1254,14 @@ func (s *Service) SendPhoneVerificationToUser(ctx context.Context, phone, userID
 
 	// Send SMS
 	if s.sms != nil {
-		_ = s.sms.SendVerificationCode(ctx, phone, code)
+		_ = s.sendMessage(ctx, outboundMessage{UserID: userID, Channel: MessageChannelSMS, Template: MessageTemplateVerificationCode, To: phone, Secret: code})
 	} else {
 		// In production, require SMS to be configured
 		if !isDevEnvironment(getEnvironment()) {
 			return fmt.Errorf("SMS verification unavailable: Twilio not configured (phone verification requires SMS in production)")
 		}
-		// Dev mode: log code to stdout
-		stdlog.Printf("[authkit/dev-sms] phone verify phone=%s code=%s", phone, code)
+		// Dev mode: log the code
+		s.Logger().InfoContext(ctx, "authkit dev sms: phone verification", "to", phone, "code", code)
 	}
 
 	return nil
@@ -1245,19 +1318,18 @@ func (s *Service) RequestPhonePasswordReset(ctx context.Context, phone string, t
 		if !isDevEnvironment(getEnvironment()) {
 			return fmt.Errorf("SMS password reset unavailable: sms sender not configured")
 		}
-		stdlog.Printf("[authkit/dev-sms] password reset phone=%s token=%s", phone, token)
+		s.Logger().InfoContext(ctx, "authkit dev sms: password reset", "to", phone, "token", token)
 		return nil
 	}
 
-	linkSender, ok := s.sms.(SMSSenderWithPasswordResetLink)
-	if !ok {
+	if _, ok := s.sms.(SMSSenderWithPasswordResetLink); !ok {
 		if !isDevEnvironment(getEnvironment()) {
 			return fmt.Errorf("SMS password reset unavailable: sms sender does not implement password reset links")
 		}
-		stdlog.Printf("[authkit/dev-sms] password reset phone=%s token=%s (no SMS link sender configured)", phone, token)
+		s.Logger().InfoContext(ctx, "authkit dev sms: password reset (no SMS link sender configured)", "to", phone, "token", token)
 		return nil
 	}
-	_ = linkSender.SendPasswordResetLink(ctx, phone, token)
+	_ = s.sendMessage(ctx, outboundMessage{UserID: u.ID, Channel: MessageChannelSMS, Template: MessageTemplatePasswordResetLink, To: phone, Secret: token})
 
 	s.LogPasswordRecovery(ctx, u.ID, "sms", "", nil, nil)
 
@@ -1417,8 +1489,17 @@ func (s *Service) createUser(ctx context.Context, email, username string) (*User
 	if s.pg == nil {
 		return nil, nil
 	}
+	return insertUser(ctx, s.pg, email, username)
+}
+
+// rowQuerier is satisfied by both the pool and a transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func insertUser(ctx context.Context, q rowQuerier, email, username string) (*User, error) {
 	// Convert empty email to NULL for database (allows multiple users without emails)
-	row := s.pg.QueryRow(ctx, `INSERT INTO profiles.users (email, username) VALUES (NULLIF(lower($1), ''), $2) RETURNING id, email, username, email_verified, banned_at, deleted_at`, email, username)
+	row := q.QueryRow(ctx, `INSERT INTO profiles.users (email, username) VALUES (NULLIF(lower($1), ''), $2) RETURNING id, email, username, email_verified, banned_at, deleted_at`, email, username)
 	var u User
 	if err := row.Scan(&u.ID, &u.Email, &u.Username, &u.EmailVerified, &u.BannedAt, &u.DeletedAt); err != nil {
 		return nil, err
@@ -1482,13 +1563,18 @@ func (s *Service) BanUser(ctx context.Context, userID string, reason *string, un
 	if err != nil {
 		return err
 	}
-	_ = s.RevokeAllSessions(WithSessionRevokeReason(ctx, SessionRevokeReasonBanned), userID, nil)
+	s.logIfErr(ctx, "authkit: revoke sessions failed", s.RevokeAllSessions(WithSessionRevokeReason(ctx, SessionRevokeReasonBanned), userID, nil), "user_id", userID)
+	s.publishSecurityEvent(ctx, SecurityEventUserBanned, userID, "", map[string]any{"reason": reasonPtr, "banned_until": untilPtr, "banned_by": bannedByPtr})
 	return nil
 }
 
 // UnbanUser clears ban metadata and re-enables the account.
 func (s *Service) UnbanUser(ctx context.Context, userID string) error {
-	return s.clearUserBan(ctx, userID)
+	if err := s.clearUserBan(ctx, userID); err != nil {
+		return err
+	}
+	s.publishSecurityEvent(ctx, SecurityEventUserUnbanned, userID, "", nil)
+	return nil
 }
 
 // SoftDeleteUser marks the user deleted and sets deleted_at without dropping rows.
@@ -1498,10 +1584,13 @@ func (s *Service) SoftDeleteUser(ctx context.Context, id string) error {
 		return nil
 	}
 	// Revoke sessions first
-	_ = s.RevokeAllSessions(WithSessionRevokeReason(ctx, SessionRevokeReasonSoftDeleted), id, nil)
+	s.logIfErr(ctx, "authkit: revoke sessions failed", s.RevokeAllSessions(WithSessionRevokeReason(ctx, SessionRevokeReasonSoftDeleted), id, nil), "user_id", id)
 	// Soft-delete user
-	_, err := s.pg.Exec(ctx, `UPDATE profiles.users SET deleted_at=now(), updated_at=now() WHERE id=$1`, id)
-	return err
+	if _, err := s.pg.Exec(ctx, `UPDATE profiles.users SET deleted_at=now(), updated_at=now() WHERE id=$1`, id); err != nil {
+		return err
+	}
+	s.publishSecurityEvent(ctx, SecurityEventUserDeleted, id, "", map[string]any{"soft": true})
+	return nil
 }
 
 // RestoreUser clears deleted_at and re-enables the account.
@@ -1509,8 +1598,11 @@ func (s *Service) RestoreUser(ctx context.Context, id string) error {
 	if s.pg == nil {
 		return nil
 	}
-	_, err := s.pg.Exec(ctx, `UPDATE profiles.users SET deleted_at=NULL, updated_at=now() WHERE id=$1`, id)
-	return err
+	if _, err := s.pg.Exec(ctx, `UPDATE profiles.users SET deleted_at=NULL, updated_at=now() WHERE id=$1`, id); err != nil {
+		return err
+	}
+	s.publishSecurityEvent(ctx, SecurityEventUserRestored, id, "", nil)
+	return nil
 }
 
 // HostDeleteUser performs deletion on behalf of the host application.
@@ -1527,7 +1619,21 @@ func (s *Service) updateUsername(ctx context.Context, id, username string) error
 	if s.pg == nil {
 		return nil
 	}
-	_, err := s.pg.Exec(ctx, `UPDATE profiles.users SET username=$2, updated_at=NOW() WHERE id=$1`, id, username)
+	if s.usernamePolicy == nil {
+		_, err := s.pg.Exec(ctx, `UPDATE profiles.users SET username=$2, updated_at=NOW() WHERE id=$1`, id, username)
+		return err
+	}
+	// Record the released username; it is held for its owner and drives the change cooldown.
+	_, err := s.pg.Exec(ctx, `
+		WITH old AS (
+			SELECT username FROM profiles.users WHERE id = $1
+		), upd AS (
+			UPDATE profiles.users SET username=$2, updated_at=NOW() WHERE id=$1 RETURNING id
+		)
+		INSERT INTO profiles.username_history (user_id, username, held_until)
+		SELECT upd.id, old.username, $3 FROM old, upd
+		WHERE old.username IS NOT NULL AND old.username <> $2::citext
+	`, id, username, time.Now().Add(s.usernameHoldPeriod()))
 	return err
 }
 
@@ -1555,8 +1661,9 @@ func (s *Service) updateEmail(ctx context.Context, id, email string) error {
 	if _, err := s.pg.Exec(ctx, `UPDATE profiles.users SET email=lower($2), email_verified=false, updated_at=NOW() WHERE id=$1`, id, trimmed); err != nil {
 		return err
 	}
+	s.publishSecurityEvent(ctx, SecurityEventEmailChanged, id, "", map[string]any{"email": strings.ToLower(trimmed), "verified": false})
 
-	_ = s.RequestEmailVerification(ctx, trimmed, 0)
+	s.logIfErr(ctx, "authkit: send email verification failed", s.RequestEmailVerification(ctx, trimmed, 0))
 	return nil
 }
 
@@ -1615,16 +1722,16 @@ func (s *Service) RequestEmailChange(ctx context.Context, userID, newEmail strin
 
 	// Send verification code to NEW email
 	if s.email != nil {
-		_ = s.email.SendEmailVerificationCode(ctx, trimmed, username, code)
+		_ = s.sendMessage(ctx, outboundMessage{UserID: userID, Channel: MessageChannelEmail, Template: MessageTemplateEmailVerificationCode, To: trimmed, Username: username, Secret: code})
 	} else {
-		stdlog.Printf("[authkit/dev-email] email change verify to=%s username=%s code=%s", trimmed, username, code)
+		s.Logger().InfoContext(ctx, "authkit dev email: email change verification", "to", trimmed, "username", username, "code", code)
 	}
 
 	// Send notification to OLD email about the change request
 	if u.Email != nil && s.email != nil {
 		// Note: SendEmailVerificationCode is not ideal for notifications, but it's what we have
 		// In production, you'd want a dedicated SendEmailChangeNotification method
-		stdlog.Printf("[authkit/security] Email change requested for user %s from %s to %s", userID, *u.Email, trimmed)
+		s.Logger().InfoContext(ctx, "authkit: email change requested", "user_id", userID, "from", *u.Email, "to", trimmed)
 	}
 
 	return nil
@@ -1671,6 +1778,7 @@ func (s *Service) ConfirmEmailChange(ctx context.Context, userID, code string) e
 	if err != nil {
 		return err
 	}
+	s.publishSecurityEvent(ctx, SecurityEventEmailChanged, userID, "", map[string]any{"email": strings.ToLower(*rec.Email), "verified": true})
 
 	return nil
 }
@@ -1722,9 +1830,9 @@ func (s *Service) ResendEmailChangeCode(ctx context.Context, userID string) erro
 
 	// Send new code
 	if s.email != nil {
-		_ = s.email.SendEmailVerificationCode(ctx, pendingEmail, username, code)
+		_ = s.sendMessage(ctx, outboundMessage{UserID: userID, Channel: MessageChannelEmail, Template: MessageTemplateEmailVerificationCode, To: pendingEmail, Username: username, Secret: code})
 	} else {
-		stdlog.Printf("[authkit/dev-email] email change resend to=%s username=%s code=%s", pendingEmail, username, code)
+		s.Logger().InfoContext(ctx, "authkit dev email: email change resend", "to", pendingEmail, "username", username, "code", code)
 	}
 
 	return nil
@@ -1927,24 +2035,26 @@ func (s *Service) IsUserAllowed(ctx context.Context, userID string) (bool, error
 
 // Admin listing/get/delete
 type AdminUser struct {
-	ID              string     `json:"id"`
-	Email           *string    `json:"email"` // Nullable for phone-only users
-	PhoneNumber     *string    `json:"phone_number"`
-	Username        *string    `json:"username"`
-	DiscordUsername *string    `json:"discord_username"`
-	EmailVerified   bool       `json:"email_verified"`
-	PhoneVerified   bool       `json:"phone_verified"`
-	BannedAt        *time.Time `json:"banned_at,omitempty"`
-	BannedUntil     *time.Time `json:"banned_until,omitempty"`
-	BanReason       *string    `json:"ban_reason,omitempty"`
-	BannedBy        *string    `json:"banned_by,omitempty"`
-	DeletedAt       *time.Time `json:"deleted_at"`
-	Biography       *string    `json:"biography"`
-	CreatedAt       time.Time  `json:"created_at"`
-	UpdatedAt       time.Time  `json:"updated_at"`
-	LastLogin       *time.Time `json:"last_login"`
-	Roles           []string   `json:"roles"`
-	Entitlements    []string   `json:"entitlements"`
+	ID              string         `json:"id"`
+	Email           *string        `json:"email"` // Nullable for phone-only users
+	PhoneNumber     *string        `json:"phone_number"`
+	Username        *string        `json:"username"`
+	DiscordUsername *string        `json:"discord_username"`
+	EmailVerified   bool           `json:"email_verified"`
+	PhoneVerified   bool           `json:"phone_verified"`
+	BannedAt        *time.Time     `json:"banned_at,omitempty"`
+	BannedUntil     *time.Time     `json:"banned_until,omitempty"`
+	BanReason       *string        `json:"ban_reason,omitempty"`
+	BannedBy        *string        `json:"banned_by,omitempty"`
+	DeletedAt       *time.Time     `json:"deleted_at"`
+	Biography       *string        `json:"biography"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	LastLogin       *time.Time     `json:"last_login"`
+	Roles           []string       `json:"roles"`
+	Entitlements    []string       `json:"entitlements"`
+	UserMetadata    map[string]any `json:"user_metadata,omitempty"`
+	AppMetadata     map[string]any `json:"app_metadata,omitempty"`
 }
 
 // AdminListUsersResult contains paginated user list with total count
@@ -1965,8 +2075,25 @@ func (s *Service) AdminListUsers(ctx context.Context, page, pageSize int, filter
 	if pageSize <= 0 || pageSize > 200 {
 		pageSize = 50
 	}
-	offset := (page - 1) * pageSize
+	return s.adminListUsers(ctx, (page-1)*pageSize, pageSize, filter, search, onlyDeleted)
+}
+
+// AdminListUsersFrom lists live users starting at a zero-based offset, for clients that
+// page by position rather than page number (SCIM startIndex). limit is capped at 200.
+func (s *Service) AdminListUsersFrom(ctx context.Context, offset, limit int) (*AdminListUsersResult, error) {
+	if s.pg == nil {
+		return &AdminListUsersResult{Users: []AdminUser{}, Total: 0, Limit: limit, Offset: offset}, nil
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return s.adminListUsers(ctx, offset, limit, "", "", false)
+}
 
+func (s *Service) adminListUsers(ctx context.Context, offset, pageSize int, filter, search string, onlyDeleted bool) (*AdminListUsersResult, error) {
 	// Only support these filters:
 	// "All users", "Super administrators", "Taggers", "Bloggers"
 
@@ -2064,6 +2191,9 @@ func (s *Service) AdminGetUser(ctx context.Context, id string) (*AdminUser, erro
 	}
 	a.Roles = s.listRoleSlugsByUser(ctx, id)
 	a.Entitlements = s.ListEntitlements(ctx, id)
+	userMeta, appMeta, err := s.GetUserMetadata(ctx, id)
+	s.logIfErr(ctx, "authkit: metadata lookup failed", err, "user_id", id)
+	a.UserMetadata, a.AppMetadata = userMeta, appMeta
 	return a, nil
 }
 
@@ -2072,10 +2202,14 @@ func (s *Service) AdminDeleteUser(ctx context.Context, id string) error {
 		return nil
 	}
 	// Revoke all sessions
-	_, _ = s.pg.Exec(ctx, `UPDATE profiles.refresh_sessions SET revoked_at=now() WHERE user_id=$1 AND issuer=$2`, id, s.opts.Issuer)
+	_, err := s.pg.Exec(ctx, `UPDATE profiles.refresh_sessions SET revoked_at=now() WHERE user_id=$1 AND issuer=$2`, id, s.opts.Issuer)
+	s.logIfErr(ctx, "authkit: session revoke failed", err, "user_id", id)
 	// Delete user
-	_, err := s.pg.Exec(ctx, `DELETE FROM profiles.users WHERE id=$1`, id)
-	return err
+	if _, err := s.pg.Exec(ctx, `DELETE FROM profiles.users WHERE id=$1`, id); err != nil {
+		return err
+	}
+	s.publishSecurityEvent(ctx, SecurityEventUserDeleted, id, "", map[string]any{"soft": false})
+	return nil
 }
 
 // Additional public helpers used by OIDC flow
@@ -2115,6 +2249,7 @@ func (s *Service) DeriveUsername(email string) string { return deriveUsername(em
 
 // LogSessionCreated records a session creation event via the configured AuthEventLogger (best-effort).
 func (s *Service) LogSessionCreated(ctx context.Context, userID string, method string, sessionID string, ip *string, ua *string) {
+	s.tel.LoginSucceeded(ctx, method)
 	if s.authlog == nil {
 		return
 	}
@@ -2134,10 +2269,11 @@ func (s *Service) LogSessionCreated(ctx context.Context, userID string, method s
 		IPAddr:     ip,
 		UserAgent:  ua,
 	}
-	_ = s.authlog.LogSessionEvent(ctx, e)
+	s.logIfErr(ctx, "authkit: auth event log failed", s.authlog.LogSessionEvent(ctx, e))
 }
 
 func (s *Service) logSessionRevoked(ctx context.Context, userID string, sessionID string, reason *string) {
+	s.publishSecurityEvent(ctx, SecurityEventSessionRevoked, userID, sessionID, map[string]any{"reason": reason})
 	if s.authlog == nil {
 		return
 	}
@@ -2152,7 +2288,7 @@ func (s *Service) logSessionRevoked(ctx context.Context, userID string, sessionI
 		IPAddr:     nil,
 		UserAgent:  nil,
 	}
-	_ = s.authlog.LogSessionEvent(ctx, e)
+	s.logIfErr(ctx, "authkit: auth event log failed", s.authlog.LogSessionEvent(ctx, e))
 }
 
 // LogPasswordChanged records a password change event for a user (best-effort).
@@ -2171,7 +2307,7 @@ func (s *Service) LogPasswordChanged(ctx context.Context, userID string, session
 		IPAddr:     ip,
 		UserAgent:  ua,
 	}
-	_ = s.authlog.LogSessionEvent(ctx, e)
+	s.logIfErr(ctx, "authkit: auth event log failed", s.authlog.LogSessionEvent(ctx, e))
 }
 
 // LogPasswordRecovery records a password recovery event for a user (best-effort).
@@ -2191,7 +2327,7 @@ func (s *Service) LogPasswordRecovery(ctx context.Context, userID string, method
 		IPAddr:     ip,
 		UserAgent:  ua,
 	}
-	_ = s.authlog.LogSessionEvent(ctx, e)
+	s.logIfErr(ctx, "authkit: auth event log failed", s.authlog.LogSessionEvent(ctx, e))
 }
 
 // LogSessionFailed records a failed session event for a user (best-effort).
@@ -2211,7 +2347,7 @@ func (s *Service) LogSessionFailed(ctx context.Context, userID string, sessionID
 		IPAddr:     ip,
 		UserAgent:  ua,
 	}
-	_ = s.authlog.LogSessionEvent(ctx, e)
+	s.logIfErr(ctx, "authkit: auth event log failed", s.authlog.LogSessionEvent(ctx, e))
 }
 
 // SendWelcome triggers the welcome email if an EmailSender is configured.
@@ -2228,7 +2364,7 @@ func (s *Service) SendWelcome(ctx context.Context, userID string) {
 	if u.Username != nil {
 		username = *u.Username
 	}
-	_ = s.email.SendWelcome(ctx, *u.Email, username)
+	_ = s.sendMessage(ctx, outboundMessage{UserID: u.ID, Channel: MessageChannelEmail, Template: MessageTemplateWelcome, To: *u.Email, Username: username})
 }
 
 // Provider link management
@@ -2278,9 +2414,10 @@ func (s *Service) LinkProviderByIssuer(ctx context.Context, userID, issuer, prov
 		return nil
 	}
 	// First delete old Discord link if user is switching to a different Discord account
-	_, _ = s.pg.Exec(ctx, `DELETE FROM profiles.user_providers WHERE user_id=$1 AND issuer=$2 AND subject != $3`, userID, issuer, subject)
+	_, err := s.pg.Exec(ctx, `DELETE FROM profiles.user_providers WHERE user_id=$1 AND issuer=$2 AND subject != $3`, userID, issuer, subject)
+	s.logIfErr(ctx, "authkit: stale provider link delete failed", err, "user_id", userID, "issuer", issuer)
 	// Then insert/update the new link
-	_, err := s.pg.Exec(ctx, `
+	_, err = s.pg.Exec(ctx, `
 		INSERT INTO profiles.user_providers (user_id, issuer, provider_slug, subject, email_at_provider)
 		VALUES ($1,$2,$3,$4,$5)
 		ON CONFLICT (issuer, subject) DO UPDATE
@@ -2527,6 +2664,7 @@ func (s *Service) Enable2FA(ctx context.Context, userID, method string, phoneNum
 	if err != nil {
 		return nil, err
 	}
+	s.publishSecurityEvent(ctx, SecurityEventTwoFactorEnabled, userID, "", map[string]any{"method": method})
 
 	return plaintextCodes, nil
 }
@@ -2622,25 +2760,25 @@ func (s *Service) Require2FAForLogin(ctx context.Context, userID string) (string
 
 	if settings.Method == "email" {
 		if s.email != nil {
-			_ = s.email.SendLoginCode(ctx, destination, username, code)
+			_ = s.sendMessage(ctx, outboundMessage{UserID: userID, Channel: MessageChannelEmail, Template: MessageTemplateLoginCode, To: destination, Username: username, Secret: code})
 		} else {
 			// In production, require email to be configured for email 2FA
 			if !isDevEnvironment(getEnvironment()) {
 				return "", fmt.Errorf("Email 2FA unavailable: email sender not configured (email 2FA requires email in production)")
 			}
-			// Dev mode: log code to stdout
-			stdlog.Printf("[authkit/dev-2fa] email 2FA code for %s: %s", destination, code)
+			// Dev mode: log the code
+			s.Logger().InfoContext(ctx, "authkit dev 2fa: email code", "to", destination, "code", code)
 		}
 	} else { // sms
 		if s.sms != nil {
-			_ = s.sms.SendLoginCode(ctx, destination, code)
+			_ = s.sendMessage(ctx, outboundMessage{UserID: userID, Channel: MessageChannelSMS, Template: MessageTemplateLoginCode, To: destination, Secret: code})
 		} else {
 			// In production, require SMS to be configured for SMS 2FA
 			if !isDevEnvironment(getEnvironment()) {
 				return "", fmt.Errorf("SMS 2FA unavailable: Twilio not configured (SMS 2FA requires Twilio in production)")
 			}
-			// Dev mode: log code to stdout
-			stdlog.Printf("[authkit/dev-2fa] SMS 2FA code for %s: %s", destination, code)
+			// Dev mode: log the code
+			s.Logger().InfoContext(ctx, "authkit dev 2fa: sms code", "to", destination, "code", code)
 		}
 	}
 
@@ -2685,7 +2823,9 @@ func (s *Service) Clear2FAChallenge(ctx context.Context, userID string) error {
 
 // Verify2FACode verifies a 2FA code entered by the user during login.
 // Returns true if code is valid, false otherwise.
-func (s *Service) Verify2FACode(ctx context.Context, userID, code string) (bool, error) {
+func (s *Service) Verify2FACode(ctx context.Context, userID, code string) (_ bool, err error) {
+	ctx, span := s.startSpan(ctx, "Verify2FACode")
+	defer func() { telemetry.End(span, err) }()
 	hash := sha256Hex(code)
 
 	if s.useEphemeralStore() {
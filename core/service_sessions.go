@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/open-rails/authkit/telemetry"
 )
 
 // Session represents a sanitized session view (no tokens).
@@ -25,6 +26,8 @@ type Session struct {
 
 // IssueRefreshSession creates a session row and returns a new refresh token string.
 func (s *Service) IssueRefreshSession(ctx context.Context, userID, userAgent string, ip net.IP) (sessionID, refreshToken string, expiresAt *time.Time, err error) {
+	ctx, span := s.startSpan(ctx, "IssueRefreshSession")
+	defer func() { telemetry.End(span, err) }()
 	if s.pg == nil {
 		return "", "", nil, errors.New("postgres not configured")
 	}
@@ -58,11 +61,14 @@ func (s *Service) IssueRefreshSession(ctx context.Context, userID, userAgent str
 	if err = s.pg.QueryRow(ctx, q, userID, s.opts.Issuer, hash, expPtr, nullable(userAgent), ipstr).Scan(&sid, &fam); err != nil {
 		return "", "", nil, err
 	}
+	s.tel.TokenIssued(ctx, "refresh")
 	return sid, rt, expPtr, nil
 }
 
 // ExchangeRefreshToken rotates a refresh token and returns a new ID token + refresh token.
 func (s *Service) ExchangeRefreshToken(ctx context.Context, refreshToken string, ua string, ip net.IP) (idToken string, expiresAt time.Time, newRefresh string, err error) {
+	ctx, span := s.startSpan(ctx, "ExchangeRefreshToken")
+	defer func() { telemetry.End(span, err) }()
 	if s.pg == nil {
 		return "", time.Time{}, "", errors.New("postgres not configured")
 	}
@@ -83,7 +89,9 @@ func (s *Service) ExchangeRefreshToken(ctx context.Context, refreshToken string,
 		selPrev := `SELECT id::text, user_id, family_id::text FROM profiles.refresh_sessions
                     WHERE previous_token_hash=$1 AND issuer=$2 AND revoked_at IS NULL`
 		if e2 := s.pg.QueryRow(ctx, selPrev, h, s.opts.Issuer).Scan(&sidPrev, &uidPrev, &famPrev); e2 == nil {
-			_ = s.revokeFamily(ctx, famPrev)
+			s.tel.RefreshReuseDetected(ctx)
+			s.Logger().WarnContext(ctx, "authkit: refresh token reuse detected; revoking session family", "user_id", uidPrev, "session_id", sidPrev)
+			s.logIfErr(ctx, "authkit: revoke refresh token family failed", s.revokeFamily(ctx, famPrev), "user_id", uidPrev)
 			return "", time.Time{}, "", errors.New("refresh token reuse detected")
 		}
 		return "", time.Time{}, "", errors.New("invalid refresh token")
@@ -97,7 +105,7 @@ func (s *Service) ExchangeRefreshToken(ctx context.Context, refreshToken string,
 		_ = s.pg.QueryRow(ctx, `SELECT email FROM profiles.users WHERE id=$1`, uid).Scan(&email)
 	}
 	if ok, e := s.IsUserAllowed(ctx, uid); e != nil || !ok {
-		_ = s.RevokeAllSessions(WithSessionRevokeReason(ctx, SessionRevokeReasonUserDisabled), uid, nil)
+		s.logIfErr(ctx, "authkit: revoke sessions failed", s.RevokeAllSessions(WithSessionRevokeReason(ctx, SessionRevokeReasonUserDisabled), uid, nil), "user_id", uid)
 		return "", time.Time{}, "", errors.New("user_disabled")
 	}
 
@@ -117,6 +125,7 @@ func (s *Service) ExchangeRefreshToken(ctx context.Context, refreshToken string,
 	if err != nil {
 		return "", time.Time{}, "", err
 	}
+	s.tel.TokenIssued(ctx, "refresh")
 
 	return accessToken, exp, newTok, nil
 }
@@ -208,7 +217,9 @@ func (s *Service) RevokeSessionByIDForUser(ctx context.Context, userID, sessionI
 	return nil
 }
 
-func (s *Service) RevokeAllSessions(ctx context.Context, userID string, keepSessionID *string) error {
+func (s *Service) RevokeAllSessions(ctx context.Context, userID string, keepSessionID *string) (err error) {
+	ctx, span := s.startSpan(ctx, "RevokeAllSessions")
+	defer func() { telemetry.End(span, err) }()
 	if s.pg == nil {
 		return nil
 	}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/open-rails/authkit/siws"
+	"github.com/open-rails/authkit/telemetry"
 )
 
 // SolanaProviderSlug is the provider slug used for Solana wallets.
@@ -77,7 +78,10 @@ func (s *Service) GenerateSIWSChallenge(ctx context.Context, cache siws.Challeng
 
 // VerifySIWSAndLogin verifies a SIWS signature and logs in or creates a user.
 // Returns access token, expiry, refresh token, user ID, and whether a new user was created.
+// New users are subject to the registration policy (invitation via WithRegistrationInvite).
 func (s *Service) VerifySIWSAndLogin(ctx context.Context, cache siws.ChallengeCache, output siws.SignInOutput, extra map[string]any) (accessToken string, expiresAt time.Time, refreshToken, userID string, created bool, err error) {
+	ctx, span := s.startSpan(ctx, "VerifySIWSAndLogin")
+	defer func() { telemetry.End(span, err) }()
 	if s.pg == nil {
 		return "", time.Time{}, "", "", false, fmt.Errorf("postgres not configured")
 	}
@@ -88,8 +92,8 @@ func (s *Service) VerifySIWSAndLogin(ctx context.Context, cache siws.ChallengeCa
 		return "", time.Time{}, "", "", false, fmt.Errorf("failed to parse signed message: %w", err)
 	}
 
-	// Look up the challenge by nonce
-	challengeData, found, err := cache.Get(ctx, parsedInput.Nonce)
+	// Consume the challenge by nonce (single-use)
+	challengeData, found, err := siws.ConsumeChallenge(ctx, cache, parsedInput.Nonce)
 	if err != nil {
 		return "", time.Time{}, "", "", false, fmt.Errorf("failed to lookup challenge: %w", err)
 	}
@@ -97,9 +101,6 @@ func (s *Service) VerifySIWSAndLogin(ctx context.Context, cache siws.ChallengeCa
 		return "", time.Time{}, "", "", false, fmt.Errorf("challenge not found or expired")
 	}
 
-	// Delete the nonce immediately (single-use)
-	_ = cache.Del(ctx, parsedInput.Nonce)
-
 	// Verify the address matches
 	if challengeData.Address != output.Account.Address {
 		return "", time.Time{}, "", "", false, fmt.Errorf("address mismatch")
@@ -131,7 +132,7 @@ func (s *Service) VerifySIWSAndLogin(ctx context.Context, cache siws.ChallengeCa
 		username = s.ensureUniqueUsername(ctx, username)
 
 		// Create user with no email/phone
-		u, err := s.createUser(ctx, "", username)
+		u, err := s.CreateRegisteredUser(ctx, RegistrationAttempt{InviteCode: registrationInviteFromContext(ctx)}, username)
 		if err != nil {
 			return "", time.Time{}, "", "", false, fmt.Errorf("failed to create user: %w", err)
 		}
@@ -184,8 +185,8 @@ func (s *Service) LinkSolanaWallet(ctx context.Context, cache siws.ChallengeCach
 		return fmt.Errorf("failed to parse signed message: %w", err)
 	}
 
-	// Look up the challenge by nonce
-	challengeData, found, err := cache.Get(ctx, parsedInput.Nonce)
+	// Consume the challenge by nonce (single-use)
+	challengeData, found, err := siws.ConsumeChallenge(ctx, cache, parsedInput.Nonce)
 	if err != nil {
 		return fmt.Errorf("failed to lookup challenge: %w", err)
 	}
@@ -193,9 +194,6 @@ func (s *Service) LinkSolanaWallet(ctx context.Context, cache siws.ChallengeCach
 		return fmt.Errorf("challenge not found or expired")
 	}
 
-	// Delete the nonce immediately (single-use)
-	_ = cache.Del(ctx, parsedInput.Nonce)
-
 	// Verify the address matches
 	if challengeData.Address != output.Account.Address {
 		return fmt.Errorf("address mismatch")
@@ -273,8 +271,7 @@ func (s *Service) deriveSolanaUsername(address string) string {
 func (s *Service) ensureUniqueUsername(ctx context.Context, username string) string {
 	original := username
 	for i := 0; i < 10; i++ {
-		exists, err := s.usernameExists(ctx, username)
-		if err != nil || !exists {
+		if s.usernameAvailable(ctx, username) {
 			return username
 		}
 		// Append random suffix
@@ -283,12 +280,3 @@ func (s *Service) ensureUniqueUsername(ctx context.Context, username string) str
 	// Last resort - use full random
 	return "u_" + randAlphanumeric(8)
 }
-
-func (s *Service) usernameExists(ctx context.Context, username string) (bool, error) {
-	if s.pg == nil {
-		return false, nil
-	}
-	var exists bool
-	err := s.pg.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM profiles.users WHERE username = $1)`, username).Scan(&exists)
-	return exists, err
-}
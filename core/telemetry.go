@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/open-rails/authkit/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTelemetry enables OpenTelemetry spans and metrics for core operations,
+// ephemeral store calls and outbound messages. A nil Telemetry disables it (the default).
+func (s *Service) WithTelemetry(t *telemetry.Telemetry) *Service {
+	s.tel = t
+	return s
+}
+
+// Telemetry returns the configured telemetry (nil when disabled).
+func (s *Service) Telemetry() *telemetry.Telemetry { return s.tel }
+
+func (s *Service) startSpan(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tel.Start(ctx, "authkit.core."+op, attrs...)
+}
+
+// observeSend records the outcome of an email/SMS send and returns err unchanged.
+func (s *Service) observeSend(ctx context.Context, channel, template string, err error) error {
+	s.tel.MessageSent(ctx, channel, template, err)
+	if err != nil {
+		s.Logger().ErrorContext(ctx, "authkit: send failed", "channel", channel, "template", template, "error", err)
+	}
+	return err
+}
+
+// ephemNamespace strips the variable suffix (email, token hash, ...) from an ephemeral
+// key so spans never carry identifiers.
+func ephemNamespace(key string) string {
+	if i := strings.LastIndexByte(key, ':'); i >= 0 {
+		return key[:i+1]
+	}
+	return key
+}
+
+func (s *Service) storeGet(ctx context.Context, key string) (b []byte, ok bool, err error) {
+	ctx, span := s.tel.Start(ctx, "authkit.ephemeral.get", attribute.String("authkit.ephemeral.namespace", ephemNamespace(key)))
+	defer func() {
+		span.SetAttributes(attribute.Bool("authkit.ephemeral.found", ok))
+		telemetry.End(span, err)
+	}()
+	return s.ephemeralStore.Get(ctx, key)
+}
+
+func (s *Service) storeSet(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	ctx, span := s.tel.Start(ctx, "authkit.ephemeral.set", attribute.String("authkit.ephemeral.namespace", ephemNamespace(key)))
+	defer func() { telemetry.End(span, err) }()
+	return s.ephemeralStore.Set(ctx, key, value, ttl)
+}
+
+func (s *Service) storeDel(ctx context.Context, key string) (err error) {
+	ctx, span := s.tel.Start(ctx, "authkit.ephemeral.del", attribute.String("authkit.ephemeral.namespace", ephemNamespace(key)))
+	defer func() { telemetry.End(span, err) }()
+	return s.ephemeralStore.Del(ctx, key)
+}
+
+func (s *Service) storeGetDel(ctx context.Context, key string) (b []byte, ok bool, err error) {
+	ctx, span := s.tel.Start(ctx, "authkit.ephemeral.getdel", attribute.String("authkit.ephemeral.namespace", ephemNamespace(key)))
+	defer func() {
+		span.SetAttributes(attribute.Bool("authkit.ephemeral.found", ok))
+		telemetry.End(span, err)
+	}()
+	if as, isAtomic := s.ephemeralStore.(AtomicEphemeralStore); isAtomic {
+		return as.GetDel(ctx, key)
+	}
+	b, ok, err = s.ephemeralStore.Get(ctx, key)
+	if err != nil || !ok {
+		return b, ok, err
+	}
+	return b, true, s.ephemeralStore.Del(ctx, key)
+}
+
+func (s *Service) storeCompareAndDelete(ctx context.Context, key string, expected []byte) (deleted bool, err error) {
+	ctx, span := s.tel.Start(ctx, "authkit.ephemeral.compare_and_delete", attribute.String("authkit.ephemeral.namespace", ephemNamespace(key)))
+	defer func() {
+		span.SetAttributes(attribute.Bool("authkit.ephemeral.deleted", deleted))
+		telemetry.End(span, err)
+	}()
+	if as, isAtomic := s.ephemeralStore.(AtomicEphemeralStore); isAtomic {
+		return as.CompareAndDelete(ctx, key, expected)
+	}
+	b, ok, err := s.ephemeralStore.Get(ctx, key)
+	if err != nil || !ok || !bytes.Equal(b, expected) {
+		return false, err
+	}
+	return true, s.ephemeralStore.Del(ctx, key)
+}
+
+func (s *Service) storeSetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (set bool, err error) {
+	ctx, span := s.tel.Start(ctx, "authkit.ephemeral.setnx", attribute.String("authkit.ephemeral.namespace", ephemNamespace(key)))
+	defer func() {
+		span.SetAttributes(attribute.Bool("authkit.ephemeral.set", set))
+		telemetry.End(span, err)
+	}()
+	if as, isAtomic := s.ephemeralStore.(AtomicEphemeralStore); isAtomic {
+		return as.SetNX(ctx, key, value, ttl)
+	}
+	if _, ok, err := s.ephemeralStore.Get(ctx, key); err != nil || ok {
+		return false, err
+	}
+	return true, s.ephemeralStore.Set(ctx, key, value, ttl)
+}
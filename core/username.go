@@ -9,19 +9,20 @@ import (
 )
 
 // GenerateAvailableUsername tries base, then minimal numeric suffixes, then a short fallback.
+// Candidates refused by the username policy are skipped.
 func (s *Service) GenerateAvailableUsername(ctx context.Context, base string) string {
 	base = cleanUsername(base)
 	if base == "" {
 		base = "user"
 	}
 	// If available, return immediately
-	if u, _ := s.getUserByUsername(ctx, base); u == nil {
+	if s.usernameAvailable(ctx, base) {
 		return base
 	}
 	// Try numbered suffixes
 	for i := 1; i <= 999; i++ {
 		candidate := fmt.Sprintf("%s%d", base, i)
-		if u, _ := s.getUserByUsername(ctx, candidate); u == nil {
+		if s.usernameAvailable(ctx, candidate) {
 			return candidate
 		}
 	}
@@ -29,7 +30,7 @@ func (s *Service) GenerateAvailableUsername(ctx context.Context, base string) st
 	rand.Seed(time.Now().UnixNano())
 	for tries := 0; tries < 100; tries++ {
 		candidate := fmt.Sprintf("%s%04d", base, rand.Intn(10000))
-		if u, _ := s.getUserByUsername(ctx, candidate); u == nil {
+		if s.usernameAvailable(ctx, candidate) {
 			return candidate
 		}
 	}
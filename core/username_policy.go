@@ -0,0 +1,235 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/open-rails/authkit/telemetry"
+)
+
+var (
+	// ErrUsernameTaken indicates another account already uses the username.
+	ErrUsernameTaken = errors.New("username_in_use")
+	// ErrUsernameReserved indicates the username (or a look-alike of it) is reserved.
+	ErrUsernameReserved = errors.New("username_reserved")
+	// ErrUsernameNotAllowed indicates the profanity filter rejected the username.
+	ErrUsernameNotAllowed = errors.New("username_not_allowed")
+	// ErrUsernameConfusable indicates the username looks like another account's username.
+	ErrUsernameConfusable = errors.New("username_too_similar")
+	// ErrUsernameHeld indicates the username was recently released by another account.
+	ErrUsernameHeld = errors.New("username_held")
+	// ErrUsernameChangeCooldown indicates the user changed their username too recently.
+	ErrUsernameChangeCooldown = errors.New("username_change_cooldown")
+)
+
+// DefaultReservedUsernames are refused when UsernamePolicy.Reserved is nil.
+var DefaultReservedUsernames = []string{
+	"abuse", "admin", "administrator", "api", "auth", "billing", "help", "hostmaster",
+	"info", "mod", "moderator", "noreply", "no_reply", "null", "official", "owner",
+	"postmaster", "root", "security", "staff", "support", "sysadmin", "system",
+	"undefined", "webmaster", "www",
+}
+
+// defaultUsernameHold is how long a released username stays with its previous owner.
+const defaultUsernameHold = 30 * 24 * time.Hour
+
+// UsernamePolicy restricts which usernames can be claimed and how often they change.
+// Enabling it requires migration 014 (skeleton column and profiles.username_history).
+type UsernamePolicy struct {
+	// Reserved usernames, compared by skeleton so look-alikes are refused too.
+	// nil uses DefaultReservedUsernames; an empty non-nil slice reserves nothing.
+	Reserved []string
+	// Profane reports whether a username is offensive. Optional.
+	Profane func(username string) bool
+	// ChangeCooldown is the minimum time between self-service username changes (0 = none).
+	ChangeCooldown time.Duration
+	// HoldPeriod keeps a released username claimable only by its previous owner
+	// (default 30 days, negative disables).
+	HoldPeriod time.Duration
+}
+
+// WithUsernamePolicy enables the username policy for registrations, self-service
+// changes and generated usernames.
+func (s *Service) WithUsernamePolicy(p UsernamePolicy) *Service {
+	s.usernamePolicy = &p
+	return s
+}
+
+func (s *Service) reservedUsernames() []string {
+	if s.usernamePolicy != nil && s.usernamePolicy.Reserved != nil {
+		return s.usernamePolicy.Reserved
+	}
+	return DefaultReservedUsernames
+}
+
+func (s *Service) usernameHoldPeriod() time.Duration {
+	if s.usernamePolicy == nil {
+		return 0
+	}
+	switch d := s.usernamePolicy.HoldPeriod; {
+	case d == 0:
+		return defaultUsernameHold
+	case d < 0:
+		return 0
+	default:
+		return d
+	}
+}
+
+// Confusable folding; confusableFrom/confusableTo must match profiles.username_skeleton.
+const (
+	confusableFrom = "аеорсухіјѕԁԛԝһӏАВЕКМНОРСТХУІЈЅαορντικυΑΒΕΖΗΙΚΜΝΟΡΤΥΧıłɡ"
+	confusableTo   = "aeopcyxijsdqwhlabekmhopctxyijsaopvtikuabezhikmnoptyxilg"
+)
+
+var confusableMap = func() map[rune]rune {
+	from, to := []rune(confusableFrom), []rune(confusableTo)
+	m := make(map[rune]rune, len(from))
+	for i, r := range from {
+		m[r] = to[i]
+	}
+	return m
+}()
+
+// UsernameSkeleton folds a username so visually confusable names compare equal:
+// Cyrillic/Greek look-alikes map to Latin letters, case is ignored, 0/1/i/l and
+// rn/m, vv/w are merged and "_", "." and "-" are dropped.
+func UsernameSkeleton(username string) string {
+	var b strings.Builder
+	b.Grow(len(username))
+	for _, r := range username {
+		if m, ok := confusableMap[r]; ok {
+			r = m
+		}
+		if r >= 'A' && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		switch r {
+		case '0':
+			r = 'o'
+		case '1', 'i':
+			r = 'l'
+		case '_', '.', '-':
+			continue
+		}
+		b.WriteRune(r)
+	}
+	out := strings.ReplaceAll(b.String(), "rn", "m")
+	return strings.ReplaceAll(out, "vv", "w")
+}
+
+// isReservedUsername reports whether username is a look-alike of a reserved name.
+func (s *Service) isReservedUsername(username string) bool {
+	sk := UsernameSkeleton(username)
+	for _, r := range s.reservedUsernames() {
+		if UsernameSkeleton(r) == sk {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckUsername reports whether userID may claim username under the username policy.
+// userID is empty for new accounts. Without a policy only the default reserved names
+// and exact duplicates are refused.
+func (s *Service) CheckUsername(ctx context.Context, userID, username string) (err error) {
+	ctx, span := s.startSpan(ctx, "CheckUsername")
+	defer func() { telemetry.End(span, err) }()
+	if s.isReservedUsername(username) {
+		return ErrUsernameReserved
+	}
+	p := s.usernamePolicy
+	if p != nil && p.Profane != nil && p.Profane(username) {
+		return ErrUsernameNotAllowed
+	}
+	if s.pg == nil {
+		return nil
+	}
+	var owner *string
+	if userID != "" {
+		owner = &userID
+	}
+	if p == nil {
+		var taken bool
+		if err := s.pg.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM profiles.users WHERE username = $1 AND id IS DISTINCT FROM $2::uuid)
+		`, username, owner).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			return ErrUsernameTaken
+		}
+		return nil
+	}
+
+	var existing string
+	err = s.pg.QueryRow(ctx, `
+		SELECT username::text FROM profiles.users
+		WHERE username_skeleton = profiles.username_skeleton($1::text) AND id IS DISTINCT FROM $2::uuid
+		ORDER BY (lower(username::text) = lower($1::text)) DESC
+		LIMIT 1
+	`, username, owner).Scan(&existing)
+	switch {
+	case err == nil && strings.EqualFold(existing, username):
+		return ErrUsernameTaken
+	case err == nil:
+		return ErrUsernameConfusable
+	case !errors.Is(err, pgx.ErrNoRows):
+		return err
+	}
+
+	var held bool
+	if err := s.pg.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM profiles.username_history
+			WHERE skeleton = profiles.username_skeleton($1::text) AND held_until > now() AND user_id IS DISTINCT FROM $2::uuid
+		)
+	`, username, owner).Scan(&held); err != nil {
+		return err
+	}
+	if held {
+		return ErrUsernameHeld
+	}
+	return nil
+}
+
+// usernameAvailable reports whether a generated username can be used for a new account.
+// Lookup failures count as available; the unique constraint still guards the insert.
+func (s *Service) usernameAvailable(ctx context.Context, username string) bool {
+	err := s.CheckUsername(ctx, "", username)
+	for _, refused := range []error{ErrUsernameTaken, ErrUsernameReserved, ErrUsernameNotAllowed, ErrUsernameConfusable, ErrUsernameHeld} {
+		if errors.Is(err, refused) {
+			return false
+		}
+	}
+	return true
+}
+
+// ChangeUsername is the self-service username change: it applies the username policy
+// and the change cooldown, then renames the user and holds the old username.
+func (s *Service) ChangeUsername(ctx context.Context, userID, username string) (err error) {
+	ctx, span := s.startSpan(ctx, "ChangeUsername")
+	defer func() { telemetry.End(span, err) }()
+	if s.pg == nil {
+		return fmt.Errorf("postgres not configured")
+	}
+	if p := s.usernamePolicy; p != nil && p.ChangeCooldown > 0 {
+		var last *time.Time
+		if err := s.pg.QueryRow(ctx, `
+			SELECT max(released_at) FROM profiles.username_history WHERE user_id = $1
+		`, userID).Scan(&last); err != nil {
+			return err
+		}
+		if last != nil && time.Since(*last) < p.ChangeCooldown {
+			return ErrUsernameChangeCooldown
+		}
+	}
+	if err := s.CheckUsername(ctx, userID, username); err != nil {
+		return err
+	}
+	return s.updateUsername(ctx, userID, username)
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	migrations "github.com/open-rails/authkit/migrations/postgres"
+)
+
+func TestUsernameSkeleton(t *testing.T) {
+	same := [][2]string{
+		{"paypal", "PayPa1"},
+		{"paypal", "раураl"}, // Cyrillic а, р, у
+		{"modern", "modem"},
+		{"john_smith", "John.Smith"},
+		{"wolf", "vvo1f"},
+		{"alice", "ALlCE"},
+	}
+	for _, c := range same {
+		if UsernameSkeleton(c[0]) != UsernameSkeleton(c[1]) {
+			t.Fatalf("expected %q and %q to share a skeleton (%q vs %q)", c[0], c[1], UsernameSkeleton(c[0]), UsernameSkeleton(c[1]))
+		}
+	}
+	if UsernameSkeleton("alice") == UsernameSkeleton("alina") {
+		t.Fatalf("distinct names must not collide")
+	}
+}
+
+func TestUsernameSkeleton_MatchesMigration(t *testing.T) {
+	sql, err := migrations.FS.ReadFile("014_username_policy.up.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	for _, s := range []string{confusableFrom, confusableTo, "'01i_.-', 'oll'", "'rn', 'm'", "'vv', 'w'"} {
+		if !strings.Contains(string(sql), s) {
+			t.Fatalf("profiles.username_skeleton is out of sync with UsernameSkeleton: missing %q", s)
+		}
+	}
+}
+
+func TestCheckUsername_ReservedAndProfane(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(Options{}, Keyset{})
+	for _, name := range []string{"admin", "Adm1n", "suppοrt"} {
+		if err := svc.CheckUsername(ctx, "", name); !errors.Is(err, ErrUsernameReserved) {
+			t.Fatalf("%q: expected ErrUsernameReserved, got %v", name, err)
+		}
+	}
+
+	svc.WithUsernamePolicy(UsernamePolicy{
+		Reserved: []string{"acme"},
+		Profane:  func(u string) bool { return strings.Contains(u, "darn") },
+	})
+	if err := svc.CheckUsername(ctx, "", "admin"); err != nil {
+		t.Fatalf("custom reserved list replaces the default, got %v", err)
+	}
+	if err := svc.CheckUsername(ctx, "", "AcMe"); !errors.Is(err, ErrUsernameReserved) {
+		t.Fatalf("expected ErrUsernameReserved, got %v", err)
+	}
+	if err := svc.CheckUsername(ctx, "", "darnit"); !errors.Is(err, ErrUsernameNotAllowed) {
+		t.Fatalf("expected ErrUsernameNotAllowed, got %v", err)
+	}
+}
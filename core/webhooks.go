@@ -0,0 +1,550 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/open-rails/authkit/ssf"
+	"github.com/open-rails/authkit/telemetry"
+	"github.com/open-rails/authkit/webhooks"
+)
+
+var (
+	// ErrWebhookEndpointNotFound indicates the webhook endpoint does not exist.
+	ErrWebhookEndpointNotFound = errors.New("webhook_endpoint_not_found")
+	// ErrWebhookDeliveryNotFound indicates the webhook delivery does not exist.
+	ErrWebhookDeliveryNotFound = errors.New("webhook_delivery_not_found")
+	// ErrInvalidWebhookURL indicates the endpoint URL is not an absolute https URL (http is allowed in dev).
+	ErrInvalidWebhookURL = errors.New("invalid_webhook_url")
+	// ErrInvalidWebhookEventType indicates an unknown event type in a subscription filter.
+	ErrInvalidWebhookEventType = errors.New("invalid_webhook_event_type")
+	// ErrInvalidWebhookFormat indicates a format other than "json" or "set".
+	ErrInvalidWebhookFormat = errors.New("invalid_webhook_format")
+)
+
+// Webhook payload formats.
+const (
+	// WebhookFormatJSON posts the SecurityEvent as JSON.
+	WebhookFormatJSON = "json"
+	// WebhookFormatSET posts a signed Security Event Token (application/secevent+jwt).
+	WebhookFormatSET = "set"
+)
+
+// Webhook delivery states.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// webhookResponseMaxBytes bounds the response body kept in last_error.
+const webhookResponseMaxBytes = 512
+
+// WebhookEnqueuer schedules delivery attempts for a webhook delivery row.
+// riverjobs.NewWebhookEnqueuer provides the River-backed implementation.
+type WebhookEnqueuer interface {
+	EnqueueWebhookDelivery(ctx context.Context, deliveryID string) error
+}
+
+// WithWebhookEnqueuer enables webhook fan-out: each security event creates one delivery
+// per matching enabled endpoint and enqueues it.
+func (s *Service) WithWebhookEnqueuer(e WebhookEnqueuer) *Service { s.webhookEnqueuer = e; return s }
+
+// WithWebhookHTTPClient overrides the client used to deliver webhooks (default: 10s timeout).
+func (s *Service) WithWebhookHTTPClient(c *http.Client) *Service { s.webhookClient = c; return s }
+
+func (s *Service) webhookHTTPClient() *http.Client {
+	if s.webhookClient != nil {
+		return s.webhookClient
+	}
+	return s.tel.HTTPClient(&http.Client{Timeout: 10 * time.Second})
+}
+
+// WebhookEndpoint is a row from profiles.webhook_endpoints. Secret is only populated by
+// CreateWebhookEndpoint and RotateWebhookSecret.
+type WebhookEndpoint struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	EventTypes  []string `json:"event_types"`
+	Enabled     bool     `json:"enabled"`
+	// Format is WebhookFormatJSON (default) or WebhookFormatSET.
+	Format string `json:"format"`
+	// Audience is the SET "aud" claim for WebhookFormatSET (default: URL).
+	Audience  *string   `json:"audience,omitempty"`
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookEndpointUpdate holds the fields to change; nil fields are left as is.
+type WebhookEndpointUpdate struct {
+	URL         *string
+	Description *string
+	EventTypes  *[]string
+	Enabled     *bool
+	Format      *string
+	Audience    *string
+}
+
+// WebhookDelivery is a row from profiles.webhook_deliveries.
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	EndpointID     string          `json:"endpoint_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+const webhookEndpointColumns = `id::text, url, description, event_types, enabled, format, audience, created_at, updated_at`
+
+func scanWebhookEndpoint(row interface{ Scan(...any) error }) (*WebhookEndpoint, error) {
+	var e WebhookEndpoint
+	if err := row.Scan(&e.ID, &e.URL, &e.Description, &e.EventTypes, &e.Enabled, &e.Format, &e.Audience, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrWebhookEndpointNotFound
+		}
+		return nil, err
+	}
+	if e.EventTypes == nil {
+		e.EventTypes = []string{}
+	}
+	return &e, nil
+}
+
+const webhookDeliveryColumns = `id::text, endpoint_id::text, event_id::text, event_type, payload, status, attempts, last_status_code, last_error, delivered_at, created_at, updated_at`
+
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload []byte
+	if err := row.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.LastStatusCode, &d.LastError, &d.DeliveredAt, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+	d.Payload = payload
+	return &d, nil
+}
+
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	if u.Scheme == "https" || (u.Scheme == "http" && IsDevEnvironment()) {
+		return nil
+	}
+	return ErrInvalidWebhookURL
+}
+
+func normalizeWebhookEventTypes(types []string) ([]string, error) {
+	out := make([]string, 0, len(types))
+	seen := map[string]bool{}
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if !IsSecurityEventType(t) {
+			return nil, ErrInvalidWebhookEventType
+		}
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func normalizeWebhookFormat(format string) (string, error) {
+	switch format = strings.TrimSpace(format); format {
+	case "":
+		return WebhookFormatJSON, nil
+	case WebhookFormatJSON, WebhookFormatSET:
+		return format, nil
+	}
+	return "", ErrInvalidWebhookFormat
+}
+
+func trimmedOrNil(v *string) *string {
+	if v == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*v)
+	if t == "" {
+		return nil
+	}
+	return &t
+}
+
+// CreateWebhookEndpoint registers ep (URL, Description, EventTypes with empty = all
+// events, Format, Audience) and returns it with its newly generated signing secret.
+func (s *Service) CreateWebhookEndpoint(ctx context.Context, ep WebhookEndpoint) (*WebhookEndpoint, error) {
+	if s.pg == nil {
+		return nil, fmt.Errorf("postgres not configured")
+	}
+	rawURL := strings.TrimSpace(ep.URL)
+	if err := validateWebhookURL(rawURL); err != nil {
+		return nil, err
+	}
+	types, err := normalizeWebhookEventTypes(ep.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+	format, err := normalizeWebhookFormat(ep.Format)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	e, err := scanWebhookEndpoint(s.pg.QueryRow(ctx, `
+		INSERT INTO profiles.webhook_endpoints (url, description, event_types, secret, format, audience)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+webhookEndpointColumns,
+		rawURL, strings.TrimSpace(ep.Description), types, secret, format, trimmedOrNil(ep.Audience)))
+	if err != nil {
+		return nil, err
+	}
+	e.Secret = secret
+	return e, nil
+}
+
+// UpdateWebhookEndpoint applies the non-nil fields of u.
+func (s *Service) UpdateWebhookEndpoint(ctx context.Context, id string, u WebhookEndpointUpdate) (*WebhookEndpoint, error) {
+	if s.pg == nil {
+		return nil, fmt.Errorf("postgres not configured")
+	}
+	var rawURL *string
+	if u.URL != nil {
+		v := strings.TrimSpace(*u.URL)
+		if err := validateWebhookURL(v); err != nil {
+			return nil, err
+		}
+		rawURL = &v
+	}
+	var types []string
+	if u.EventTypes != nil {
+		var err error
+		if types, err = normalizeWebhookEventTypes(*u.EventTypes); err != nil {
+			return nil, err
+		}
+	}
+	var description *string
+	if u.Description != nil {
+		v := strings.TrimSpace(*u.Description)
+		description = &v
+	}
+	var format *string
+	if u.Format != nil {
+		v, err := normalizeWebhookFormat(*u.Format)
+		if err != nil {
+			return nil, err
+		}
+		format = &v
+	}
+	return scanWebhookEndpoint(s.pg.QueryRow(ctx, `
+		UPDATE profiles.webhook_endpoints SET
+			url = COALESCE($2, url),
+			description = COALESCE($3, description),
+			event_types = CASE WHEN $4 THEN $5::text[] ELSE event_types END,
+			enabled = COALESCE($6, enabled),
+			format = COALESCE($7, format),
+			audience = CASE WHEN $8 THEN $9 ELSE audience END,
+			updated_at = now()
+		WHERE id = $1
+		RETURNING `+webhookEndpointColumns,
+		id, rawURL, description, u.EventTypes != nil, types, u.Enabled, format, u.Audience != nil, trimmedOrNil(u.Audience)))
+}
+
+// RotateWebhookSecret replaces the endpoint's signing secret and returns the new one.
+// Deliveries sent after the call are signed with the new secret only.
+func (s *Service) RotateWebhookSecret(ctx context.Context, id string) (string, error) {
+	if s.pg == nil {
+		return "", fmt.Errorf("postgres not configured")
+	}
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	tag, err := s.pg.Exec(ctx, `UPDATE profiles.webhook_endpoints SET secret=$2, updated_at=now() WHERE id=$1`, id, secret)
+	if err != nil {
+		return "", err
+	}
+	if tag.RowsAffected() == 0 {
+		return "", ErrWebhookEndpointNotFound
+	}
+	return secret, nil
+}
+
+// GetWebhookEndpoint returns the endpoint with the given id (without its secret).
+func (s *Service) GetWebhookEndpoint(ctx context.Context, id string) (*WebhookEndpoint, error) {
+	if s.pg == nil {
+		return nil, ErrWebhookEndpointNotFound
+	}
+	return scanWebhookEndpoint(s.pg.QueryRow(ctx, `SELECT `+webhookEndpointColumns+` FROM profiles.webhook_endpoints WHERE id=$1`, id))
+}
+
+// ListWebhookEndpoints returns all endpoints ordered by creation time.
+func (s *Service) ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	if s.pg == nil {
+		return nil, nil
+	}
+	rows, err := s.pg.Query(ctx, `SELECT `+webhookEndpointColumns+` FROM profiles.webhook_endpoints ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WebhookEndpoint
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *e)
+	}
+	return out, rows.Err()
+}
+
+// DeleteWebhookEndpoint removes an endpoint and its delivery history.
+func (s *Service) DeleteWebhookEndpoint(ctx context.Context, id string) error {
+	if s.pg == nil {
+		return nil
+	}
+	tag, err := s.pg.Exec(ctx, `DELETE FROM profiles.webhook_endpoints WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookEndpointNotFound
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the newest deliveries for an endpoint, optionally filtered by status.
+func (s *Service) ListWebhookDeliveries(ctx context.Context, endpointID, status string, limit int) ([]WebhookDelivery, error) {
+	if s.pg == nil {
+		return nil, nil
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	rows, err := s.pg.Query(ctx, `
+		SELECT `+webhookDeliveryColumns+` FROM profiles.webhook_deliveries
+		WHERE endpoint_id=$1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3`, endpointID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+// ReplayWebhookDelivery resets a delivery to pending and enqueues it again. The payload
+// and webhook-id are unchanged, so receivers can deduplicate replays.
+func (s *Service) ReplayWebhookDelivery(ctx context.Context, deliveryID string) error {
+	if s.pg == nil || s.webhookEnqueuer == nil {
+		return fmt.Errorf("webhooks not configured")
+	}
+	tag, err := s.pg.Exec(ctx, `UPDATE profiles.webhook_deliveries SET status='pending', updated_at=now() WHERE id=$1`, deliveryID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	return s.webhookEnqueuer.EnqueueWebhookDelivery(ctx, deliveryID)
+}
+
+// ReplayDeadWebhookDeliveries re-enqueues every dead delivery of an endpoint and returns how many were queued.
+func (s *Service) ReplayDeadWebhookDeliveries(ctx context.Context, endpointID string) (int, error) {
+	if s.pg == nil || s.webhookEnqueuer == nil {
+		return 0, fmt.Errorf("webhooks not configured")
+	}
+	rows, err := s.pg.Query(ctx, `
+		UPDATE profiles.webhook_deliveries SET status='pending', updated_at=now()
+		WHERE endpoint_id=$1 AND status='dead'
+		RETURNING id::text`, endpointID)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if err := s.webhookEnqueuer.EnqueueWebhookDelivery(ctx, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// enqueueWebhookDeliveries creates a delivery for every enabled endpoint subscribed to
+// e.Type and enqueues them. Rows whose enqueue fails stay pending and can be replayed.
+func (s *Service) enqueueWebhookDeliveries(ctx context.Context, e SecurityEvent) error {
+	if s.pg == nil || s.webhookEnqueuer == nil {
+		return nil
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	rows, err := s.pg.Query(ctx, `
+		INSERT INTO profiles.webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT id, $1, $2, $3 FROM profiles.webhook_endpoints
+		WHERE enabled AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING
+		RETURNING id::text`, e.ID, string(e.Type), payload)
+	if err != nil {
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, id := range ids {
+		errs = append(errs, s.webhookEnqueuer.EnqueueWebhookDelivery(ctx, id))
+	}
+	return errors.Join(errs...)
+}
+
+// DeliverWebhook performs one delivery attempt and records its outcome. It returns an
+// error when the attempt failed so the job runner retries; when final is true a failed
+// attempt moves the delivery to the dead state instead. Deliveries whose endpoint has
+// been disabled are marked dead without sending.
+func (s *Service) DeliverWebhook(ctx context.Context, deliveryID string, final bool) (err error) {
+	ctx, span := s.startSpan(ctx, "DeliverWebhook")
+	defer func() { telemetry.End(span, err) }()
+	if s.pg == nil {
+		return fmt.Errorf("postgres not configured")
+	}
+	var (
+		status, eventID, rawURL, secret, format string
+		audience                                *string
+		enabled                                 bool
+		payload                                 []byte
+	)
+	err = s.pg.QueryRow(ctx, `
+		SELECT d.status, d.event_id::text, d.payload, e.url, e.secret, e.enabled, e.format, e.audience
+		FROM profiles.webhook_deliveries d
+		JOIN profiles.webhook_endpoints e ON e.id = d.endpoint_id
+		WHERE d.id=$1`, deliveryID).Scan(&status, &eventID, &payload, &rawURL, &secret, &enabled, &format, &audience)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // endpoint deleted
+	}
+	if err != nil {
+		return err
+	}
+	if status != WebhookDeliveryPending {
+		return nil
+	}
+	if !enabled {
+		return s.recordWebhookAttempt(ctx, deliveryID, WebhookDeliveryDead, nil, "endpoint_disabled")
+	}
+
+	contentType := "application/json"
+	if format == WebhookFormatSET {
+		var e SecurityEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		aud := rawURL
+		if audience != nil {
+			aud = *audience
+		}
+		set, err := s.SecurityEventToken(ctx, e, aud)
+		if errors.Is(err, ErrNoSETMapping) {
+			return s.recordWebhookAttempt(ctx, deliveryID, WebhookDeliveryDelivered, nil, "no_set_mapping")
+		}
+		if err != nil {
+			return err
+		}
+		payload, contentType = []byte(set), ssf.ContentType
+	}
+
+	code, sendErr := s.sendWebhook(ctx, rawURL, secret, eventID, contentType, payload)
+	var codePtr *int
+	if code != 0 {
+		codePtr = &code
+	}
+	if sendErr == nil {
+		return s.recordWebhookAttempt(ctx, deliveryID, WebhookDeliveryDelivered, codePtr, "")
+	}
+	next := WebhookDeliveryPending
+	if final {
+		next = WebhookDeliveryDead
+		s.Logger().WarnContext(ctx, "authkit: webhook delivery dead", "delivery_id", deliveryID, "error", sendErr)
+	}
+	if err := s.recordWebhookAttempt(ctx, deliveryID, next, codePtr, sendErr.Error()); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+func (s *Service) recordWebhookAttempt(ctx context.Context, deliveryID, status string, code *int, lastErr string) error {
+	var errPtr *string
+	if lastErr != "" {
+		errPtr = &lastErr
+	}
+	_, err := s.pg.Exec(ctx, `
+		UPDATE profiles.webhook_deliveries SET
+			status=$2,
+			attempts=attempts+1,
+			last_status_code=$3,
+			last_error=$4,
+			delivered_at=CASE WHEN $2='delivered' THEN now() ELSE delivered_at END,
+			updated_at=now()
+		WHERE id=$1`, deliveryID, status, code, errPtr)
+	return err
+}
+
+// sendWebhook POSTs a signed payload and returns the response status code. Any non-2xx
+// status is an error. SET deliveries carry the same webhook-* headers; receivers
+// following RFC 8935 verify the JWT signature instead.
+func (s *Service) sendWebhook(ctx context.Context, rawURL, secret, eventID, contentType string, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "authkit-webhooks")
+	if err := webhooks.SetHeaders(req.Header, secret, eventID, time.Now(), payload); err != nil {
+		return 0, err
+	}
+	resp, err := s.webhookHTTPClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseMaxBytes))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp.StatusCode, nil
+}
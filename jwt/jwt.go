@@ -28,6 +28,12 @@ type Signer interface {
 	Sign(ctx context.Context, claims jwt.MapClaims) (token string, err error)
 }
 
+// TypedSigner is implemented by signers that can set the JWS "typ" header, e.g.
+// "secevent+jwt" for Security Event Tokens. Callers fall back to Sign otherwise.
+type TypedSigner interface {
+	SignTyped(ctx context.Context, typ string, claims jwt.MapClaims) (token string, err error)
+}
+
 // Minimal in-memory RSA signer for bootstrap/dev. Production should load from KMS or DB.
 type RSASigner struct {
 	key *rsa.PrivateKey
@@ -56,6 +62,13 @@ func (s *RSASigner) Sign(_ context.Context, claims jwt.MapClaims) (string, error
 	return token.SignedString(s.key)
 }
 
+func (s *RSASigner) SignTyped(_ context.Context, typ string, claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	token.Header["typ"] = typ
+	return token.SignedString(s.key)
+}
+
 // NewRSASignerFromPEM constructs an RSASigner from a PEM-encoded private key.
 func NewRSASignerFromPEM(kid string, pemBytes []byte) (*RSASigner, error) {
 	if len(pemBytes) == 0 {
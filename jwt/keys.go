@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -66,7 +67,7 @@ func NewGeneratedKeySource() (*GeneratedKeySource, error) {
 	// Persist to disk for next startup
 	if err := persistKeysToDisk(signer, kid); err != nil {
 		// Log warning but continue - we can still use in-memory keys
-		fmt.Printf("Warning: failed to persist authkit dev keys: %v\n", err)
+		slog.Warn("authkit: failed to persist dev keys", "error", err)
 	}
 
 	return &GeneratedKeySource{
@@ -248,7 +249,7 @@ func tryLoadFromEnv() (KeySource, error) {
 			pub, err := jwt.ParseRSAPublicKeyFromPEM([]byte(pemStr))
 			if err != nil {
 				// Log warning but don't fail - just skip this key
-				fmt.Printf("Warning: failed to parse public key %s from PUBLIC_KEYS: %v\n", kid, err)
+				slog.Warn("authkit: failed to parse public key from PUBLIC_KEYS", "kid", kid, "error", err)
 				continue
 			}
 			publicKeys[kid] = pub
@@ -315,7 +316,7 @@ func tryLoadFromFilesystem(keysPath string) (KeySource, error) {
 		pub, err := jwt.ParseRSAPublicKeyFromPEM([]byte(pemStr))
 		if err != nil {
 			// Log warning but continue
-			fmt.Printf("Warning: failed to parse public key %s: %v\n", kid, err)
+			slog.Warn("authkit: failed to parse public key", "kid", kid, "error", err)
 			continue
 		}
 		publicKeys[kid] = pub
@@ -0,0 +1,2 @@
+-- Counterpart account for events involving two users (e.g. account_merged).
+ALTER TABLE user_auth_session_events {{ON_CLUSTER}} ADD COLUMN IF NOT EXISTS related_user_id Nullable(String) AFTER user_agent;
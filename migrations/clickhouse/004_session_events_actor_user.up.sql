@@ -0,0 +1,2 @@
+-- Account performing the action when it differs from user_id (e.g. the admin behind account_merged).
+ALTER TABLE user_auth_session_events {{ON_CLUSTER}} ADD COLUMN IF NOT EXISTS actor_user_id Nullable(String) AFTER related_user_id;
@@ -0,0 +1,18 @@
+-- SAML 2.0 IdP connections (enterprise SSO)
+-- Each row is one IdP, addressed by slug in /auth/saml/{slug}/login|callback|metadata.
+-- Users are linked in profiles.user_providers with issuer = idp_entity_id and subject = NameID.
+CREATE TABLE IF NOT EXISTS profiles.saml_connections (
+  id                  uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  slug                text NOT NULL UNIQUE,
+  idp_entity_id       text NOT NULL UNIQUE,
+  idp_metadata_xml    text NOT NULL,
+  attribute_mapping   jsonb NOT NULL DEFAULT '{}'::jsonb,
+  binding             text NOT NULL DEFAULT 'redirect' CHECK (binding IN ('redirect', 'post')),
+  allow_idp_initiated boolean NOT NULL DEFAULT false,
+  trust_email         boolean NOT NULL DEFAULT true,
+  created_at          timestamptz NOT NULL DEFAULT now(),
+  updated_at          timestamptz NOT NULL DEFAULT now()
+);
+
+COMMENT ON COLUMN profiles.saml_connections.attribute_mapping IS 'Assertion attribute names for email, username and name (empty = defaults)';
+COMMENT ON COLUMN profiles.saml_connections.trust_email IS 'Treat asserted emails as verified and link existing accounts by email';
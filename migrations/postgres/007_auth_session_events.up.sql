@@ -0,0 +1,22 @@
+-- Postgres sink for core.AuthSessionEvent (storage/postgres EventLog).
+-- Deployments without ClickHouse use this for GET /auth/admin/users/{user_id}/signins.
+-- user_id has no foreign key: failed logins may not resolve to a user and history outlives
+-- hard deletes until retention pruning (riverjobs PruneAuthSessionEventsWorker) removes it.
+CREATE TABLE IF NOT EXISTS profiles.auth_session_events (
+  id              bigserial PRIMARY KEY,
+  occurred_at     timestamptz NOT NULL DEFAULT now(),
+  issuer          text NOT NULL DEFAULT '',
+  user_id         text NOT NULL DEFAULT '',
+  session_id      text NOT NULL DEFAULT '',
+  event           text NOT NULL,
+  method          text,
+  reason          text,
+  ip_addr         text,
+  user_agent      text,
+  related_user_id text
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_session_events_user_time
+  ON profiles.auth_session_events (user_id, occurred_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_auth_session_events_time
+  ON profiles.auth_session_events (occurred_at DESC, id DESC);
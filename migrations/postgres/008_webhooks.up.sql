@@ -0,0 +1,37 @@
+-- Outbound security-event webhooks.
+-- secret is the HMAC signing key and must be readable to sign deliveries; it is never
+-- returned by the admin API after creation/rotation.
+CREATE TABLE IF NOT EXISTS profiles.webhook_endpoints (
+  id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  url         text NOT NULL,
+  description text NOT NULL DEFAULT '',
+  event_types text[] NOT NULL DEFAULT '{}',
+  secret      text NOT NULL,
+  enabled     boolean NOT NULL DEFAULT true,
+  created_at  timestamptz NOT NULL DEFAULT now(),
+  updated_at  timestamptz NOT NULL DEFAULT now()
+);
+
+COMMENT ON COLUMN profiles.webhook_endpoints.event_types IS 'Subscribed event types (empty = all)';
+
+-- One row per (endpoint, event). status: pending (queued or retrying), delivered, dead (retries exhausted).
+CREATE TABLE IF NOT EXISTS profiles.webhook_deliveries (
+  id               uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  endpoint_id      uuid NOT NULL REFERENCES profiles.webhook_endpoints(id) ON DELETE CASCADE,
+  event_id         uuid NOT NULL,
+  event_type       text NOT NULL,
+  payload          jsonb NOT NULL,
+  status           text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+  attempts         integer NOT NULL DEFAULT 0,
+  last_status_code integer,
+  last_error       text,
+  delivered_at     timestamptz,
+  created_at       timestamptz NOT NULL DEFAULT now(),
+  updated_at       timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (endpoint_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_created
+  ON profiles.webhook_deliveries (endpoint_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_dead
+  ON profiles.webhook_deliveries (endpoint_id) WHERE status = 'dead';
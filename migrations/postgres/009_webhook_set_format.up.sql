@@ -0,0 +1,6 @@
+-- Webhook endpoints can receive Security Event Tokens (RFC 8417, CAEP/RISC) instead of JSON.
+-- audience is the SET "aud" claim (defaults to the endpoint URL when NULL).
+ALTER TABLE profiles.webhook_endpoints
+  ADD COLUMN IF NOT EXISTS format text NOT NULL DEFAULT 'json' CHECK (format IN ('json', 'set'));
+ALTER TABLE profiles.webhook_endpoints
+  ADD COLUMN IF NOT EXISTS audience text;
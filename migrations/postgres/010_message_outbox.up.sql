@@ -0,0 +1,22 @@
+-- Outbox for email and SMS delivery (enabled with WithMessageOutbox).
+-- status: pending (queued or retrying), sent, dead (retries exhausted or expired).
+-- secret holds the code or reset token until the message leaves pending, then is cleared.
+CREATE TABLE IF NOT EXISTS profiles.message_outbox (
+  id              uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id         uuid REFERENCES profiles.users(id) ON DELETE CASCADE,
+  channel         text NOT NULL CHECK (channel IN ('email', 'sms')),
+  template        text NOT NULL,
+  destination     text NOT NULL,
+  username        text NOT NULL DEFAULT '',
+  secret          text,
+  idempotency_key text NOT NULL UNIQUE,
+  status          text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+  attempts        integer NOT NULL DEFAULT 0,
+  last_error      text,
+  sent_at         timestamptz,
+  created_at      timestamptz NOT NULL DEFAULT now(),
+  updated_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_outbox_user_created
+  ON profiles.message_outbox (user_id, created_at DESC) WHERE user_id IS NOT NULL;
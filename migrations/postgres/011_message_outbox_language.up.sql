@@ -0,0 +1,2 @@
+-- Request language captured at enqueue time, restored for localized sender templates.
+ALTER TABLE profiles.message_outbox ADD COLUMN IF NOT EXISTS language text NOT NULL DEFAULT '';
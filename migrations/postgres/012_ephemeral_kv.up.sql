@@ -0,0 +1,12 @@
+-- Ephemeral auth state for deployments without Redis (storage/postgres KV).
+-- UNLOGGED: not WAL-logged or replicated and truncated after a crash, which is acceptable
+-- for short-lived codes, tokens and OIDC state. Expired rows are ignored on read and
+-- removed by the riverjobs sweeper.
+CREATE UNLOGGED TABLE IF NOT EXISTS profiles.ephemeral_kv (
+  key        text PRIMARY KEY,
+  value      bytea NOT NULL,
+  expires_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_ephemeral_kv_expires_at
+  ON profiles.ephemeral_kv (expires_at) WHERE expires_at IS NOT NULL;
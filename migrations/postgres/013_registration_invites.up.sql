@@ -0,0 +1,15 @@
+-- Invitation codes for invite-only registration (core.RegistrationInviteOnly).
+-- Only the SHA-256 of the code is stored; the code is shown once on creation.
+CREATE TABLE IF NOT EXISTS profiles.registration_invites (
+  id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  code_hash  text NOT NULL UNIQUE,
+  note       text NOT NULL DEFAULT '',
+  max_uses   integer CHECK (max_uses IS NULL OR max_uses > 0),
+  uses       integer NOT NULL DEFAULT 0,
+  expires_at timestamptz,
+  revoked_at timestamptz,
+  created_by uuid REFERENCES profiles.users(id) ON DELETE SET NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+COMMENT ON COLUMN profiles.registration_invites.max_uses IS 'Maximum accounts created with this code (NULL = unlimited)';
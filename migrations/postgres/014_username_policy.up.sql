@@ -0,0 +1,34 @@
+-- Username policy (core.UsernamePolicy): confusable skeletons and released-username holds.
+
+-- username_skeleton folds look-alike characters so "paypal", "paypa1" and "раураl"
+-- (Cyrillic) compare equal. It must stay in sync with core.UsernameSkeleton.
+CREATE OR REPLACE FUNCTION profiles.username_skeleton(name text) RETURNS text
+LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE AS $$
+  SELECT replace(replace(
+    translate(
+      lower(translate(name,
+        'аеорсухіјѕԁԛԝһӏАВЕКМНОРСТХУІЈЅαορντικυΑΒΕΖΗΙΚΜΝΟΡΤΥΧıłɡ',
+        'aeopcyxijsdqwhlabekmhopctxyijsaopvtikuabezhikmnoptyxilg')),
+      '01i_.-', 'oll'),
+    'rn', 'm'), 'vv', 'w')
+$$;
+
+ALTER TABLE profiles.users
+  ADD COLUMN IF NOT EXISTS username_skeleton text
+  GENERATED ALWAYS AS (profiles.username_skeleton(username::text)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_users_username_skeleton ON profiles.users (username_skeleton);
+
+-- Usernames given up by a rename. They stay claimable only by their previous owner until
+-- held_until; the newest row per user also drives the change cooldown.
+CREATE TABLE IF NOT EXISTS profiles.username_history (
+  id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id     uuid NOT NULL REFERENCES profiles.users(id) ON DELETE CASCADE,
+  username    public.citext NOT NULL,
+  skeleton    text GENERATED ALWAYS AS (profiles.username_skeleton(username::text)) STORED,
+  released_at timestamptz NOT NULL DEFAULT now(),
+  held_until  timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_username_history_skeleton ON profiles.username_history (skeleton, held_until);
+CREATE INDEX IF NOT EXISTS idx_username_history_user ON profiles.username_history (user_id, released_at DESC);
@@ -0,0 +1,5 @@
+-- User and app metadata (core.MetadataConfig): free-form JSON objects per user.
+-- user_metadata is editable by the user; app_metadata only by admins and the host application.
+ALTER TABLE profiles.users
+  ADD COLUMN IF NOT EXISTS user_metadata jsonb NOT NULL DEFAULT '{}'::jsonb,
+  ADD COLUMN IF NOT EXISTS app_metadata jsonb NOT NULL DEFAULT '{}'::jsonb;
@@ -0,0 +1,5 @@
+-- Asserted SAML emails are no longer trusted unless the connection opts in.
+-- Existing connections keep their current setting.
+ALTER TABLE profiles.saml_connections ALTER COLUMN trust_email SET DEFAULT false;
+
+COMMENT ON COLUMN profiles.saml_connections.trust_email IS 'Treat asserted emails as verified (matching existing accounts still require link confirmation)';
@@ -0,0 +1,3 @@
+-- Codes and tokens of queued messages now live in the (optionally encrypted) ephemeral
+-- store, keyed by idempotency_key. The column only drains rows queued before this change.
+COMMENT ON COLUMN profiles.message_outbox.secret IS 'Deprecated: plaintext secret of messages queued before migration 017; new messages leave it NULL';
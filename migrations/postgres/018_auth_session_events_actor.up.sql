@@ -0,0 +1,2 @@
+-- Account performing the action when it differs from user_id (e.g. the admin behind an account_merged event).
+ALTER TABLE profiles.auth_session_events ADD COLUMN IF NOT EXISTS actor_user_id text;
@@ -23,6 +23,8 @@ func DefaultExchanger(ctx context.Context, rpClient rp.RelyingParty, provider, c
 		opts = append(opts, oauth2.SetAuthURLParam("code_verifier", verifier))
 	}
 
+	// Use the RP's HTTP client (which may be instrumented) for the token request.
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, rpClient.HttpClient())
 	oauth2Token, err := oauthConfig.Exchange(ctx, code, opts...)
 	if err != nil {
 		return Claims{}, fmt.Errorf("token exchange failed for %s: %w", provider, err)
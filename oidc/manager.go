@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"net/http"
 
 	"github.com/zitadel/oidc/v2/pkg/client/rp"
 )
@@ -24,11 +25,21 @@ type RPClient struct {
 }
 
 // Manager builds provider RPs and helps construct auth URLs with PKCE.
-type Manager struct{ providers map[string]RPClient }
+type Manager struct {
+	providers  map[string]RPClient
+	httpClient *http.Client
+}
 
 // NewManager initializes the RP clients lazily on first use.
 func NewManager(cfgs map[string]RPClient) *Manager { return &Manager{providers: cfgs} }
 
+// WithHTTPClient sets the client used for discovery, JWKS and token requests
+// (e.g. one instrumented with tracing). Nil keeps the library default.
+func (m *Manager) WithHTTPClient(c *http.Client) *Manager {
+	m.httpClient = c
+	return m
+}
+
 // Provider returns the configured RPClient for a provider slug (if present).
 func (m *Manager) Provider(name string) (RPClient, bool) { pc, ok := m.providers[name]; return pc, ok }
 
@@ -70,7 +81,11 @@ func (m *Manager) rp(ctx context.Context, pc RPClient, redirectURI string) (rp.R
 			return nil, err
 		}
 	}
-	return rp.NewRelyingPartyOIDC(pc.Issuer, pc.ClientID, secret, redirectURI, pc.Scopes)
+	var opts []rp.Option
+	if m.httpClient != nil {
+		opts = append(opts, rp.WithHTTPClient(m.httpClient))
+	}
+	return rp.NewRelyingPartyOIDC(pc.Issuer, pc.ClientID, secret, redirectURI, pc.Scopes, opts...)
 }
 
 // GetRP exposes the relying party for a configured provider.
@@ -110,6 +125,31 @@ type StateCache interface {
 	Del(ctx context.Context, state string) error
 }
 
+// AtomicStateCache is an optional extension of StateCache that reads and deletes a
+// state in one step, so a callback is accepted at most once per state. The bundled
+// memory, Redis and Postgres caches implement it.
+type AtomicStateCache interface {
+	StateCache
+	GetDel(ctx context.Context, state string) (StateData, bool, error)
+}
+
+// ConsumeState returns the data for state and deletes it. Caches that do not implement
+// AtomicStateCache fall back to Get followed by Del; a failed Del is returned as an
+// error rather than leaving the state redeemable.
+func ConsumeState(ctx context.Context, cache StateCache, state string) (StateData, bool, error) {
+	if ac, ok := cache.(AtomicStateCache); ok {
+		return ac.GetDel(ctx, state)
+	}
+	data, found, err := cache.Get(ctx, state)
+	if err != nil || !found {
+		return StateData{}, false, err
+	}
+	if err := cache.Del(ctx, state); err != nil {
+		return StateData{}, false, err
+	}
+	return data, true, nil
+}
+
 // StateData is what we persist for a pending OIDC login.
 type StateData struct {
 	Provider    string
@@ -119,4 +159,5 @@ type StateData struct {
 	LinkUserID  string
 	UI          string // "popup" to trigger popup HTML callback; else redirect
 	PopupNonce  string // echoed in popup postMessage for opener validation
+	InviteCode  string // registration invitation presented at login start
 }
@@ -0,0 +1,71 @@
+package memorylimiter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/open-rails/authkit/ratelimit"
+)
+
+// GCRA is an in-memory GCRA (token bucket) limiter: each key may burst up to Limit and
+// then earns one request every Window/Limit. It stores one timestamp per key and
+// reports remaining quota and retry times. Single-node only.
+type GCRA struct {
+	mu     sync.Mutex
+	limits map[string]Limit
+	tats   map[string]time.Time
+	calls  int
+}
+
+// NewGCRA constructs an in-memory GCRA limiter with the provided per-bucket limits.
+func NewGCRA(limits map[string]Limit) *GCRA {
+	if limits == nil {
+		limits = map[string]Limit{}
+	}
+	return &GCRA{limits: limits, tats: make(map[string]time.Time)}
+}
+
+func (l *GCRA) get(bucket string) Limit {
+	if v, ok := l.limits[bucket]; ok {
+		return v
+	}
+	if v, ok := l.limits["default"]; ok {
+		return v
+	}
+	return Limit{Limit: 100, Window: time.Minute}
+}
+
+// AllowNamed matches the auth adapter's RateLimiter interface.
+func (l *GCRA) AllowNamed(bucket, key string) (bool, error) {
+	res, err := l.AllowNamedDetailed(bucket, key)
+	return res.Allowed, err
+}
+
+// AllowNamedDetailed records a request for key in bucket and returns the decision.
+func (l *GCRA) AllowNamedDetailed(bucket, key string) (ratelimit.Result, error) {
+	if l == nil {
+		return ratelimit.Result{Allowed: true}, nil
+	}
+	if bucket == "" || key == "" {
+		return ratelimit.Result{}, fmt.Errorf("bucket and key required")
+	}
+	lim := l.get(bucket)
+	limitKey := key + ":" + bucket
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tat, res := ratelimit.GCRA(now, l.tats[limitKey], lim.Limit, lim.Window)
+	l.tats[limitKey] = tat
+	l.calls++
+	if l.calls%1024 == 0 {
+		// Keys whose arrival time has passed are back at full quota; drop them.
+		for k, t := range l.tats {
+			if !t.After(now) {
+				delete(l.tats, k)
+			}
+		}
+	}
+	return res, nil
+}
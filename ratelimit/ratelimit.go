@@ -0,0 +1,48 @@
+// Package ratelimit holds types shared by the memory and Redis limiters.
+package ratelimit
+
+import "time"
+
+// Result describes one rate limit decision.
+type Result struct {
+	Allowed bool
+	// Limit requests are allowed per Window.
+	Limit  int
+	Window time.Duration
+	// Remaining is how many further requests would be allowed right now.
+	Remaining int
+	// Reset is the time until the full quota is available again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed; zero when Allowed.
+	RetryAfter time.Duration
+}
+
+// GCRA applies the generic cell rate algorithm to a key whose theoretical arrival time is
+// tat (zero for a new key). A key earns one request every Window/Limit and may burst up
+// to Limit. It returns the key's new arrival time, which is unchanged when denied.
+//
+// GCRA keeps one timestamp per key, unlike a sliding window log.
+func GCRA(now, tat time.Time, limit int, window time.Duration) (time.Time, Result) {
+	if limit <= 0 {
+		limit = 1
+	}
+	interval := window / time.Duration(limit)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+	period := interval * time.Duration(limit)
+	if tat.Before(now) {
+		tat = now
+	}
+	res := Result{Limit: limit, Window: window}
+	newTAT := tat.Add(interval)
+	if allowAt := newTAT.Add(-period); now.Before(allowAt) {
+		res.Reset = tat.Sub(now)
+		res.RetryAfter = allowAt.Sub(now)
+		return tat, res
+	}
+	res.Allowed = true
+	res.Reset = newTAT.Sub(now)
+	res.Remaining = int((period - res.Reset) / interval)
+	return newTAT, res
+}
@@ -0,0 +1,26 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGCRA_BurstThenSteadyRate(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	var tat time.Time
+	var res Result
+	for i := 0; i < 3; i++ {
+		tat, res = GCRA(now, tat, 3, 3*time.Minute)
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i, res)
+		}
+	}
+	tat, res = GCRA(now, tat, 3, 3*time.Minute)
+	if res.Allowed || res.RetryAfter != time.Minute || res.Reset != 3*time.Minute {
+		t.Fatalf("expected denial with 1m retry, got %+v", res)
+	}
+	_, res = GCRA(now.Add(time.Minute), tat, 3, 3*time.Minute)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("expected one request after one interval, got %+v", res)
+	}
+}
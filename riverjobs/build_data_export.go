@@ -0,0 +1,66 @@
+package riverjobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/open-rails/authkit/core"
+	"github.com/riverqueue/river"
+)
+
+type BuildDataExportArgs struct {
+	UserID string `json:"user_id"`
+}
+
+func (BuildDataExportArgs) Kind() string { return "authkit_build_data_export" }
+
+// InsertOpts collapses repeated requests for the same user within an hour into one export.
+func (BuildDataExportArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       river.QueueDefault,
+		MaxAttempts: 5,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: time.Hour,
+		},
+	}
+}
+
+// BuildDataExportWorker builds a user's data export, stores it and emails the download
+// link. Contributor or storage failures retry with River's default backoff.
+type BuildDataExportWorker struct {
+	river.WorkerDefaults[BuildDataExportArgs]
+	svc *core.Service
+}
+
+func NewBuildDataExportWorker(svc *core.Service) *BuildDataExportWorker {
+	return &BuildDataExportWorker{svc: svc}
+}
+
+func (w *BuildDataExportWorker) Timeout(*river.Job[BuildDataExportArgs]) time.Duration {
+	return 5 * time.Minute
+}
+
+func (w *BuildDataExportWorker) Work(ctx context.Context, job *river.Job[BuildDataExportArgs]) error {
+	if w == nil || w.svc == nil {
+		return errors.New("authkit data export: service not configured")
+	}
+	return w.svc.DeliverDataExport(ctx, job.Args.UserID)
+}
+
+// dataExportEnqueuer implements core.DataExportEnqueuer on a River client.
+type dataExportEnqueuer[T any] struct {
+	client *river.Client[T]
+}
+
+// NewDataExportEnqueuer returns a core.DataExportEnqueuer that inserts BuildDataExportArgs jobs.
+// Pass it to core.Service.WithDataExport.
+func NewDataExportEnqueuer[T any](client *river.Client[T]) core.DataExportEnqueuer {
+	return dataExportEnqueuer[T]{client: client}
+}
+
+func (e dataExportEnqueuer[T]) EnqueueDataExport(ctx context.Context, userID string) error {
+	_, err := e.client.Insert(ctx, BuildDataExportArgs{UserID: userID}, nil)
+	return err
+}
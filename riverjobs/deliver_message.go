@@ -0,0 +1,78 @@
+package riverjobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/open-rails/authkit/core"
+	"github.com/riverqueue/river"
+)
+
+// MessageMaxAttempts is the number of delivery attempts before an outbox message is marked
+// dead. Codes expire within minutes, so retries are short: the last attempt happens about
+// five minutes after the first.
+const MessageMaxAttempts = 6
+
+const messageBackoffBase = 10 * time.Second
+
+type DeliverMessageArgs struct {
+	MessageID string `json:"message_id"`
+}
+
+func (DeliverMessageArgs) Kind() string { return "authkit_deliver_message" }
+
+func (DeliverMessageArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       river.QueueDefault,
+		MaxAttempts: MessageMaxAttempts,
+	}
+}
+
+// DeliverMessageWorker sends one outbox email or SMS per attempt through the Service's
+// configured senders. Failed attempts retry with exponential backoff (10s doubling); the
+// final failed attempt moves the message to the dead state.
+type DeliverMessageWorker struct {
+	river.WorkerDefaults[DeliverMessageArgs]
+	svc *core.Service
+}
+
+func NewDeliverMessageWorker(svc *core.Service) *DeliverMessageWorker {
+	return &DeliverMessageWorker{svc: svc}
+}
+
+func (w *DeliverMessageWorker) Timeout(*river.Job[DeliverMessageArgs]) time.Duration {
+	return 30 * time.Second
+}
+
+func (w *DeliverMessageWorker) NextRetry(job *river.Job[DeliverMessageArgs]) time.Time {
+	return time.Now().Add(messageBackoff(job.Attempt))
+}
+
+func (w *DeliverMessageWorker) Work(ctx context.Context, job *river.Job[DeliverMessageArgs]) error {
+	if w == nil || w.svc == nil {
+		return errors.New("authkit outbox: service not configured")
+	}
+	return w.svc.DeliverMessage(ctx, job.Args.MessageID, job.Attempt >= job.MaxAttempts)
+}
+
+// messageBackoff returns the delay after the given (1-based) failed attempt.
+func messageBackoff(attempt int) time.Duration {
+	return messageBackoffBase << min(max(attempt-1, 0), 5)
+}
+
+// messageEnqueuer implements core.MessageEnqueuer on a River client.
+type messageEnqueuer[T any] struct {
+	client *river.Client[T]
+}
+
+// NewMessageEnqueuer returns a core.MessageEnqueuer that inserts DeliverMessageArgs jobs.
+// Pass it to core.Service.WithMessageOutbox.
+func NewMessageEnqueuer[T any](client *river.Client[T]) core.MessageEnqueuer {
+	return messageEnqueuer[T]{client: client}
+}
+
+func (e messageEnqueuer[T]) EnqueueMessageDelivery(ctx context.Context, messageID string) error {
+	_, err := e.client.Insert(ctx, DeliverMessageArgs{MessageID: messageID}, nil)
+	return err
+}
@@ -0,0 +1,16 @@
+package riverjobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMessageBackoff(t *testing.T) {
+	var total time.Duration
+	for attempt := 1; attempt < MessageMaxAttempts; attempt++ {
+		total += messageBackoff(attempt)
+	}
+	if messageBackoff(1) != 10*time.Second || total != 310*time.Second {
+		t.Fatalf("unexpected schedule: first %s, total %s", messageBackoff(1), total)
+	}
+}
@@ -0,0 +1,87 @@
+package riverjobs
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/open-rails/authkit/core"
+	"github.com/riverqueue/river"
+)
+
+// WebhookMaxAttempts is the number of delivery attempts before a delivery is marked dead.
+// With the backoff below the last attempt happens roughly 17 hours after the first.
+const WebhookMaxAttempts = 12
+
+const (
+	webhookBackoffBase = 30 * time.Second
+	webhookBackoffMax  = 12 * time.Hour
+)
+
+type DeliverWebhookArgs struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+func (DeliverWebhookArgs) Kind() string { return "authkit_deliver_webhook" }
+
+func (DeliverWebhookArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       river.QueueDefault,
+		MaxAttempts: WebhookMaxAttempts,
+	}
+}
+
+// DeliverWebhookWorker sends one webhook delivery per attempt. Failed attempts are retried
+// with exponential backoff (30s doubling, capped at 12h, with jitter); the final failed
+// attempt moves the delivery to the dead state, from which admins can replay it.
+type DeliverWebhookWorker struct {
+	river.WorkerDefaults[DeliverWebhookArgs]
+	svc *core.Service
+}
+
+func NewDeliverWebhookWorker(svc *core.Service) *DeliverWebhookWorker {
+	return &DeliverWebhookWorker{svc: svc}
+}
+
+func (w *DeliverWebhookWorker) Timeout(*river.Job[DeliverWebhookArgs]) time.Duration {
+	return time.Minute
+}
+
+func (w *DeliverWebhookWorker) NextRetry(job *river.Job[DeliverWebhookArgs]) time.Time {
+	return time.Now().Add(webhookBackoff(job.Attempt))
+}
+
+func (w *DeliverWebhookWorker) Work(ctx context.Context, job *river.Job[DeliverWebhookArgs]) error {
+	if w == nil || w.svc == nil {
+		return errors.New("authkit webhooks: service not configured")
+	}
+	return w.svc.DeliverWebhook(ctx, job.Args.DeliveryID, job.Attempt >= job.MaxAttempts)
+}
+
+// webhookBackoff returns the delay after the given (1-based) failed attempt.
+func webhookBackoff(attempt int) time.Duration {
+	d := webhookBackoffBase
+	for i := 1; i < attempt && d < webhookBackoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, webhookBackoffMax)
+	// ±10% jitter spreads retries after a receiver outage.
+	return d - d/10 + time.Duration(rand.Int64N(int64(d/5)+1))
+}
+
+// webhookEnqueuer implements core.WebhookEnqueuer on a River client.
+type webhookEnqueuer[T any] struct {
+	client *river.Client[T]
+}
+
+// NewWebhookEnqueuer returns a core.WebhookEnqueuer that inserts DeliverWebhookArgs jobs.
+// Pass it to core.Service.WithWebhookEnqueuer.
+func NewWebhookEnqueuer[T any](client *river.Client[T]) core.WebhookEnqueuer {
+	return webhookEnqueuer[T]{client: client}
+}
+
+func (e webhookEnqueuer[T]) EnqueueWebhookDelivery(ctx context.Context, deliveryID string) error {
+	_, err := e.client.Insert(ctx, DeliverWebhookArgs{DeliveryID: deliveryID}, nil)
+	return err
+}
@@ -0,0 +1,25 @@
+package riverjobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	within := func(got, want time.Duration) bool {
+		return got >= want-want/10 && got <= want+want/10
+	}
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		11: 512 * time.Minute,
+		12: webhookBackoffMax,
+		40: webhookBackoffMax,
+	}
+	for attempt, want := range cases {
+		if got := webhookBackoff(attempt); !within(got, want) {
+			t.Fatalf("attempt %d: got %s, want ~%s", attempt, got, want)
+		}
+	}
+}
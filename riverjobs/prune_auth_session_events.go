@@ -0,0 +1,91 @@
+package riverjobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/riverqueue/river"
+)
+
+type PruneAuthSessionEventsArgs struct {
+	RetentionDays int `json:"retention_days,omitempty"`
+	BatchSize     int `json:"batch_size,omitempty"`
+	// Since and Until bound the pruned range [Since, Until) like SessionEventQuery.
+	// Until, when set, replaces the RetentionDays cutoff.
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+}
+
+func (PruneAuthSessionEventsArgs) Kind() string { return "authkit_prune_auth_session_events" }
+
+func (args PruneAuthSessionEventsArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue: river.QueueDefault,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: 24 * time.Hour,
+			ByQueue:  true,
+		},
+	}
+}
+
+// SessionEventPruner deletes session events in [since, until) in bounded batches; a zero
+// since has no lower bound. storage/postgres EventLog implements it.
+type SessionEventPruner interface {
+	PruneRange(ctx context.Context, since, until time.Time, limit int) (int64, error)
+}
+
+// PruneAuthSessionEventsWorker enforces retention on profiles.auth_session_events by deleting
+// events older than RetentionDays (default 90), or in [Since, Until) when set, BatchSize
+// rows (default 5000) at a time.
+type PruneAuthSessionEventsWorker struct {
+	river.WorkerDefaults[PruneAuthSessionEventsArgs]
+	pruner SessionEventPruner
+}
+
+func NewPruneAuthSessionEventsWorker(pruner SessionEventPruner) *PruneAuthSessionEventsWorker {
+	return &PruneAuthSessionEventsWorker{pruner: pruner}
+}
+
+func (w *PruneAuthSessionEventsWorker) Timeout(*river.Job[PruneAuthSessionEventsArgs]) time.Duration {
+	return 30 * time.Minute
+}
+
+func (w *PruneAuthSessionEventsWorker) Work(ctx context.Context, job *river.Job[PruneAuthSessionEventsArgs]) error {
+	if w == nil || w.pruner == nil {
+		return errors.New("authkit prune session events: pruner not configured")
+	}
+	retention := job.Args.RetentionDays
+	if retention <= 0 {
+		retention = 90
+	}
+	batch := job.Args.BatchSize
+	if batch <= 0 {
+		batch = 5000
+	}
+
+	var since time.Time
+	if job.Args.Since != nil {
+		since = *job.Args.Since
+	}
+	until := time.Now().AddDate(0, 0, -retention)
+	if job.Args.Until != nil {
+		until = *job.Args.Until
+	}
+	if !since.IsZero() && !until.After(since) {
+		return nil
+	}
+	for {
+		n, err := w.pruner.PruneRange(ctx, since, until, batch)
+		if err != nil {
+			return err
+		}
+		if n < int64(batch) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package riverjobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+)
+
+type fakePruner struct {
+	since, until time.Time
+	batches      []int64
+}
+
+func (p *fakePruner) PruneRange(_ context.Context, since, until time.Time, _ int) (int64, error) {
+	p.since, p.until = since, until
+	n := p.batches[0]
+	p.batches = p.batches[1:]
+	return n, nil
+}
+
+func TestPruneAuthSessionEventsWorker_Bounds(t *testing.T) {
+	ctx := context.Background()
+	p := &fakePruner{batches: []int64{2, 2, 1}}
+	w := NewPruneAuthSessionEventsWorker(p)
+	if err := w.Work(ctx, &river.Job[PruneAuthSessionEventsArgs]{Args: PruneAuthSessionEventsArgs{RetentionDays: 30, BatchSize: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.batches) != 0 || !p.since.IsZero() {
+		t.Fatalf("expected three unbounded batches, left %v since %v", p.batches, p.since)
+	}
+	if d := time.Since(p.until) - 30*24*time.Hour; d < 0 || d > time.Minute {
+		t.Fatalf("retention cutoff off by %s", d)
+	}
+
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	p = &fakePruner{batches: []int64{0}}
+	w = NewPruneAuthSessionEventsWorker(p)
+	if err := w.Work(ctx, &river.Job[PruneAuthSessionEventsArgs]{Args: PruneAuthSessionEventsArgs{Since: &since, Until: &until}}); err != nil {
+		t.Fatal(err)
+	}
+	if !p.since.Equal(since) || !p.until.Equal(until) {
+		t.Fatalf("bounds not honored: [%v, %v)", p.since, p.until)
+	}
+
+	// An empty range prunes nothing.
+	p = &fakePruner{}
+	w = NewPruneAuthSessionEventsWorker(p)
+	if err := w.Work(ctx, &river.Job[PruneAuthSessionEventsArgs]{Args: PruneAuthSessionEventsArgs{Since: &until, Until: &since}}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -13,10 +13,60 @@ func RegisterPurgeDeletedUsersWorker(ws *river.Workers, svc *core.Service, befor
 	river.AddWorker(ws, NewPurgeDeletedUsersWorker(svc, before))
 }
 
+// RegisterDeliverWebhookWorker registers the webhook delivery worker into a River workers registry.
+func RegisterDeliverWebhookWorker(ws *river.Workers, svc *core.Service) {
+	river.AddWorker(ws, NewDeliverWebhookWorker(svc))
+}
+
+// RegisterDeliverMessageWorker registers the email/SMS outbox worker into a River workers registry.
+func RegisterDeliverMessageWorker(ws *river.Workers, svc *core.Service) {
+	river.AddWorker(ws, NewDeliverMessageWorker(svc))
+}
+
+// RegisterBuildDataExportWorker registers the user data export worker into a River workers registry.
+func RegisterBuildDataExportWorker(ws *river.Workers, svc *core.Service) {
+	river.AddWorker(ws, NewBuildDataExportWorker(svc))
+}
+
 // AddPurgeDeletedUsersPeriodicJob adds a periodic job that enqueues the purge job on a cron schedule.
 //
 // Example cron: "0 4 * * *" (daily at 4 AM).
 func AddPurgeDeletedUsersPeriodicJob[T any](client *river.Client[T], cronSpec string, args PurgeDeletedUsersArgs, runOnStart bool) error {
+	return addPeriodicJob(client, cronSpec, args, runOnStart)
+}
+
+// RegisterPruneAuthSessionEventsWorker registers the session event retention worker into a River workers registry.
+func RegisterPruneAuthSessionEventsWorker(ws *river.Workers, pruner SessionEventPruner) {
+	river.AddWorker(ws, NewPruneAuthSessionEventsWorker(pruner))
+}
+
+// AddPruneAuthSessionEventsPeriodicJob adds a periodic job that enqueues the retention job on a cron schedule.
+//
+// Example cron: "30 3 * * *" (daily at 3:30 AM).
+func AddPruneAuthSessionEventsPeriodicJob[T any](client *river.Client[T], cronSpec string, args PruneAuthSessionEventsArgs, runOnStart bool) error {
+	return addPeriodicJob(client, cronSpec, args, runOnStart)
+}
+
+// RegisterSweepEphemeralWorker registers the expired ephemeral key sweeper into a River workers registry.
+func RegisterSweepEphemeralWorker(ws *river.Workers, sweeper ExpiredKeySweeper) {
+	river.AddWorker(ws, NewSweepEphemeralWorker(sweeper))
+}
+
+// AddSweepEphemeralPeriodicJob adds a periodic job that enqueues the sweeper on a cron schedule.
+//
+// Example cron: "*/5 * * * *" (every 5 minutes).
+func AddSweepEphemeralPeriodicJob[T any](client *river.Client[T], cronSpec string, args SweepEphemeralArgs, runOnStart bool) error {
+	return addPeriodicJob(client, cronSpec, args, runOnStart)
+}
+
+// periodicArgs is job args that carry their own insert options.
+type periodicArgs interface {
+	river.JobArgs
+	InsertOpts() river.InsertOpts
+}
+
+// addPeriodicJob adds a periodic job that enqueues args on a five-field cron schedule.
+func addPeriodicJob[T any](client *river.Client[T], cronSpec string, args periodicArgs, runOnStart bool) error {
 	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
 	schedule, err := parser.Parse(cronSpec)
 	if err != nil {
@@ -0,0 +1,70 @@
+package riverjobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/riverqueue/river"
+)
+
+type SweepEphemeralArgs struct {
+	BatchSize int `json:"batch_size,omitempty"`
+}
+
+func (SweepEphemeralArgs) Kind() string { return "authkit_sweep_ephemeral" }
+
+func (args SweepEphemeralArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue: river.QueueDefault,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: time.Minute,
+			ByQueue:  true,
+		},
+	}
+}
+
+// ExpiredKeySweeper deletes expired ephemeral keys in bounded batches.
+// storage/postgres KV implements it.
+type ExpiredKeySweeper interface {
+	PruneExpired(ctx context.Context, limit int) (int64, error)
+}
+
+// SweepEphemeralWorker deletes expired rows from profiles.ephemeral_kv, BatchSize rows
+// (default 5000) at a time. Expired rows are already invisible to reads; sweeping only
+// reclaims space.
+type SweepEphemeralWorker struct {
+	river.WorkerDefaults[SweepEphemeralArgs]
+	sweeper ExpiredKeySweeper
+}
+
+func NewSweepEphemeralWorker(sweeper ExpiredKeySweeper) *SweepEphemeralWorker {
+	return &SweepEphemeralWorker{sweeper: sweeper}
+}
+
+func (w *SweepEphemeralWorker) Timeout(*river.Job[SweepEphemeralArgs]) time.Duration {
+	return 5 * time.Minute
+}
+
+func (w *SweepEphemeralWorker) Work(ctx context.Context, job *river.Job[SweepEphemeralArgs]) error {
+	if w == nil || w.sweeper == nil {
+		return errors.New("authkit sweep ephemeral: sweeper not configured")
+	}
+	batch := job.Args.BatchSize
+	if batch <= 0 {
+		batch = 5000
+	}
+	for {
+		n, err := w.sweeper.PruneExpired(ctx, batch)
+		if err != nil {
+			return err
+		}
+		if n < int64(batch) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package samlkit
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/crewjam/saml"
+)
+
+// AttributeMapping names the assertion attributes that carry AuthKit user fields.
+// Empty fields fall back to the common names used by Okta, Entra ID, ADFS and Google.
+// Attributes are matched by Name or FriendlyName, case-insensitively.
+type AttributeMapping struct {
+	Email    string `json:"email,omitempty"`
+	Username string `json:"username,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+var (
+	defaultEmailAttributes = []string{
+		"email",
+		"mail",
+		"emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	}
+	defaultUsernameAttributes = []string{
+		"username",
+		"uid",
+		"preferred_username",
+		"urn:oid:0.9.2342.19200300.100.1.1",
+	}
+	defaultNameAttributes = []string{
+		"displayname",
+		"name",
+		"cn",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+		"urn:oid:2.5.4.3",
+		"http://schemas.microsoft.com/identity/claims/displayname",
+	}
+)
+
+// Identity is the user identity asserted by the IdP.
+type Identity struct {
+	Issuer     string // IdP entityID
+	Subject    string // NameID value
+	Email      *string
+	Username   string
+	Name       string
+	Attributes map[string][]string
+}
+
+// ExtractIdentity maps a validated assertion to an Identity.
+// When no email attribute is present and the NameID uses the emailAddress format,
+// the NameID is used as the email.
+func ExtractIdentity(a *saml.Assertion, m AttributeMapping) (Identity, error) {
+	if a == nil || a.Subject == nil || a.Subject.NameID == nil || strings.TrimSpace(a.Subject.NameID.Value) == "" {
+		return Identity{}, errors.New("saml: assertion has no NameID")
+	}
+	id := Identity{
+		Issuer:     strings.TrimSpace(a.Issuer.Value),
+		Subject:    strings.TrimSpace(a.Subject.NameID.Value),
+		Attributes: map[string][]string{},
+	}
+	for _, st := range a.AttributeStatements {
+		for _, attr := range st.Attributes {
+			name := attr.Name
+			if name == "" {
+				name = attr.FriendlyName
+			}
+			for _, v := range attr.Values {
+				if s := strings.TrimSpace(v.Value); s != "" {
+					id.Attributes[name] = append(id.Attributes[name], s)
+				}
+			}
+		}
+	}
+
+	if v := lookupAttribute(a, m.Email, defaultEmailAttributes); v != "" {
+		id.Email = &v
+	} else if a.Subject.NameID.Format == string(saml.EmailAddressNameIDFormat) && strings.Contains(id.Subject, "@") {
+		v := id.Subject
+		id.Email = &v
+	}
+	id.Username = lookupAttribute(a, m.Username, defaultUsernameAttributes)
+	id.Name = lookupAttribute(a, m.Name, defaultNameAttributes)
+	return id, nil
+}
+
+func lookupAttribute(a *saml.Assertion, configured string, defaults []string) string {
+	names := defaults
+	if c := strings.TrimSpace(configured); c != "" {
+		names = []string{c}
+	}
+	for _, want := range names {
+		for _, st := range a.AttributeStatements {
+			for _, attr := range st.Attributes {
+				if !strings.EqualFold(attr.Name, want) && !strings.EqualFold(attr.FriendlyName, want) {
+					continue
+				}
+				for _, v := range attr.Values {
+					if s := strings.TrimSpace(v.Value); s != "" {
+						return s
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
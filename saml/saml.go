@@ -0,0 +1,132 @@
+package samlkit
+
+// Thin wrapper over crewjam/saml for AuthKit's SAML 2.0 service-provider (SP) login.
+// XML signature handling, audience/time validation and InResponseTo checks are done
+// by crewjam/saml; this package only wires per-connection settings and maps
+// assertion attributes onto AuthKit user fields.
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// Bindings accepted for sending the AuthnRequest to the IdP.
+const (
+	BindingRedirect = "redirect"
+	BindingPost     = "post"
+)
+
+// SPConfig describes the AuthKit side of one IdP connection.
+type SPConfig struct {
+	// EntityID defaults to MetadataURL when empty.
+	EntityID    string
+	MetadataURL string
+	ACSURL      string
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+	// IdPMetadata is the raw EntityDescriptor XML published by the IdP.
+	IdPMetadata       []byte
+	AllowIDPInitiated bool
+}
+
+// ParseIdPMetadata parses IdP metadata XML and ensures it describes an IdP with an SSO endpoint.
+func ParseIdPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	ed, err := samlsp.ParseMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse idp metadata: %w", err)
+	}
+	if strings.TrimSpace(ed.EntityID) == "" {
+		return nil, errors.New("idp metadata: missing entityID")
+	}
+	for _, d := range ed.IDPSSODescriptors {
+		if len(d.SingleSignOnServices) > 0 {
+			return ed, nil
+		}
+	}
+	return nil, errors.New("idp metadata: no SingleSignOnService")
+}
+
+// NewServiceProvider builds a crewjam/saml ServiceProvider for a connection.
+// AuthnRequests are signed with RSA-SHA256 (query signature for the redirect
+// binding, enveloped XML signature for the POST binding).
+func NewServiceProvider(cfg SPConfig) (*saml.ServiceProvider, error) {
+	if cfg.Key == nil || cfg.Certificate == nil {
+		return nil, errors.New("saml: sp key and certificate required")
+	}
+	idp, err := ParseIdPMetadata(cfg.IdPMetadata)
+	if err != nil {
+		return nil, err
+	}
+	mdURL, err := url.Parse(cfg.MetadataURL)
+	if err != nil || mdURL.Host == "" {
+		return nil, errors.New("saml: invalid metadata url")
+	}
+	acsURL, err := url.Parse(cfg.ACSURL)
+	if err != nil || acsURL.Host == "" {
+		return nil, errors.New("saml: invalid acs url")
+	}
+	entityID := strings.TrimSpace(cfg.EntityID)
+	if entityID == "" {
+		entityID = mdURL.String()
+	}
+	return &saml.ServiceProvider{
+		EntityID:          entityID,
+		Key:               cfg.Key,
+		Certificate:       cfg.Certificate,
+		MetadataURL:       *mdURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idp,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+		AllowIDPInitiated: cfg.AllowIDPInitiated,
+		SignatureMethod:   dsig.RSASHA256SignatureMethod,
+	}, nil
+}
+
+// BindingURN maps a connection binding ("redirect" or "post") to the SAML binding URN.
+func BindingURN(binding string) string {
+	if strings.EqualFold(strings.TrimSpace(binding), BindingPost) {
+		return saml.HTTPPostBinding
+	}
+	return saml.HTTPRedirectBinding
+}
+
+// SelfSignedCertificate returns a self-signed certificate for the SP signing key.
+// IdPs only pin the certificate from SP metadata, so a CA-issued certificate is not required.
+func SelfSignedCertificate(key *rsa.PrivateKey, commonName string, validFor time.Duration) (*x509.Certificate, error) {
+	if key == nil {
+		return nil, errors.New("saml: key required")
+	}
+	if validFor <= 0 {
+		validFor = 10 * 365 * 24 * time.Hour
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
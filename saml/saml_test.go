@@ -0,0 +1,87 @@
+package samlkit
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/xml"
+	"net/url"
+	"testing"
+
+	"github.com/crewjam/saml"
+	"github.com/stretchr/testify/require"
+)
+
+func testIdPMetadata(t *testing.T) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	cert, err := SelfSignedCertificate(key, "idp", 0)
+	require.NoError(t, err)
+	mdURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	idp := &saml.IdentityProvider{Key: key, Certificate: cert, MetadataURL: *mdURL, SSOURL: *ssoURL}
+	b, err := xml.Marshal(idp.Metadata())
+	require.NoError(t, err)
+	return b
+}
+
+func TestNewServiceProvider_SignedRedirectRequest(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	cert, err := SelfSignedCertificate(key, "sp", 0)
+	require.NoError(t, err)
+
+	sp, err := NewServiceProvider(SPConfig{
+		MetadataURL: "https://app.example.com/auth/saml/acme/metadata",
+		ACSURL:      "https://app.example.com/auth/saml/acme/callback",
+		Key:         key,
+		Certificate: cert,
+		IdPMetadata: testIdPMetadata(t),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "https://app.example.com/auth/saml/acme/metadata", sp.EntityID)
+	require.Equal(t, "https://idp.example.com/metadata", sp.IDPMetadata.EntityID)
+
+	md := sp.Metadata()
+	require.Equal(t, "https://app.example.com/auth/saml/acme/callback", md.SPSSODescriptors[0].AssertionConsumerServices[0].Location)
+	require.True(t, *md.SPSSODescriptors[0].AuthnRequestsSigned)
+
+	req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(BindingURN("redirect")), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	require.NoError(t, err)
+	u, err := req.Redirect("relay", sp)
+	require.NoError(t, err)
+	q := u.Query()
+	require.NotEmpty(t, q.Get("SAMLRequest"))
+	require.NotEmpty(t, q.Get("Signature"))
+	require.Equal(t, "relay", q.Get("RelayState"))
+
+	_, err = NewServiceProvider(SPConfig{MetadataURL: "https://x/m", ACSURL: "https://x/c", Key: key, Certificate: cert, IdPMetadata: []byte("<nope/>")})
+	require.Error(t, err)
+}
+
+func TestExtractIdentity(t *testing.T) {
+	a := &saml.Assertion{
+		Issuer:  saml.Issuer{Value: "https://idp.example.com/metadata"},
+		Subject: &saml.Subject{NameID: &saml.NameID{Format: string(saml.EmailAddressNameIDFormat), Value: "alice@example.com"}},
+		AttributeStatements: []saml.AttributeStatement{{Attributes: []saml.Attribute{
+			{Name: "http://schemas.microsoft.com/identity/claims/displayname", Values: []saml.AttributeValue{{Value: "Alice A"}}},
+			{Name: "urn:oid:0.9.2342.19200300.100.1.1", FriendlyName: "uid", Values: []saml.AttributeValue{{Value: "alice"}}},
+			{Name: "corpMail", Values: []saml.AttributeValue{{Value: "alice@corp.example.com"}}},
+		}}},
+	}
+
+	id, err := ExtractIdentity(a, AttributeMapping{})
+	require.NoError(t, err)
+	require.Equal(t, "https://idp.example.com/metadata", id.Issuer)
+	require.Equal(t, "alice@example.com", id.Subject)
+	require.Equal(t, "alice@example.com", *id.Email) // NameID fallback
+	require.Equal(t, "alice", id.Username)
+	require.Equal(t, "Alice A", id.Name)
+
+	id, err = ExtractIdentity(a, AttributeMapping{Email: "CORPMAIL"})
+	require.NoError(t, err)
+	require.Equal(t, "alice@corp.example.com", *id.Email)
+
+	_, err = ExtractIdentity(&saml.Assertion{}, AttributeMapping{})
+	require.Error(t, err)
+}
@@ -58,6 +58,31 @@ type ChallengeCache interface {
 	Del(ctx context.Context, nonce string) error
 }
 
+// AtomicChallengeCache is an optional extension of ChallengeCache that reads and deletes
+// a challenge in one step, so a signed challenge is redeemed at most once. The bundled
+// memory, Redis and Postgres caches implement it.
+type AtomicChallengeCache interface {
+	ChallengeCache
+	GetDel(ctx context.Context, nonce string) (ChallengeData, bool, error)
+}
+
+// ConsumeChallenge returns the challenge for nonce and deletes it. Caches that do not
+// implement AtomicChallengeCache fall back to Get followed by Del; a failed Del is
+// returned as an error rather than leaving the challenge redeemable.
+func ConsumeChallenge(ctx context.Context, cache ChallengeCache, nonce string) (ChallengeData, bool, error) {
+	if ac, ok := cache.(AtomicChallengeCache); ok {
+		return ac.GetDel(ctx, nonce)
+	}
+	data, found, err := cache.Get(ctx, nonce)
+	if err != nil || !found {
+		return ChallengeData{}, false, err
+	}
+	if err := cache.Del(ctx, nonce); err != nil {
+		return ChallengeData{}, false, err
+	}
+	return data, true, nil
+}
+
 // Verify checks that the signature is valid for the given input and output.
 // Returns nil if valid, or an error describing the validation failure.
 func Verify(input SignInInput, output SignInOutput) error {
@@ -1,8 +1,10 @@
 package siws
 
 import (
+	"context"
 	"crypto/ed25519"
 	"crypto/rand"
+	"errors"
 	"testing"
 	"time"
 )
@@ -320,3 +322,66 @@ func containsAt(s, substr string) bool {
 	}
 	return false
 }
+
+// mapCache is a ChallengeCache without GetDel, exercising the ConsumeChallenge fallback.
+type mapCache struct {
+	data   map[string]ChallengeData
+	delErr error
+}
+
+func (c *mapCache) Put(_ context.Context, nonce string, data ChallengeData) error {
+	c.data[nonce] = data
+	return nil
+}
+
+func (c *mapCache) Get(_ context.Context, nonce string) (ChallengeData, bool, error) {
+	d, ok := c.data[nonce]
+	return d, ok, nil
+}
+
+func (c *mapCache) Del(_ context.Context, nonce string) error {
+	if c.delErr != nil {
+		return c.delErr
+	}
+	delete(c.data, nonce)
+	return nil
+}
+
+// atomicCache records that ConsumeChallenge preferred GetDel.
+type atomicCache struct {
+	mapCache
+	getDels int
+}
+
+func (c *atomicCache) GetDel(ctx context.Context, nonce string) (ChallengeData, bool, error) {
+	c.getDels++
+	d, ok, _ := c.Get(ctx, nonce)
+	delete(c.data, nonce)
+	return d, ok, nil
+}
+
+func TestConsumeChallenge(t *testing.T) {
+	ctx := context.Background()
+
+	fallback := &mapCache{data: map[string]ChallengeData{"n1": {Address: "addr"}}}
+	got, found, err := ConsumeChallenge(ctx, fallback, "n1")
+	if err != nil || !found || got.Address != "addr" {
+		t.Fatalf("first consume = %+v, %v, %v", got, found, err)
+	}
+	if _, found, _ := ConsumeChallenge(ctx, fallback, "n1"); found {
+		t.Error("challenge redeemable twice")
+	}
+
+	failing := &mapCache{data: map[string]ChallengeData{"n2": {}}, delErr: errors.New("down")}
+	if _, found, err := ConsumeChallenge(ctx, failing, "n2"); err == nil || found {
+		t.Errorf("failed delete should not redeem: found=%v err=%v", found, err)
+	}
+
+	atomic := &atomicCache{mapCache: mapCache{data: map[string]ChallengeData{"n3": {}}}}
+	if _, found, err := ConsumeChallenge(ctx, atomic, "n3"); err != nil || !found {
+		t.Fatalf("atomic consume: found=%v err=%v", found, err)
+	}
+	if atomic.getDels != 1 {
+		t.Errorf("GetDel calls = %d, want 1", atomic.getDels)
+	}
+}
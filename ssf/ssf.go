@@ -0,0 +1,122 @@
+// Package ssf holds OpenID Shared Signals Framework vocabulary (CAEP and RISC event types,
+// subject identifiers) and helpers to build and read Security Event Token (RFC 8417) claims.
+//
+// Signing and verification are left to callers: AuthKit signs SETs with its jwtkit.Signer
+// and verifies received SETs against the transmitter's JWKS.
+package ssf
+
+import (
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// TokenType is the JWS "typ" header for SETs; ContentType is the push delivery media type (RFC 8935).
+const (
+	TokenType   = "secevent+jwt"
+	ContentType = "application/secevent+jwt"
+)
+
+// CAEP event types.
+const (
+	CAEPSessionRevoked       = "https://schemas.openid.net/secevent/caep/event-type/session-revoked"
+	CAEPCredentialChange     = "https://schemas.openid.net/secevent/caep/event-type/credential-change"
+	CAEPTokenClaimsChange    = "https://schemas.openid.net/secevent/caep/event-type/token-claims-change"
+	CAEPAssuranceLevelChange = "https://schemas.openid.net/secevent/caep/event-type/assurance-level-change"
+)
+
+// RISC event types.
+const (
+	RISCAccountDisabled                 = "https://schemas.openid.net/secevent/risc/event-type/account-disabled"
+	RISCAccountEnabled                  = "https://schemas.openid.net/secevent/risc/event-type/account-enabled"
+	RISCAccountPurged                   = "https://schemas.openid.net/secevent/risc/event-type/account-purged"
+	RISCAccountCredentialChangeRequired = "https://schemas.openid.net/secevent/risc/event-type/account-credential-change-required"
+	RISCCredentialCompromise            = "https://schemas.openid.net/secevent/risc/event-type/credential-compromise"
+	RISCIdentifierChanged               = "https://schemas.openid.net/secevent/risc/event-type/identifier-changed"
+	// RISCSessionsRevoked is the pre-CAEP RISC event still sent by Google.
+	RISCSessionsRevoked = "https://schemas.openid.net/secevent/risc/event-type/sessions-revoked"
+	// OAuthTokensRevoked is sent by Google when a user revokes the app's OAuth tokens.
+	OAuthTokensRevoked = "https://schemas.openid.net/secevent/oauth/event-type/tokens-revoked"
+)
+
+// Stream verification events carry no subject and require no action.
+const (
+	SSFVerification  = "https://schemas.openid.net/secevent/ssf/event-type/verification"
+	RISCVerification = "https://schemas.openid.net/secevent/risc/event-type/verification"
+)
+
+// IsVerification reports whether uri is a stream verification event.
+func IsVerification(uri string) bool {
+	return uri == SSFVerification || uri == RISCVerification
+}
+
+// Subject is an SSF subject identifier. AuthKit emits the "iss_sub" format.
+type Subject struct {
+	Format string `json:"format"`
+	Iss    string `json:"iss,omitempty"`
+	Sub    string `json:"sub,omitempty"`
+	Email  string `json:"email,omitempty"`
+}
+
+// IssSub returns an "iss_sub" subject identifier.
+func IssSub(iss, sub string) Subject { return Subject{Format: "iss_sub", Iss: iss, Sub: sub} }
+
+// NewClaims returns SET claims carrying a single event. The subject goes in the
+// top-level "sub_id" claim as defined by SSF 1.0.
+func NewClaims(issuer, audience, jti string, iat time.Time, subject Subject, eventURI string, event map[string]any) jwt.MapClaims {
+	if event == nil {
+		event = map[string]any{}
+	}
+	return jwt.MapClaims{
+		"iss":    issuer,
+		"aud":    audience,
+		"jti":    jti,
+		"iat":    iat.Unix(),
+		"sub_id": subject,
+		"events": map[string]any{eventURI: event},
+	}
+}
+
+// Events returns the "events" claim of a SET.
+func Events(claims jwt.MapClaims) map[string]map[string]any {
+	raw, _ := claims["events"].(map[string]any)
+	out := make(map[string]map[string]any, len(raw))
+	for uri, v := range raw {
+		payload, _ := v.(map[string]any)
+		if payload == nil {
+			payload = map[string]any{}
+		}
+		out[uri] = payload
+	}
+	return out
+}
+
+// IssSubject extracts an issuer/subject pair for one event. It accepts the SSF 1.0
+// top-level "sub_id" claim and the event-level "subject" member used by RISC drafts
+// (Google sends {"subject_type":"iss-sub","iss":...,"sub":...}).
+func IssSubject(claims jwt.MapClaims, event map[string]any) (iss, sub string, ok bool) {
+	if subj, _ := event["subject"].(map[string]any); subj != nil {
+		if iss, sub, ok := issSub(subj); ok {
+			return iss, sub, true
+		}
+	}
+	if subj, _ := claims["sub_id"].(map[string]any); subj != nil {
+		return issSub(subj)
+	}
+	return "", "", false
+}
+
+func issSub(m map[string]any) (string, string, bool) {
+	format, _ := m["format"].(string)
+	if format == "" {
+		format, _ = m["subject_type"].(string)
+	}
+	if format != "iss_sub" && format != "iss-sub" {
+		return "", "", false
+	}
+	iss, _ := m["iss"].(string)
+	sub, _ := m["sub"].(string)
+	iss, sub = strings.TrimSpace(iss), strings.TrimSpace(sub)
+	return iss, sub, iss != "" && sub != ""
+}
@@ -0,0 +1,44 @@
+package ssf
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+func TestIssSubject(t *testing.T) {
+	// SSF 1.0: top-level sub_id.
+	claims := jwt.MapClaims{
+		"sub_id": map[string]any{"format": "iss_sub", "iss": "https://idp.example.com", "sub": "123"},
+		"events": map[string]any{CAEPSessionRevoked: map[string]any{"event_timestamp": 1}},
+	}
+	events := Events(claims)
+	if iss, sub, ok := IssSubject(claims, events[CAEPSessionRevoked]); !ok || iss != "https://idp.example.com" || sub != "123" {
+		t.Fatalf("sub_id not parsed: %q %q %v", iss, sub, ok)
+	}
+
+	// Google RISC: event-level subject with subject_type.
+	google := jwt.MapClaims{"events": map[string]any{RISCAccountDisabled: map[string]any{
+		"subject": map[string]any{"subject_type": "iss-sub", "iss": "https://accounts.google.com/", "sub": "777"},
+		"reason":  "hijacking",
+	}}}
+	if iss, sub, ok := IssSubject(google, Events(google)[RISCAccountDisabled]); !ok || iss != "https://accounts.google.com/" || sub != "777" {
+		t.Fatalf("RISC subject not parsed: %q %q %v", iss, sub, ok)
+	}
+
+	email := jwt.MapClaims{"sub_id": map[string]any{"format": "email", "email": "a@example.com"}}
+	if _, _, ok := IssSubject(email, nil); ok {
+		t.Fatal("email subjects are not resolvable to provider links")
+	}
+}
+
+func TestNewClaims(t *testing.T) {
+	c := NewClaims("https://auth.example.com", "rp", "evt-1", time.Unix(100, 0), IssSub("https://auth.example.com", "u1"), RISCAccountPurged, nil)
+	if c["iat"] != int64(100) || c["jti"] != "evt-1" || len(Events(c)) != 1 {
+		t.Fatalf("unexpected claims: %v", c)
+	}
+	if _, ok := c["sub"]; ok {
+		t.Fatal("SETs must not carry a top-level sub")
+	}
+}
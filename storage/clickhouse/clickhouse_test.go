@@ -0,0 +1,201 @@
+package clickhousestore
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// fakeClickHouse mimics the parts of the ClickHouse HTTP interface used by this package.
+type fakeClickHouse struct {
+	mu      sync.Mutex
+	queries []string            // statements (query param or body)
+	params  []url.Values        // URL params per request
+	inserts map[string][]string // table -> JSONEachRow lines
+	rows    []string            // JSONEachRow response for SELECTs
+	block   chan struct{}       // when set, INSERTs wait on it
+}
+
+func newFake(t *testing.T) (*fakeClickHouse, *Client) {
+	t.Helper()
+	f := &fakeClickHouse{inserts: map[string][]string{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	c, err := NewClient(Config{URL: srv.URL, Database: "auth", Username: "u", Password: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, c
+}
+
+func (f *fakeClickHouse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-ClickHouse-User") != "u" || r.Header.Get("X-ClickHouse-Key") != "p" {
+		http.Error(w, "Code: 516. Authentication failed", http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	stmt := q.Get("query")
+	if stmt == "" {
+		stmt = string(body)
+	}
+	if strings.HasPrefix(stmt, "INSERT INTO ") {
+		if f.block != nil {
+			<-f.block
+		}
+		table := strings.Fields(stmt)[2]
+		f.mu.Lock()
+		sc := bufio.NewScanner(strings.NewReader(string(body)))
+		for sc.Scan() {
+			f.inserts[table] = append(f.inserts[table], sc.Text())
+		}
+		f.mu.Unlock()
+	}
+	f.mu.Lock()
+	f.queries = append(f.queries, stmt)
+	f.params = append(f.params, q)
+	rows := f.rows
+	f.mu.Unlock()
+	if strings.HasPrefix(stmt, "SELECT") {
+		_, _ = io.WriteString(w, strings.Join(rows, "\n"))
+	}
+}
+
+func TestLogger_BatchesAndFlushesOnClose(t *testing.T) {
+	f, c := newFake(t)
+	l := NewLogger(c, LoggerOptions{BatchSize: 2, FlushInterval: time.Hour})
+	method := "password_login"
+	for _, sid := range []string{"s1", "s2", "s3"} {
+		_ = l.LogSessionEvent(context.Background(), core.AuthSessionEvent{
+			OccurredAt: time.Date(2026, 1, 2, 3, 4, 5, 6e6, time.UTC),
+			Issuer:     "https://auth.example.com", UserID: "u1", SessionID: sid,
+			Event: core.SessionEventCreated, Method: &method,
+		})
+	}
+	if err := l.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	lines := f.inserts[DefaultTable]
+	f.mu.Unlock()
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 inserted rows, got %d: %v", len(lines), lines)
+	}
+	if !strings.Contains(lines[0], `"occurred_at":"2026-01-02 03:04:05.006"`) || !strings.Contains(lines[0], `"related_user_id":null,"actor_user_id":null`) {
+		t.Fatalf("unexpected row encoding: %s", lines[0])
+	}
+	st := l.Stats()
+	if st.Written != 3 || st.Flushes != 2 || st.Dropped != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+	if err := l.LogSessionEvent(context.Background(), core.AuthSessionEvent{}); err != nil || l.Stats().Dropped != 1 {
+		t.Fatalf("events after Close must be dropped: %+v", l.Stats())
+	}
+}
+
+func TestLogger_DropsWhenBufferFull(t *testing.T) {
+	f, c := newFake(t)
+	f.block = make(chan struct{})
+	l := NewLogger(c, LoggerOptions{BufferSize: 1, BatchSize: 1, FlushInterval: time.Hour})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for l.Stats().Dropped == 0 && time.Now().Before(deadline) {
+		_ = l.LogSessionEvent(context.Background(), core.AuthSessionEvent{UserID: "u1", Event: core.SessionEventFailed})
+	}
+	if l.Stats().Dropped == 0 {
+		t.Fatal("expected drops while the writer is stalled")
+	}
+	close(f.block)
+	_ = l.Close(context.Background())
+	st := l.Stats()
+	if st.Enqueued != st.Written || st.Enqueued+st.Dropped == 0 {
+		t.Fatalf("every accepted event should be written: %+v", st)
+	}
+}
+
+func TestReader_PaginatesWithCursor(t *testing.T) {
+	f, c := newFake(t)
+	f.rows = []string{
+		`{"occurred_at":"2026-01-02 03:04:07.000","issuer":"iss","user_id":"u1","session_id":"s3","event":"session_created","method":"password_login","reason":null,"ip_addr":null,"user_agent":null,"related_user_id":null,"actor_user_id":null}`,
+		`{"occurred_at":"2026-01-02 03:04:06.500","issuer":"iss","user_id":"u1","session_id":"s2","event":"session_failed","method":null,"reason":"invalid_credentials","ip_addr":"1.2.3.4","user_agent":null,"related_user_id":null,"actor_user_id":null}`,
+		`{"occurred_at":"2026-01-02 03:04:05.000","issuer":"iss","user_id":"u1","session_id":"s1","event":"session_created","method":"oidc_login","reason":null,"ip_addr":null,"user_agent":null,"related_user_id":null,"actor_user_id":null}`,
+	}
+	r := NewReader(c, "")
+	page, err := r.ListSessionEventsPage(context.Background(), core.SessionEventQuery{
+		UserID:     "u1",
+		EventTypes: []core.SessionEventType{core.SessionEventCreated, core.SessionEventFailed},
+		Limit:      2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Events) != 2 || page.NextCursor == "" {
+		t.Fatalf("expected 2 events and a cursor, got %d %q", len(page.Events), page.NextCursor)
+	}
+	if page.Events[1].Reason == nil || *page.Events[1].Reason != "invalid_credentials" || page.Events[1].OccurredAt.UnixMilli()%1000 != 500 {
+		t.Fatalf("unexpected decoded event: %+v", page.Events[1])
+	}
+	f.mu.Lock()
+	p := f.params[len(f.params)-1]
+	q := f.queries[len(f.queries)-1]
+	f.mu.Unlock()
+	if p.Get("param_user_id") != "u1" || p.Get("param_event_types") != "['session_created','session_failed']" || p.Get("database") != "auth" {
+		t.Fatalf("unexpected params: %v", p)
+	}
+	if !strings.Contains(q, "LIMIT 3") || strings.Contains(q, "u1") {
+		t.Fatalf("query must bind values as parameters and over-fetch by one: %s", q)
+	}
+
+	if _, err := r.ListSessionEventsPage(context.Background(), core.SessionEventQuery{Cursor: page.NextCursor}); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	p = f.params[len(f.params)-1]
+	f.mu.Unlock()
+	if p.Get("param_cursor_sid") != "s2" || p.Get("param_cursor_event") != "session_failed" {
+		t.Fatalf("cursor not applied: %v", p)
+	}
+	if _, err := r.ListSessionEventsPage(context.Background(), core.SessionEventQuery{Cursor: "garbage"}); err != core.ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestMigrate_RendersOnClusterAndSplitsStatements(t *testing.T) {
+	f, c := newFake(t)
+	if err := Migrate(context.Background(), c, MigrateOptions{Cluster: "auth_cluster"}); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	queries := append([]string(nil), f.queries...)
+	f.mu.Unlock()
+	if len(queries) < 5 {
+		t.Fatalf("expected one request per statement, got %d", len(queries))
+	}
+	for _, q := range queries {
+		if strings.Contains(q, "{{ON_CLUSTER}}") || strings.HasSuffix(q, ";") || strings.HasPrefix(q, "--") {
+			t.Fatalf("statement not rendered: %q", q)
+		}
+	}
+	if !strings.Contains(queries[0], "CREATE TABLE IF NOT EXISTS user_auth_logins ON CLUSTER auth_cluster (") {
+		t.Fatalf("unexpected first statement: %s", queries[0])
+	}
+
+	f2, c2 := newFake(t)
+	fsys := fstest.MapFS{"001_x.up.sql": {Data: []byte("-- header\nCREATE TABLE t {{ON_CLUSTER}} (a String);\nDROP TABLE u {{ON_CLUSTER}};\n")}}
+	if err := Migrate(context.Background(), c2, MigrateOptions{FS: fsys}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f2.queries; len(got) != 2 || got[0] != "CREATE TABLE t  (a String)" || got[1] != "DROP TABLE u" {
+		t.Fatalf("unexpected statements without cluster: %q", got)
+	}
+}
@@ -0,0 +1,137 @@
+// Package clickhousestore provides ClickHouse-backed implementations of core.AuthEventLogger
+// and core.AuthEventLogReader, plus a runner for the SQL in migrations/clickhouse.
+//
+// It talks to ClickHouse over the HTTP interface (port 8123 by default), so it needs no
+// driver and can be tested against any HTTP server that speaks the same protocol.
+package clickhousestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config configures the ClickHouse HTTP client.
+type Config struct {
+	// URL of the HTTP interface, e.g. "http://localhost:8123".
+	URL      string
+	Database string
+	Username string
+	Password string
+	// HTTPClient defaults to a client with a 30s timeout.
+	HTTPClient *http.Client
+}
+
+// Client executes queries over the ClickHouse HTTP interface.
+type Client struct {
+	base url.URL
+	cfg  Config
+	hc   *http.Client
+}
+
+// NewClient validates cfg and returns a Client.
+func NewClient(cfg Config) (*Client, error) {
+	u, err := url.Parse(strings.TrimSpace(cfg.URL))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("clickhouse: invalid URL %q", cfg.URL)
+	}
+	hc := cfg.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{base: *u, cfg: cfg, hc: hc}, nil
+}
+
+// Exec runs a statement that returns no rows. params are bound to {name:Type} placeholders.
+func (c *Client) Exec(ctx context.Context, query string, params map[string]string) error {
+	resp, err := c.do(ctx, nil, params, strings.NewReader(query))
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// insertJSONEachRow inserts rows (one JSON object each) into table.
+func (c *Client) insertJSONEachRow(ctx context.Context, table string, rows []any) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, r := range rows {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	q := "INSERT INTO " + table + " FORMAT JSONEachRow"
+	resp, err := c.do(ctx, &q, nil, &body)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// selectJSONEachRow runs query (which must not include a FORMAT clause) and calls fn for
+// each returned row.
+func (c *Client) selectJSONEachRow(ctx context.Context, query string, params map[string]string, fn func(json.RawMessage) error) error {
+	resp, err := c.do(ctx, nil, params, strings.NewReader(query+" FORMAT JSONEachRow"))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(json.RawMessage(line)); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// do POSTs body to the HTTP interface. When query is set it is sent as the "query" URL
+// parameter and body carries the data (used for INSERT ... FORMAT).
+func (c *Client) do(ctx context.Context, query *string, params map[string]string, body io.Reader) (*http.Response, error) {
+	u := c.base
+	v := u.Query()
+	if c.cfg.Database != "" {
+		v.Set("database", c.cfg.Database)
+	}
+	if query != nil {
+		v.Set("query", *query)
+	}
+	for k, p := range params {
+		v.Set("param_"+k, p)
+	}
+	u.RawQuery = v.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.Username != "" {
+		req.Header.Set("X-ClickHouse-User", c.cfg.Username)
+	}
+	if c.cfg.Password != "" {
+		req.Header.Set("X-ClickHouse-Key", c.cfg.Password)
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("clickhouse: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
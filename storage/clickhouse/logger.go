@@ -0,0 +1,272 @@
+package clickhousestore
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// DefaultTable is the session event table created by migrations/clickhouse.
+const DefaultTable = "user_auth_session_events"
+
+const chTimeLayout = "2006-01-02 15:04:05.000"
+
+// LoggerOptions tunes batching. Zero values use the defaults noted on each field.
+type LoggerOptions struct {
+	// Table defaults to DefaultTable.
+	Table string
+	// BufferSize bounds queued events; events beyond it are dropped. Default 10000.
+	BufferSize int
+	// BatchSize flushes as soon as this many events are queued. Default 1000.
+	BatchSize int
+	// FlushInterval flushes partial batches. Default 2s.
+	FlushInterval time.Duration
+	// FlushTimeout bounds each INSERT. Default 10s.
+	FlushTimeout time.Duration
+	// Logger receives flush failures. Default slog.Default().
+	Logger *slog.Logger
+}
+
+// LoggerStats are cumulative counters since the logger started.
+type LoggerStats struct {
+	Enqueued uint64 // accepted into the buffer
+	Written  uint64 // inserted into ClickHouse
+	Dropped  uint64 // rejected because the buffer was full or the logger closed
+	Failed   uint64 // lost because an INSERT failed
+	Flushes  uint64 // INSERT requests attempted
+}
+
+// Logger is a non-blocking, batching core.AuthEventLogger. LogSessionEvent never waits on
+// ClickHouse: events are queued and written by a background goroutine.
+type Logger struct {
+	client *Client
+	opts   LoggerOptions
+
+	ch      chan core.AuthSessionEvent
+	flushCh chan chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	mu     sync.RWMutex // guards closed against concurrent sends during Close
+	closed bool
+
+	enqueued, written, dropped, failed, flushes atomic.Uint64
+}
+
+// NewLogger starts a batching logger. Call Close on shutdown to flush queued events.
+func NewLogger(client *Client, opts LoggerOptions) *Logger {
+	if opts.Table == "" {
+		opts.Table = DefaultTable
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 10000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 2 * time.Second
+	}
+	if opts.FlushTimeout <= 0 {
+		opts.FlushTimeout = 10 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	l := &Logger{
+		client:  client,
+		opts:    opts,
+		ch:      make(chan core.AuthSessionEvent, opts.BufferSize),
+		flushCh: make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	l.wg.Add(1)
+	go l.run()
+	return l
+}
+
+// LogSessionEvent queues e. It never blocks; when the buffer is full the event is dropped
+// and counted in LoggerStats.Dropped.
+func (l *Logger) LogSessionEvent(_ context.Context, e core.AuthSessionEvent) error {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		l.dropped.Add(1)
+		return nil
+	}
+	select {
+	case l.ch <- e:
+		l.enqueued.Add(1)
+	default:
+		l.dropped.Add(1)
+	}
+	return nil
+}
+
+// Flush writes all events queued so far and waits for the write (or ctx) to finish.
+func (l *Logger) Flush(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case l.flushCh <- ack:
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting events, flushes the buffer and waits for the writer to exit.
+func (l *Logger) Close(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.done)
+	}
+	l.mu.Unlock()
+	finished := make(chan struct{})
+	go func() { l.wg.Wait(); close(finished) }()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the current counters.
+func (l *Logger) Stats() LoggerStats {
+	return LoggerStats{
+		Enqueued: l.enqueued.Load(),
+		Written:  l.written.Load(),
+		Dropped:  l.dropped.Load(),
+		Failed:   l.failed.Load(),
+		Flushes:  l.flushes.Load(),
+	}
+}
+
+func (l *Logger) run() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]core.AuthSessionEvent, 0, l.opts.BatchSize)
+
+	// drain moves everything currently buffered into batch, writing full batches.
+	drain := func() {
+		for {
+			select {
+			case e := <-l.ch:
+				batch = append(batch, e)
+				if len(batch) >= l.opts.BatchSize {
+					batch = l.write(batch)
+				}
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case e := <-l.ch:
+			batch = append(batch, e)
+			if len(batch) >= l.opts.BatchSize {
+				batch = l.write(batch)
+			}
+		case <-ticker.C:
+			batch = l.write(batch)
+		case ack := <-l.flushCh:
+			drain()
+			batch = l.write(batch)
+			close(ack)
+		case <-l.done:
+			drain()
+			l.write(batch)
+			return
+		}
+	}
+}
+
+// write inserts batch and returns it emptied for reuse.
+func (l *Logger) write(batch []core.AuthSessionEvent) []core.AuthSessionEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+	rows := make([]any, len(batch))
+	for i, e := range batch {
+		rows[i] = toRow(e)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.FlushTimeout)
+	defer cancel()
+	l.flushes.Add(1)
+	if err := l.client.insertJSONEachRow(ctx, l.opts.Table, rows); err != nil {
+		l.failed.Add(uint64(len(batch)))
+		l.opts.Logger.Warn("authkit: clickhouse session event flush failed", "events", len(batch), "error", err)
+	} else {
+		l.written.Add(uint64(len(batch)))
+	}
+	return batch[:0]
+}
+
+type eventRow struct {
+	OccurredAt    string  `json:"occurred_at"`
+	Issuer        string  `json:"issuer"`
+	UserID        string  `json:"user_id"`
+	SessionID     string  `json:"session_id"`
+	Event         string  `json:"event"`
+	Method        *string `json:"method"`
+	Reason        *string `json:"reason"`
+	IPAddr        *string `json:"ip_addr"`
+	UserAgent     *string `json:"user_agent"`
+	RelatedUserID *string `json:"related_user_id"`
+	ActorUserID   *string `json:"actor_user_id"`
+}
+
+func toRow(e core.AuthSessionEvent) eventRow {
+	return eventRow{
+		OccurredAt:    e.OccurredAt.UTC().Format(chTimeLayout),
+		Issuer:        e.Issuer,
+		UserID:        e.UserID,
+		SessionID:     e.SessionID,
+		Event:         string(e.Event),
+		Method:        e.Method,
+		Reason:        e.Reason,
+		IPAddr:        e.IPAddr,
+		UserAgent:     e.UserAgent,
+		RelatedUserID: e.RelatedUserID,
+		ActorUserID:   e.ActorUserID,
+	}
+}
+
+func (r eventRow) toEvent() (core.AuthSessionEvent, error) {
+	// Fractional seconds are accepted when parsing even though the layout omits them.
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", r.OccurredAt, time.UTC)
+	if err != nil {
+		return core.AuthSessionEvent{}, err
+	}
+	return core.AuthSessionEvent{
+		OccurredAt:    t,
+		Issuer:        r.Issuer,
+		UserID:        r.UserID,
+		SessionID:     r.SessionID,
+		Event:         core.SessionEventType(r.Event),
+		Method:        r.Method,
+		Reason:        r.Reason,
+		IPAddr:        r.IPAddr,
+		UserAgent:     r.UserAgent,
+		RelatedUserID: r.RelatedUserID,
+		ActorUserID:   r.ActorUserID,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package clickhousestore
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	chmigrations "github.com/open-rails/authkit/migrations/clickhouse"
+)
+
+// MigrateOptions configures Migrate.
+type MigrateOptions struct {
+	// Cluster, when set, renders {{ON_CLUSTER}} as "ON CLUSTER <Cluster>"; otherwise it is removed.
+	Cluster string
+	// FS overrides the embedded migrations/clickhouse files (mainly for tests).
+	FS fs.FS
+}
+
+// Migrate applies every *.up.sql file in name order. ClickHouse's HTTP interface runs one
+// statement per request, so files are split on ";" at the end of a line. The shipped
+// statements are idempotent (IF [NOT] EXISTS), so Migrate is safe to run on every start.
+func Migrate(ctx context.Context, c *Client, opts MigrateOptions) error {
+	fsys := opts.FS
+	if fsys == nil {
+		fsys = chmigrations.FS
+	}
+	files, err := fs.Glob(fsys, "*.up.sql")
+	if err != nil {
+		return fmt.Errorf("list clickhouse migrations: %w", err)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("read migration %s: %w", name, err)
+		}
+		for _, stmt := range splitStatements(renderOnCluster(string(b), opts.Cluster)) {
+			if err := c.Exec(ctx, stmt, nil); err != nil {
+				return fmt.Errorf("apply migration %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func renderOnCluster(sql, cluster string) string {
+	repl := ""
+	if cluster = strings.TrimSpace(cluster); cluster != "" {
+		repl = "ON CLUSTER " + cluster
+	}
+	return strings.ReplaceAll(sql, "{{ON_CLUSTER}}", repl)
+}
+
+// splitStatements drops full-line "--" comments and splits on statement-terminating ";".
+func splitStatements(sql string) []string {
+	var out []string
+	var cur strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if stmt := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(cur.String()), ";")); stmt != "" {
+				out = append(out, stmt)
+			}
+			cur.Reset()
+		}
+	}
+	if stmt := strings.TrimSpace(cur.String()); stmt != "" {
+		out = append(out, stmt)
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package clickhousestore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Reader implements core.AuthEventLogReader and core.AuthEventLogPageReader.
+type Reader struct {
+	client *Client
+	table  string
+}
+
+// NewReader returns a reader over table (DefaultTable when empty).
+func NewReader(client *Client, table string) *Reader {
+	if table == "" {
+		table = DefaultTable
+	}
+	return &Reader{client: client, table: table}
+}
+
+// ListSessionEvents returns the newest page (up to 1000) of matching events.
+func (r *Reader) ListSessionEvents(ctx context.Context, userID string, eventTypes ...core.SessionEventType) ([]core.AuthSessionEvent, error) {
+	page, err := r.ListSessionEventsPage(ctx, core.SessionEventQuery{UserID: userID, EventTypes: eventTypes, Limit: maxPageSize})
+	return page.Events, err
+}
+
+// pageCursor identifies the last row of a page in (occurred_at, session_id, event) order.
+type pageCursor struct {
+	TS    int64  `json:"t"` // unix milliseconds
+	SID   string `json:"s"`
+	Event string `json:"e"`
+}
+
+// ListSessionEventsPage returns events newest first using keyset pagination.
+func (r *Reader) ListSessionEventsPage(ctx context.Context, q core.SessionEventQuery) (core.SessionEventPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	var where []string
+	params := map[string]string{}
+	if q.UserID != "" {
+		where = append(where, "user_id = {user_id:String}")
+		params["user_id"] = q.UserID
+	}
+	if len(q.EventTypes) > 0 {
+		types := make([]string, len(q.EventTypes))
+		for i, t := range q.EventTypes {
+			types[i] = quoteString(string(t))
+		}
+		where = append(where, "event IN {event_types:Array(String)}")
+		params["event_types"] = "[" + strings.Join(types, ",") + "]"
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "occurred_at >= fromUnixTimestamp64Milli({since:Int64}, 'UTC')")
+		params["since"] = strconv.FormatInt(q.Since.UnixMilli(), 10)
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "occurred_at < fromUnixTimestamp64Milli({until:Int64}, 'UTC')")
+		params["until"] = strconv.FormatInt(q.Until.UnixMilli(), 10)
+	}
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return core.SessionEventPage{}, err
+		}
+		where = append(where, "(occurred_at, session_id, event) < (fromUnixTimestamp64Milli({cursor_ts:Int64}, 'UTC'), {cursor_sid:String}, {cursor_event:String})")
+		params["cursor_ts"] = strconv.FormatInt(c.TS, 10)
+		params["cursor_sid"] = c.SID
+		params["cursor_event"] = c.Event
+	}
+
+	sql := "SELECT occurred_at, issuer, user_id, session_id, event, method, reason, ip_addr, user_agent, related_user_id, actor_user_id FROM " + r.table
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	// Fetch one extra row to know whether another page exists.
+	sql += " ORDER BY occurred_at DESC, session_id DESC, event DESC LIMIT " + strconv.Itoa(limit+1)
+
+	events := make([]core.AuthSessionEvent, 0, limit)
+	more := false
+	err := r.client.selectJSONEachRow(ctx, sql, params, func(raw json.RawMessage) error {
+		if len(events) == limit {
+			more = true
+			return nil
+		}
+		var row eventRow
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return err
+		}
+		e, err := row.toEvent()
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return core.SessionEventPage{}, err
+	}
+	page := core.SessionEventPage{Events: events}
+	if more {
+		last := events[len(events)-1]
+		page.NextCursor = encodeCursor(pageCursor{TS: last.OccurredAt.UnixMilli(), SID: last.SessionID, Event: string(last.Event)})
+	}
+	return page, nil
+}
+
+func encodeCursor(c pageCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.TS <= 0 {
+		return pageCursor{}, core.ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// quoteString renders s as a ClickHouse string literal for array query parameters.
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
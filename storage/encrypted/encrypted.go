@@ -0,0 +1,205 @@
+// Package encryptedstore encrypts ephemeral auth state at rest. Store wraps any
+// core.EphemeralStore (memory, Redis, Postgres, ...) and seals every value with AES-256-GCM
+// before it reaches the backend; Keyring is also used directly by the Redis and Postgres
+// OIDC state and SIWS challenge caches.
+//
+// Sealed values carry the ID of the key that produced them, so keys can be rotated by
+// adding a new active key and keeping the old one until its values have expired. The
+// storage key name is bound as associated data: a value copied to another key fails to
+// open.
+package encryptedstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+// prefix marks sealed values: "ak1:<key id>:" followed by nonce and ciphertext.
+const prefix = "ak1:"
+
+var (
+	// ErrUnknownKey is returned when a value was sealed with a key ID the keyring lacks.
+	ErrUnknownKey = errors.New("encryptedstore: unknown key id")
+	// ErrMalformed is returned for values that were not sealed by a Keyring, or that
+	// fail authentication (tampered, or moved from another key name).
+	ErrMalformed = errors.New("encryptedstore: malformed or unauthenticated value")
+)
+
+// Keyring holds the AEAD keys. Values are sealed with the active key and opened with
+// whichever key their ID names.
+type Keyring struct {
+	active string
+	aeads  map[string]cipher.AEAD
+}
+
+// NewKeyring returns a keyring sealing with keys[activeID]. Keys must be 32 bytes
+// (AES-256); IDs must be non-empty and must not contain ':'.
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("encryptedstore: active key %q not in keys", activeID)
+	}
+	kr := &Keyring{active: activeID, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("encryptedstore: invalid key id %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryptedstore: key %q must be 32 bytes", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		kr.aeads[id] = aead
+	}
+	return kr, nil
+}
+
+// Seal encrypts plaintext for the storage key name.
+func (kr *Keyring) Seal(name string, plaintext []byte) ([]byte, error) {
+	aead := kr.aeads[kr.active]
+	header := prefix + kr.active + ":"
+	out := make([]byte, len(header), len(header)+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(out, header)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, associatedData(kr.active, name)), nil
+}
+
+// Open decrypts a value sealed for the storage key name.
+func (kr *Keyring) Open(name string, sealed []byte) ([]byte, error) {
+	rest, ok := bytes.CutPrefix(sealed, []byte(prefix))
+	if !ok {
+		return nil, ErrMalformed
+	}
+	id, body, ok := bytes.Cut(rest, []byte(":"))
+	if !ok {
+		return nil, ErrMalformed
+	}
+	aead, ok := kr.aeads[string(id)]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if len(body) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ct := body[:aead.NonceSize()], body[aead.NonceSize():]
+	pt, err := aead.Open(nil, nonce, ct, associatedData(string(id), name))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return pt, nil
+}
+
+func associatedData(id, name string) []byte {
+	return []byte(prefix + id + ":" + name)
+}
+
+// Store is a core.EphemeralStore that encrypts values before passing them to the wrapped
+// store. It implements core.AtomicEphemeralStore; the operations are atomic when the
+// wrapped store is.
+//
+// Values written before encryption was enabled cannot be read and behave as missing.
+type Store struct {
+	inner core.EphemeralStore
+	keys  *Keyring
+}
+
+var _ core.AtomicEphemeralStore = (*Store)(nil)
+
+// New wraps inner with encryption under keys.
+func New(inner core.EphemeralStore, keys *Keyring) *Store {
+	return &Store{inner: inner, keys: keys}
+}
+
+// open decrypts b, treating values that cannot be opened as missing so stale plaintext
+// or foreign data never reaches callers.
+func (s *Store) open(key string, b []byte, ok bool, err error) ([]byte, bool, error) {
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	pt, err := s.keys.Open(key, b)
+	if err != nil {
+		return nil, false, nil
+	}
+	return pt, true, nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b, ok, err := s.inner.Get(ctx, key)
+	return s.open(key, b, ok, err)
+}
+
+func (s *Store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	sealed, err := s.keys.Seal(key, value)
+	if err != nil {
+		return err
+	}
+	return s.inner.Set(ctx, key, sealed, ttl)
+}
+
+func (s *Store) Del(ctx context.Context, key string) error {
+	return s.inner.Del(ctx, key)
+}
+
+func (s *Store) GetDel(ctx context.Context, key string) ([]byte, bool, error) {
+	if as, ok := s.inner.(core.AtomicEphemeralStore); ok {
+		b, found, err := as.GetDel(ctx, key)
+		return s.open(key, b, found, err)
+	}
+	b, found, err := s.inner.Get(ctx, key)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	if err := s.inner.Del(ctx, key); err != nil {
+		return nil, false, err
+	}
+	return s.open(key, b, true, nil)
+}
+
+// CompareAndDelete compares plaintexts. Sealing is randomized, so it reads the stored
+// ciphertext and deletes only if that exact ciphertext is still present.
+func (s *Store) CompareAndDelete(ctx context.Context, key string, expected []byte) (bool, error) {
+	sealed, found, err := s.inner.Get(ctx, key)
+	if err != nil || !found {
+		return false, err
+	}
+	pt, err := s.keys.Open(key, sealed)
+	if err != nil || !bytes.Equal(pt, expected) {
+		return false, nil
+	}
+	if as, ok := s.inner.(core.AtomicEphemeralStore); ok {
+		return as.CompareAndDelete(ctx, key, sealed)
+	}
+	return true, s.inner.Del(ctx, key)
+}
+
+func (s *Store) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	sealed, err := s.keys.Seal(key, value)
+	if err != nil {
+		return false, err
+	}
+	if as, ok := s.inner.(core.AtomicEphemeralStore); ok {
+		return as.SetNX(ctx, key, sealed, ttl)
+	}
+	if _, found, err := s.inner.Get(ctx, key); err != nil || found {
+		return false, err
+	}
+	return true, s.inner.Set(ctx, key, sealed, ttl)
+}
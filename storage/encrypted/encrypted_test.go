@@ -0,0 +1,77 @@
+package encryptedstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	memorystore "github.com/open-rails/authkit/storage/memory"
+)
+
+func testKey(b byte) []byte { return bytes.Repeat([]byte{b}, 32) }
+
+func TestStore_EncryptsAndBindsKeyName(t *testing.T) {
+	kr, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := memorystore.NewKV()
+	s := New(inner, kr)
+	ctx := context.Background()
+
+	secret := []byte(`{"password_hash":"argon2id$secret"}`)
+	if err := s.Set(ctx, "auth:pending_reg:token:a", secret, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	raw, _, _ := inner.Get(ctx, "auth:pending_reg:token:a")
+	if bytes.Contains(raw, []byte("argon2id")) || !bytes.HasPrefix(raw, []byte("ak1:k1:")) {
+		t.Fatalf("value stored in plaintext: %q", raw)
+	}
+	got, ok, err := s.Get(ctx, "auth:pending_reg:token:a")
+	if err != nil || !ok || !bytes.Equal(got, secret) {
+		t.Fatalf("round trip failed: %q %v %v", got, ok, err)
+	}
+
+	// A sealed value moved to another key name must not open.
+	_ = inner.Set(ctx, "auth:pending_reg:token:b", raw, time.Minute)
+	if _, ok, _ := s.Get(ctx, "auth:pending_reg:token:b"); ok {
+		t.Fatalf("swapped value was accepted")
+	}
+	if _, err := kr.Open("auth:pending_reg:token:b", raw); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected ErrMalformed, got %v", err)
+	}
+
+	if ok, _ := s.CompareAndDelete(ctx, "auth:pending_reg:token:a", []byte("other")); ok {
+		t.Fatalf("compare-and-delete matched the wrong plaintext")
+	}
+	if ok, _ := s.CompareAndDelete(ctx, "auth:pending_reg:token:a", secret); !ok {
+		t.Fatalf("compare-and-delete should match the plaintext")
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	old, _ := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	sealed, err := old.Seal("name", []byte("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt, err := rotated.Open("name", sealed); err != nil || string(pt) != "v" {
+		t.Fatalf("rotated keyring cannot open old value: %v", err)
+	}
+	fresh, _ := rotated.Seal("name", []byte("v"))
+	if !bytes.HasPrefix(fresh, []byte("ak1:k2:")) {
+		t.Fatalf("expected new values under the active key, got %q", fresh[:7])
+	}
+	if _, err := old.Open("name", fresh); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+	if _, err := NewKeyring("k1", map[string][]byte{"k1": []byte("short")}); err == nil {
+		t.Fatalf("expected short key to be rejected")
+	}
+}
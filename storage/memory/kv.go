@@ -1,6 +1,7 @@
 package memorystore
 
 import (
+	"bytes"
 	"context"
 	"sync"
 	"time"
@@ -26,15 +27,24 @@ func (k *KV) Get(ctx context.Context, key string) ([]byte, bool, error) {
 	_ = ctx
 	k.mu.Lock()
 	defer k.mu.Unlock()
-	it, ok := k.items[key]
+	it, ok := k.live(key)
 	if !ok {
 		return nil, false, nil
 	}
+	return it.value, true, nil
+}
+
+// live returns the unexpired item for key. Callers must hold k.mu.
+func (k *KV) live(key string) (kvItem, bool) {
+	it, ok := k.items[key]
+	if !ok {
+		return kvItem{}, false
+	}
 	if !it.expires.IsZero() && time.Now().After(it.expires) {
 		delete(k.items, key)
-		return nil, false, nil
+		return kvItem{}, false
 	}
-	return it.value, true, nil
+	return it, true
 }
 
 func (k *KV) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
@@ -56,3 +66,42 @@ func (k *KV) Del(ctx context.Context, key string) error {
 	delete(k.items, key)
 	return nil
 }
+
+func (k *KV) GetDel(ctx context.Context, key string) ([]byte, bool, error) {
+	_ = ctx
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	it, ok := k.live(key)
+	if !ok {
+		return nil, false, nil
+	}
+	delete(k.items, key)
+	return it.value, true, nil
+}
+
+func (k *KV) CompareAndDelete(ctx context.Context, key string, expected []byte) (bool, error) {
+	_ = ctx
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	it, ok := k.live(key)
+	if !ok || !bytes.Equal(it.value, expected) {
+		return false, nil
+	}
+	delete(k.items, key)
+	return true, nil
+}
+
+func (k *KV) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	_ = ctx
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.live(key); ok {
+		return false, nil
+	}
+	var exp time.Time
+	if ttl > 0 {
+		exp = time.Now().Add(ttl)
+	}
+	k.items[key] = kvItem{value: append([]byte(nil), value...), expires: exp}
+	return true, nil
+}
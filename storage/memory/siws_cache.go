@@ -8,6 +8,8 @@ import (
 	"github.com/open-rails/authkit/siws"
 )
 
+var _ siws.AtomicChallengeCache = (*SIWSCache)(nil)
+
 // SIWSCache stores pending SIWS challenges in memory.
 // This is only suitable for single-node deployments or local development.
 type SIWSCache struct {
@@ -67,6 +69,21 @@ func (c *SIWSCache) Del(ctx context.Context, nonce string) error {
 	return nil
 }
 
+// GetDel retrieves and removes a challenge in one step.
+func (c *SIWSCache) GetDel(ctx context.Context, nonce string) (siws.ChallengeData, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.data[nonce]
+	if !ok {
+		return siws.ChallengeData{}, false, nil
+	}
+	delete(c.data, nonce)
+	if time.Now().After(entry.expiresAt) {
+		return siws.ChallengeData{}, false, nil
+	}
+	return entry.data, true, nil
+}
+
 // cleanupLoop periodically removes expired entries.
 func (c *SIWSCache) cleanupLoop() {
 	ticker := time.NewTicker(time.Minute)
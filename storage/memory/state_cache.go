@@ -8,6 +8,8 @@ import (
 	oidckit "github.com/open-rails/authkit/oidc"
 )
 
+var _ oidckit.AtomicStateCache = (*StateCache)(nil)
+
 // StateCache is an in-memory implementation of oidckit.StateCache with TTL.
 type StateCache struct {
 	mu     sync.Mutex
@@ -64,6 +66,21 @@ func (s *StateCache) Del(ctx context.Context, state string) error {
 	return nil
 }
 
+func (s *StateCache) GetDel(ctx context.Context, state string) (oidckit.StateData, bool, error) {
+	_ = ctx
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.data[state]
+	if !ok {
+		return oidckit.StateData{}, false, nil
+	}
+	delete(s.data, state)
+	if time.Now().After(it.exp) {
+		return oidckit.StateData{}, false, nil
+	}
+	return it.v, true, nil
+}
+
 // cleanupLoop runs in the background and removes expired entries every minute.
 func (s *StateCache) cleanupLoop() {
 	ticker := time.NewTicker(time.Minute)
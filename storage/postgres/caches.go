@@ -0,0 +1,138 @@
+package postgresstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	core "github.com/open-rails/authkit/core"
+	oidckit "github.com/open-rails/authkit/oidc"
+	"github.com/open-rails/authkit/siws"
+)
+
+var (
+	_ oidckit.AtomicStateCache  = (*StateCache)(nil)
+	_ siws.AtomicChallengeCache = (*SIWSCache)(nil)
+)
+
+// StateCache implements oidckit.StateCache on a KV, or on a KV wrapped by
+// storage/encrypted.
+type StateCache struct {
+	kv    core.EphemeralStore
+	keyNS string
+	ttl   time.Duration
+}
+
+// NewStateCache returns a StateCache storing entries under keyPrefix
+// (default "auth:oidc:state:") for ttl (default 15 minutes).
+func NewStateCache(kv core.EphemeralStore, keyPrefix string, ttl time.Duration) *StateCache {
+	if keyPrefix == "" {
+		keyPrefix = "auth:oidc:state:"
+	}
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	return &StateCache{kv: kv, keyNS: keyPrefix, ttl: ttl}
+}
+
+func (s *StateCache) Put(ctx context.Context, state string, data oidckit.StateData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return s.kv.Set(ctx, s.keyNS+state, b, s.ttl)
+}
+
+func (s *StateCache) Get(ctx context.Context, state string) (oidckit.StateData, bool, error) {
+	var d oidckit.StateData
+	ok, err := getJSON(ctx, s.kv, s.keyNS+state, &d)
+	return d, ok, err
+}
+
+// GetDel reads and removes state in one step when the KV is a core.AtomicEphemeralStore.
+func (s *StateCache) GetDel(ctx context.Context, state string) (oidckit.StateData, bool, error) {
+	var d oidckit.StateData
+	ok, err := getDelJSON(ctx, s.kv, s.keyNS+state, &d)
+	return d, ok, err
+}
+
+func (s *StateCache) Del(ctx context.Context, state string) error {
+	return s.kv.Del(ctx, s.keyNS+state)
+}
+
+// SIWSCache implements siws.ChallengeCache on a KV, or on a KV wrapped by
+// storage/encrypted.
+type SIWSCache struct {
+	kv    core.EphemeralStore
+	keyNS string
+	ttl   time.Duration
+}
+
+// NewSIWSCache returns a SIWSCache storing challenges under keyPrefix
+// (default "auth:siws:nonce:") for ttl (default 15 minutes).
+func NewSIWSCache(kv core.EphemeralStore, keyPrefix string, ttl time.Duration) *SIWSCache {
+	if keyPrefix == "" {
+		keyPrefix = "auth:siws:nonce:"
+	}
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	return &SIWSCache{kv: kv, keyNS: keyPrefix, ttl: ttl}
+}
+
+func (c *SIWSCache) Put(ctx context.Context, nonce string, data siws.ChallengeData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return c.kv.Set(ctx, c.keyNS+nonce, b, c.ttl)
+}
+
+func (c *SIWSCache) Get(ctx context.Context, nonce string) (siws.ChallengeData, bool, error) {
+	var d siws.ChallengeData
+	ok, err := getJSON(ctx, c.kv, c.keyNS+nonce, &d)
+	return d, ok, err
+}
+
+// GetDel reads and removes a challenge in one step when the KV is a
+// core.AtomicEphemeralStore.
+func (c *SIWSCache) GetDel(ctx context.Context, nonce string) (siws.ChallengeData, bool, error) {
+	var d siws.ChallengeData
+	ok, err := getDelJSON(ctx, c.kv, c.keyNS+nonce, &d)
+	return d, ok, err
+}
+
+func (c *SIWSCache) Del(ctx context.Context, nonce string) error {
+	return c.kv.Del(ctx, c.keyNS+nonce)
+}
+
+// getDelJSON consumes key; KVs without GetDel fall back to Get followed by Del.
+func getDelJSON(ctx context.Context, kv core.EphemeralStore, key string, out any) (bool, error) {
+	as, ok := kv.(core.AtomicEphemeralStore)
+	if !ok {
+		found, err := getJSON(ctx, kv, key, out)
+		if err != nil || !found {
+			return false, err
+		}
+		return true, kv.Del(ctx, key)
+	}
+	b, found, err := as.GetDel(ctx, key)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func getJSON(ctx context.Context, kv core.EphemeralStore, key string, out any) (bool, error) {
+	b, ok, err := kv.Get(ctx, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,124 @@
+package postgresstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	core "github.com/open-rails/authkit/core"
+)
+
+// KV implements core.AtomicEphemeralStore on the unlogged profiles.ephemeral_kv table
+// (migration 012). Use it with core.EphemeralPostgres in multi-instance deployments that
+// run Postgres but not Redis.
+//
+// Expired rows are invisible to every operation; PruneExpired deletes them and is run
+// periodically by riverjobs.RegisterSweepEphemeralWorker.
+type KV struct {
+	pg *pgxpool.Pool
+}
+
+var _ core.AtomicEphemeralStore = (*KV)(nil)
+
+// NewKV returns a KV backed by pool.
+func NewKV(pool *pgxpool.Pool) *KV {
+	return &KV{pg: pool}
+}
+
+// expiresAt converts a TTL to the stored expiry; a zero TTL never expires.
+func expiresAt(ttl time.Duration) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	t := time.Now().Add(ttl).UTC()
+	return &t
+}
+
+func (k *KV) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var b []byte
+	err := k.pg.QueryRow(ctx, `
+		SELECT value FROM profiles.ephemeral_kv
+		WHERE key = $1 AND (expires_at IS NULL OR expires_at > now())`, key).Scan(&b)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (k *KV) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := k.pg.Exec(ctx, `
+		INSERT INTO profiles.ephemeral_kv (key, value, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`,
+		key, value, expiresAt(ttl))
+	return err
+}
+
+func (k *KV) Del(ctx context.Context, key string) error {
+	_, err := k.pg.Exec(ctx, `DELETE FROM profiles.ephemeral_kv WHERE key = $1`, key)
+	return err
+}
+
+// GetDel deletes key and returns its value. An expired row is deleted too but reported
+// as missing; expiry is decided by the database clock, as in every other operation.
+func (k *KV) GetDel(ctx context.Context, key string) ([]byte, bool, error) {
+	var (
+		b    []byte
+		live bool
+	)
+	err := k.pg.QueryRow(ctx, `
+		DELETE FROM profiles.ephemeral_kv WHERE key = $1
+		RETURNING value, (expires_at IS NULL OR expires_at > now())`, key).Scan(&b, &live)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !live {
+		return nil, false, nil
+	}
+	return b, true, nil
+}
+
+func (k *KV) CompareAndDelete(ctx context.Context, key string, expected []byte) (bool, error) {
+	tag, err := k.pg.Exec(ctx, `
+		DELETE FROM profiles.ephemeral_kv
+		WHERE key = $1 AND value = $2 AND (expires_at IS NULL OR expires_at > now())`, key, expected)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SetNX inserts key, replacing it only when the existing row has expired.
+func (k *KV) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	tag, err := k.pg.Exec(ctx, `
+		INSERT INTO profiles.ephemeral_kv (key, value, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at
+		WHERE profiles.ephemeral_kv.expires_at IS NOT NULL AND profiles.ephemeral_kv.expires_at <= now()`,
+		key, value, expiresAt(ttl))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// PruneExpired deletes up to limit expired keys and returns how many were removed.
+func (k *KV) PruneExpired(ctx context.Context, limit int) (int64, error) {
+	tag, err := k.pg.Exec(ctx, `
+		DELETE FROM profiles.ephemeral_kv
+		WHERE key IN (
+			SELECT key FROM profiles.ephemeral_kv
+			WHERE expires_at <= now()
+			LIMIT $1
+		)`, limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
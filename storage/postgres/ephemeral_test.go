@@ -0,0 +1,249 @@
+package postgresstore
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	migrations "github.com/open-rails/authkit/migrations/postgres"
+	oidckit "github.com/open-rails/authkit/oidc"
+	"github.com/open-rails/authkit/riverjobs"
+	"github.com/open-rails/authkit/siws"
+	"github.com/riverqueue/river"
+)
+
+// testKV connects to AUTHKIT_TEST_POSTGRES_URL, applies the ephemeral_kv migration and
+// returns a KV plus a key prefix unique to the test. Tests are skipped when the variable
+// is unset.
+func testKV(t *testing.T) (*KV, *pgxpool.Pool, string) {
+	t.Helper()
+	dsn := os.Getenv("AUTHKIT_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("AUTHKIT_TEST_POSTGRES_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	ddl, err := migrations.FS.ReadFile("012_ephemeral_kv.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS profiles"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, string(ddl)); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := "test:" + t.Name() + ":" + time.Now().Format("150405.000000000") + ":"
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), `DELETE FROM profiles.ephemeral_kv WHERE key LIKE $1`, prefix+"%")
+	})
+	return NewKV(pool), pool, prefix
+}
+
+// putExpired stores key with an expiry already in the past by the database clock.
+func putExpired(t *testing.T, pool *pgxpool.Pool, key string, value []byte) {
+	t.Helper()
+	_, err := pool.Exec(context.Background(), `
+		INSERT INTO profiles.ephemeral_kv (key, value, expires_at) VALUES ($1, $2, now() - interval '1 minute')
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`, key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKV_GetDel(t *testing.T) {
+	kv, pool, p := testKV(t)
+	ctx := context.Background()
+
+	if err := kv.Set(ctx, p+"k", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	b, ok, err := kv.GetDel(ctx, p+"k")
+	if err != nil || !ok || string(b) != "v" {
+		t.Fatalf("first GetDel = %q, %v, %v", b, ok, err)
+	}
+	if _, ok, err := kv.GetDel(ctx, p+"k"); err != nil || ok {
+		t.Fatalf("second GetDel should miss: ok=%v err=%v", ok, err)
+	}
+
+	putExpired(t, pool, p+"old", []byte("v"))
+	if _, ok, err := kv.GetDel(ctx, p+"old"); err != nil || ok {
+		t.Fatalf("expired GetDel should miss: ok=%v err=%v", ok, err)
+	}
+	var n int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM profiles.ephemeral_kv WHERE key = $1`, p+"old").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatal("expired row should be deleted by GetDel")
+	}
+}
+
+func TestKV_GetDelConcurrent(t *testing.T) {
+	kv, _, p := testKV(t)
+	ctx := context.Background()
+	if err := kv.Set(ctx, p+"k", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 8
+	wins := make(chan bool, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, ok, err := kv.GetDel(ctx, p+"k")
+			wins <- err == nil && ok
+		}()
+	}
+	won := 0
+	for i := 0; i < n; i++ {
+		if <-wins {
+			won++
+		}
+	}
+	if won != 1 {
+		t.Fatalf("GetDel succeeded %d times, want 1", won)
+	}
+}
+
+func TestKV_CompareAndDelete(t *testing.T) {
+	kv, pool, p := testKV(t)
+	ctx := context.Background()
+
+	if err := kv.Set(ctx, p+"k", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := kv.CompareAndDelete(ctx, p+"k", []byte("other")); err != nil || ok {
+		t.Fatalf("mismatched value deleted: ok=%v err=%v", ok, err)
+	}
+	if ok, err := kv.CompareAndDelete(ctx, p+"k", []byte("v")); err != nil || !ok {
+		t.Fatalf("matching value not deleted: ok=%v err=%v", ok, err)
+	}
+	if ok, err := kv.CompareAndDelete(ctx, p+"k", []byte("v")); err != nil || ok {
+		t.Fatalf("second delete succeeded: ok=%v err=%v", ok, err)
+	}
+
+	putExpired(t, pool, p+"old", []byte("v"))
+	if ok, err := kv.CompareAndDelete(ctx, p+"old", []byte("v")); err != nil || ok {
+		t.Fatalf("expired value deleted: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestKV_SetNX(t *testing.T) {
+	kv, pool, p := testKV(t)
+	ctx := context.Background()
+
+	if ok, err := kv.SetNX(ctx, p+"k", []byte("a"), time.Minute); err != nil || !ok {
+		t.Fatalf("first SetNX: ok=%v err=%v", ok, err)
+	}
+	if ok, err := kv.SetNX(ctx, p+"k", []byte("b"), time.Minute); err != nil || ok {
+		t.Fatalf("SetNX over live key: ok=%v err=%v", ok, err)
+	}
+	if b, _, _ := kv.Get(ctx, p+"k"); string(b) != "a" {
+		t.Fatalf("live value overwritten: %q", b)
+	}
+
+	putExpired(t, pool, p+"old", []byte("a"))
+	if ok, err := kv.SetNX(ctx, p+"old", []byte("b"), time.Minute); err != nil || !ok {
+		t.Fatalf("SetNX over expired key: ok=%v err=%v", ok, err)
+	}
+	if b, ok, _ := kv.Get(ctx, p+"old"); !ok || string(b) != "b" {
+		t.Fatalf("expired value not replaced: %q, %v", b, ok)
+	}
+}
+
+func TestKV_TTLExpiry(t *testing.T) {
+	kv, _, p := testKV(t)
+	ctx := context.Background()
+
+	if err := kv.Set(ctx, p+"k", []byte("v"), 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := kv.Get(ctx, p+"k"); !ok {
+		t.Fatal("key should be readable before its TTL")
+	}
+	time.Sleep(time.Second)
+	if _, ok, err := kv.Get(ctx, p+"k"); err != nil || ok {
+		t.Fatalf("key readable after its TTL: ok=%v err=%v", ok, err)
+	}
+
+	if err := kv.Set(ctx, p+"forever", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := kv.Get(ctx, p+"forever"); !ok {
+		t.Fatal("zero TTL should never expire")
+	}
+}
+
+func TestCaches_ConsumeOnce(t *testing.T) {
+	kv, _, p := testKV(t)
+	ctx := context.Background()
+
+	states := NewStateCache(kv, p+"state:", time.Minute)
+	if err := states.Put(ctx, "s1", oidckit.StateData{Provider: "google", Nonce: "n"}); err != nil {
+		t.Fatal(err)
+	}
+	sd, ok, err := oidckit.ConsumeState(ctx, states, "s1")
+	if err != nil || !ok || sd.Provider != "google" || sd.Nonce != "n" {
+		t.Fatalf("ConsumeState = %+v, %v, %v", sd, ok, err)
+	}
+	if _, ok, err := oidckit.ConsumeState(ctx, states, "s1"); err != nil || ok {
+		t.Fatalf("state consumed twice: ok=%v err=%v", ok, err)
+	}
+
+	challenges := NewSIWSCache(kv, p+"siws:", time.Minute)
+	if err := challenges.Put(ctx, "n1", siws.ChallengeData{Address: "addr"}); err != nil {
+		t.Fatal(err)
+	}
+	cd, ok, err := siws.ConsumeChallenge(ctx, challenges, "n1")
+	if err != nil || !ok || cd.Address != "addr" {
+		t.Fatalf("ConsumeChallenge = %+v, %v, %v", cd, ok, err)
+	}
+	if _, ok, err := siws.ConsumeChallenge(ctx, challenges, "n1"); err != nil || ok {
+		t.Fatalf("challenge consumed twice: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestSweepEphemeralWorker(t *testing.T) {
+	kv, pool, p := testKV(t)
+	ctx := context.Background()
+
+	for _, k := range []string{"a", "b", "c"} {
+		putExpired(t, pool, p+k, []byte("v"))
+	}
+	if err := kv.Set(ctx, p+"live", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	w := riverjobs.NewSweepEphemeralWorker(kv)
+	if err := w.Work(ctx, &river.Job[riverjobs.SweepEphemeralArgs]{Args: riverjobs.SweepEphemeralArgs{BatchSize: 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := pool.Query(ctx, `SELECT key FROM profiles.ephemeral_kv WHERE key LIKE $1`, p+"%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			t.Fatal(err)
+		}
+		left = append(left, strings.TrimPrefix(k, p))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0] != "live" {
+		t.Fatalf("rows after sweep = %v, want [live]", left)
+	}
+}
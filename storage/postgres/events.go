@@ -0,0 +1,214 @@
+// Package postgresstore provides Postgres-backed implementations of AuthKit storage
+// interfaces for deployments that do not run ClickHouse or Redis.
+//
+// Tables are created by migrations/postgres and live in the profiles schema.
+package postgresstore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	core "github.com/open-rails/authkit/core"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// EventLog implements core.AuthEventLogger, core.AuthEventLogReader and
+// core.AuthEventLogPageReader on profiles.auth_session_events.
+//
+// Writes are synchronous single-row INSERTs; this suits low to moderate login volume. High
+// volume deployments should prefer storage/clickhouse.
+type EventLog struct {
+	pg *pgxpool.Pool
+}
+
+// NewEventLog returns an EventLog backed by pool.
+func NewEventLog(pool *pgxpool.Pool) *EventLog {
+	return &EventLog{pg: pool}
+}
+
+// LogSessionEvent inserts e. Callers treat the error as best-effort.
+func (l *EventLog) LogSessionEvent(ctx context.Context, e core.AuthSessionEvent) error {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	_, err := l.pg.Exec(ctx, `
+		INSERT INTO profiles.auth_session_events
+			(occurred_at, issuer, user_id, session_id, event, method, reason, ip_addr, user_agent, related_user_id, actor_user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		e.OccurredAt.UTC(), e.Issuer, e.UserID, e.SessionID, string(e.Event),
+		e.Method, e.Reason, e.IPAddr, e.UserAgent, e.RelatedUserID, e.ActorUserID,
+	)
+	return err
+}
+
+// ListSessionEvents returns the newest page (up to 1000) of matching events.
+func (l *EventLog) ListSessionEvents(ctx context.Context, userID string, eventTypes ...core.SessionEventType) ([]core.AuthSessionEvent, error) {
+	page, err := l.ListSessionEventsPage(ctx, core.SessionEventQuery{UserID: userID, EventTypes: eventTypes, Limit: maxPageSize})
+	return page.Events, err
+}
+
+// ListSessionEventsPage returns events newest first using keyset pagination on (occurred_at, id).
+func (l *EventLog) ListSessionEventsPage(ctx context.Context, q core.SessionEventQuery) (core.SessionEventPage, error) {
+	sql, args, limit, err := buildPageQuery(q)
+	if err != nil {
+		return core.SessionEventPage{}, err
+	}
+	rows, err := l.pg.Query(ctx, sql, args...)
+	if err != nil {
+		return core.SessionEventPage{}, err
+	}
+	defer rows.Close()
+
+	events := make([]core.AuthSessionEvent, 0, limit)
+	var lastID int64
+	more := false
+	for rows.Next() {
+		if len(events) == limit {
+			more = true
+			break
+		}
+		var (
+			id    int64
+			e     core.AuthSessionEvent
+			event string
+		)
+		if err := rows.Scan(&id, &e.OccurredAt, &e.Issuer, &e.UserID, &e.SessionID, &event,
+			&e.Method, &e.Reason, &e.IPAddr, &e.UserAgent, &e.RelatedUserID, &e.ActorUserID); err != nil {
+			return core.SessionEventPage{}, err
+		}
+		e.Event = core.SessionEventType(event)
+		events = append(events, e)
+		lastID = id
+	}
+	if err := rows.Err(); err != nil {
+		return core.SessionEventPage{}, err
+	}
+	page := core.SessionEventPage{Events: events}
+	if more {
+		last := events[len(events)-1]
+		page.NextCursor = encodeCursor(pageCursor{TS: last.OccurredAt.UnixMicro(), ID: lastID})
+	}
+	return page, nil
+}
+
+// PruneBefore deletes up to limit events older than cutoff and returns how many were removed.
+// Deleting in bounded batches keeps each transaction short on large tables.
+func (l *EventLog) PruneBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	return l.PruneRange(ctx, time.Time{}, cutoff, limit)
+}
+
+// PruneRange deletes up to limit events in [since, until) and returns how many were
+// removed; the bounds match SessionEventQuery. A zero since has no lower bound; until is
+// required.
+func (l *EventLog) PruneRange(ctx context.Context, since, until time.Time, limit int) (int64, error) {
+	if until.IsZero() {
+		return 0, errors.New("postgresstore: prune requires an upper bound")
+	}
+	sql, args := buildPruneQuery(since, until, limit)
+	tag, err := l.pg.Exec(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// buildPruneQuery renders the batched DELETE for [since, until).
+func buildPruneQuery(since, until time.Time, limit int) (string, []any) {
+	if limit <= 0 {
+		limit = 5000
+	}
+	where := "occurred_at < $1"
+	args := []any{until}
+	if !since.IsZero() {
+		where += " AND occurred_at >= $2"
+		args = append(args, since)
+	}
+	args = append(args, limit)
+	sql := `
+		DELETE FROM profiles.auth_session_events
+		WHERE id IN (
+			SELECT id FROM profiles.auth_session_events
+			WHERE ` + where + `
+			LIMIT $` + strconv.Itoa(len(args)) + `
+		)`
+	return sql, args
+}
+
+// buildPageQuery renders the page SELECT for q. It over-fetches by one row so the caller
+// can tell whether another page exists.
+func buildPageQuery(q core.SessionEventQuery) (string, []any, int, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if q.UserID != "" {
+		where = append(where, "user_id = "+arg(q.UserID))
+	}
+	if len(q.EventTypes) > 0 {
+		types := make([]string, len(q.EventTypes))
+		for i, t := range q.EventTypes {
+			types[i] = string(t)
+		}
+		where = append(where, "event = ANY("+arg(types)+")")
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "occurred_at >= "+arg(q.Since))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "occurred_at < "+arg(q.Until))
+	}
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return "", nil, 0, err
+		}
+		where = append(where, "(occurred_at, id) < ("+arg(time.UnixMicro(c.TS).UTC())+", "+arg(c.ID)+")")
+	}
+
+	sql := "SELECT id, occurred_at, issuer, user_id, session_id, event, method, reason, ip_addr, user_agent, related_user_id, actor_user_id FROM profiles.auth_session_events"
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	sql += " ORDER BY occurred_at DESC, id DESC LIMIT " + arg(limit+1)
+	return sql, args, limit, nil
+}
+
+// pageCursor identifies the last row of a page in (occurred_at, id) order.
+type pageCursor struct {
+	TS int64 `json:"t"` // unix microseconds (timestamptz precision)
+	ID int64 `json:"i"`
+}
+
+func encodeCursor(c pageCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.TS <= 0 || c.ID <= 0 {
+		return pageCursor{}, core.ErrInvalidCursor
+	}
+	return c, nil
+}
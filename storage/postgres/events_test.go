@@ -0,0 +1,64 @@
+package postgresstore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	core "github.com/open-rails/authkit/core"
+)
+
+func TestBuildPageQuery_FiltersAndCursor(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	cursor := encodeCursor(pageCursor{TS: since.Add(time.Hour + 1500*time.Microsecond).UnixMicro(), ID: 42})
+
+	sql, args, limit, err := buildPageQuery(core.SessionEventQuery{
+		UserID:     "u1",
+		EventTypes: []core.SessionEventType{core.SessionEventCreated, core.SessionEventFailed},
+		Since:      since,
+		Until:      until,
+		Limit:      5000,
+		Cursor:     cursor,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit != maxPageSize {
+		t.Fatalf("limit should be capped at %d, got %d", maxPageSize, limit)
+	}
+	want := "WHERE user_id = $1 AND event = ANY($2) AND occurred_at >= $3 AND occurred_at < $4 AND (occurred_at, id) < ($5, $6) ORDER BY occurred_at DESC, id DESC LIMIT $7"
+	if !strings.HasSuffix(sql, want) {
+		t.Fatalf("unexpected query: %s", sql)
+	}
+	if len(args) != 7 || args[0] != "u1" || args[5] != int64(42) || args[6] != maxPageSize+1 {
+		t.Fatalf("unexpected args: %v", args)
+	}
+	if types, ok := args[1].([]string); !ok || len(types) != 2 || types[1] != "session_failed" {
+		t.Fatalf("event types not bound as text[]: %#v", args[1])
+	}
+	if ts, ok := args[4].(time.Time); !ok || !ts.Equal(since.Add(time.Hour+1500*time.Microsecond)) {
+		t.Fatalf("cursor timestamp lost precision: %v", args[4])
+	}
+
+	sql, args, limit, err = buildPageQuery(core.SessionEventQuery{})
+	if err != nil || strings.Contains(sql, "WHERE") || limit != defaultPageSize || len(args) != 1 {
+		t.Fatalf("unexpected unfiltered query: %s %v %d %v", sql, args, limit, err)
+	}
+
+	if _, _, _, err := buildPageQuery(core.SessionEventQuery{Cursor: "garbage"}); err != core.ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestBuildPruneQuery_Bounds(t *testing.T) {
+	until := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	sql, args := buildPruneQuery(time.Time{}, until, 0)
+	if !strings.Contains(sql, "WHERE occurred_at < $1\n") || !strings.Contains(sql, "LIMIT $2") || len(args) != 2 || args[1] != 5000 {
+		t.Fatalf("unexpected unbounded prune: %s %v", sql, args)
+	}
+	sql, args = buildPruneQuery(until.Add(-24*time.Hour), until, 10)
+	if !strings.Contains(sql, "WHERE occurred_at < $1 AND occurred_at >= $2") || !strings.Contains(sql, "LIMIT $3") || len(args) != 3 || args[2] != 10 {
+		t.Fatalf("unexpected bounded prune: %s %v", sql, args)
+	}
+}
@@ -7,6 +7,14 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// compareAndDelete deletes KEYS[1] only if it holds ARGV[1].
+var compareAndDelete = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
 // KV is a Redis-backed ephemeral key-value store with TTL support.
 type KV struct {
 	rdb *redis.Client
@@ -34,3 +42,27 @@ func (k *KV) Set(ctx context.Context, key string, value []byte, ttl time.Duratio
 func (k *KV) Del(ctx context.Context, key string) error {
 	return k.rdb.Del(ctx, key).Err()
 }
+
+// GetDel requires Redis 6.2 or later.
+func (k *KV) GetDel(ctx context.Context, key string) ([]byte, bool, error) {
+	b, err := k.rdb.GetDel(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (k *KV) CompareAndDelete(ctx context.Context, key string, expected []byte) (bool, error) {
+	n, err := compareAndDelete.Run(ctx, k.rdb, []string{key}, expected).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (k *KV) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return k.rdb.SetNX(ctx, key, value, ttl).Result()
+}
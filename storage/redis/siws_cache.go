@@ -6,14 +6,18 @@ import (
 	"time"
 
 	"github.com/open-rails/authkit/siws"
+	encryptedstore "github.com/open-rails/authkit/storage/encrypted"
 	"github.com/redis/go-redis/v9"
 )
 
+var _ siws.AtomicChallengeCache = (*SIWSCache)(nil)
+
 // SIWSCache stores pending SIWS challenges in Redis.
 type SIWSCache struct {
 	rdb   *redis.Client
 	keyNS string
 	ttl   time.Duration
+	keys  *encryptedstore.Keyring
 }
 
 // NewSIWSCache creates a new Redis-backed SIWS challenge cache.
@@ -27,6 +31,12 @@ func NewSIWSCache(rdb *redis.Client, keyPrefix string, ttl time.Duration) *SIWSC
 	return &SIWSCache{rdb: rdb, keyNS: keyPrefix, ttl: ttl}
 }
 
+// WithKeyring encrypts stored challenges with keys.
+func (c *SIWSCache) WithKeyring(keys *encryptedstore.Keyring) *SIWSCache {
+	c.keys = keys
+	return c
+}
+
 func (c *SIWSCache) key(nonce string) string { return c.keyNS + nonce }
 
 // Put stores a challenge in Redis.
@@ -35,18 +45,37 @@ func (c *SIWSCache) Put(ctx context.Context, nonce string, data siws.ChallengeDa
 	if err != nil {
 		return err
 	}
+	if c.keys != nil {
+		if b, err = c.keys.Seal(c.key(nonce), b); err != nil {
+			return err
+		}
+	}
 	return c.rdb.Set(ctx, c.key(nonce), b, c.ttl).Err()
 }
 
 // Get retrieves a challenge from Redis.
 func (c *SIWSCache) Get(ctx context.Context, nonce string) (siws.ChallengeData, bool, error) {
-	val, err := c.rdb.Get(ctx, c.key(nonce)).Bytes()
+	return c.decode(nonce, c.rdb.Get(ctx, c.key(nonce)))
+}
+
+// GetDel retrieves and removes a challenge in one step (Redis 6.2 or later).
+func (c *SIWSCache) GetDel(ctx context.Context, nonce string) (siws.ChallengeData, bool, error) {
+	return c.decode(nonce, c.rdb.GetDel(ctx, c.key(nonce)))
+}
+
+func (c *SIWSCache) decode(nonce string, cmd *redis.StringCmd) (siws.ChallengeData, bool, error) {
+	val, err := cmd.Bytes()
 	if err == redis.Nil {
 		return siws.ChallengeData{}, false, nil
 	}
 	if err != nil {
 		return siws.ChallengeData{}, false, err
 	}
+	if c.keys != nil {
+		if val, err = c.keys.Open(c.key(nonce), val); err != nil {
+			return siws.ChallengeData{}, false, nil
+		}
+	}
 	var d siws.ChallengeData
 	if err := json.Unmarshal(val, &d); err != nil {
 		return siws.ChallengeData{}, false, err
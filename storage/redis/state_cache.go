@@ -6,13 +6,17 @@ import (
 	"time"
 
 	oidckit "github.com/open-rails/authkit/oidc"
+	encryptedstore "github.com/open-rails/authkit/storage/encrypted"
 	"github.com/redis/go-redis/v9"
 )
 
+var _ oidckit.AtomicStateCache = (*StateCache)(nil)
+
 type StateCache struct {
 	rdb   *redis.Client
 	keyNS string
 	ttl   time.Duration
+	keys  *encryptedstore.Keyring
 }
 
 func NewStateCache(rdb *redis.Client, keyPrefix string, ttl time.Duration) *StateCache {
@@ -25,6 +29,12 @@ func NewStateCache(rdb *redis.Client, keyPrefix string, ttl time.Duration) *Stat
 	return &StateCache{rdb: rdb, keyNS: keyPrefix, ttl: ttl}
 }
 
+// WithKeyring encrypts stored state (PKCE verifier, nonce, link user) with keys.
+func (s *StateCache) WithKeyring(keys *encryptedstore.Keyring) *StateCache {
+	s.keys = keys
+	return s
+}
+
 func (s *StateCache) key(state string) string { return s.keyNS + state }
 
 func (s *StateCache) Put(ctx context.Context, state string, data oidckit.StateData) error {
@@ -32,17 +42,36 @@ func (s *StateCache) Put(ctx context.Context, state string, data oidckit.StateDa
 	if err != nil {
 		return err
 	}
+	if s.keys != nil {
+		if b, err = s.keys.Seal(s.key(state), b); err != nil {
+			return err
+		}
+	}
 	return s.rdb.Set(ctx, s.key(state), b, s.ttl).Err()
 }
 
 func (s *StateCache) Get(ctx context.Context, state string) (oidckit.StateData, bool, error) {
-	val, err := s.rdb.Get(ctx, s.key(state)).Bytes()
+	return s.decode(state, s.rdb.Get(ctx, s.key(state)))
+}
+
+// GetDel retrieves and removes state in one step (Redis 6.2 or later).
+func (s *StateCache) GetDel(ctx context.Context, state string) (oidckit.StateData, bool, error) {
+	return s.decode(state, s.rdb.GetDel(ctx, s.key(state)))
+}
+
+func (s *StateCache) decode(state string, cmd *redis.StringCmd) (oidckit.StateData, bool, error) {
+	val, err := cmd.Bytes()
 	if err == redis.Nil {
 		return oidckit.StateData{}, false, nil
 	}
 	if err != nil {
 		return oidckit.StateData{}, false, err
 	}
+	if s.keys != nil {
+		if val, err = s.keys.Open(s.key(state), val); err != nil {
+			return oidckit.StateData{}, false, nil
+		}
+	}
 	var d oidckit.StateData
 	if err := json.Unmarshal(val, &d); err != nil {
 		return oidckit.StateData{}, false, err
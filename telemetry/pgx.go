@@ -0,0 +1,36 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PgxTracer returns a pgx.QueryTracer that records a client span per query. Install it
+// on the pool AuthKit uses:
+//
+//	cfg, _ := pgxpool.ParseConfig(dsn)
+//	cfg.ConnConfig.Tracer = tel.PgxTracer()
+//
+// Query arguments are never recorded.
+func (t *Telemetry) PgxTracer() pgx.QueryTracer { return pgxTracer{t: t} }
+
+type pgxTracer struct{ t *Telemetry }
+
+func (p pgxTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = p.t.Start(ctx, "postgres.query",
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.statement", data.SQL),
+	)
+	return ctx
+}
+
+func (p pgxTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err == nil {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	End(span, data.Err)
+}
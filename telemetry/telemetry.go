@@ -0,0 +1,152 @@
+// Package telemetry provides optional OpenTelemetry tracing and metrics for AuthKit.
+//
+// A nil *Telemetry is valid and records nothing, so instrumented code never needs to
+// check whether telemetry was configured.
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// ScopeName is the instrumentation scope used for AuthKit tracers and meters.
+const ScopeName = "github.com/open-rails/authkit"
+
+// Config selects the OpenTelemetry providers. Nil providers disable that signal.
+type Config struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+	// Propagator extracts incoming trace context in Middleware.
+	// Default: otel.GetTextMapPropagator().
+	Propagator propagation.TextMapPropagator
+}
+
+// Telemetry holds the tracer and instruments used across AuthKit.
+type Telemetry struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+
+	loginSuccess   metric.Int64Counter
+	loginFailure   metric.Int64Counter
+	tokensIssued   metric.Int64Counter
+	refreshReuse   metric.Int64Counter
+	rateLimitHits  metric.Int64Counter
+	senderMessages metric.Int64Counter
+	httpDuration   metric.Float64Histogram
+}
+
+var noopTracer = tracenoop.NewTracerProvider().Tracer(ScopeName)
+
+// New builds a Telemetry from cfg. Instrument creation errors leave that instrument disabled.
+func New(cfg Config) *Telemetry {
+	t := &Telemetry{tracer: noopTracer, propagator: cfg.Propagator}
+	if t.propagator == nil {
+		t.propagator = otel.GetTextMapPropagator()
+	}
+	if cfg.TracerProvider != nil {
+		t.tracer = cfg.TracerProvider.Tracer(ScopeName)
+	}
+	if cfg.MeterProvider != nil {
+		m := cfg.MeterProvider.Meter(ScopeName)
+		t.loginSuccess, _ = m.Int64Counter("authkit.login.success",
+			metric.WithDescription("Successful logins by method."))
+		t.loginFailure, _ = m.Int64Counter("authkit.login.failure",
+			metric.WithDescription("Failed logins by method and reason."))
+		t.tokensIssued, _ = m.Int64Counter("authkit.tokens.issued",
+			metric.WithDescription("Issued tokens by kind (access, refresh)."))
+		t.refreshReuse, _ = m.Int64Counter("authkit.refresh.reuse_detected",
+			metric.WithDescription("Refresh token reuse detections (token family revoked)."))
+		t.rateLimitHits, _ = m.Int64Counter("authkit.ratelimit.hits",
+			metric.WithDescription("Requests rejected by the rate limiter, by bucket."))
+		t.senderMessages, _ = m.Int64Counter("authkit.sender.messages",
+			metric.WithDescription("Outbound email/SMS messages by channel, template and outcome."))
+		t.httpDuration, _ = m.Float64Histogram("authkit.http.server.duration",
+			metric.WithDescription("Duration of AuthKit HTTP requests by route and status."),
+			metric.WithUnit("s"))
+	}
+	return t
+}
+
+// Enabled reports whether t records anything.
+func (t *Telemetry) Enabled() bool { return t != nil }
+
+// Start starts a span named name. With a nil Telemetry the returned span is a no-op.
+func (t *Telemetry) Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tr := noopTracer
+	if t != nil {
+		tr = t.tracer
+	}
+	return tr.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err (if any) on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// LoginSucceeded counts a successful login (method e.g. password_login, oidc_login).
+func (t *Telemetry) LoginSucceeded(ctx context.Context, method string) {
+	if t == nil || t.loginSuccess == nil {
+		return
+	}
+	t.loginSuccess.Add(ctx, 1, metric.WithAttributes(attribute.String("method", method)))
+}
+
+// LoginFailed counts a failed login attempt.
+func (t *Telemetry) LoginFailed(ctx context.Context, method, reason string) {
+	if t == nil || t.loginFailure == nil {
+		return
+	}
+	t.loginFailure.Add(ctx, 1, metric.WithAttributes(attribute.String("method", method), attribute.String("reason", reason)))
+}
+
+// TokenIssued counts an issued token of the given kind ("access" or "refresh").
+func (t *Telemetry) TokenIssued(ctx context.Context, kind string) {
+	if t == nil || t.tokensIssued == nil {
+		return
+	}
+	t.tokensIssued.Add(ctx, 1, metric.WithAttributes(attribute.String("kind", kind)))
+}
+
+// RefreshReuseDetected counts a replayed refresh token.
+func (t *Telemetry) RefreshReuseDetected(ctx context.Context) {
+	if t == nil || t.refreshReuse == nil {
+		return
+	}
+	t.refreshReuse.Add(ctx, 1)
+}
+
+// RateLimited counts a request rejected by the rate limiter.
+func (t *Telemetry) RateLimited(ctx context.Context, bucket string) {
+	if t == nil || t.rateLimitHits == nil {
+		return
+	}
+	t.rateLimitHits.Add(ctx, 1, metric.WithAttributes(attribute.String("bucket", bucket)))
+}
+
+// MessageSent counts an outbound message; err != nil marks it failed.
+func (t *Telemetry) MessageSent(ctx context.Context, channel, template string, err error) {
+	if t == nil || t.senderMessages == nil {
+		return
+	}
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	t.senderMessages.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("channel", channel),
+		attribute.String("template", template),
+		attribute.String("outcome", outcome),
+	))
+}
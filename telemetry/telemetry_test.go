@@ -0,0 +1,99 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNilTelemetryIsNoop(t *testing.T) {
+	var tel *Telemetry
+	ctx, span := tel.Start(context.Background(), "op")
+	End(span, errors.New("boom"))
+	tel.LoginSucceeded(ctx, "password_login")
+	tel.LoginFailed(ctx, "password_login", "invalid_credentials")
+	tel.RateLimited(ctx, "auth_password_login")
+	tel.MessageSent(ctx, "email", "login_code", nil)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if got := tel.Middleware(h); got == nil {
+		t.Fatal("Middleware returned nil")
+	}
+	if tel.HTTPClient(nil) != http.DefaultClient {
+		t.Fatal("nil telemetry should return the base client")
+	}
+}
+
+func TestMiddleware_NamesSpanAfterRoute(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	tel := New(Config{TracerProvider: tp})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /auth/user/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	rec := httptest.NewRecorder()
+	tel.Middleware(mux).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/user/123", nil))
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Name != "GET /auth/user/{id}" {
+		t.Fatalf("span name = %q", spans[0].Name)
+	}
+	var status int64
+	for _, a := range spans[0].Attributes {
+		if a.Key == "http.response.status_code" {
+			status = a.Value.AsInt64()
+		}
+	}
+	if status != http.StatusTeapot {
+		t.Fatalf("status attribute = %d", status)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	tel := New(Config{MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))})
+	ctx := context.Background()
+
+	tel.RateLimited(ctx, "auth_password_login")
+	tel.RateLimited(ctx, "auth_password_login")
+	tel.LoginFailed(ctx, "password_login", "invalid_credentials")
+	tel.MessageSent(ctx, "sms", "login_code", errors.New("down"))
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				got[m.Name] += dp.Value
+				if m.Name == "authkit.sender.messages" {
+					if v, _ := dp.Attributes.Value(attribute.Key("outcome")); v.AsString() != "error" {
+						t.Fatalf("sender outcome = %q", v.AsString())
+					}
+				}
+			}
+		}
+	}
+	if got["authkit.ratelimit.hits"] != 2 || got["authkit.login.failure"] != 1 || got["authkit.sender.messages"] != 1 {
+		t.Fatalf("unexpected counters: %v", got)
+	}
+}
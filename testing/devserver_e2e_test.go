@@ -319,6 +319,11 @@ func TestDevserverE2E(t *testing.T) {
 		c.run(t, "-f", composeFile, "-f", overridePath, "exec", "-T", "postgres",
 			"psql", "-U", "admin", "-d", "authkit_db", "-v", "ON_ERROR_STOP=1", "-c", sql)
 	}
+	queryPSQL := func(t *testing.T, sql string) string {
+		t.Helper()
+		return c.run(t, "-f", composeFile, "-f", overridePath, "exec", "-T", "postgres",
+			"psql", "-U", "admin", "-d", "authkit_db", "-v", "ON_ERROR_STOP=1", "-tA", "-c", sql)
+	}
 
 	t.Run("minted_token_can_call_user_me", func(t *testing.T) {
 		userID := "11111111-1111-1111-1111-111111111111"
@@ -446,4 +451,178 @@ func TestDevserverE2E(t *testing.T) {
 			t.Fatalf("expected 401 after logout, got %d: %s", refreshResp2.StatusCode, string(refreshBody2))
 		}
 	})
+
+	t.Run("admin_merge_users_transaction", func(t *testing.T) {
+		adminID := "33333333-3333-3333-3333-333333333333"
+		sourceID := "44444444-4444-4444-4444-444444444444"
+		targetID := "55555555-5555-5555-5555-555555555555"
+		otherID := "66666666-6666-6666-6666-666666666666"
+		execPSQL(t, fmt.Sprintf(
+			"INSERT INTO profiles.users (id, email, username, email_verified, created_at, updated_at) VALUES (%q, 'merge-admin@example.com', 'mergeadmin', true, now(), now()), (%q, 'merge-src@example.com', 'mergesrc', true, now(), now()), (%q, NULL, 'mergetgt', false, now(), now()), (%q, 'merge-other@example.com', 'mergeother', true, now(), now());",
+			adminID, sourceID, targetID, otherID,
+		))
+		execPSQL(t, "INSERT INTO profiles.roles (name, slug) VALUES ('Admin', 'admin'), ('Editor', 'editor') ON CONFLICT (slug) DO NOTHING;")
+		execPSQL(t, fmt.Sprintf(
+			"INSERT INTO profiles.user_roles (user_id, role_id) VALUES (%q, profiles.role_id('admin')), (%q, profiles.role_id('editor'));",
+			adminID, sourceID,
+		))
+		execPSQL(t, fmt.Sprintf(
+			"INSERT INTO profiles.user_passwords (user_id, password_hash, hash_algo) VALUES (%q, 'hash', 'argon2id');",
+			sourceID,
+		))
+		execPSQL(t, fmt.Sprintf(
+			"INSERT INTO profiles.user_providers (user_id, issuer, provider_slug, subject) VALUES (%q, 'https://accounts.google.com', 'google', 'g-src'), (%q, 'https://github.com', 'github', 'gh-other'), (%q, 'https://github.com', 'github', 'gh-tgt');",
+			sourceID, otherID, targetID,
+		))
+		auth := map[string]string{"Authorization": "Bearer " + mint(t, adminID, 300)}
+
+		// Both accounts link the same issuer: the merge is refused and nothing moves.
+		resp, body := httpJSON(t, http.MethodPost, baseURL+"/auth/admin/users/merge", auth, map[string]any{
+			"source_user_id": otherID,
+			"target_user_id": targetID,
+		})
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("conflicting merge: expected 409, got %d: %s", resp.StatusCode, string(body))
+		}
+		if got := queryPSQL(t, fmt.Sprintf("SELECT deleted_at IS NULL FROM profiles.users WHERE id=%q;", otherID)); got != "t" {
+			t.Fatalf("refused merge must roll back, deleted_at IS NULL = %q", got)
+		}
+
+		resp, body = httpJSON(t, http.MethodPost, baseURL+"/auth/admin/users/merge", auth, map[string]any{
+			"source_user_id": sourceID,
+			"target_user_id": targetID,
+		})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("merge: expected 200, got %d: %s", resp.StatusCode, string(body))
+		}
+		checks := map[string]string{
+			fmt.Sprintf("SELECT deleted_at IS NOT NULL AND email IS NULL FROM profiles.users WHERE id=%q;", sourceID):                  "t",
+			fmt.Sprintf("SELECT email || ' ' || email_verified FROM profiles.users WHERE id=%q;", targetID):                            "merge-src@example.com true",
+			fmt.Sprintf("SELECT count(*) FROM profiles.user_providers WHERE user_id=%q;", targetID):                                    "2",
+			fmt.Sprintf("SELECT count(*) FROM profiles.user_roles WHERE user_id=%q AND role_id=profiles.role_id('editor');", targetID): "1",
+			fmt.Sprintf("SELECT count(*) FROM profiles.user_passwords WHERE user_id=%q;", targetID):                                    "1",
+			fmt.Sprintf("SELECT count(*) FROM profiles.user_roles WHERE user_id=%q;", sourceID):                                        "0",
+			fmt.Sprintf("SELECT count(*) FROM profiles.user_passwords WHERE user_id=%q;", sourceID):                                    "0",
+		}
+		for q, want := range checks {
+			if got := queryPSQL(t, q); got != want {
+				t.Fatalf("%s = %q, want %q", q, got, want)
+			}
+		}
+
+		// The source is soft-deleted, so it cannot be merged again.
+		resp, body = httpJSON(t, http.MethodPost, baseURL+"/auth/admin/users/merge", auth, map[string]any{
+			"source_user_id": sourceID,
+			"target_user_id": targetID,
+		})
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("repeat merge: expected 404, got %d: %s", resp.StatusCode, string(body))
+		}
+	})
+
+	// inboxLatest polls the dev inbox for the newest message matching the query.
+	inboxLatest := func(t *testing.T, query string) map[string]any {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			resp, body := httpJSON(t, http.MethodGet, baseURL+"/dev/inbox/messages/latest?"+query, nil, nil)
+			if resp.StatusCode == http.StatusOK {
+				var m map[string]any
+				if err := json.Unmarshal(body, &m); err != nil {
+					t.Fatalf("decode inbox message: %v", err)
+				}
+				return m
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("no inbox message for %s: %d %s", query, resp.StatusCode, string(body))
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	decodeTokens := func(t *testing.T, body []byte) (access string) {
+		t.Helper()
+		var out struct {
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.Unmarshal(body, &out); err != nil || out.AccessToken == "" {
+			t.Fatalf("expected access_token in %s", string(body))
+		}
+		return out.AccessToken
+	}
+
+	t.Run("inbox_registration_reset_and_2fa", func(t *testing.T) {
+		email := "inbox@example.com"
+		pass := "Password123!"
+		newPass := "Password456!"
+
+		// Registration: the verification code arrives in the dev inbox.
+		resp, body := httpJSON(t, http.MethodPost, baseURL+"/auth/register", nil, map[string]any{
+			"identifier": email,
+			"username":   "inboxuser",
+			"password":   pass,
+		})
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("register: expected 202, got %d: %s", resp.StatusCode, string(body))
+		}
+		msg := inboxLatest(t, "to="+email+"&template=email_verification_code")
+		resp, body = httpJSON(t, http.MethodPost, baseURL+"/auth/email/verify/confirm", nil, map[string]any{"code": msg["code"]})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("verify: expected 200, got %d: %s", resp.StatusCode, string(body))
+		}
+		access := decodeTokens(t, body)
+
+		// Password reset via the emailed token.
+		resp, body = httpJSON(t, http.MethodPost, baseURL+"/auth/password/reset/request", nil, map[string]any{"identifier": email})
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("reset request: expected 202, got %d: %s", resp.StatusCode, string(body))
+		}
+		msg = inboxLatest(t, "to="+email+"&template=password_reset_link")
+		resp, body = httpJSON(t, http.MethodPost, baseURL+"/auth/password/reset/confirm-link", nil, map[string]any{
+			"token":        msg["token"],
+			"new_password": newPass,
+		})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("reset confirm: expected 200, got %d: %s", resp.StatusCode, string(body))
+		}
+		resp, body = httpJSON(t, http.MethodPost, baseURL+"/auth/password/login", nil, map[string]any{"email": email, "password": newPass})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("login with new password: expected 200, got %d: %s", resp.StatusCode, string(body))
+		}
+		access = decodeTokens(t, body)
+
+		// Email 2FA: login now stops at a challenge and the code arrives in the inbox.
+		resp, body = httpJSON(t, http.MethodPost, baseURL+"/auth/user/2fa/enable", map[string]string{
+			"Authorization": "Bearer " + access,
+		}, map[string]any{"method": "email"})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("enable 2fa: expected 200, got %d: %s", resp.StatusCode, string(body))
+		}
+		resp, body = httpJSON(t, http.MethodPost, baseURL+"/auth/password/login", nil, map[string]any{"email": email, "password": newPass})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("2fa login: expected 200, got %d: %s", resp.StatusCode, string(body))
+		}
+		var challenge struct {
+			Requires2FA bool   `json:"requires_2fa"`
+			UserID      string `json:"user_id"`
+			Challenge   string `json:"challenge"`
+		}
+		if err := json.Unmarshal(body, &challenge); err != nil || !challenge.Requires2FA {
+			t.Fatalf("expected 2fa challenge, got %s", string(body))
+		}
+		msg = inboxLatest(t, "to="+email+"&template=login_code")
+		resp, body = httpJSON(t, http.MethodPost, baseURL+"/auth/2fa/verify", nil, map[string]any{
+			"user_id":   challenge.UserID,
+			"challenge": challenge.Challenge,
+			"code":      msg["code"],
+		})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("2fa verify: expected 200, got %d: %s", resp.StatusCode, string(body))
+		}
+		decodeTokens(t, body)
+
+		resp, _ = httpJSON(t, http.MethodGet, baseURL+"/dev/inbox/", nil, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("html inbox: expected 200, got %d", resp.StatusCode)
+		}
+	})
 }
@@ -0,0 +1,347 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	smsgateway "github.com/open-rails/authkit/adapters/sms/gateway"
+	"github.com/open-rails/authkit/core"
+	authlang "github.com/open-rails/authkit/lang"
+)
+
+// DefaultInboxCapacity is the number of messages an Inbox keeps before dropping the oldest.
+const DefaultInboxCapacity = 500
+
+// InboxMessage is an email or SMS captured by an Inbox. Code and Token carry the secret
+// AuthKit passed to the sender, so tests never need to parse Text.
+type InboxMessage struct {
+	ID        int64     `json:"id"`
+	Channel   string    `json:"channel"`  // "email" or "sms"
+	Template  string    `json:"template"` // e.g. "login_code", "password_reset_link"
+	To        string    `json:"to"`
+	Username  string    `json:"username,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	Link      string    `json:"link,omitempty"`
+	Text      string    `json:"text"`
+	Language  string    `json:"language,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Inbox captures messages from AuthKit's email and SMS senders for local development and
+// end-to-end tests. Wire it with:
+//
+//	inbox := testing.NewInbox()
+//	svc.WithEmailSender(inbox.EmailSender()).WithSMSSender(inbox.SMSSender())
+//	mux.Handle("/dev/inbox/", http.StripPrefix("/dev/inbox", inbox.Handler()))
+//
+// Never expose an Inbox in production: it reveals every code and reset token.
+type Inbox struct {
+	// ResetURL renders InboxMessage.Link for password reset messages; "{token}" is
+	// replaced with the token. Optional.
+	ResetURL string
+	// AppName is used in message texts.
+	AppName string
+
+	mu       sync.Mutex
+	nextID   int64
+	capacity int
+	messages []InboxMessage
+}
+
+// NewInbox returns an Inbox keeping up to DefaultInboxCapacity messages.
+func NewInbox() *Inbox {
+	return &Inbox{capacity: DefaultInboxCapacity}
+}
+
+// InboxFilter selects messages. Empty fields match everything.
+type InboxFilter struct {
+	To       string
+	Channel  string
+	Template string
+}
+
+func (f InboxFilter) match(m InboxMessage) bool {
+	return (f.To == "" || normalizeRecipient(f.To) == m.To) &&
+		(f.Channel == "" || f.Channel == m.Channel) &&
+		(f.Template == "" || f.Template == m.Template)
+}
+
+func normalizeRecipient(to string) string {
+	to = strings.TrimSpace(to)
+	if strings.Contains(to, "@") {
+		return strings.ToLower(to)
+	}
+	return to
+}
+
+func (in *Inbox) add(ctx context.Context, m InboxMessage) {
+	m.To = normalizeRecipient(m.To)
+	if m.Token != "" && in.ResetURL != "" && m.Template == core.MessageTemplatePasswordResetLink {
+		m.Link = strings.ReplaceAll(in.ResetURL, "{token}", url.QueryEscape(m.Token))
+	}
+	m.Language, _ = authlang.LanguageFromContext(ctx)
+	m.CreatedAt = time.Now().UTC()
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.nextID++
+	m.ID = in.nextID
+	in.messages = append(in.messages, m)
+	if capacity := in.capacity; capacity > 0 && len(in.messages) > capacity {
+		in.messages = append([]InboxMessage(nil), in.messages[len(in.messages)-capacity:]...)
+	}
+}
+
+// Messages returns matching messages, newest first. limit <= 0 returns all.
+func (in *Inbox) Messages(f InboxFilter, limit int) []InboxMessage {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	out := []InboxMessage{}
+	for i := len(in.messages) - 1; i >= 0; i-- {
+		if f.match(in.messages[i]) {
+			out = append(out, in.messages[i])
+			if limit > 0 && len(out) == limit {
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Latest returns the newest matching message.
+func (in *Inbox) Latest(f InboxFilter) (InboxMessage, bool) {
+	msgs := in.Messages(f, 1)
+	if len(msgs) == 0 {
+		return InboxMessage{}, false
+	}
+	return msgs[0], true
+}
+
+// LatestCode returns the code of the newest message to recipient that carries one.
+func (in *Inbox) LatestCode(to string) (string, bool) {
+	for _, m := range in.Messages(InboxFilter{To: to}, 0) {
+		if m.Code != "" {
+			return m.Code, true
+		}
+	}
+	return "", false
+}
+
+// Clear removes messages to recipient, or all messages when to is empty.
+func (in *Inbox) Clear(to string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if to == "" {
+		in.messages = nil
+		return
+	}
+	to = normalizeRecipient(to)
+	kept := in.messages[:0]
+	for _, m := range in.messages {
+		if m.To != to {
+			kept = append(kept, m)
+		}
+	}
+	in.messages = kept
+}
+
+// EmailSender returns a core.EmailSender (with password reset and data export links) writing to the inbox.
+func (in *Inbox) EmailSender() core.EmailSender { return inboxEmail{in} }
+
+// SMSSender returns a core.SMSSender (with password reset links) writing to the inbox.
+func (in *Inbox) SMSSender() core.SMSSender { return inboxSMS{in} }
+
+func (in *Inbox) appName() string {
+	if in.AppName != "" {
+		return in.AppName
+	}
+	return "AuthKit"
+}
+
+type inboxEmail struct{ in *Inbox }
+
+var (
+	_ core.EmailSenderWithPasswordResetLink = inboxEmail{}
+	_ core.EmailSenderWithDataExportLink    = inboxEmail{}
+	_ core.EmailSenderWithLinkAccountCode   = inboxEmail{}
+)
+
+func (e inboxEmail) SendPasswordResetCode(ctx context.Context, email, username, code string) error {
+	e.in.add(ctx, InboxMessage{Channel: "email", Template: "password_reset_code", To: email, Username: username, Code: code,
+		Text: fmt.Sprintf("Your %s password reset code is: %s", e.in.appName(), code)})
+	return nil
+}
+
+func (e inboxEmail) SendEmailVerificationCode(ctx context.Context, email, username, code string) error {
+	e.in.add(ctx, InboxMessage{Channel: "email", Template: core.MessageTemplateEmailVerificationCode, To: email, Username: username, Code: code,
+		Text: fmt.Sprintf("Your %s verification code is: %s", e.in.appName(), code)})
+	return nil
+}
+
+func (e inboxEmail) SendLoginCode(ctx context.Context, email, username, code string) error {
+	e.in.add(ctx, InboxMessage{Channel: "email", Template: core.MessageTemplateLoginCode, To: email, Username: username, Code: code,
+		Text: fmt.Sprintf("Your %s login code is: %s", e.in.appName(), code)})
+	return nil
+}
+
+func (e inboxEmail) SendLinkAccountCode(ctx context.Context, email, username, code string) error {
+	e.in.add(ctx, InboxMessage{Channel: "email", Template: core.MessageTemplateLinkAccountCode, To: email, Username: username, Code: code,
+		Text: fmt.Sprintf("Your %s account link code is: %s", e.in.appName(), code)})
+	return nil
+}
+
+func (e inboxEmail) SendWelcome(ctx context.Context, email, username string) error {
+	e.in.add(ctx, InboxMessage{Channel: "email", Template: core.MessageTemplateWelcome, To: email, Username: username,
+		Text: fmt.Sprintf("Welcome to %s!", e.in.appName())})
+	return nil
+}
+
+func (e inboxEmail) SendPasswordResetLink(ctx context.Context, email, username, token string) error {
+	e.in.add(ctx, InboxMessage{Channel: "email", Template: core.MessageTemplatePasswordResetLink, To: email, Username: username, Token: token,
+		Text: fmt.Sprintf("Reset your %s password with token: %s", e.in.appName(), token)})
+	return nil
+}
+
+func (e inboxEmail) SendDataExportLink(ctx context.Context, email, username, token string) error {
+	e.in.add(ctx, InboxMessage{Channel: "email", Template: core.MessageTemplateDataExportLink, To: email, Username: username, Token: token,
+		Text: fmt.Sprintf("Your %s data export is ready: %s", e.in.appName(), token)})
+	return nil
+}
+
+type inboxSMS struct{ in *Inbox }
+
+var _ core.SMSSenderWithPasswordResetLink = inboxSMS{}
+
+func (s inboxSMS) texts() smsgateway.Texts {
+	return smsgateway.Texts{AppName: s.in.appName(), PasswordResetURL: s.in.ResetURL}
+}
+
+func (s inboxSMS) SendVerificationCode(ctx context.Context, phone, code string) error {
+	s.in.add(ctx, InboxMessage{Channel: "sms", Template: core.MessageTemplateVerificationCode, To: phone, Code: code,
+		Text: s.texts().VerificationCodeText(code)})
+	return nil
+}
+
+func (s inboxSMS) SendLoginCode(ctx context.Context, phone, code string) error {
+	s.in.add(ctx, InboxMessage{Channel: "sms", Template: core.MessageTemplateLoginCode, To: phone, Code: code,
+		Text: s.texts().LoginCodeText(code)})
+	return nil
+}
+
+func (s inboxSMS) SendPasswordResetLink(ctx context.Context, phone, token string) error {
+	text, err := s.texts().PasswordResetLinkText(token)
+	if err != nil {
+		text = fmt.Sprintf("Reset your %s password with token: %s", s.in.appName(), token)
+	}
+	s.in.add(ctx, InboxMessage{Channel: "sms", Template: core.MessageTemplatePasswordResetLink, To: phone, Token: token, Text: text})
+	return nil
+}
+
+// Handler serves the inbox, relative to where it is mounted:
+//
+//	GET    /                  HTML inbox grouped by recipient
+//	GET    /messages          JSON {"messages": [...]}, newest first; ?to=&channel=&template=&limit=
+//	GET    /messages/latest   JSON message, newest match for the same filters; 404 when none
+//	DELETE /messages          clear all messages, or one recipient's with ?to=
+func (in *Inbox) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", in.handleHTML)
+	mux.HandleFunc("GET /messages", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		inboxJSON(w, http.StatusOK, map[string]any{"messages": in.Messages(inboxFilter(r), limit)})
+	})
+	mux.HandleFunc("GET /messages/latest", func(w http.ResponseWriter, r *http.Request) {
+		m, ok := in.Latest(inboxFilter(r))
+		if !ok {
+			inboxJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
+			return
+		}
+		inboxJSON(w, http.StatusOK, m)
+	})
+	mux.HandleFunc("DELETE /messages", func(w http.ResponseWriter, r *http.Request) {
+		in.Clear(r.URL.Query().Get("to"))
+		inboxJSON(w, http.StatusOK, map[string]any{"ok": true})
+	})
+	return mux
+}
+
+func inboxFilter(r *http.Request) InboxFilter {
+	q := r.URL.Query()
+	return InboxFilter{To: q.Get("to"), Channel: q.Get("channel"), Template: q.Get("template")}
+}
+
+func inboxJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+var inboxPage = template.Must(template.New("inbox").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>AuthKit dev inbox</title>
+<style>
+body { font-family: sans-serif; margin: 2rem; color: #222; }
+h2 { margin-top: 2rem; font-size: 1.1rem; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border-bottom: 1px solid #ddd; padding: .4rem .6rem; text-align: left; vertical-align: top; }
+code { font-size: 1.1rem; font-weight: bold; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>AuthKit dev inbox</h1>
+<p class="muted">{{len .Messages}} message(s). JSON: <a href="messages">messages</a></p>
+{{range .Recipients}}
+<h2>{{.To}}</h2>
+<table>
+<tr><th>Time</th><th>Channel</th><th>Template</th><th>Code / link</th><th>Text</th></tr>
+{{range .Messages}}
+<tr>
+<td class="muted">{{.CreatedAt.Format "15:04:05"}}</td>
+<td>{{.Channel}}</td>
+<td>{{.Template}}</td>
+<td>{{if .Code}}<code>{{.Code}}</code>{{end}}{{if .Link}}<a href="{{.Link}}">{{.Link}}</a>{{else if .Token}}<code>{{.Token}}</code>{{end}}</td>
+<td>{{.Text}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>No messages yet.</p>
+{{end}}
+</body>
+</html>
+`))
+
+func (in *Inbox) handleHTML(w http.ResponseWriter, r *http.Request) {
+	type recipient struct {
+		To       string
+		Messages []InboxMessage
+	}
+	msgs := in.Messages(InboxFilter{}, 0)
+	var recipients []*recipient
+	byTo := map[string]*recipient{}
+	for _, m := range msgs {
+		rc := byTo[m.To]
+		if rc == nil {
+			rc = &recipient{To: m.To}
+			byTo[m.To] = rc
+			recipients = append(recipients, rc)
+		}
+		rc.Messages = append(rc.Messages, m)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = inboxPage.Execute(w, map[string]any{"Messages": msgs, "Recipients": recipients})
+}
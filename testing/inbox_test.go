@@ -0,0 +1,67 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-rails/authkit/core"
+)
+
+func TestInbox_CapturesAndServes(t *testing.T) {
+	inbox := NewInbox()
+	inbox.ResetURL = "http://localhost:3000/reset?token={token}"
+	ctx := context.Background()
+
+	email := inbox.EmailSender()
+	_ = email.SendEmailVerificationCode(ctx, "Alice@Example.com", "alice", "ABC123")
+	_ = email.(core.EmailSenderWithPasswordResetLink).SendPasswordResetLink(ctx, "alice@example.com", "alice", "tok en")
+	_ = inbox.SMSSender().SendLoginCode(ctx, "+15551234567", "654321")
+
+	if code, ok := inbox.LatestCode("alice@example.com"); !ok || code != "ABC123" {
+		t.Fatalf("LatestCode: %q %v", code, ok)
+	}
+	if code, _ := inbox.LatestCode("+15551234567"); code != "654321" {
+		t.Fatalf("sms code: %q", code)
+	}
+
+	srv := httptest.NewServer(http.StripPrefix("/dev/inbox", inbox.Handler()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/dev/inbox/messages/latest?to=alice@example.com&template=password_reset_link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m InboxMessage
+	_ = json.NewDecoder(resp.Body).Decode(&m)
+	resp.Body.Close()
+	if m.Token != "tok en" || m.Link != "http://localhost:3000/reset?token=tok+en" {
+		t.Fatalf("unexpected reset message: %+v", m)
+	}
+
+	resp, err = http.Get(srv.URL + "/dev/inbox/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "alice@example.com") || !strings.Contains(string(page), "654321") {
+		t.Fatalf("html inbox missing messages:\n%s", page)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/dev/inbox/messages?to=alice@example.com", nil)
+	if _, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := inbox.Messages(InboxFilter{}, 0); len(got) != 1 || got[0].Channel != "sms" {
+		t.Fatalf("expected only the SMS to remain: %+v", got)
+	}
+	resp, _ = http.Get(srv.URL + "/dev/inbox/messages/latest?to=alice@example.com")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 after clear, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,125 @@
+// Package webhooks signs and verifies AuthKit outbound webhook requests.
+//
+// The scheme follows the Standard Webhooks convention: every request carries
+// webhook-id, webhook-timestamp and webhook-signature headers, and the signature is
+// "v1," + base64(HMAC-SHA256(secret, id + "." + timestamp + "." + body)). Receivers that
+// import this package can call Verify; others can use any Standard Webhooks library.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header names set on every delivery.
+const (
+	HeaderID        = "webhook-id"
+	HeaderTimestamp = "webhook-timestamp"
+	HeaderSignature = "webhook-signature"
+)
+
+// SecretPrefix marks endpoint secrets; the remainder is the base64-encoded HMAC key.
+const SecretPrefix = "whsec_"
+
+// DefaultTolerance is the maximum clock skew Verify accepts by default.
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	ErrInvalidSecret    = errors.New("webhook_invalid_secret")
+	ErrMissingHeaders   = errors.New("webhook_missing_headers")
+	ErrInvalidTimestamp = errors.New("webhook_invalid_timestamp")
+	ErrInvalidSignature = errors.New("webhook_invalid_signature")
+	ErrTimestampTooOld  = errors.New("webhook_timestamp_too_old")
+	ErrTimestampTooNew  = errors.New("webhook_timestamp_too_new")
+)
+
+// GenerateSecret returns a new random endpoint secret ("whsec_" + 32 random bytes).
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+func secretKey(secret string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, SecretPrefix))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
+
+// Sign returns the webhook-signature header value for body.
+func Sign(secret, id string, ts time.Time, body []byte) (string, error) {
+	key, err := secretKey(secret)
+	if err != nil {
+		return "", err
+	}
+	return "v1," + sign(key, id, ts.Unix(), body), nil
+}
+
+func sign(key []byte, id string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + strconv.FormatInt(ts, 10) + "."))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SetHeaders signs body and sets the three webhook headers on h.
+func SetHeaders(h http.Header, secret, id string, ts time.Time, body []byte) error {
+	sig, err := Sign(secret, id, ts, body)
+	if err != nil {
+		return err
+	}
+	h.Set(HeaderID, id)
+	h.Set(HeaderTimestamp, strconv.FormatInt(ts.Unix(), 10))
+	h.Set(HeaderSignature, sig)
+	return nil
+}
+
+// Verify checks the webhook headers in h against body. tolerance bounds the accepted
+// clock skew (DefaultTolerance when <= 0). The signature header may list several
+// space-separated signatures (e.g. during secret rotation); any valid v1 entry passes.
+func Verify(secret string, h http.Header, body []byte, tolerance time.Duration) error {
+	return verifyAt(secret, h, body, tolerance, time.Now())
+}
+
+func verifyAt(secret string, h http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	key, err := secretKey(secret)
+	if err != nil {
+		return err
+	}
+	id, tsRaw, sigs := h.Get(HeaderID), h.Get(HeaderTimestamp), h.Get(HeaderSignature)
+	if id == "" || tsRaw == "" || sigs == "" {
+		return ErrMissingHeaders
+	}
+	ts, err := strconv.ParseInt(tsRaw, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	switch sent := time.Unix(ts, 0); {
+	case now.Sub(sent) > tolerance:
+		return ErrTimestampTooOld
+	case sent.Sub(now) > tolerance:
+		return ErrTimestampTooNew
+	}
+	want := []byte(sign(key, id, ts, body))
+	for _, s := range strings.Fields(sigs) {
+		version, sig, ok := strings.Cut(s, ",")
+		if ok && version == "v1" && hmac.Equal([]byte(sig), want) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
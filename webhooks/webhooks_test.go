@@ -0,0 +1,48 @@
+package webhooks
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil || !strings.HasPrefix(secret, SecretPrefix) {
+		t.Fatalf("unexpected secret %q: %v", secret, err)
+	}
+	body := []byte(`{"type":"user.banned"}`)
+	now := time.Unix(1767225600, 0)
+	h := http.Header{}
+	if err := SetHeaders(h, secret, "evt_1", now, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyAt(secret, h, body, 0, now.Add(time.Minute)); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+
+	// Rotation: an unknown signature alongside a valid one still verifies.
+	rotated := h.Clone()
+	rotated.Set(HeaderSignature, "v1,bogus "+h.Get(HeaderSignature))
+	if err := verifyAt(secret, rotated, body, 0, now); err != nil {
+		t.Fatalf("multi-signature header rejected: %v", err)
+	}
+
+	if err := verifyAt(secret, h, []byte(`{"type":"user.deleted"}`), 0, now); err != ErrInvalidSignature {
+		t.Fatalf("tampered body: got %v", err)
+	}
+	other, _ := GenerateSecret()
+	if err := verifyAt(other, h, body, 0, now); err != ErrInvalidSignature {
+		t.Fatalf("wrong secret: got %v", err)
+	}
+	if err := verifyAt(secret, h, body, time.Minute, now.Add(2*time.Minute)); err != ErrTimestampTooOld {
+		t.Fatalf("stale timestamp: got %v", err)
+	}
+	if err := verifyAt(secret, h, body, time.Minute, now.Add(-2*time.Minute)); err != ErrTimestampTooNew {
+		t.Fatalf("future timestamp: got %v", err)
+	}
+	if err := verifyAt(secret, http.Header{}, body, 0, now); err != ErrMissingHeaders {
+		t.Fatalf("missing headers: got %v", err)
+	}
+}